@@ -0,0 +1,333 @@
+// Package catalog indexes the tables, columns and functions of every backup
+// in a backup directory or deduplicating repository, so incident reviews can
+// find which backups hold an object and when it first and last appeared.
+//
+// The index is kept in IndexFile next to the backups. Backups are only read
+// when they are not indexed yet or have changed since.
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/lockfile"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/repo"
+	"github.com/curtisbraxdale/go-pg-backup/internal/schemadiff"
+)
+
+// IndexFile is the name of the index in a backup directory or repository.
+const IndexFile = "catalog.json"
+
+// indexVersion changes when the objects recorded per backup do, so older
+// indexes are rebuilt.
+const indexVersion = 1
+
+// indexedKinds are the kinds of schema objects recorded per backup.
+var indexedKinds = []schemadiff.Kind{schemadiff.KindTable, schemadiff.KindColumn, schemadiff.KindFunction}
+
+// Object is a schema object of a backup. Columns are named after their
+// table, functions carry their argument list.
+type Object struct {
+	Kind schemadiff.Kind `json:"kind"`
+	Name string          `json:"name"`
+}
+
+// Entry is one indexed backup.
+type Entry struct {
+	Location  string    `json:"location"` // File name in the directory, or snapshot ID in the repository
+	Host      string    `json:"host"`
+	Database  string    `json:"database"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum,omitempty"`
+	Objects   []Object  `json:"objects"`
+	Error     string    `json:"error,omitempty"` // Why the backup could not be read, it is retried on the next Update
+}
+
+// Index is the catalog of one directory or repository.
+type Index struct {
+	Version int     `json:"version"`
+	Backups []Entry `json:"backups"` // Oldest first
+}
+
+// Source is where the backups are: a directory of backup files with their
+// manifests, or a repository.
+type Source struct {
+	Dir           string
+	Repo          string
+	Password      string   // Repository password, if it is encrypted
+	ClientBinDirs []string // Where to look for pg_restore, for custom-format backups
+}
+
+// String names the source for messages.
+func (s Source) String() string {
+	if s.Repo != "" {
+		return "repository " + s.Repo
+	}
+	return s.Dir
+}
+
+// Update brings the index of src up to date, reading the backups not
+// indexed yet, and returns it. A backup that cannot be read is recorded with
+// its error, see Failed, and the others are still indexed. The index of an
+// encrypted repository is not written to disk, as it would reveal the names
+// of its objects.
+func Update(src Source) (*Index, error) {
+	switch {
+	case src.Repo != "":
+		r, err := repo.Open(src.Repo, src.Password)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		snaps, err := r.Snapshots()
+		if err != nil {
+			return nil, err
+		}
+		var backups []Entry
+		for _, s := range snaps {
+			e := Entry{Location: s.ID, Database: s.Database, CreatedAt: s.CreatedAt, Size: s.Size}
+			if s.Manifest != nil {
+				e.Host = s.Manifest.Host
+				e.Checksum = s.Manifest.Checksum
+			}
+			backups = append(backups, e)
+		}
+		path := filepath.Join(src.Repo, IndexFile)
+		if r.Encrypted() {
+			path = ""
+		}
+		return update(path, backups, func(e Entry) ([]Object, error) {
+			return readSnapshot(r, e.Location)
+		})
+	case src.Dir != "":
+		backups, err := listDir(src.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return update(filepath.Join(src.Dir, IndexFile), backups, func(e Entry) ([]Object, error) {
+			return readFile(filepath.Join(src.Dir, e.Location), src.ClientBinDirs)
+		})
+	default:
+		return nil, fmt.Errorf("a backup directory or repository is required")
+	}
+}
+
+// Add indexes the backup file at path, which has just been written, in the
+// index of its directory. Other backups in the directory are left for the
+// next Update.
+func Add(path string, clientBinDirs []string) error {
+	m, err := pgbackup.ReadManifest(path)
+	if err != nil {
+		return err
+	}
+	objects, err := readFile(path, clientBinDirs)
+	if err != nil {
+		return err
+	}
+	e := manifestEntry(filepath.Base(path), m)
+	e.Objects = objects
+	indexPath := filepath.Join(filepath.Dir(path), IndexFile)
+	return withLock(indexPath, func() error {
+		idx := load(indexPath)
+		idx.Backups = append(removeEntry(idx.Backups, e.Location), e)
+		idx.sort()
+		return save(indexPath, idx)
+	})
+}
+
+// Failed returns the backups that could not be read, oldest first.
+func (idx *Index) Failed() []Entry {
+	var failed []Entry
+	for _, e := range idx.Backups {
+		if e.Error != "" {
+			failed = append(failed, e)
+		}
+	}
+	return failed
+}
+
+// update reuses the entries of the index at path for the backups that have
+// not changed, reads the others with read and writes the index back if it
+// changed. An empty path keeps the index in memory only.
+func update(path string, backups []Entry, read func(Entry) ([]Object, error)) (*Index, error) {
+	old := &Index{Version: indexVersion}
+	if path != "" {
+		old = load(path)
+	}
+	known := map[string]Entry{}
+	for _, e := range old.Backups {
+		known[e.Location] = e
+	}
+
+	idx := &Index{Version: indexVersion}
+	listed := map[string]bool{}
+	changed := len(old.Backups) != len(backups)
+	for _, b := range backups {
+		listed[b.Location] = true
+		if e, ok := known[b.Location]; ok && e.Error == "" && e.Size == b.Size && e.Checksum == b.Checksum {
+			idx.Backups = append(idx.Backups, e)
+			continue
+		}
+		objects, err := read(b)
+		if err != nil {
+			b.Error = err.Error()
+		}
+		b.Objects = objects
+		idx.Backups = append(idx.Backups, b)
+		changed = true
+	}
+	idx.sort()
+	if path == "" || !changed {
+		return idx, nil
+	}
+	err := withLock(path, func() error {
+		// Keep the backups Add indexed since the index was loaded.
+		for _, e := range load(path).Backups {
+			if _, ok := known[e.Location]; !ok && !listed[e.Location] {
+				idx.Backups = append(idx.Backups, e)
+			}
+		}
+		idx.sort()
+		return save(path, idx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// withLock runs fn holding the lock of the index at path, so concurrent
+// updates do not lose each other's entries.
+func withLock(path string, fn func() error) error {
+	unlock, err := lockfile.Lock(path)
+	if err != nil {
+		return fmt.Errorf("failed to lock catalog index: %w", err)
+	}
+	defer unlock()
+	return fn()
+}
+
+// listDir lists the backups in dir that have a manifest.
+func listDir(dir string) ([]Entry, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	manifests, err := filepath.Glob(filepath.Join(dir, "*"+pgbackup.ManifestSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var backups []Entry
+	for _, path := range manifests {
+		file := strings.TrimSuffix(path, pgbackup.ManifestSuffix)
+		if _, err := os.Stat(file); err != nil {
+			continue // A manifest left behind by a removed backup
+		}
+		m, err := pgbackup.ReadManifest(file)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, manifestEntry(filepath.Base(file), m))
+	}
+	return backups, nil
+}
+
+func manifestEntry(location string, m *pgbackup.Manifest) Entry {
+	return Entry{Location: location, Host: m.Host, Database: m.Database, CreatedAt: m.CreatedAt, Size: m.Size, Checksum: m.Checksum}
+}
+
+// readFile reads the objects of a backup file, plain SQL or custom format.
+func readFile(path string, clientBinDirs []string) ([]Object, error) {
+	schema, err := schemadiff.ReadFile(path, clientBinDirs)
+	if err != nil {
+		return nil, err
+	}
+	return objectsOf(schema), nil
+}
+
+// readSnapshot reads the objects of a repository snapshot as it is
+// reassembled, without writing it to disk.
+func readSnapshot(r *repo.Repo, id string) ([]Object, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(r.WriteSnapshot(id, pw))
+	}()
+	schema, err := schemadiff.Parse(pr)
+	pr.CloseWithError(io.ErrClosedPipe) // Stop the writer if parsing failed
+	if err != nil {
+		return nil, err
+	}
+	return objectsOf(schema), nil
+}
+
+func objectsOf(schema *schemadiff.Schema) []Object {
+	var objects []Object
+	for _, o := range schema.Objects {
+		for _, k := range indexedKinds {
+			if o.Kind == k {
+				objects = append(objects, Object{Kind: o.Kind, Name: o.Name})
+			}
+		}
+	}
+	return objects
+}
+
+func removeEntry(entries []Entry, location string) []Entry {
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.Location != location {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+func (idx *Index) sort() {
+	sort.SliceStable(idx.Backups, func(i, j int) bool { return idx.Backups[i].CreatedAt.Before(idx.Backups[j].CreatedAt) })
+}
+
+// load reads the index at path. A missing, unreadable or outdated index is
+// returned empty, so every backup is read again.
+func load(path string) *Index {
+	idx := &Index{}
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, idx) != nil || idx.Version != indexVersion {
+		return &Index{Version: indexVersion}
+	}
+	return idx
+}
+
+// save writes the index through a temporary file, so a concurrent search
+// never reads it partially written.
+func save(path string, idx *Index) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog index: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".catalog-*")
+	if err != nil {
+		return fmt.Errorf("failed to write catalog index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(data, '\n'))
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write catalog index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/schemadiff"
+)
+
+// writeBackup writes a plain backup holding ddl and its manifest into dir.
+func writeBackup(t *testing.T, dir, file, database string, createdAt time.Time, ddl string) string {
+	t.Helper()
+	path := filepath.Join(dir, file)
+	if err := os.WriteFile(path, []byte(ddl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := pgbackup.WriteManifest(path, &pgbackup.Manifest{Database: database, Host: "db1", CreatedAt: createdAt}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUpdateAndSearch(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	writeBackup(t, dir, "shop-1.sql", "shop", day, `
+CREATE TABLE public.orders (
+    id integer NOT NULL
+);
+COPY public.orders (id) FROM stdin;
+1
+\.
+`)
+	writeBackup(t, dir, "shop-2.sql", "shop", day.Add(24*time.Hour), `
+CREATE TABLE public.orders (
+    id integer NOT NULL,
+    discount numeric
+);
+CREATE FUNCTION public.order_total(o public.orders) RETURNS numeric
+    LANGUAGE sql
+    AS $$ SELECT 0 $$;
+`)
+	writeBackup(t, dir, "shop-3.sql", "shop", day.Add(48*time.Hour), `
+CREATE TABLE public."Orders" (
+    id integer NOT NULL
+);
+`)
+	writeBackup(t, dir, "crm-1.sql", "crm", day, `
+CREATE TABLE sales.orders (
+    id integer NOT NULL
+);
+`)
+
+	idx, err := Update(Source{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Backups) != 4 {
+		t.Fatalf("%d backups indexed, want 4", len(idx.Backups))
+	}
+	if _, err := os.Stat(filepath.Join(dir, IndexFile)); err != nil {
+		t.Fatalf("index not written: %v", err)
+	}
+
+	discount := idx.Search(Query{Name: "orders.discount"})
+	if len(discount) != 1 || discount[0].Kind != schemadiff.KindColumn || len(discount[0].Backups) != 1 || discount[0].Total != 3 {
+		t.Fatalf("orders.discount matches %+v", discount)
+	}
+	if d := discount[0]; d.First().Location != "shop-2.sql" || d.Last().Location != "shop-2.sql" || d.InLatest(idx) {
+		t.Errorf("orders.discount appeared in %s to %s, in the latest: %v", d.First().Location, d.Last().Location, d.InLatest(idx))
+	}
+
+	tables := idx.Search(Query{Name: "orders", Kind: schemadiff.KindTable})
+	var names []string
+	for _, m := range tables {
+		names = append(names, m.Database+":"+m.Name+":"+m.First().Location+"-"+m.Last().Location)
+	}
+	want := []string{"crm:sales.orders:crm-1.sql-crm-1.sql", `shop:public."Orders":shop-3.sql-shop-3.sql`, "shop:public.orders:shop-1.sql-shop-2.sql"}
+	if len(names) != len(want) {
+		t.Fatalf("tables %q, want %q", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("table %d is %s, want %s", i, names[i], want[i])
+		}
+	}
+
+	if f := idx.Search(Query{Name: "order_total"}); len(f) != 1 || f[0].Kind != schemadiff.KindFunction {
+		t.Errorf("order_total matches %+v", f)
+	}
+	if got := idx.Search(Query{Name: "*.orders", Database: "crm"}); len(got) != 1 || got[0].Name != "sales.orders" {
+		t.Errorf("*.orders in crm matches %+v", got)
+	}
+
+	// A removed backup leaves the index, the others are not read again.
+	os.Remove(filepath.Join(dir, "crm-1.sql"))
+	os.WriteFile(filepath.Join(dir, "shop-1.sql"), []byte("not read again"), 0644)
+	idx, err = Update(Source{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Backups) != 3 {
+		t.Errorf("index after removing a backup: %+v", idx.Backups)
+	}
+	// Case and quotes are ignored, so both spellings are found.
+	ids := idx.Search(Query{Name: "public.orders.id"})
+	if len(ids) != 2 || ids[1].Name != "public.orders.id" || len(ids[1].Backups) != 2 {
+		t.Errorf("public.orders.id matches %+v", ids)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	dir := t.TempDir()
+	path := writeBackup(t, dir, "shop-1.sql", "shop", time.Now(), "CREATE TABLE public.orders (id integer);\n")
+	if err := Add(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	idx := load(filepath.Join(dir, IndexFile))
+	if len(idx.Backups) != 1 || len(idx.Backups[0].Objects) != 2 {
+		t.Errorf("index after Add: %+v", idx.Backups)
+	}
+}
+
+func TestUpdateSkipsUnreadableBackup(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	writeBackup(t, dir, "shop-1.sql", "shop", day, "CREATE TABLE public.orders (id integer);\n")
+	writeBackup(t, dir, "shop-2.dump", "shop", day.Add(24*time.Hour), "PGDMP not a custom-format archive")
+
+	idx, err := Update(Source{Dir: dir, ClientBinDirs: []string{t.TempDir()}})
+	if err != nil {
+		t.Fatalf("one unreadable backup failed the update: %v", err)
+	}
+	failed := idx.Failed()
+	if len(failed) != 1 || failed[0].Location != "shop-2.dump" || failed[0].Error == "" {
+		t.Fatalf("failed backups %+v", failed)
+	}
+	orders := idx.Search(Query{Name: "orders", Kind: schemadiff.KindTable})
+	if len(orders) != 1 || orders[0].Total != 1 || !orders[0].InLatest(idx) {
+		t.Errorf("orders matches %+v", orders)
+	}
+
+	// The failure is recorded, and the backup is read again once fixed.
+	if failed := load(filepath.Join(dir, IndexFile)).Failed(); len(failed) != 1 {
+		t.Errorf("saved failures %+v", failed)
+	}
+	os.WriteFile(filepath.Join(dir, "shop-2.dump"), []byte("CREATE TABLE public.customers (id integer);\n"), 0644)
+	idx, err = Update(Source{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Failed()) != 0 || len(idx.Search(Query{Name: "customers"})) != 1 {
+		t.Errorf("index after fixing the backup: %+v", idx.Backups)
+	}
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	dir := t.TempDir()
+	const backups = 8
+	var paths []string
+	for i := 0; i < backups; i++ {
+		file := "shop-" + string(rune('a'+i)) + ".sql"
+		paths = append(paths, writeBackup(t, dir, file, "shop", time.Now(), "CREATE TABLE public.orders (id integer);\n"))
+	}
+	errs := make(chan error, backups)
+	for _, path := range paths {
+		go func(path string) { errs <- Add(path, nil) }(path)
+	}
+	for range paths {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if idx := load(filepath.Join(dir, IndexFile)); len(idx.Backups) != backups {
+		t.Errorf("%d backups indexed by concurrent Adds, want %d", len(idx.Backups), backups)
+	}
+	if _, err := os.Stat(filepath.Join(dir, IndexFile+".lock")); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
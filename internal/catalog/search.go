@@ -0,0 +1,159 @@
+package catalog
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/dbpattern"
+	"github.com/curtisbraxdale/go-pg-backup/internal/schemadiff"
+)
+
+// Query selects the objects to search for.
+type Query struct {
+	// Name is matched, ignoring case and quotes, against the object's
+	// qualified name and every shorter suffix of it, so "orders",
+	// "public.orders" and "orders.total" all find what they name. It may
+	// hold glob wildcards. Functions also match without their arguments.
+	Name     string
+	Kind     schemadiff.Kind // Empty for any kind
+	Database string          // "host/database" glob pattern, empty for any
+}
+
+// Match is an object found in the backups of one database.
+type Match struct {
+	Host     string
+	Database string
+	Kind     schemadiff.Kind
+	Name     string
+	Backups  []Entry // Backups holding the object, oldest first, without their objects
+	Total    int     // Readable backups of the database in the catalog
+}
+
+// First is the oldest backup holding the object.
+func (m Match) First() Entry {
+	return m.Backups[0]
+}
+
+// Last is the newest backup holding the object.
+func (m Match) Last() Entry {
+	return m.Backups[len(m.Backups)-1]
+}
+
+// InLatest reports whether the newest readable backup of the database
+// still holds the object.
+func (m Match) InLatest(idx *Index) bool {
+	for i := len(idx.Backups) - 1; i >= 0; i-- {
+		if b := idx.Backups[i]; b.Error == "" && b.Host == m.Host && b.Database == m.Database {
+			return b.Location == m.Last().Location
+		}
+	}
+	return false
+}
+
+// Search returns the objects matching q, sorted by database, kind and name.
+// Backups that could not be read are left out.
+func (idx *Index) Search(q Query) []Match {
+	pattern := foldName(q.Name)
+	type key struct{ host, database string }
+	type objectKey struct {
+		key
+		object Object
+	}
+	totals := map[key]int{}
+	found := map[objectKey]*Match{}
+	for _, b := range idx.Backups {
+		if b.Error != "" {
+			continue
+		}
+		if ok, _ := dbpattern.Match(q.Database, b.Host, b.Database); q.Database != "" && !ok {
+			continue
+		}
+		db := key{b.Host, b.Database}
+		totals[db]++
+		entry := b
+		entry.Objects = nil
+		for _, o := range b.Objects {
+			if (q.Kind != "" && o.Kind != q.Kind) || !matchesName(pattern, o) {
+				continue
+			}
+			k := objectKey{db, o}
+			if found[k] == nil {
+				found[k] = &Match{Host: b.Host, Database: b.Database, Kind: o.Kind, Name: o.Name}
+			}
+			found[k].Backups = append(found[k].Backups, entry)
+		}
+	}
+
+	matches := make([]Match, 0, len(found))
+	for k, m := range found {
+		m.Total = totals[k.key]
+		matches = append(matches, *m)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Host+"/"+a.Database != b.Host+"/"+b.Database {
+			return a.Host+"/"+a.Database < b.Host+"/"+b.Database
+		}
+		if a.Kind != b.Kind {
+			return kindRank(a.Kind) < kindRank(b.Kind)
+		}
+		return a.Name < b.Name
+	})
+	return matches
+}
+
+// ParseKind parses the kind of object to search for: table, column or
+// function. An empty string means any.
+func ParseKind(s string) (schemadiff.Kind, bool) {
+	if s == "" {
+		return "", true
+	}
+	for _, k := range indexedKinds {
+		if strings.EqualFold(s, string(k)) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+func kindRank(k schemadiff.Kind) int {
+	for i, o := range indexedKinds {
+		if o == k {
+			return i
+		}
+	}
+	return len(indexedKinds)
+}
+
+// foldName lower-cases a name and drops its identifier quotes.
+func foldName(s string) string {
+	return strings.ToLower(strings.ReplaceAll(s, `"`, ""))
+}
+
+// matchesName reports whether the folded pattern matches the object's name
+// or one of its suffixes.
+func matchesName(pattern string, o Object) bool {
+	name := foldName(o.Name)
+	var names []string
+	if o.Kind == schemadiff.KindFunction {
+		if open := strings.IndexByte(name, '('); open >= 0 {
+			names = append(names, name)
+			name = name[:open]
+		}
+	}
+	for {
+		names = append(names, name)
+		dot := strings.IndexByte(name, '.')
+		if dot < 0 {
+			break
+		}
+		name = name[dot+1:]
+	}
+	for _, n := range names {
+		if ok, _ := path.Match(pattern, n); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/catalog"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/masking"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+)
+
+func runBackup(args []string, stdout, stderr io.Writer, j *job) (code int) {
+	fs := newFlagSet("backup", stderr)
+	var conn connFlags
+	conn.register(fs)
+	dir := fs.String("dir", "", "directory to write the backup into")
+	output := fs.String("output", "", "full path of the backup file (overrides -dir)")
+	repoDir := fs.String("repo", "", "store the backup as a snapshot in this deduplicating repository instead of a file")
+	engineName := fs.String("engine", "auto", "dump engine: auto (pg_dump, or the Go engine if pg_dump is missing), pg_dump or go")
+	dumpBinary := fs.String("pg-dump", "", "pg_dump binary to use (default: newest installed one supporting the server)")
+	mask := fs.String("mask", "", "masking ruleset to apply: a name from the masking directory or a path to a rules file")
+	checksums := fs.Bool("checksums", false, "record each table's row count and checksum in the manifest (default: compare.record from the config file)")
+	var subset stringList
+	fs.Var(&subset, "subset", `dump only the rows reachable from a root table, as "table [N%] [WHERE condition]" (repeatable)`)
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if conn.dbname == "" || (*dir == "" && *output == "" && *repoDir == "") {
+		fmt.Fprintln(stderr, "backup: -dbname and one of -dir, -output or -repo are required")
+		fs.Usage()
+		return 2
+	}
+
+	engine, err := pgbackup.ParseEngine(*engineName)
+	if err != nil {
+		fmt.Fprintf(stderr, "backup: %v\n", err)
+		return 2
+	}
+
+	var roots []pgbackup.SubsetRoot
+	for _, s := range subset {
+		root, err := pgbackup.ParseSubsetRoot(s)
+		if err != nil {
+			fmt.Fprintf(stderr, "backup: %v\n", err)
+			return 2
+		}
+		roots = append(roots, root)
+	}
+	if len(roots) > 0 {
+		if engine == pgbackup.EnginePgDump {
+			fmt.Fprintln(stderr, "backup: -subset requires the go engine")
+			return 2
+		}
+		engine = pgbackup.EngineGo
+	}
+
+	outputPath := *output
+	if *repoDir != "" {
+		// Only used to check the free space where the chunks will go.
+		outputPath = filepath.Join(*repoDir, "chunks", conn.dbname)
+	} else if outputPath == "" {
+		outputPath = pgbackup.OutputPath(*dir, conn.dbname)
+	}
+
+	j.start(conn)
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "Backup failed: %v\n", err)
+		return 1
+	}
+
+	var rules *masking.Ruleset
+	if *mask != "" {
+		dir, err := cfg.MaskingRulesDir()
+		if err == nil {
+			rules, err = masking.Find(dir, *mask)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Backup failed: %v\n", err)
+			return 1
+		}
+	}
+
+	var signingKey ed25519.PrivateKey
+	if cfg.SigningKey != "" {
+		if signingKey, err = pgbackup.LoadSigningKey(cfg.SigningKey); err != nil {
+			fmt.Fprintf(stderr, "Backup failed: %v\n", err)
+			return 1
+		}
+	}
+
+	report := preflight.Backup(preflight.BackupOptions{
+		Host:          conn.host,
+		Port:          conn.port,
+		User:          conn.user,
+		Password:      conn.password(),
+		DBName:        conn.dbname,
+		OutputPath:    outputPath,
+		DumpBinary:    *dumpBinary,
+		ClientBinDirs: cfg.ClientBinDirs,
+		Engine:        engine,
+		Masking:       rules,
+	})
+	j.Warnings = reportWarnings(report)
+	if !printPreflight(stdout, stderr, report) {
+		return 1
+	}
+
+	j.File = outputPath
+	if *repoDir != "" {
+		j.File = *repoDir
+	}
+	if !j.beforeHooks(stdout, stderr) {
+		return 1
+	}
+	defer func() { code = j.afterHooks(code, stdout, stderr) }()
+
+	opts := pgbackup.Options{
+		Host:          conn.host,
+		Port:          conn.port,
+		User:          conn.user,
+		Password:      conn.password(),
+		DBName:        conn.dbname,
+		OutputPath:    outputPath,
+		DumpBinary:    report.Binary.Path,
+		ClientBinDirs: cfg.ClientBinDirs,
+		Engine:        engine,
+		Masking:       rules,
+		Subset:        roots,
+		SigningKey:    signingKey,
+	}
+	if *checksums || cfg.Compare.Record {
+		sums := cfg.Compare.Checksums()
+		opts.Checksums = &sums
+	}
+	var manifest *pgbackup.Manifest
+	if *repoDir != "" {
+		r, code := openRepo(*repoDir, "backup", stderr)
+		if r == nil {
+			return code
+		}
+		defer r.Close()
+		snap, err := r.Backup(opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "Backup failed: %v\n", err)
+			return 1
+		}
+		manifest = snap.Manifest
+		j.File, j.Size = *repoDir+":"+snap.ID, snap.Size
+		fmt.Fprintf(stdout, "Backup completed successfully!\nSnapshot: %s in %s\n", snap.ID, *repoDir)
+		fmt.Fprintf(stdout, "Stored %s of new data for a %s dump (%d of %d chunks new)\n",
+			preflight.FormatBytes(snap.NewBytes), preflight.FormatBytes(snap.Size), snap.NewChunks, len(snap.Chunks))
+	} else {
+		manifest, err = pgbackup.Run(opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "Backup failed: %v\n", err)
+			return 1
+		}
+		j.File, j.Size = outputPath, manifest.Size
+		fmt.Fprintf(stdout, "Backup completed successfully!\nBackup file: %s\n", outputPath)
+		// The backup is sound either way, a search indexes it later.
+		if err := catalog.Add(outputPath, cfg.ClientBinDirs); err != nil {
+			fmt.Fprintf(stderr, "Warning: failed to index the backup in the catalog: %v\n", err)
+		}
+		if signingKey != nil {
+			fmt.Fprintf(stdout, "Manifest signed with key %s\n", pgbackup.KeyFingerprint(signingKey.Public().(ed25519.PublicKey)))
+		}
+	}
+	if manifest.Engine == pgbackup.EngineGo {
+		fmt.Fprintln(stdout, "Engine: built-in Go engine")
+	} else {
+		fmt.Fprintf(stdout, "pg_dump: %s (%s)\n", manifest.DumpBinary, manifest.DumpVersion)
+	}
+	if manifest.Masked {
+		fmt.Fprintf(stdout, "Masked %d columns with ruleset %s\n", len(manifest.MaskedColumns), manifest.MaskingRuleset)
+	}
+	if len(manifest.SubsetRoots) > 0 {
+		fmt.Fprintln(stdout, "Subset rows:")
+		for _, t := range manifest.Subset {
+			fmt.Fprintf(stdout, "  %-40s %d\n", t.Table, t.Rows)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/notify"
+	"github.com/curtisbraxdale/go-pg-backup/internal/repo"
+	"github.com/curtisbraxdale/go-pg-backup/internal/rpo"
+)
+
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("check", stderr)
+	notifyViolations := fs.Bool("notify", false, "send the configured notifications about every violation")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stdout, "RPO UNKNOWN - %v\n", err)
+		return int(rpo.Unknown)
+	}
+	results := rpo.Check(cfg.RPO, os.Getenv(repo.PasswordEnv), time.Now())
+	fmt.Fprint(stdout, rpo.Nagios(results))
+	if len(results) == 0 {
+		return int(rpo.Unknown)
+	}
+
+	if *notifyViolations {
+		for _, r := range results {
+			if r.Status == rpo.OK {
+				continue
+			}
+			if err := notify.Send(cfg.Notifications, rpoEvent(r)); err != nil {
+				fmt.Fprintf(stderr, "Notification failed: %v\n", err)
+			}
+		}
+	}
+	return int(rpo.Worst(results))
+}
+
+// rpoEvent describes a check result as a notification: a warning stays a
+// warning, anything worse is a failure and OK is a success.
+func rpoEvent(r rpo.Result) notify.Event {
+	ev := notify.Event{
+		Operation: "check",
+		Status:    notify.Success,
+		Database:  r.Database,
+		Host:      r.Host,
+		StartedAt: time.Now(),
+		Error:     strings.Join(r.Problems, "; "),
+	}
+	switch r.Status {
+	case rpo.OK:
+	case rpo.Warning:
+		ev.Status = notify.Warning
+		ev.Warnings, ev.Error = r.Problems, ""
+	default:
+		ev.Status = notify.Failure
+	}
+	if r.Latest != nil {
+		ev.File, ev.Size = r.Latest.Location, r.Latest.Size
+	}
+	return ev
+}
+
+// rpoMonitor runs the RPO check periodically in the background of a long
+// running command, keeping the latest results for the metrics endpoint and
+// notifying when a database's status changes.
+type rpoMonitor struct {
+	mu      sync.Mutex
+	results []rpo.Result
+	last    map[string]rpo.Status
+	stderr  io.Writer
+}
+
+func (m *rpoMonitor) run(interval time.Duration) {
+	for {
+		m.check()
+		time.Sleep(interval)
+	}
+}
+
+func (m *rpoMonitor) check() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(m.stderr, "RPO check: %v\n", err)
+		return
+	}
+	results := rpo.Check(cfg.RPO, os.Getenv(repo.PasswordEnv), time.Now())
+
+	m.mu.Lock()
+	m.results = results
+	if m.last == nil {
+		m.last = map[string]rpo.Status{}
+	}
+	var changed []rpo.Result
+	for _, r := range results {
+		previous, seen := m.last[r.Name()]
+		if previous != r.Status && (seen || r.Status != rpo.OK) {
+			changed = append(changed, r)
+		}
+		m.last[r.Name()] = r.Status
+	}
+	m.mu.Unlock()
+
+	for _, r := range changed {
+		fmt.Fprintf(m.stderr, "RPO %s: %s %s\n", r.Status, r.Name(), strings.Join(r.Problems, "; "))
+		if err := notify.Send(cfg.Notifications, rpoEvent(r)); err != nil {
+			fmt.Fprintf(m.stderr, "Notification failed: %v\n", err)
+		}
+	}
+}
+
+// writeMetrics publishes the latest results.
+func (m *rpoMonitor) writeMetrics(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return rpo.WriteMetrics(w, m.results)
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+)
+
+// command is a subcommand of the command-line interface.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+func commands() []command {
+	return []command{
+		{"backup", "Back up a database to a plain SQL file", reported("backup", runBackup)},
+		{"restore", "Restore a database from a plain SQL file", reported("restore", runRestore)},
+		{"extract", "Extract chosen tables from a plain SQL backup into a smaller one", runExtract},
+		{"basebackup", "Take a physical base backup for point-in-time recovery", runBaseBackup},
+		{"archive-wal", "Archive a WAL segment, for use as archive_command", runArchiveWAL},
+		{"repo", "Create, list and prune a deduplicating backup repository", runRepo},
+		{"pitr-restore", "Lay out a data directory recovering to a point in time", runPITRRestore},
+		{"keygen", "Create an Ed25519 key for signing backup manifests", runKeygen},
+		{"verify", "Check backup signatures, checksums and manifest chains", runVerify},
+		{"compare", "Compare row counts and checksums of two databases or a backup and a database", runCompare},
+		{"export", "Export tables or a query to CSV, TSV or JSON Lines files", reported("export", runExport)},
+		{"schema-export", "Write the schema as one file per object, for version control", runSchemaExport},
+		{"search", "Find the backups holding a table, column or function", runSearch},
+		{"schema-diff", "Show how a backup's schema differs from a database's, as a unified diff", runSchemaDiff},
+		{"notify", "Send a test notification to the configured targets", runNotify},
+		{"metrics", "Serve or write the recorded metrics for Prometheus", runMetrics},
+		{"check", "Check every database's newest backup against its RPO (Nagios format)", runCheck},
+	}
+}
+
+// Run executes the subcommand named by args[0] and returns the process exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stdout)
+		return 0
+	}
+	for _, c := range commands() {
+		if c.name == args[0] {
+			return c.run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: go-pg-backup [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Without a command, the interactive wizard is started.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %-14s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'go-pg-backup <command> -h' for the flags of a command.")
+	fmt.Fprintln(w, "The database password is read from the PGPASSWORD environment variable.")
+}
+
+// connFlags holds the connection flags shared by all commands.
+type connFlags struct {
+	host   string
+	port   int
+	user   string
+	dbname string
+}
+
+func (c *connFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.host, "host", "localhost", "database host")
+	fs.IntVar(&c.port, "port", 5432, "database port")
+	fs.StringVar(&c.user, "user", "postgres", "database user")
+	fs.StringVar(&c.dbname, "dbname", "", "database name (required)")
+}
+
+func (c *connFlags) password() string {
+	return os.Getenv("PGPASSWORD")
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// newFlagSet creates a flag set for the named command that reports errors
+// instead of exiting.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// flagExitCode returns the exit code for a flag parsing error: asking for
+// help succeeds, anything else is a usage error.
+func flagExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+// printPreflight prints the pre-flight checklist and reports whether the
+// operation may start.
+func printPreflight(stdout, stderr io.Writer, report preflight.Report) bool {
+	fmt.Fprintln(stdout, "Pre-flight checks:")
+	fmt.Fprint(stdout, report.String())
+	if report.Blocking() {
+		fmt.Fprintln(stderr, "Pre-flight checks failed, nothing was changed.")
+		return false
+	}
+	return true
+}
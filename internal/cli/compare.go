@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/compare"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+func runCompare(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("compare", stderr)
+	var conn connFlags
+	conn.register(fs)
+	sourceHost := fs.String("source-host", "localhost", "source database host")
+	sourcePort := fs.Int("source-port", 5432, "source database port")
+	sourceUser := fs.String("source-user", "postgres", "source database user")
+	sourceDB := fs.String("source-dbname", "", "source database name")
+	backup := fs.String("backup", "", "compare with the table checksums recorded in this backup's manifest instead of a source database")
+	sample := fs.Float64("sample", 0, "hash only this percentage of the rows of big tables with a primary key (default: the config file's)")
+	sampleMinRows := fs.Int64("sample-min-rows", 0, "tables with more estimated rows than this are sampled (default: the config file's)")
+	jsonOut := fs.String("json", "", `write the report as JSON to this file ("-" for stdout)`)
+	all := fs.Bool("all", false, "list matching tables too")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if conn.dbname == "" || (*sourceDB == "") == (*backup == "") {
+		fmt.Fprintln(stderr, "compare: -dbname and exactly one of -source-dbname or -backup are required")
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "compare: %v\n", err)
+		return 1
+	}
+	opts := cfg.Compare.Checksums()
+	if *sample > 0 {
+		opts.SamplePercent = *sample
+	}
+	if *sampleMinRows > 0 {
+		opts.SampleMinRows = *sampleMinRows
+	}
+
+	target := targetDatabase(conn)
+	var report *compare.Report
+	if *backup != "" {
+		m, err := pgbackup.ReadManifest(*backup)
+		if err == nil {
+			report, err = compare.Manifest(m, target)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "compare: %v\n", err)
+			return 1
+		}
+	} else {
+		source := compare.Database{Host: *sourceHost, Port: *sourcePort, User: *sourceUser, Password: sourcePassword(), DBName: *sourceDB}
+		if report, err = compare.Databases(source, target, opts); err != nil {
+			fmt.Fprintf(stderr, "compare: %v\n", err)
+			return 1
+		}
+	}
+
+	if *jsonOut == "-" {
+		if err := report.WriteJSON(stdout); err != nil {
+			fmt.Fprintf(stderr, "compare: %v\n", err)
+			return 1
+		}
+	} else {
+		report.WriteTable(stdout, *all)
+		if *jsonOut != "" {
+			if err := writeReport(report, *jsonOut); err != nil {
+				fmt.Fprintf(stderr, "compare: %v\n", err)
+				return 1
+			}
+		}
+	}
+	if len(report.Mismatches()) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// sourcePassword reads the source database's password from
+// SOURCE_PGPASSWORD, falling back to PGPASSWORD.
+func sourcePassword() string {
+	if p, ok := os.LookupEnv("SOURCE_PGPASSWORD"); ok {
+		return p
+	}
+	return os.Getenv("PGPASSWORD")
+}
+
+func targetDatabase(c connFlags) compare.Database {
+	return compare.Database{Host: c.host, Port: c.port, User: c.user, Password: c.password(), DBName: c.dbname}
+}
+
+func writeReport(report *compare.Report, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compareWithBackup compares the database with the table checksums in the
+// backup's manifest after a restore or verification, prints the differences
+// and saves the report to the configured directory. It reports whether the
+// data matches.
+func compareWithBackup(cfg config.Config, m *pgbackup.Manifest, target compare.Database, stdout, stderr io.Writer) bool {
+	report, err := compare.Manifest(m, target)
+	if err != nil {
+		fmt.Fprintf(stderr, "Comparison failed: %v\n", err)
+		return false
+	}
+	fmt.Fprintf(stdout, "Comparison with %s:\n", report.Source)
+	report.WriteTable(stdout, false)
+	if cfg.Compare.ReportDir != "" {
+		path, err := report.Save(cfg.Compare.ReportDir)
+		if err != nil {
+			fmt.Fprintf(stderr, "Comparison report: %v\n", err)
+		} else {
+			fmt.Fprintf(stdout, "Comparison report: %s\n", path)
+		}
+	}
+	if bad := len(report.Mismatches()); bad > 0 {
+		fmt.Fprintf(stderr, "Data comparison found %d differing tables.\n", bad)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+	"github.com/curtisbraxdale/go-pg-backup/internal/tableexport"
+)
+
+func runExport(args []string, stdout, stderr io.Writer, j *job) (code int) {
+	fs := newFlagSet("export", stderr)
+	var conn connFlags
+	conn.register(fs)
+	var tables stringList
+	fs.Var(&tables, "table", `table to export, as "schema.table" or "table" (repeatable)`)
+	query := fs.String("query", "", "SELECT whose result is exported, instead of or in addition to tables")
+	name := fs.String("name", "query", "base name of the files the -query result is written to")
+	formatName := fs.String("format", "csv", "file format: csv, tsv or jsonl")
+	compressName := fs.String("compress", "none", "compression: none, gzip or zstd")
+	splitSize := fs.String("split-size", "", "start a new numbered file after this much uncompressed data, e.g. 100MB")
+	dir := fs.String("dir", "", "directory to write the files into")
+	toStdout := fs.Bool("stdout", false, "write the only table or query to standard output instead of -dir")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if conn.dbname == "" || (len(tables) == 0 && *query == "") || (*dir == "") == !*toStdout {
+		fmt.Fprintln(stderr, "export: -dbname, at least one -table or -query, and one of -dir or -stdout are required")
+		fs.Usage()
+		return 2
+	}
+
+	opts := tableexport.Options{
+		Host:     conn.host,
+		Port:     conn.port,
+		User:     conn.user,
+		Password: conn.password(),
+		DBName:   conn.dbname,
+		Dir:      *dir,
+	}
+	var err error
+	if opts.Format, err = tableexport.ParseFormat(*formatName); err == nil {
+		opts.Compression, err = tableexport.ParseCompression(*compressName)
+	}
+	if err == nil && *splitSize != "" {
+		opts.SplitSize, err = tableexport.ParseSize(*splitSize)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "export: %v\n", err)
+		return 2
+	}
+	for _, t := range tables {
+		opts.Sources = append(opts.Sources, tableexport.TableSource(t))
+	}
+	if *query != "" {
+		opts.Sources = append(opts.Sources, tableexport.Source{Name: *name, Query: *query})
+	}
+	if *toStdout {
+		if len(opts.Sources) > 1 || opts.SplitSize > 0 {
+			fmt.Fprintln(stderr, "export: -stdout takes a single -table or -query and no -split-size")
+			return 2
+		}
+		// The data owns stdout, so report on stderr.
+		opts.Stdout, stdout = j.output, stderr
+	}
+
+	j.start(conn)
+	j.File = *dir
+	if *toStdout {
+		j.File = "-"
+	}
+
+	// The hooks use the config file, so surface its problems first.
+	if _, err := config.Load(); err != nil {
+		fmt.Fprintf(stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	if !j.beforeHooks(stdout, stderr) {
+		return 1
+	}
+	defer func() { code = j.afterHooks(code, stdout, stderr) }()
+
+	result, err := tableexport.Export(context.Background(), opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	j.Size = result.Bytes()
+	for _, s := range result.Sources {
+		fmt.Fprintf(stdout, "%s: %d rows, %s\n", s.Name, s.Rows, preflight.FormatBytes(s.Bytes))
+		for _, f := range s.Files {
+			fmt.Fprintf(stdout, "  %s\n", f)
+		}
+	}
+	fmt.Fprintln(stdout, "Export completed successfully!")
+	return 0
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+)
+
+func runExtract(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("extract", stderr)
+	file := fs.String("file", "", "plain SQL backup to extract from (required)")
+	var tables stringList
+	fs.Var(&tables, "table", `table to extract, as "schema.table" or "table" (repeatable)`)
+	output := fs.String("output", "", "SQL file to write the extracted tables to")
+	list := fs.Bool("list", false, "list the tables of the backup instead of extracting")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if *file == "" || (!*list && (len(tables) == 0 || *output == "")) {
+		fmt.Fprintln(stderr, "extract: -file and either -list or at least one -table and -output are required")
+		fs.Usage()
+		return 2
+	}
+
+	if *list {
+		names, err := pgrestore.ListTables(*file)
+		if err != nil {
+			fmt.Fprintf(stderr, "extract: %v\n", err)
+			return 1
+		}
+		for _, name := range names {
+			fmt.Fprintln(stdout, name)
+		}
+		return 0
+	}
+
+	result, err := pgrestore.ExtractFile(*file, *output, tables)
+	if err != nil {
+		fmt.Fprintf(stderr, "extract: %v\n", err)
+		return 1
+	}
+	printExtraction(stdout, result)
+	fmt.Fprintf(stdout, "Extracted into %s\n", *output)
+	return 0
+}
+
+// printExtraction reports the tables and rows extracted from a backup and
+// the statements left out.
+func printExtraction(w io.Writer, e *pgrestore.Extraction) {
+	fmt.Fprintf(w, "Tables: %d, rows: %d\n", len(e.Tables), e.Rows)
+	for _, t := range e.Tables {
+		fmt.Fprintf(w, "  %s\n", t)
+	}
+	if len(e.Skipped) > 0 {
+		fmt.Fprintln(w, "Left out, as they need tables that were not extracted:")
+		for _, s := range e.Skipped {
+			fmt.Fprintf(w, "  %s\n", s)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/hooks"
+	"github.com/curtisbraxdale/go-pg-backup/internal/notify"
+)
+
+// runHooks runs the configured hooks for phase, writing their output to w.
+func runHooks(cfg config.Config, phase hooks.Phase, job hooks.Job, w io.Writer) error {
+	return hooks.Run(cfg.Hooks, phase, job, func(line string) {
+		fmt.Fprintf(w, "[hook] %s\n", line)
+	})
+}
+
+// finishHooks runs the after hooks of a command that exited with code and
+// returns its final exit code: a failed hook that aborts fails the command.
+// lastErr holds the last line the command wrote to stderr.
+func finishHooks(cfg config.Config, job hooks.Job, code int, lastErr *notify.Tail, stdout, stderr io.Writer) int {
+	job.Status = "success"
+	if code != 0 {
+		job.Status = "failure"
+		if lines := lastErr.Lines(); len(lines) > 0 {
+			job.Error = lines[0]
+		}
+	}
+	if err := runHooks(cfg, hooks.After, job, stdout); err != nil {
+		fmt.Fprintf(stderr, "%s failed: %v\n", job.Operation, err)
+		return 1
+	}
+	return code
+}
+
+// hookJob describes the job to its hooks.
+func (j *job) hookJob() hooks.Job {
+	return hooks.Job{
+		Operation: j.Operation,
+		Host:      j.conn.host,
+		Port:      j.conn.port,
+		User:      j.conn.user,
+		Password:  j.conn.password(),
+		Database:  j.conn.dbname,
+		File:      j.File,
+	}
+}
+
+// beforeHooks runs the job's before hooks, reporting whether the command
+// may go ahead.
+func (j *job) beforeHooks(stdout, stderr io.Writer) bool {
+	if err := runHooks(j.cfg, hooks.Before, j.hookJob(), stdout); err != nil {
+		fmt.Fprintf(stderr, "%s aborted: %v\n", j.Operation, err)
+		return false
+	}
+	return true
+}
+
+// afterHooks runs the job's after hooks once the command exited with code
+// and returns the final exit code.
+func (j *job) afterHooks(code int, stdout, stderr io.Writer) int {
+	return finishHooks(j.cfg, j.hookJob(), code, j.lastErr, stdout, stderr)
+}
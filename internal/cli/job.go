@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/metrics"
+	"github.com/curtisbraxdale/go-pg-backup/internal/notify"
+)
+
+// logTailLines is how much of a job's output a notification carries.
+const logTailLines = 20
+
+// job is one run of a command on a database. Its outcome is recorded in
+// the metrics and sent to the configured notifications.
+type job struct {
+	notify.Event
+	cfg     config.Config
+	conn    connFlags
+	stderr  io.Writer
+	lastErr *notify.Tail // Last line written to stderr
+	output  io.Writer    // The command's stdout without the log capture, for streamed data
+}
+
+// start records the database the job works on, once the command's flags
+// are parsed, and counts the job as in flight.
+func (j *job) start(c connFlags) {
+	j.conn = c
+	j.Database, j.Host, j.Port = c.dbname, c.host, c.port
+	j.updateMetrics(func(s *metrics.State) {
+		s.Get(j.Operation, j.Host, j.Database).Start()
+	})
+}
+
+// updateMetrics applies fn to the metrics state and refreshes the textfile.
+// Problems are reported but never fail the job.
+func (j *job) updateMetrics(fn func(*metrics.State)) {
+	if err := recordMetrics(j.cfg, fn); err != nil {
+		fmt.Fprintf(j.stderr, "Metrics update failed: %v\n", err)
+	}
+}
+
+// recordMetrics applies fn to the metrics state and, if configured,
+// rewrites the textfile collector output.
+func recordMetrics(cfg config.Config, fn func(*metrics.State)) error {
+	path, err := cfg.MetricsStatePath()
+	if err != nil {
+		return err
+	}
+	if err := metrics.Update(path, fn); err != nil {
+		return err
+	}
+	if cfg.MetricsTextfile != "" {
+		return metrics.WriteTextfile(path, cfg.MetricsTextfile)
+	}
+	return nil
+}
+
+// reported wraps a command so its outcome is recorded and notified. Usage
+// errors and runs that stop before start is called are not reported.
+func reported(operation string, run func(args []string, stdout, stderr io.Writer, j *job) int) func(args []string, stdout, stderr io.Writer) int {
+	return func(args []string, stdout, stderr io.Writer) int {
+		// Problems with the config file surface when the command loads it.
+		cfg, _ := config.Load()
+		log := notify.NewTail(logTailLines)
+		lastErr := notify.NewTail(1)
+		j := &job{Event: notify.Event{Operation: operation, StartedAt: time.Now()}, cfg: cfg, stderr: stderr, lastErr: lastErr, output: stdout}
+		code := run(args, io.MultiWriter(stdout, log), io.MultiWriter(stderr, log, lastErr), j)
+		if j.Database == "" {
+			return code
+		}
+
+		j.Duration = time.Since(j.StartedAt)
+		j.LogTail = log.Lines()
+		switch {
+		case code != 0:
+			j.Status = notify.Failure
+			if lines := lastErr.Lines(); len(lines) > 0 {
+				j.Error = lines[0]
+			}
+		case len(j.Warnings) > 0:
+			j.Status = notify.Warning
+		default:
+			j.Status = notify.Success
+		}
+		j.updateMetrics(func(s *metrics.State) {
+			s.Get(j.Operation, j.Host, j.Database).Finish(code == 0, j.Duration, j.Size)
+		})
+		if err := notify.Send(cfg.Notifications, j.Event); err != nil {
+			fmt.Fprintf(stderr, "Notification failed: %v\n", err)
+		}
+		return code
+	}
+}
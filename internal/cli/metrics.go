@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/metrics"
+)
+
+// runMetrics dispatches the subcommands publishing the recorded metrics.
+func runMetrics(args []string, stdout, stderr io.Writer) int {
+	subcommands := map[string]func(args []string, stdout, stderr io.Writer) int{
+		"serve": runMetricsServe,
+		"write": runMetricsWrite,
+	}
+	if len(args) > 0 {
+		if run, ok := subcommands[args[0]]; ok {
+			return run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintln(stderr, "Usage: go-pg-backup metrics <serve|write> [flags]")
+	return 2
+}
+
+func runMetricsServe(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("metrics serve", stderr)
+	listen := fs.String("listen", ":9187", "address to serve /metrics on")
+	checkInterval := fs.Duration("check-interval", 5*time.Minute, "how often to run the RPO check in the background (0 disables it)")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	path, code := metricsStatePath("metrics serve", stderr)
+	if path == "" {
+		return code
+	}
+
+	var extra []func(io.Writer) error
+	if *checkInterval > 0 {
+		monitor := &rpoMonitor{stderr: stderr}
+		go monitor.run(*checkInterval)
+		extra = append(extra, monitor.writeMetrics)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(path, extra...))
+	fmt.Fprintf(stdout, "Serving metrics from %s on %s/metrics\n", path, *listen)
+	if err := http.ListenAndServe(*listen, mux); err != nil {
+		fmt.Fprintf(stderr, "metrics serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runMetricsWrite(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("metrics write", stderr)
+	out := fs.String("out", "", "file to write the metrics to, e.g. in node_exporter's textfile directory (default: metrics_textfile from the config file, or stdout)")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	path, code := metricsStatePath("metrics write", stderr)
+	if path == "" {
+		return code
+	}
+	if *out == "" {
+		if cfg, err := config.Load(); err == nil {
+			*out = cfg.MetricsTextfile
+		}
+	}
+
+	if *out == "" {
+		s, err := metrics.Load(path)
+		if err == nil {
+			err = s.WriteText(stdout)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "metrics write: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if err := metrics.WriteTextfile(path, *out); err != nil {
+		fmt.Fprintf(stderr, "metrics write: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// metricsStatePath locates the metrics state file. On failure it reports
+// the error and returns an empty path with the exit code.
+func metricsStatePath(command string, stderr io.Writer) (string, int) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", command, err)
+		return "", 1
+	}
+	path, err := cfg.MetricsStatePath()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", command, err)
+		return "", 1
+	}
+	return path, 0
+}
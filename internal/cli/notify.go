@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/notify"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+)
+
+// reportWarnings lists the pre-flight checks that passed with a warning.
+func reportWarnings(report preflight.Report) []string {
+	var warnings []string
+	for _, c := range report.Checks {
+		if c.Status == preflight.Warn {
+			warnings = append(warnings, c.Name+": "+c.Detail)
+		}
+	}
+	return warnings
+}
+
+func runNotify(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(stderr, "Usage: go-pg-backup notify test [-target NAME] [-status success|failure|warning]")
+		return 2
+	}
+	fs := newFlagSet("notify test", stderr)
+	name := fs.String("target", "", "only notify the target with this name (default: all)")
+	status := fs.String("status", "failure", "status of the test event: success, failure or warning")
+	if err := fs.Parse(args[1:]); err != nil {
+		return flagExitCode(err)
+	}
+	ev := notify.Event{
+		Operation: "test",
+		Status:    notify.Status(*status),
+		Database:  "example",
+		Host:      "localhost",
+		Port:      5432,
+		StartedAt: time.Now().Add(-42 * time.Second),
+		Duration:  42 * time.Second,
+		Size:      123456789,
+		LogTail:   []string{"This is a test notification from go-pg-backup."},
+	}
+	switch ev.Status {
+	case notify.Success:
+	case notify.Failure:
+		ev.Error = "this is a test failure"
+	case notify.Warning:
+		ev.Warnings = []string{"this is a test warning"}
+	default:
+		fmt.Fprintf(stderr, "notify test: unknown status %q\n", *status)
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "notify test: %v\n", err)
+		return 1
+	}
+	sent, failed := 0, 0
+	for _, t := range cfg.Notifications {
+		if *name != "" && t.Name != *name {
+			continue
+		}
+		sent++
+		label := strings.TrimSpace(t.Name + " (" + t.Type + ")")
+		if err := notify.Deliver(t, ev); err != nil {
+			fmt.Fprintf(stdout, "FAIL  %s: %v\n", label, err)
+			failed++
+		} else {
+			fmt.Fprintf(stdout, " ok   %s\n", label)
+		}
+	}
+	if sent == 0 {
+		fmt.Fprintln(stderr, "notify test: no matching notification targets in the config file")
+		return 1
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
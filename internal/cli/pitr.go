@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbin"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pitr"
+)
+
+// archiveDirFlag registers -dir, defaulting to the configured archive directory.
+func archiveDirFlag(fs *flag.FlagSet) *string {
+	return fs.String("dir", "", "archive directory (default: archive_dir from the config file)")
+}
+
+// resolveArchiveDir returns dir, or the configured archive directory if dir is empty.
+func resolveArchiveDir(dir string, cfg config.Config) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	if cfg.ArchiveDir == "" {
+		return "", fmt.Errorf("no archive directory, pass -dir or set archive_dir in the config file")
+	}
+	return cfg.ArchiveDir, nil
+}
+
+func runBaseBackup(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("basebackup", stderr)
+	var conn connFlags
+	conn.register(fs)
+	dir := archiveDirFlag(fs)
+	binary := fs.String("pg-basebackup", "", "pg_basebackup binary to use (default: newest installed one supporting the server)")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "Base backup failed: %v\n", err)
+		return 1
+	}
+	archiveDir, err := resolveArchiveDir(*dir, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "Base backup failed: %v\n", err)
+		return 1
+	}
+
+	base, err := pitr.TakeBaseBackup(pitr.BaseOptions{
+		Host:          conn.host,
+		Port:          conn.port,
+		User:          conn.user,
+		Password:      conn.password(),
+		DBName:        conn.dbname,
+		ArchiveDir:    archiveDir,
+		Binary:        *binary,
+		ClientBinDirs: cfg.ClientBinDirs,
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "Base backup failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Base backup completed successfully!\nBase backup: %s\n", base.Dir)
+	fmt.Fprintf(stdout, "WAL: %s to %s on timeline %d\n", base.StartLSN, base.EndLSN, base.Timeline)
+	fmt.Fprintf(stdout, "pg_basebackup: %s (%s)\n", base.Binary, base.BinaryVersion)
+	return 0
+}
+
+func runArchiveWAL(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("archive-wal", stderr)
+	dir := archiveDirFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: go-pg-backup archive-wal [-dir DIR] <path> <name>")
+		fmt.Fprintf(stderr, "Set archive_command = 'go-pg-backup archive-wal -dir DIR %s %s'.\n", "%p", "%f")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.Load()
+	var archiveDir string
+	if err == nil {
+		archiveDir, err = resolveArchiveDir(*dir, cfg)
+	}
+	if err == nil {
+		err = pitr.ArchiveWAL(archiveDir, fs.Arg(0), fs.Arg(1))
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "archive-wal: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runPITRRestore(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("pitr-restore", stderr)
+	dir := archiveDirFlag(fs)
+	dataDir := fs.String("data-dir", "", "data directory to create (required)")
+	targetTime := fs.String("target-time", "", "recover up to this time, e.g. 2024-01-01T12:00:00Z")
+	targetLSN := fs.String("target-lsn", "", "recover up to this WAL position, e.g. 0/3000060")
+	targetName := fs.String("target-name", "", "recover up to this restore point")
+	base := fs.String("base", "", "label of the base backup to start from (default: newest before the target)")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if *dataDir == "" {
+		fmt.Fprintln(stderr, "pitr-restore: -data-dir is required")
+		fs.Usage()
+		return 2
+	}
+
+	var target pitr.Target
+	targets := 0
+	if *targetTime != "" {
+		t, err := pitr.ParseTime(*targetTime)
+		if err != nil {
+			fmt.Fprintf(stderr, "pitr-restore: %v\n", err)
+			return 2
+		}
+		target.Time = t
+		targets++
+	}
+	if *targetLSN != "" {
+		lsn, err := pitr.ParseLSN(*targetLSN)
+		if err != nil {
+			fmt.Fprintf(stderr, "pitr-restore: %v\n", err)
+			return 2
+		}
+		target.LSN = lsn
+		targets++
+	}
+	if *targetName != "" {
+		target.Name = *targetName
+		targets++
+	}
+	if targets > 1 {
+		fmt.Fprintln(stderr, "pitr-restore: -target-time, -target-lsn and -target-name are mutually exclusive")
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "Restore failed: %v\n", err)
+		return 1
+	}
+	archiveDir, err := resolveArchiveDir(*dir, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "Restore failed: %v\n", err)
+		return 1
+	}
+	used, err := pitr.Restore(pitr.RestoreOptions{
+		ArchiveDir: archiveDir,
+		DataDir:    *dataDir,
+		Target:     target,
+		Base:       *base,
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "Restore failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Data directory %s is ready to recover to %s.\n", *dataDir, target)
+	fmt.Fprintf(stdout, "Base backup: %s (finished %s)\n", used.Label, used.FinishedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(stdout, "Start PostgreSQL %s on it, e.g. pg_ctl -D %s start; it promotes itself once the target is reached.\n",
+		pgbin.FormatMajor(pgbin.MajorVersion(used.ServerVersion)), *dataDir)
+	return 0
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/metrics"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+	"github.com/curtisbraxdale/go-pg-backup/internal/repo"
+)
+
+// runRepo dispatches the subcommands managing a deduplicating repository.
+func runRepo(args []string, stdout, stderr io.Writer) int {
+	subcommands := map[string]func(args []string, stdout, stderr io.Writer) int{
+		"init":  runRepoInit,
+		"list":  runRepoList,
+		"prune": runRepoPrune,
+	}
+	if len(args) > 0 {
+		if run, ok := subcommands[args[0]]; ok {
+			return run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintln(stderr, "Usage: go-pg-backup repo <init|list|prune> -repo DIR [flags]")
+	fmt.Fprintf(stderr, "The password of an encrypted repository is read from %s.\n", repo.PasswordEnv)
+	return 2
+}
+
+func runRepoInit(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("repo init", stderr)
+	dir := fs.String("repo", "", "directory to create the repository in (required)")
+	encrypt := fs.Bool("encrypt", false, "encrypt the chunks with the password in "+repo.PasswordEnv)
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if *dir == "" {
+		fmt.Fprintln(stderr, "repo init: -repo is required")
+		return 2
+	}
+	password := ""
+	if *encrypt {
+		if password = os.Getenv(repo.PasswordEnv); password == "" {
+			fmt.Fprintf(stderr, "repo init: -encrypt needs a password in %s\n", repo.PasswordEnv)
+			return 2
+		}
+	}
+
+	r, err := repo.Init(*dir, password)
+	if err != nil {
+		fmt.Fprintf(stderr, "repo init: %v\n", err)
+		return 1
+	}
+	defer r.Close()
+	if r.Encrypted() {
+		fmt.Fprintf(stdout, "Created encrypted repository %s\n", *dir)
+	} else {
+		fmt.Fprintf(stdout, "Created repository %s\n", *dir)
+	}
+	return 0
+}
+
+func runRepoList(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("repo list", stderr)
+	dir := fs.String("repo", "", "repository directory (required)")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	r, code := openRepo(*dir, "repo list", stderr)
+	if r == nil {
+		return code
+	}
+	defer r.Close()
+
+	snaps, err := r.Snapshots()
+	if err != nil {
+		fmt.Fprintf(stderr, "repo list: %v\n", err)
+		return 1
+	}
+	st, err := r.Stats()
+	if err != nil {
+		fmt.Fprintf(stderr, "repo list: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%-36s %-20s %10s %10s %9s\n", "SNAPSHOT", "CREATED", "SIZE", "ADDED", "DEDUP")
+	for _, s := range snaps {
+		fmt.Fprintf(stdout, "%-36s %-20s %10s %10s %9s\n", s.ID, s.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			preflight.FormatBytes(s.Size), preflight.FormatBytes(s.NewBytes), formatRatio(s.Ratio()))
+	}
+	fmt.Fprintf(stdout, "\n%d snapshots, %s of dumps stored in %s (%d chunks), dedup ratio %s\n",
+		st.Snapshots, preflight.FormatBytes(st.LogicalSize), preflight.FormatBytes(st.StoredSize), st.Chunks, formatRatio(st.Ratio()))
+	return 0
+}
+
+func runRepoPrune(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("repo prune", stderr)
+	dir := fs.String("repo", "", "repository directory (required)")
+	keepLast := fs.Int("keep-last", 0, "forget all but the newest N snapshots of each database first (0 keeps all)")
+	var forget stringList
+	fs.Var(&forget, "forget", "snapshot to forget first (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	r, code := openRepo(*dir, "repo prune", stderr)
+	if r == nil {
+		return code
+	}
+	defer r.Close()
+
+	snaps, err := r.Snapshots()
+	if err != nil {
+		fmt.Fprintf(stderr, "repo prune: %v\n", err)
+		return 1
+	}
+	ids := []string(forget)
+	if *keepLast > 0 {
+		ids = append(ids, repo.KeepLast(snaps, *keepLast)...)
+	}
+	if err := r.Forget(ids...); err != nil {
+		fmt.Fprintf(stderr, "repo prune: %v\n", err)
+		return 1
+	}
+	for _, id := range ids {
+		fmt.Fprintf(stdout, "Forgot snapshot %s\n", id)
+	}
+	if len(ids) > 0 {
+		recordRetention(snaps, ids, stderr)
+	}
+
+	result, err := r.Prune()
+	if err != nil {
+		fmt.Fprintf(stderr, "repo prune: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Deleted %d unreferenced chunks, freeing %s\n", result.Chunks, preflight.FormatBytes(result.Bytes))
+	return 0
+}
+
+// recordRetention counts the forgotten snapshots as retention deletions
+// in the metrics of the databases they were taken from.
+func recordRetention(snaps []repo.Snapshot, forgotten []string, stderr io.Writer) {
+	cfg, err := config.Load()
+	if err == nil {
+		err = recordMetrics(cfg, func(s *metrics.State) {
+			for _, snap := range snaps {
+				if slices.Contains(forgotten, snap.ID) && snap.Manifest != nil {
+					s.Get("backup", snap.Manifest.Host, snap.Manifest.Database).RetentionDeletions++
+				}
+			}
+		})
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Metrics update failed: %v\n", err)
+	}
+}
+
+// openRepo opens the repository in dir with the password from the
+// environment. On failure it reports the error and returns the exit code.
+func openRepo(dir, command string, stderr io.Writer) (*repo.Repo, int) {
+	if dir == "" {
+		fmt.Fprintf(stderr, "%s: -repo is required\n", command)
+		return nil, 2
+	}
+	r, err := repo.Open(dir, os.Getenv(repo.PasswordEnv))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", command, err)
+		return nil, 1
+	}
+	return r, 0
+}
+
+// formatRatio prints a dedup ratio, "all dedup" for a snapshot that added
+// nothing.
+func formatRatio(r float64) string {
+	switch {
+	case r == 0:
+		return "-"
+	case math.IsInf(r, 1):
+		return "all dedup"
+	}
+	return fmt.Sprintf("%.1fx", r)
+}
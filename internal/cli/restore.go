@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+)
+
+func runRestore(args []string, stdout, stderr io.Writer, j *job) (code int) {
+	fs := newFlagSet("restore", stderr)
+	var conn connFlags
+	conn.register(fs)
+	file := fs.String("file", "", "backup file to restore (required unless -repo is given)")
+	repoDir := fs.String("repo", "", "deduplicating repository to restore a snapshot from")
+	snapshot := fs.String("snapshot", "", "snapshot to restore from -repo")
+	create := fs.Bool("create", false, "create the database before restoring")
+	recreate := fs.Bool("recreate", false, "drop and recreate the database before restoring, after a safety backup")
+	swap := fs.Bool("swap", false, "restore into a staging database and swap it in, keeping the old one")
+	psqlBinary := fs.String("psql", "", "psql binary to use (default: newest installed one)")
+	engineName := fs.String("engine", "auto", "restore engine: auto (psql, or the Go executor if psql is missing), psql or go")
+	var validate stringList
+	fs.Var(&validate, "validate", "validation query run against the staging database before swapping (repeatable)")
+	analyze := fs.Bool("analyze", false, "run ANALYZE after restoring")
+	analyzeJobs := fs.Int("analyze-jobs", 0, "run the ANALYZE with vacuumdb using this many parallel jobs")
+	resetSequences := fs.Bool("reset-sequences", false, "reset every serial and identity sequence to its column's maximum after restoring")
+	compareData := fs.Bool("compare", false, "compare each table's row count and checksum with the backup after restoring (default: compare.after_restore from the config file)")
+	var tables stringList
+	fs.Var(&tables, "table", `restore only this table of the backup, as "schema.table" or "table" (repeatable)`)
+	var reindex stringList
+	fs.Var(&reindex, "reindex", `object to REINDEX after restoring, as "TABLE name", "INDEX name", "SCHEMA name" or "DATABASE" (repeatable)`)
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if conn.dbname == "" || (*file == "") == (*repoDir == "") || (*repoDir != "") != (*snapshot != "") {
+		fmt.Fprintln(stderr, "restore: -dbname and either -file or -repo with -snapshot are required")
+		fs.Usage()
+		return 2
+	}
+
+	engine, err := pgrestore.ParseEngine(*engineName)
+	if err != nil {
+		fmt.Fprintf(stderr, "restore: %v\n", err)
+		return 2
+	}
+
+	mode := pgrestore.ModeExisting
+	selected := 0
+	for flagMode, set := range map[pgrestore.Mode]bool{pgrestore.ModeCreate: *create, pgrestore.ModeRecreate: *recreate, pgrestore.ModeSwap: *swap} {
+		if set {
+			mode = flagMode
+			selected++
+		}
+	}
+	if selected > 1 {
+		fmt.Fprintln(stderr, "restore: -create, -recreate and -swap are mutually exclusive")
+		return 2
+	}
+	if len(tables) > 0 && (*recreate || *swap || *compareData) {
+		fmt.Fprintln(stderr, "restore: -table cannot be combined with -recreate, -swap or -compare")
+		return 2
+	}
+
+	j.start(conn)
+	j.File = *file
+	if *repoDir != "" {
+		j.File = *repoDir + ":" + *snapshot
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "Restore failed: %v\n", err)
+		return 1
+	}
+
+	if *repoDir != "" {
+		// Reassemble the snapshot into a plain backup file and restore that.
+		r, code := openRepo(*repoDir, "restore", stderr)
+		if r == nil {
+			return code
+		}
+		tmp, err := os.MkdirTemp("", "go-pg-backup-")
+		if err == nil {
+			defer os.RemoveAll(tmp)
+			*file = filepath.Join(tmp, *snapshot+".sql")
+			_, err = r.Extract(*snapshot, *file)
+		}
+		r.Close()
+		if err != nil {
+			fmt.Fprintf(stderr, "Restore failed: %v\n", err)
+			return 1
+		}
+		// Safety backups default to the backup's directory, which is removed afterwards.
+		if cfg.SafetyBackupDir == "" {
+			cfg.SafetyBackupDir = "."
+		}
+	}
+
+	report := preflight.Restore(preflight.RestoreOptions{
+		Host:          conn.host,
+		Port:          conn.port,
+		User:          conn.user,
+		Password:      conn.password(),
+		DBName:        conn.dbname,
+		BackupPath:    *file,
+		Mode:          mode,
+		RestoreBinary: *psqlBinary,
+		ClientBinDirs: cfg.ClientBinDirs,
+		Engine:        engine,
+	})
+	j.Warnings = reportWarnings(report)
+	if info, err := os.Stat(*file); err == nil {
+		j.Size = info.Size()
+	}
+	if !printPreflight(stdout, stderr, report) {
+		return 1
+	}
+	if !j.beforeHooks(stdout, stderr) {
+		return 1
+	}
+	defer func() { code = j.afterHooks(code, stdout, stderr) }()
+
+	maintenance := cfg.PostRestore
+	maintenance.Analyze = maintenance.Analyze || *analyze
+	maintenance.AnalyzeJobs = max(maintenance.AnalyzeJobs, *analyzeJobs)
+	maintenance.ResetSequences = maintenance.ResetSequences || *resetSequences
+	maintenance.Reindex = append(maintenance.Reindex, reindex...)
+
+	result, err := pgrestore.Run(pgrestore.Options{
+		Host:              conn.host,
+		Port:              conn.port,
+		User:              conn.user,
+		Password:          conn.password(),
+		DBName:            conn.dbname,
+		BackupPath:        *file,
+		Mode:              mode,
+		ProtectedTargets:  cfg.ProtectedTargets,
+		SafetyBackupDir:   cfg.SafetyBackupDir,
+		ValidationQueries: append(cfg.SwapValidationQueries, validate...),
+		RestoreBinary:     report.Binary.Path,
+		ClientBinDirs:     cfg.ClientBinDirs,
+		Engine:            engine,
+		Maintenance:       maintenance,
+		Tables:            tables,
+	})
+	if result != nil && result.Extraction != nil {
+		printExtraction(stdout, result.Extraction)
+	}
+	if result != nil && result.SafetyBackupPath != "" {
+		fmt.Fprintf(stdout, "Safety backup: %s\n", result.SafetyBackupPath)
+	}
+	if result != nil && len(result.Maintenance) > 0 {
+		fmt.Fprintln(stdout, "Post-restore maintenance:")
+		for _, step := range result.Maintenance {
+			fmt.Fprintf(stdout, "  %s\n", step)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Restore failed: %v\n", err)
+		return 1
+	}
+	// A partial restore cannot match the backup's manifest.
+	if *compareData || (cfg.Compare.AfterRestore && len(tables) == 0) {
+		m, err := pgbackup.ReadManifest(*file)
+		if err != nil {
+			fmt.Fprintf(stderr, "Restore failed: cannot compare the data: %v\n", err)
+			return 1
+		}
+		if !compareWithBackup(cfg, m, targetDatabase(conn), stdout, stderr) {
+			return 1
+		}
+	}
+	fmt.Fprintln(stdout, "Restore completed successfully!")
+	if result.Engine == pgrestore.EngineGo {
+		fmt.Fprintln(stdout, "Engine: built-in Go executor")
+	} else {
+		fmt.Fprintf(stdout, "psql: %s\n", result.Binary)
+	}
+	if result.PreviousDatabase != "" {
+		fmt.Fprintf(stdout, "Previous database kept as %s for rollback.\n", result.PreviousDatabase)
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/schemadiff"
+)
+
+// runSchemaDiff exits like diff(1): 0 when the schemas match, 1 when they
+// differ and 2 on errors.
+func runSchemaDiff(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("schema-diff", stderr)
+	var conn connFlags
+	conn.register(fs)
+	backup := fs.String("backup", "", "backup file whose schema is compared with the database (required)")
+	engineName := fs.String("engine", "", "dump the database's schema with auto, pg_dump or go (default: the engine that wrote the backup)")
+	dumpBinary := fs.String("pg-dump", "", "pg_dump binary to use (default: newest installed one supporting the server)")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if conn.dbname == "" || *backup == "" {
+		fmt.Fprintln(stderr, "schema-diff: -dbname and -backup are required")
+		fs.Usage()
+		return 2
+	}
+	engine, err := pgbackup.ParseEngine(*engineName)
+	if err != nil {
+		fmt.Fprintf(stderr, "schema-diff: %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "schema-diff: %v\n", err)
+		return 2
+	}
+	result, err := schemadiff.Backup(*backup, schemadiff.Database{
+		Host:          conn.host,
+		Port:          conn.port,
+		User:          conn.user,
+		Password:      conn.password(),
+		DBName:        conn.dbname,
+		Engine:        engine,
+		DumpBinary:    *dumpBinary,
+		ClientBinDirs: cfg.ClientBinDirs,
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "schema-diff: %v\n", err)
+		return 2
+	}
+	if err := result.WriteUnified(stdout); err != nil {
+		fmt.Fprintf(stderr, "schema-diff: %v\n", err)
+		return 2
+	}
+	if len(result.Changes) > 0 {
+		return 1
+	}
+	return 0
+}
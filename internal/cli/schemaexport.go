@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/schemaexport"
+)
+
+func runSchemaExport(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("schema-export", stderr)
+	var conn connFlags
+	conn.register(fs)
+	dir := fs.String("dir", "", "directory to write one file per object into; other SQL files in it are removed (required)")
+	engineName := fs.String("engine", "auto", "dump engine: auto (pg_dump, or the Go engine if pg_dump is missing), pg_dump or go")
+	dumpBinary := fs.String("pg-dump", "", "pg_dump binary to use (default: newest installed one supporting the server)")
+	verbose := fs.Bool("v", false, "list the files written and removed")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if conn.dbname == "" || *dir == "" {
+		fmt.Fprintln(stderr, "schema-export: -dbname and -dir are required")
+		fs.Usage()
+		return 2
+	}
+	engine, err := pgbackup.ParseEngine(*engineName)
+	if err != nil {
+		fmt.Fprintf(stderr, "schema-export: %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "schema-export: %v\n", err)
+		return 1
+	}
+	result, err := schemaexport.Export(pgbackup.Options{
+		Host:          conn.host,
+		Port:          conn.port,
+		User:          conn.user,
+		Password:      conn.password(),
+		DBName:        conn.dbname,
+		DumpBinary:    *dumpBinary,
+		ClientBinDirs: cfg.ClientBinDirs,
+		Engine:        engine,
+	}, *dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "schema-export: %v\n", err)
+		return 1
+	}
+	if *verbose {
+		for _, path := range result.Written {
+			fmt.Fprintf(stdout, "written  %s\n", path)
+		}
+		for _, path := range result.Removed {
+			fmt.Fprintf(stdout, "removed  %s\n", path)
+		}
+	}
+	fmt.Fprintf(stdout, "Exported %s\n", result)
+	return 0
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/catalog"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/repo"
+)
+
+// catalogTime is how search shows when a backup was taken.
+const catalogTime = "2006-01-02 15:04"
+
+func runSearch(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("search", stderr)
+	dir := fs.String("dir", "", "backup directory to search")
+	repoDir := fs.String("repo", "", "deduplicating repository to search instead of -dir")
+	kindName := fs.String("kind", "", "only find objects of this kind: table, column or function")
+	database := fs.String("database", "", `only search the backups of databases matching this "host/database" or "database" pattern`)
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if fs.NArg() != 1 || (*dir == "") == (*repoDir == "") {
+		fmt.Fprintln(stderr, "search: one object name and one of -dir or -repo are required")
+		fs.Usage()
+		return 2
+	}
+	kind, ok := catalog.ParseKind(*kindName)
+	if !ok {
+		fmt.Fprintf(stderr, "search: unknown kind %q, want table, column or function\n", *kindName)
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "search: %v\n", err)
+		return 1
+	}
+	src := catalog.Source{Dir: *dir, Repo: *repoDir, Password: os.Getenv(repo.PasswordEnv), ClientBinDirs: cfg.ClientBinDirs}
+	idx, err := catalog.Update(src)
+	if err != nil {
+		fmt.Fprintf(stderr, "search: %v\n", err)
+		return 1
+	}
+	for _, b := range idx.Failed() {
+		fmt.Fprintf(stderr, "search: warning: skipped %s, it could not be read: %s\n", b.Location, b.Error)
+	}
+
+	matches := idx.Search(catalog.Query{Name: fs.Arg(0), Kind: kind, Database: *database})
+	if len(matches) == 0 {
+		fmt.Fprintf(stdout, "%q was not found in the %d backups of %s\n", fs.Arg(0), len(idx.Backups)-len(idx.Failed()), src)
+		return 1
+	}
+	for i, m := range matches {
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		fmt.Fprintf(stdout, "%s %s (%s/%s)\n", m.Kind, m.Name, m.Host, m.Database)
+		fmt.Fprintf(stdout, "  first: %s  %s\n", m.First().CreatedAt.Local().Format(catalogTime), m.First().Location)
+		fmt.Fprintf(stdout, "  last:  %s  %s\n", m.Last().CreatedAt.Local().Format(catalogTime), m.Last().Location)
+		fmt.Fprintf(stdout, "  in %d of %d backups", len(m.Backups), m.Total)
+		if m.InLatest(idx) {
+			fmt.Fprint(stdout, ", including the newest")
+		}
+		fmt.Fprintln(stdout, ":")
+		for _, b := range m.Backups {
+			fmt.Fprintf(stdout, "    %s  %s\n", b.CreatedAt.Local().Format(catalogTime), b.Location)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/hooks"
+	"github.com/curtisbraxdale/go-pg-backup/internal/notify"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+func runKeygen(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("keygen", stderr)
+	out := fs.String("out", "", "path of the private key to write; the public key goes to PATH.pub (required)")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if *out == "" {
+		fmt.Fprintln(stderr, "keygen: -out is required")
+		return 2
+	}
+
+	pub, err := pgbackup.GenerateSigningKey(*out)
+	if err != nil {
+		fmt.Fprintf(stderr, "keygen: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Wrote signing key %s and public key %s.pub\n", *out, *out)
+	fmt.Fprintf(stdout, "Fingerprint: %s\n", pgbackup.KeyFingerprint(pub))
+	fmt.Fprintln(stdout, "Set \"signing_key\" in the config file to sign every backup's manifest.")
+	return 0
+}
+
+func runVerify(args []string, stdout, stderr io.Writer) (code int) {
+	fs := newFlagSet("verify", stderr)
+	dir := fs.String("dir", "", "verify every backup in this directory")
+	file := fs.String("file", "", "verify a single backup file")
+	var keyPaths stringList
+	fs.Var(&keyPaths, "key", "trusted public key, in addition to the config file's (repeatable)")
+	var conn connFlags
+	conn.register(fs)
+	compareData := fs.Bool("compare", false, "compare each backup's table checksums with the database given by -dbname (default: compare.after_verify from the config file)")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if (*dir == "") == (*file == "") {
+		fmt.Fprintln(stderr, "verify: exactly one of -dir or -file is required")
+		return 2
+	}
+	if *compareData && conn.dbname == "" {
+		fmt.Fprintln(stderr, "verify: -compare requires -dbname")
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "verify: %v\n", err)
+		return 1
+	}
+	keys, err := pgbackup.LoadVerifyKeys(append(append(cfg.TrustedKeys, cfg.SigningKey), keyPaths...)...)
+	if err != nil {
+		fmt.Fprintf(stderr, "verify: %v\n", err)
+		return 1
+	}
+
+	hookJob := hooks.Job{Operation: "verify", File: *file + *dir}
+	if err := runHooks(cfg, hooks.Before, hookJob, stdout); err != nil {
+		fmt.Fprintf(stderr, "verify aborted: %v\n", err)
+		return 1
+	}
+	lastErr := notify.NewTail(1)
+	stderr = io.MultiWriter(stderr, lastErr)
+	defer func() { code = finishHooks(cfg, hookJob, code, lastErr, stdout, stderr) }()
+
+	var results []pgbackup.Verification
+	if *file != "" {
+		results = []pgbackup.Verification{pgbackup.VerifyBackup(*file, keys)}
+	} else if results, err = pgbackup.VerifyDir(*dir, keys); err != nil {
+		fmt.Fprintf(stderr, "verify: %v\n", err)
+		return 1
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(stdout, "No backups with a manifest in %s\n", *dir)
+		return 0
+	}
+
+	tampered := 0
+	for _, v := range results {
+		fmt.Fprintf(stdout, "%-12s %s\n", v.Trust, filepath.Base(v.Path))
+		for _, p := range v.Problems {
+			fmt.Fprintf(stdout, "             %s\n", p)
+		}
+		if v.Trust == pgbackup.TrustTampered {
+			tampered++
+		}
+	}
+	if tampered > 0 {
+		fmt.Fprintf(stderr, "%d of %d backups failed verification.\n", tampered, len(results))
+		return 1
+	}
+
+	if conn.dbname != "" && (*compareData || cfg.Compare.AfterVerify) {
+		for _, v := range results {
+			if v.Manifest == nil {
+				fmt.Fprintf(stderr, "Comparison failed: %s has no manifest\n", filepath.Base(v.Path))
+				code = 1
+			} else if !compareWithBackup(cfg, v.Manifest, targetDatabase(conn), stdout, stderr) {
+				code = 1
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,252 @@
+// Package compare checks that two copies of a database hold the same data by
+// comparing the row count and an order-independent checksum of every table.
+// A copy is either a live database or a backup whose manifest recorded its
+// table checksums.
+package compare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+// Settings configures the comparison in the config file.
+type Settings struct {
+	// Record stores the table checksums in the manifest of every backup,
+	// so restores of it can be compared.
+	Record bool `json:"record"`
+	// AfterRestore compares every restored database with its backup.
+	AfterRestore bool `json:"after_restore"`
+	// AfterVerify compares every verified backup with the database given
+	// to verify, e.g. the one it was restored into.
+	AfterVerify bool `json:"after_verify"`
+
+	// SamplePercent, if set, hashes only that percentage of the rows of
+	// tables with a primary key and more than SampleMinRows rows.
+	SamplePercent float64 `json:"sample_percent"`
+	SampleMinRows int64   `json:"sample_min_rows"`
+
+	// ReportDir, if set, receives a JSON report of every automatic comparison.
+	ReportDir string `json:"report_dir"`
+}
+
+// Checksums returns the options the settings checksum tables with.
+func (s Settings) Checksums() pgbackup.ChecksumOptions {
+	return pgbackup.ChecksumOptions{SamplePercent: s.SamplePercent, SampleMinRows: s.SampleMinRows}
+}
+
+// Status is the outcome of comparing one table.
+type Status string
+
+const (
+	Match           Status = "match"
+	RowsDiffer      Status = "rows differ"
+	ChecksumDiffers Status = "checksum differs"
+	Missing         Status = "missing" // Only in the source
+	Extra           Status = "extra"   // Only in the target
+	// NotComparable tables were sampled on one side but hashed in full on
+	// the other, e.g. as the target has no primary key to sample by.
+	NotComparable Status = "not comparable"
+)
+
+// TableDiff compares one table in the source and the target.
+type TableDiff struct {
+	Table          string  `json:"table"`
+	Status         Status  `json:"status"`
+	SourceRows     int64   `json:"source_rows"`
+	TargetRows     int64   `json:"target_rows"`
+	SourceChecksum string  `json:"source_checksum,omitempty"`
+	TargetChecksum string  `json:"target_checksum,omitempty"`
+	Sample         float64 `json:"sample,omitempty"` // Percentage of rows hashed, 0 for all
+}
+
+// Report is the outcome of a comparison.
+type Report struct {
+	Source    string      `json:"source"`
+	Target    string      `json:"target"`
+	CreatedAt time.Time   `json:"created_at"`
+	Tables    []TableDiff `json:"tables"`
+}
+
+// Mismatches returns the tables that differ.
+func (r *Report) Mismatches() []TableDiff {
+	var bad []TableDiff
+	for _, t := range r.Tables {
+		if t.Status != Match && t.Status != NotComparable {
+			bad = append(bad, t)
+		}
+	}
+	return bad
+}
+
+// NotComparable returns the tables whose checksums cannot be compared.
+func (r *Report) NotComparable() []TableDiff {
+	var skipped []TableDiff
+	for _, t := range r.Tables {
+		if t.Status == NotComparable {
+			skipped = append(skipped, t)
+		}
+	}
+	return skipped
+}
+
+// Diff compares the checksums of the source with those of the target,
+// sorted by table.
+func Diff(source, target []pgbackup.TableChecksum) []TableDiff {
+	targets := map[string]pgbackup.TableChecksum{}
+	for _, t := range target {
+		targets[t.Table] = t
+	}
+	var diffs []TableDiff
+	for _, s := range source {
+		d := TableDiff{Table: s.Table, SourceRows: s.Rows, SourceChecksum: s.Checksum, Sample: s.Sample}
+		t, ok := targets[s.Table]
+		delete(targets, s.Table)
+		switch {
+		case !ok:
+			d.Status = Missing
+		case s.Rows != t.Rows:
+			d.Status = RowsDiffer
+		case s.Sample != t.Sample:
+			d.Status = NotComparable
+		case s.Checksum != t.Checksum:
+			d.Status = ChecksumDiffers
+		default:
+			d.Status = Match
+		}
+		if ok {
+			d.TargetRows, d.TargetChecksum = t.Rows, t.Checksum
+		}
+		diffs = append(diffs, d)
+	}
+	for _, t := range targets {
+		diffs = append(diffs, TableDiff{Table: t.Table, Status: Extra, TargetRows: t.Rows, TargetChecksum: t.Checksum})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Table < diffs[j].Table })
+	return diffs
+}
+
+// Database is a connection to one of the compared databases.
+type Database struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DBName   string
+}
+
+func (d Database) String() string {
+	return fmt.Sprintf("%s:%d/%s", d.Host, d.Port, d.DBName)
+}
+
+func (d Database) checksums(opts pgbackup.ChecksumOptions) ([]pgbackup.TableChecksum, error) {
+	sums, err := pgbackup.ReadTableChecksums(context.Background(), d.Host, d.Port, d.User, d.Password, d.DBName, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", d, err)
+	}
+	return sums, nil
+}
+
+// samples returns the sample each table was hashed with, so the other side
+// is hashed the same way.
+func samples(sums []pgbackup.TableChecksum) map[string]float64 {
+	m := make(map[string]float64, len(sums))
+	for _, s := range sums {
+		m[s.Table] = s.Sample
+	}
+	return m
+}
+
+// Databases compares two live databases. Which tables are sampled is
+// decided on the source.
+func Databases(source, target Database, opts pgbackup.ChecksumOptions) (*Report, error) {
+	sourceSums, err := source.checksums(opts)
+	if err != nil {
+		return nil, err
+	}
+	targetSums, err := target.checksums(pgbackup.ChecksumOptions{Samples: samples(sourceSums)})
+	if err != nil {
+		return nil, err
+	}
+	return &Report{Source: source.String(), Target: target.String(), CreatedAt: time.Now(), Tables: Diff(sourceSums, targetSums)}, nil
+}
+
+// Manifest compares the checksums recorded in a backup's manifest with a
+// live database, sampling the tables the backup sampled.
+func Manifest(m *pgbackup.Manifest, target Database) (*Report, error) {
+	if len(m.Tables) == 0 {
+		return nil, fmt.Errorf("the backup %s has no table checksums; take it with checksums to compare it", m.File)
+	}
+	targetSums, err := target.checksums(pgbackup.ChecksumOptions{Samples: samples(m.Tables)})
+	if err != nil {
+		return nil, err
+	}
+	return &Report{Source: "backup " + m.File, Target: target.String(), CreatedAt: time.Now(), Tables: Diff(m.Tables, targetSums)}, nil
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Save writes the report as JSON into dir, named after the target and time,
+// and returns its path.
+func (r *Report) Save(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(r.Target)
+	path := filepath.Join(dir, fmt.Sprintf("compare-%s-%s.json", name, r.CreatedAt.Format("20060102-150405")))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	if err := r.WriteJSON(f); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	return path, f.Close()
+}
+
+// WriteTable writes the report as a text table, listing only the tables
+// that differ unless all is set.
+func (r *Report) WriteTable(w io.Writer, all bool) {
+	fmt.Fprintf(w, "%-40s %-16s %12s %12s\n", "TABLE", "STATUS", "SOURCE ROWS", "TARGET ROWS")
+	for _, t := range r.Tables {
+		if t.Status == Match && !all {
+			continue
+		}
+		fmt.Fprintf(w, "%-40s %-16s %12d %12d\n", t.Table, t.Status, t.SourceRows, t.TargetRows)
+	}
+	fmt.Fprintln(w, r.Summary())
+}
+
+// Summary is a one-line account of the report.
+func (r *Report) Summary() string {
+	bad := len(r.Mismatches())
+	sampled := 0
+	for _, t := range r.Tables {
+		if t.Sample > 0 {
+			sampled++
+		}
+	}
+	skipped := len(r.NotComparable())
+	line := fmt.Sprintf("%d of %d tables match", len(r.Tables)-bad-skipped, len(r.Tables))
+	if skipped > 0 {
+		line += fmt.Sprintf(", %d not comparable", skipped)
+	}
+	if sampled > 0 {
+		line += fmt.Sprintf(" (%d sampled)", sampled)
+	}
+	return line
+}
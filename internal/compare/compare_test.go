@@ -0,0 +1,80 @@
+package compare
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+func TestDiff(t *testing.T) {
+	source := []pgbackup.TableChecksum{
+		{Table: "public.orders", Rows: 10, Checksum: "100", Sample: 10},
+		{Table: "public.customers", Rows: 3, Checksum: "30"},
+		{Table: "public.items", Rows: 5, Checksum: "50"},
+		{Table: "public.audit", Rows: 1, Checksum: "1"},
+		{Table: "public.log", Rows: 20, Checksum: "2", Sample: 10},
+	}
+	target := []pgbackup.TableChecksum{
+		{Table: "public.orders", Rows: 10, Checksum: "100", Sample: 10},
+		{Table: "public.customers", Rows: 3, Checksum: "31"},
+		{Table: "public.items", Rows: 4, Checksum: "40"},
+		{Table: "public.sessions", Rows: 7, Checksum: "70"},
+		{Table: "public.log", Rows: 20, Checksum: "20"}, // No primary key to sample by
+	}
+	got := map[string]Status{}
+	report := &Report{Source: "backup shop.sql", Target: "localhost:5432/shop", Tables: Diff(source, target)}
+	for _, d := range report.Tables {
+		got[d.Table] = d.Status
+	}
+	want := map[string]Status{
+		"public.orders":    Match,
+		"public.customers": ChecksumDiffers,
+		"public.items":     RowsDiffer,
+		"public.audit":     Missing,
+		"public.sessions":  Extra,
+		"public.log":       NotComparable,
+	}
+	for table, status := range want {
+		if got[table] != status {
+			t.Errorf("%s: %q, want %q", table, got[table], status)
+		}
+	}
+	if report.Tables[0].Table != "public.audit" {
+		t.Errorf("tables not sorted: %v", report.Tables)
+	}
+	if len(report.Mismatches()) != 4 {
+		t.Errorf("%d mismatches, want 4", len(report.Mismatches()))
+	}
+	if s := report.Summary(); s != "1 of 6 tables match, 1 not comparable (2 sampled)" {
+		t.Errorf("summary %q", s)
+	}
+
+	var table bytes.Buffer
+	report.WriteTable(&table, false)
+	if strings.Contains(table.String(), "public.orders") || !strings.Contains(table.String(), "public.items") {
+		t.Errorf("table:\n%s", table.String())
+	}
+
+	path, err := report.Save(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Report
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved.Tables) != 6 || saved.Tables[5].Status != Extra {
+		t.Errorf("saved report %s: %v", data, err)
+	}
+}
+
+func TestManifestWithoutChecksums(t *testing.T) {
+	if _, err := Manifest(&pgbackup.Manifest{File: "shop.sql"}, Database{}); err == nil {
+		t.Error("expected an error for a backup without table checksums")
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/compare"
+	"github.com/curtisbraxdale/go-pg-backup/internal/hooks"
+	"github.com/curtisbraxdale/go-pg-backup/internal/notify"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+	"github.com/curtisbraxdale/go-pg-backup/internal/rpo"
+)
+
+// Config holds the user's persistent settings for the wizard.
+type Config struct {
+	// ProtectedTargets lists "host/database" glob patterns that destructive
+	// operations refuse to touch. A pattern without a slash matches the
+	// database name on any host.
+	ProtectedTargets []string `json:"protected_targets"`
+
+	// SafetyBackupDir is where automatic backups are written before a
+	// database is dropped. Empty means next to the backup being restored.
+	SafetyBackupDir string `json:"safety_backup_dir"`
+
+	// SwapValidationQueries are run against the staging database of a
+	// "restore then swap" before it replaces the target. A query fails the
+	// swap if it errors or returns false.
+	SwapValidationQueries []string `json:"swap_validation_queries"`
+
+	// PostRestore selects the maintenance run on a database after it is
+	// restored: ANALYZE, sequence resets, REINDEX and validation checks.
+	PostRestore pgrestore.Maintenance `json:"post_restore"`
+
+	// Compare controls the row-count and checksum comparison of restored
+	// data with its backup.
+	Compare compare.Settings `json:"compare"`
+
+	// ClientBinDirs are extra directories searched for pg_dump and psql, in
+	// addition to PATH and the usual PostgreSQL install locations.
+	ClientBinDirs []string `json:"client_bin_dirs"`
+
+	// MaskingDir holds the masking rulesets offered for backups, one JSON
+	// file per ruleset. Empty means a "masking" directory next to the config file.
+	MaskingDir string `json:"masking_dir"`
+
+	// ArchiveDir holds the base backups and archived WAL used for
+	// point-in-time recovery. archive-wal stores WAL segments here.
+	ArchiveDir string `json:"archive_dir"`
+
+	// SigningKey is the Ed25519 private key (PEM) that signs the manifest
+	// of every backup. Empty leaves backups unsigned.
+	SigningKey string `json:"signing_key"`
+
+	// TrustedKeys are the Ed25519 public keys (PEM) whose signatures verify.
+	// The public half of SigningKey is always trusted.
+	TrustedKeys []string `json:"trusted_keys"`
+
+	// Notifications are told about the outcome of command-line backups and
+	// restores, each filtered by its own triggers.
+	Notifications []notify.Target `json:"notifications"`
+
+	// MetricsState is the file recording the outcome of every run for the
+	// metrics endpoint. Empty means "metrics.json" next to the config file.
+	MetricsState string `json:"metrics_state"`
+
+	// MetricsTextfile, if set, is rewritten with the metrics after every
+	// command-line run, for node_exporter's textfile collector.
+	MetricsTextfile string `json:"metrics_textfile"`
+
+	// RPO lists the recovery point objectives checked by the check command
+	// and by metrics serve.
+	RPO []rpo.Policy `json:"rpo"`
+
+	// Hooks are commands and SQL scripts run before and after backups,
+	// restores and verifications.
+	Hooks []hooks.Hook `json:"hooks"`
+}
+
+// Default returns the settings used when no config file exists.
+func Default() Config {
+	return Config{
+		ProtectedTargets: []string{"*prod*/*", "*/*prod*"},
+	}
+}
+
+// Path returns the location of the config file. GO_PG_BACKUP_CONFIG overrides
+// the default of <user config dir>/go-pg-backup/config.json.
+func Path() (string, error) {
+	if p := os.Getenv("GO_PG_BACKUP_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(dir, "go-pg-backup", "config.json"), nil
+}
+
+// MaskingRulesDir returns the directory holding the masking rulesets.
+func (c Config) MaskingRulesDir() (string, error) {
+	if c.MaskingDir != "" {
+		return c.MaskingDir, nil
+	}
+	path, err := Path()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "masking"), nil
+}
+
+// MetricsStatePath returns the file recording the metrics.
+func (c Config) MetricsStatePath() (string, error) {
+	if c.MetricsState != "" {
+		return c.MetricsState, nil
+	}
+	path, err := Path()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "metrics.json"), nil
+}
+
+// Load reads the config file, falling back to Default if it does not exist.
+func Load() (Config, error) {
+	cfg := Default()
+	path, err := Path()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
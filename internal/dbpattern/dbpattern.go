@@ -0,0 +1,39 @@
+// Package dbpattern matches databases against the "host/database" glob
+// patterns used throughout the configuration: protected targets, hook and
+// notification jobs, recovery point objectives and catalog searches.
+package dbpattern
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether host/database matches pattern, a "host/database"
+// glob pattern. A pattern without a slash matches the database name on any
+// host. The only possible error is path.ErrBadPattern.
+func Match(pattern, host, database string) (bool, error) {
+	hostPattern, dbPattern, found := strings.Cut(pattern, "/")
+	if !found {
+		hostPattern, dbPattern = "*", pattern
+	}
+	hostMatch, err := path.Match(hostPattern, host)
+	if err != nil {
+		return false, err
+	}
+	dbMatch, err := path.Match(dbPattern, database)
+	if err != nil {
+		return false, err
+	}
+	return hostMatch && dbMatch, nil
+}
+
+// MatchAny reports whether host/database matches one of patterns. Malformed
+// patterns match nothing.
+func MatchAny(patterns []string, host, database string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := Match(pattern, host, database); ok {
+			return true
+		}
+	}
+	return false
+}
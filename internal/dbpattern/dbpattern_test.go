@@ -0,0 +1,28 @@
+package dbpattern
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, host, database string
+		want                    bool
+	}{
+		{"shop", "db1", "shop", true},
+		{"shop", "db1", "shop_dev", false},
+		{"db1/*", "db1", "shop", true},
+		{"db1/*", "db2", "shop", false},
+		{"*prod*/shop", "db.prod.local", "shop", true},
+		{"*/crm", "db1", "shop", false},
+	}
+	for _, c := range cases {
+		if got, err := Match(c.pattern, c.host, c.database); err != nil || got != c.want {
+			t.Errorf("Match(%q, %q, %q) = %v, %v; want %v", c.pattern, c.host, c.database, got, err, c.want)
+		}
+	}
+	if _, err := Match("db1/[", "db1", "shop"); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+	if !MatchAny([]string{"[", "crm", "db1/shop"}, "db1", "shop") || MatchAny(nil, "db1", "shop") {
+		t.Error("MatchAny does not try every pattern")
+	}
+}
@@ -0,0 +1,285 @@
+// Package hooks runs user-configured shell commands and SQL scripts before
+// and after backups, restores and verifications, e.g. to pause application
+// workers or refresh materialized views.
+package hooks
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/dbpattern"
+)
+
+// Phase is when a hook runs relative to its operation.
+type Phase string
+
+const (
+	Before Phase = "before"
+	After  Phase = "after"
+)
+
+// DefaultTimeout bounds a hook without a timeout of its own.
+const DefaultTimeout = 5 * time.Minute
+
+// Hook is a configured command or SQL script.
+type Hook struct {
+	Name string `json:"name"`
+	When Phase  `json:"when"` // "before" or "after"
+
+	// Operations lists the operations the hook runs for: "backup",
+	// "restore", "verify" and "export". Empty means all of them.
+	Operations []string `json:"operations"`
+	// Jobs restricts the hook to "host/database" glob patterns. A pattern
+	// without a slash matches the database name on any host.
+	Jobs []string `json:"jobs"`
+
+	// Exactly one of Command, SQL and SQLFile is set. Command runs in the
+	// shell; SQL and SQLFile run against the operation's database.
+	Command string `json:"command"`
+	SQL     string `json:"sql"`
+	SQLFile string `json:"sql_file"`
+
+	Timeout Duration `json:"timeout"`
+
+	// OnFailure is "abort" (the default) to fail the operation when the
+	// hook fails, or "continue" to only report the failure. A failed
+	// "before" hook that aborts stops the operation from starting.
+	OnFailure string `json:"on_failure"`
+}
+
+// Duration is a time.Duration written as "30s" or "5m" in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (h Hook) label() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	if h.Command != "" {
+		return h.Command
+	}
+	if h.SQLFile != "" {
+		return h.SQLFile
+	}
+	return "sql hook"
+}
+
+// aborts reports whether a failure of the hook fails the operation.
+func (h Hook) aborts() bool {
+	return h.OnFailure != "continue"
+}
+
+// Job describes the operation the hooks run around. It is passed to shell
+// hooks as GO_PG_BACKUP_* environment variables, and the connection also as
+// the PG* variables psql reads.
+type Job struct {
+	Operation string // "backup", "restore", "verify" or "export"
+	Host      string
+	Port      int
+	User      string
+	Password  string
+	Database  string
+	File      string // Backup file written, restored or verified, or export directory
+
+	// Status and Error describe the outcome, for "after" hooks.
+	Status string // "success" or "failure"
+	Error  string
+}
+
+// Finish records the outcome of the operation for the "after" hooks.
+func (j *Job) Finish(err error) {
+	j.Status, j.Error = "success", ""
+	if err != nil {
+		j.Status, j.Error = "failure", err.Error()
+	}
+}
+
+func (j Job) env(phase Phase) []string {
+	env := []string{
+		"GO_PG_BACKUP_OPERATION=" + j.Operation,
+		"GO_PG_BACKUP_PHASE=" + string(phase),
+		"GO_PG_BACKUP_HOST=" + j.Host,
+		"GO_PG_BACKUP_PORT=" + strconv.Itoa(j.Port),
+		"GO_PG_BACKUP_USER=" + j.User,
+		"GO_PG_BACKUP_DATABASE=" + j.Database,
+		"GO_PG_BACKUP_FILE=" + j.File,
+		"GO_PG_BACKUP_STATUS=" + j.Status,
+		"GO_PG_BACKUP_ERROR=" + j.Error,
+	}
+	if j.Database != "" {
+		env = append(env,
+			"PGHOST="+j.Host,
+			"PGPORT="+strconv.Itoa(j.Port),
+			"PGUSER="+j.User,
+			"PGDATABASE="+j.Database,
+			"PGPASSWORD="+j.Password,
+		)
+	}
+	return env
+}
+
+// matches reports whether the hook runs in phase for job.
+func (h Hook) matches(phase Phase, job Job) bool {
+	if h.When != phase {
+		return false
+	}
+	if len(h.Operations) > 0 && !slices.Contains(h.Operations, job.Operation) {
+		return false
+	}
+	return len(h.Jobs) == 0 || dbpattern.MatchAny(h.Jobs, job.Host, job.Database)
+}
+
+// Validate checks the hooks' settings.
+func Validate(hooks []Hook) error {
+	for _, h := range hooks {
+		set := 0
+		for _, s := range []string{h.Command, h.SQL, h.SQLFile} {
+			if s != "" {
+				set++
+			}
+		}
+		switch {
+		case set != 1:
+			return fmt.Errorf("hook %s: exactly one of command, sql and sql_file is required", h.label())
+		case h.When != Before && h.When != After:
+			return fmt.Errorf("hook %s: when must be \"before\" or \"after\"", h.label())
+		case h.OnFailure != "" && h.OnFailure != "abort" && h.OnFailure != "continue":
+			return fmt.Errorf("hook %s: on_failure must be \"abort\" or \"continue\"", h.label())
+		}
+	}
+	return nil
+}
+
+// Run runs the hooks for phase and job in order, passing each line of their
+// output to output. It stops at the first failed hook whose policy aborts
+// and returns its error; other failures are reported through output.
+func Run(hooks []Hook, phase Phase, job Job, output func(line string)) error {
+	if err := Validate(hooks); err != nil {
+		return err
+	}
+	for _, h := range hooks {
+		if !h.matches(phase, job) {
+			continue
+		}
+		output(fmt.Sprintf("Running %s hook %s", phase, h.label()))
+		start := time.Now()
+		err := runHook(h, phase, job, output)
+		if err == nil {
+			output(fmt.Sprintf("Hook %s finished in %s", h.label(), time.Since(start).Round(time.Millisecond)))
+			continue
+		}
+		err = fmt.Errorf("hook %s failed: %w", h.label(), err)
+		if h.aborts() {
+			return err
+		}
+		output(err.Error() + " (continuing)")
+	}
+	return nil
+}
+
+func runHook(h Hook, phase Phase, job Job, output func(string)) error {
+	timeout := time.Duration(h.Timeout)
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+	if h.Command != "" {
+		err = runCommand(ctx, h.Command, job.env(phase), output)
+	} else {
+		err = runSQL(ctx, h, job)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
+
+func runCommand(ctx context.Context, command string, env []string, output func(string)) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	// Children of the shell may hold the pipe open after it is killed.
+	cmd.WaitDelay = 5 * time.Second
+
+	pr, pw := io.Pipe()
+	cmd.Stdout, cmd.Stderr = pw, pw
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+		for scanner.Scan() {
+			output("  " + scanner.Text())
+		}
+		io.Copy(io.Discard, pr)
+	}()
+	err := cmd.Run()
+	pw.Close()
+	wg.Wait()
+	return err
+}
+
+func runSQL(ctx context.Context, h Hook, job Job) error {
+	script := h.SQL
+	if h.SQLFile != "" {
+		data, err := os.ReadFile(h.SQLFile)
+		if err != nil {
+			return err
+		}
+		script = string(data)
+	}
+	if job.Database == "" {
+		return fmt.Errorf("a SQL hook needs a database, and %s has none", job.Operation)
+	}
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		job.Host, job.Port, job.User, job.Password, job.Database)
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+	// Without parameters the script is sent as one simple query, so it may
+	// hold several statements.
+	if _, err := db.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	return nil
+}
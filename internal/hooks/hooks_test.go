@@ -0,0 +1,79 @@
+package hooks
+
+import (
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are written for sh")
+	}
+	var hooks []Hook
+	err := json.Unmarshal([]byte(`[
+		{"name": "pause", "when": "before", "operations": ["restore"], "command": "echo pausing $GO_PG_BACKUP_DATABASE on $PGHOST:$PGPORT"},
+		{"name": "other", "when": "before", "jobs": ["other/*"], "command": "echo never"},
+		{"name": "flaky", "when": "before", "command": "echo oops >&2; exit 3", "on_failure": "continue"},
+		{"name": "resume", "when": "after", "command": "echo $GO_PG_BACKUP_STATUS: $GO_PG_BACKUP_ERROR"}
+	]`), &hooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := Job{Operation: "restore", Host: "db.local", Port: 5432, User: "app", Database: "shop"}
+
+	var lines []string
+	output := func(line string) { lines = append(lines, line) }
+	if err := Run(hooks, Before, job, output); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(lines, "\n")
+	for _, want := range []string{"  pausing shop on db.local:5432", "  oops", "hook flaky failed: exit status 3 (continuing)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "never") || strings.Contains(out, "resume") {
+		t.Errorf("unexpected hook ran:\n%s", out)
+	}
+
+	lines = nil
+	job.Finish(errTest("disk full"))
+	if err := Run(hooks, After, job, output); err != nil {
+		t.Fatal(err)
+	}
+	if out := strings.Join(lines, "\n"); !strings.Contains(out, "  failure: disk full") {
+		t.Errorf("output:\n%s", out)
+	}
+}
+
+func TestRunAborts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are written for sh")
+	}
+	hooks := []Hook{
+		{Name: "slow", When: Before, Command: "sleep 5", Timeout: Duration(100e6)},
+		{Name: "next", When: Before, Command: "echo next"},
+	}
+	var lines []string
+	err := Run(hooks, Before, Job{Operation: "backup"}, func(line string) { lines = append(lines, line) })
+	if err == nil || !strings.Contains(err.Error(), "hook slow failed: timed out after 100ms") {
+		t.Fatalf("got %v", err)
+	}
+	if strings.Contains(strings.Join(lines, "\n"), "next") {
+		t.Error("a hook ran after an aborting failure")
+	}
+
+	sqlHook := []Hook{{When: After, SQL: "REFRESH MATERIALIZED VIEW totals"}}
+	if err := Run(sqlHook, After, Job{Operation: "verify"}, func(string) {}); err == nil {
+		t.Error("expected a SQL hook without a database to fail")
+	}
+	if err := Validate([]Hook{{When: Before, Command: "true", SQL: "SELECT 1"}}); err == nil {
+		t.Error("expected a hook with both command and sql to be rejected")
+	}
+}
+
+type errTest string
+
+func (e errTest) Error() string { return string(e) }
@@ -0,0 +1,49 @@
+// Package lockfile serialises updates of a small state file between
+// processes with an exclusive lock file next to it.
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// StaleAfter is how old a lock file must be before it is taken to be left
+// behind by a process that died holding it. Holders only keep the lock
+// while they rewrite a small file.
+const StaleAfter = 10 * time.Second
+
+// Lock takes the lock of path, path+".lock", waiting while another process
+// holds it. The returned function releases it.
+func Lock(path string) (func(), error) {
+	lock := path + ".lock"
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > StaleAfter {
+			steal(lock, info)
+			continue
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// steal removes the stale lock file. It is renamed aside first, so of the
+// processes finding it stale only one removes it, and a fresh lock taken
+// since it was found is put back.
+func steal(lock string, stale os.FileInfo) {
+	aside := fmt.Sprintf("%s.stale-%d", lock, os.Getpid())
+	if err := os.Rename(lock, aside); err != nil {
+		return // Another process stole or released it first
+	}
+	if info, err := os.Stat(aside); err == nil && !os.SameFile(info, stale) {
+		os.Link(aside, lock) // Fails if yet another lock was taken, which then stands
+	}
+	os.Remove(aside)
+}
@@ -0,0 +1,78 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLock verifies concurrent holders take turns and a lock left behind
+// is only stolen once it is stale.
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	if err := os.WriteFile(path, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := Lock(path)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+			data, _ := os.ReadFile(path)
+			n, _ := strconv.Atoi(string(data))
+			time.Sleep(time.Millisecond)
+			os.WriteFile(path, []byte(strconv.Itoa(n+1)), 0644)
+		}()
+	}
+	wg.Wait()
+	if data, _ := os.ReadFile(path); string(data) != "8" {
+		t.Errorf("counter is %s after 8 locked increments", data)
+	}
+
+	// A fresh lock is waited for.
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan func())
+	go func() {
+		next, err := Lock(path)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- next
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("a held lock was taken")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	(<-acquired)()
+
+	// A stale one is stolen.
+	lock := path + ".lock"
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * StaleAfter)
+	os.Chtimes(lock, old, old)
+	unlock, err = Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if matches, _ := filepath.Glob(lock + "*"); len(matches) != 0 {
+		t.Errorf("lock files left behind: %q", matches)
+	}
+}
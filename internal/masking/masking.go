@@ -0,0 +1,222 @@
+package masking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Transform names, as written in a rules file.
+const (
+	TransformEmail     = "email"     // A fake address derived from the value
+	TransformHash      = "hash"      // Hex HMAC-SHA256 of the value
+	TransformNull      = "null"      // NULL
+	TransformFixed     = "fixed"     // Rule.Value
+	TransformPartial   = "partial"   // Keep the first and last characters, star out the rest
+	TransformPseudonym = "pseudonym" // A fake "First Last" name derived from the value
+)
+
+// Rule says how one column is masked.
+type Rule struct {
+	Transform string `json:"transform"`
+	Value     string `json:"value,omitempty"`      // For TransformFixed
+	KeepFirst int    `json:"keep_first,omitempty"` // For TransformPartial
+	KeepLast  int    `json:"keep_last,omitempty"`  // For TransformPartial, 4 when both are zero
+	Length    int    `json:"length,omitempty"`     // For TransformHash, truncates the digest
+}
+
+// Ruleset maps columns to masking rules. Columns are keyed by
+// "schema.table.column" and may use path.Match wildcards, such as
+// "*.*.email". An exact key takes precedence over a pattern.
+type Ruleset struct {
+	Name string `json:"-"` // File name without extension
+
+	// Salt keys the derived values. The same value masks to the same result
+	// wherever it appears, so joins on masked columns still match, but it
+	// cannot be recovered without the salt.
+	Salt    string          `json:"salt"`
+	Columns map[string]Rule `json:"columns"`
+}
+
+// Load reads and validates a rules file.
+func Load(file string) (*Ruleset, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read masking rules: %w", err)
+	}
+	rs := &Ruleset{Name: strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))}
+	if err := json.Unmarshal(data, rs); err != nil {
+		return nil, fmt.Errorf("failed to parse masking rules %s: %w", file, err)
+	}
+	if len(rs.Columns) == 0 {
+		return nil, fmt.Errorf("masking rules %s mask no columns", file)
+	}
+	for column, rule := range rs.Columns {
+		if strings.Count(column, ".") != 2 {
+			return nil, fmt.Errorf("masking rules %s: column %q must be schema.table.column", file, column)
+		}
+		if _, err := rs.transformer(rule); err != nil {
+			return nil, fmt.Errorf("masking rules %s: column %s: %w", file, column, err)
+		}
+		// Without a salt, derived values can be reversed by hashing guesses.
+		if rs.Salt == "" && derived(rule.Transform) {
+			return nil, fmt.Errorf("masking rules %s: column %s: the %s transform requires a salt", file, column, rule.Transform)
+		}
+	}
+	return rs, nil
+}
+
+// derived reports whether a transform derives its result from the value
+// through the salt.
+func derived(transform string) bool {
+	return transform == TransformEmail || transform == TransformHash || transform == TransformPseudonym
+}
+
+// List returns the names of the rules files in dir, sorted.
+func List(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, m := range matches {
+		names = append(names, strings.TrimSuffix(filepath.Base(m), ".json"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Find loads the ruleset named nameOrPath from dir, or from the path itself
+// if it names a file.
+func Find(dir, nameOrPath string) (*Ruleset, error) {
+	if strings.ContainsRune(nameOrPath, filepath.Separator) || strings.HasSuffix(nameOrPath, ".json") {
+		return Load(nameOrPath)
+	}
+	return Load(filepath.Join(dir, nameOrPath+".json"))
+}
+
+// Rule returns the rule for a column, if any.
+func (rs *Ruleset) Rule(schema, table, column string) (Rule, bool) {
+	key := schema + "." + table + "." + column
+	if rule, ok := rs.Columns[key]; ok {
+		return rule, true
+	}
+	patterns := make([]string, 0, len(rs.Columns))
+	for pattern := range rs.Columns {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return rs.Columns[pattern], true
+		}
+	}
+	return Rule{}, false
+}
+
+// Unapplied returns the exact column keys of the ruleset missing from
+// masked, sorted. A rule naming a column the dump does not hold is most
+// likely a typo or a renamed column, whose data went out unmasked.
+func (rs *Ruleset) Unapplied(masked []string) []string {
+	applied := map[string]bool{}
+	for _, column := range masked {
+		applied[column] = true
+	}
+	var missing []string
+	for column := range rs.Columns {
+		if !strings.ContainsAny(column, "*?[") && !applied[column] {
+			missing = append(missing, column)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// transformer maps a column value to its masked value. A nil result is NULL.
+type transformer func(value []byte) []byte
+
+func (rs *Ruleset) transformer(rule Rule) (transformer, error) {
+	switch rule.Transform {
+	case TransformEmail:
+		return func(v []byte) []byte {
+			return []byte("user_" + hex.EncodeToString(rs.mac(v)[:6]) + "@example.com")
+		}, nil
+	case TransformHash:
+		if rule.Length < 0 {
+			return nil, fmt.Errorf("length must not be negative")
+		}
+		return func(v []byte) []byte {
+			digest := hex.EncodeToString(rs.mac(v))
+			if rule.Length > 0 && rule.Length < len(digest) {
+				digest = digest[:rule.Length]
+			}
+			return []byte(digest)
+		}, nil
+	case TransformNull:
+		return func([]byte) []byte { return nil }, nil
+	case TransformFixed:
+		value := []byte(rule.Value)
+		return func([]byte) []byte { return value }, nil
+	case TransformPartial:
+		if rule.KeepFirst < 0 || rule.KeepLast < 0 {
+			return nil, fmt.Errorf("keep_first and keep_last must not be negative")
+		}
+		first, last := rule.KeepFirst, rule.KeepLast
+		if first == 0 && last == 0 {
+			last = 4
+		}
+		return func(v []byte) []byte { return redact(v, first, last) }, nil
+	case TransformPseudonym:
+		return func(v []byte) []byte {
+			sum := rs.mac(v)
+			given := givenNames[binary.BigEndian.Uint32(sum[0:4])%uint32(len(givenNames))]
+			family := familyNames[binary.BigEndian.Uint32(sum[4:8])%uint32(len(familyNames))]
+			return []byte(given + " " + family)
+		}, nil
+	case "":
+		return nil, fmt.Errorf("missing transform")
+	default:
+		return nil, fmt.Errorf("unknown transform %q, expected email, hash, null, fixed, partial or pseudonym", rule.Transform)
+	}
+}
+
+func (rs *Ruleset) mac(v []byte) []byte {
+	h := hmac.New(sha256.New, []byte(rs.Salt))
+	h.Write(v)
+	return h.Sum(nil)
+}
+
+// redact replaces all but the first and last characters of v with '*'. A
+// value too short to keep anything is starred out entirely.
+func redact(v []byte, first, last int) []byte {
+	runes := []rune(string(v))
+	if first+last >= len(runes) {
+		first, last = 0, 0
+	}
+	for i := first; i < len(runes)-last; i++ {
+		runes[i] = '*'
+	}
+	return []byte(string(runes))
+}
+
+var givenNames = []string{
+	"Alex", "Avery", "Blake", "Casey", "Charlie", "Dana", "Drew", "Eden",
+	"Emery", "Finley", "Frankie", "Harper", "Hayden", "Jamie", "Jesse", "Jordan",
+	"Kai", "Kendall", "Logan", "Morgan", "Noel", "Parker", "Quinn", "Reese",
+	"Riley", "Robin", "Rowan", "Sage", "Sam", "Skyler", "Taylor", "Tatum",
+}
+
+var familyNames = []string{
+	"Abbott", "Baker", "Bishop", "Carter", "Chen", "Dalton", "Ellis", "Fischer",
+	"Garcia", "Hale", "Ibarra", "Jensen", "Keller", "Larsen", "Moreau", "Nakamura",
+	"Novak", "Okafor", "Patel", "Quinlan", "Reyes", "Santos", "Schmidt", "Silva",
+	"Tanaka", "Turner", "Umar", "Vance", "Walsh", "Weber", "Young", "Zhang",
+}
@@ -0,0 +1,147 @@
+package masking
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestWriter verifies COPY data is masked as it streams and the rest of the
+// dump is left alone.
+func TestWriter(t *testing.T) {
+	rules := `{
+		"salt": "pepper",
+		"columns": {
+			"public.users.email": {"transform": "email"},
+			"public.users.phone": {"transform": "partial", "keep_last": 2},
+			"public.users.notes": {"transform": "null"},
+			"*.*.api_key": {"transform": "fixed", "value": "x\ty"}
+		}
+	}`
+	path := filepath.Join(t.TempDir(), "contractors.json")
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Name != "contractors" {
+		t.Errorf("unexpected ruleset name %q", rs.Name)
+	}
+
+	dump := "CREATE TABLE public.users (id integer);\n" +
+		"COPY public.users (id, email, phone, notes, api_key) FROM stdin;\n" +
+		"1\tann@corp.com\t555-1234\tlikes\\ttabs\tsecret\n" +
+		"2\t\\N\tab\t\\N\tsecret\n" +
+		"\\.\n" +
+		"COPY \"Other\".\"T\" (email) FROM stdin;\n" +
+		"kept@corp.com\n" +
+		"\\.\n"
+
+	var out bytes.Buffer
+	w := NewWriter(&out, rs)
+	// Write in small pieces to exercise lines split across writes.
+	for i := 0; i < len(dump); i += 7 {
+		end := min(i+7, len(dump))
+		if _, err := w.Write([]byte(dump[i:end])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	row1 := strings.Split(lines[2], "\t")
+	if !strings.HasPrefix(row1[1], "user_") || !strings.HasSuffix(row1[1], "@example.com") {
+		t.Errorf("email not masked: %q", row1[1])
+	}
+	if row1[2] != "******34" || row1[3] != `\N` || row1[4] != `x\ty` {
+		t.Errorf("unexpected masked row %q", lines[2])
+	}
+	if lines[3] != "2\t\\N\t**\t\\N\tx\\ty" {
+		t.Errorf("unexpected masked row %q", lines[3])
+	}
+	if lines[6] != "kept@corp.com" {
+		t.Errorf("unmatched table was masked: %q", lines[6])
+	}
+	if got := strings.Join(w.Masked(), ","); got != "public.users.api_key,public.users.email,public.users.notes,public.users.phone" {
+		t.Errorf("unexpected masked columns %s", got)
+	}
+
+	// Derived values are deterministic for a salt.
+	again, _ := rs.transformer(Rule{Transform: TransformEmail})
+	if got := string(again([]byte("ann@corp.com"))); got != row1[1] {
+		t.Errorf("email masking is not deterministic: %q vs %q", got, row1[1])
+	}
+}
+
+// TestLoadRejectsBadRules verifies rules files are validated up front.
+func TestLoadRejectsBadRules(t *testing.T) {
+	for _, rules := range []string{
+		`{"columns": {"users.email": {"transform": "email"}}}`,
+		`{"columns": {"public.users.email": {"transform": "scramble"}}}`,
+		`{"columns": {}}`,
+		`{"columns": {"public.users.email": {"transform": "hash"}}}`,
+	} {
+		path := filepath.Join(t.TempDir(), "bad.json")
+		if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("expected an error for %s", rules)
+		}
+	}
+}
+
+// TestWriterSearchPath verifies unqualified COPY blocks are matched in the
+// schema of the script's search_path, and rejected without one.
+func TestWriterSearchPath(t *testing.T) {
+	rs := &Ruleset{Salt: "pepper", Columns: map[string]Rule{
+		"sales.users.email": {Transform: TransformNull},
+		"sales.users.phone": {Transform: TransformNull},
+	}}
+	dump := "SET search_path = sales, pg_catalog;\n" +
+		"COPY users (id, email) FROM stdin;\n" +
+		"1\tann@corp.com\n" +
+		"\\.\n"
+	var out bytes.Buffer
+	w := NewWriter(&out, rs)
+	if _, err := w.Write([]byte(dump)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "1\t\\N\n") {
+		t.Errorf("email in sales.users not masked:\n%s", out.String())
+	}
+	if got := rs.Unapplied(w.Masked()); len(got) != 1 || got[0] != "sales.users.phone" {
+		t.Errorf("unapplied rules %v, want sales.users.phone", got)
+	}
+
+	for _, dump := range []string{
+		"SELECT pg_catalog.set_config('search_path', '', false);\nCOPY users (id, email) FROM stdin;\n",
+		"COPY sales.users FROM stdin;\n",
+	} {
+		if _, err := NewWriter(io.Discard, rs).Write([]byte(dump)); err == nil {
+			t.Errorf("expected an error for %q", dump)
+		}
+	}
+}
+
+// TestDecodeCopyField verifies COPY text escapes round-trip.
+func TestDecodeCopyField(t *testing.T) {
+	raw := []byte(`a\\b\tc\nd\101\x42`)
+	decoded := decodeCopyField(raw)
+	if string(decoded) != "a\\b\tc\ndAB" {
+		t.Errorf("unexpected decoded value %q", decoded)
+	}
+	if got := string(encodeCopyField([]byte("a\\b\tc\nd"))); got != `a\\b\tc\nd` {
+		t.Errorf("unexpected encoded value %q", got)
+	}
+}
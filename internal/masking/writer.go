@@ -0,0 +1,340 @@
+package masking
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Writer masks the COPY data of a plain SQL dump written through it, such as
+// the output of pg_dump or the Go dump engine, and passes everything else
+// through unchanged. Rows are masked line by line as they stream past, so
+// the unmasked data is never written out.
+type Writer struct {
+	w  io.Writer
+	rs *Ruleset
+
+	buf     []byte        // incomplete line carried over to the next Write
+	copying bool          // inside a COPY ... FROM stdin block
+	columns []transformer // per field of the current COPY block, nil to keep
+	schema  string        // first schema of the script's search_path, for unqualified names
+	masked  map[string]bool
+	err     error
+}
+
+// NewWriter returns a Writer masking the dump written to w with rs.
+func NewWriter(w io.Writer, rs *Ruleset) *Writer {
+	return &Writer{w: w, rs: rs, masked: map[string]bool{}}
+}
+
+// Write masks and writes every complete line of p, buffering the rest.
+func (m *Writer) Write(p []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.buf = append(m.buf, p...)
+	start := 0
+	for {
+		i := bytes.IndexByte(m.buf[start:], '\n')
+		if i < 0 {
+			break
+		}
+		if err := m.line(m.buf[start : start+i+1]); err != nil {
+			m.err = err
+			return 0, err
+		}
+		start += i + 1
+	}
+	m.buf = append(m.buf[:0], m.buf[start:]...)
+	return len(p), nil
+}
+
+// Close writes a final line without a newline, if any. It does not close
+// the underlying writer.
+func (m *Writer) Close() error {
+	if m.err != nil {
+		return m.err
+	}
+	if len(m.buf) > 0 {
+		if err := m.line(m.buf); err != nil {
+			return err
+		}
+		m.buf = m.buf[:0]
+	}
+	if m.copying {
+		return fmt.Errorf("dump ended inside a COPY block")
+	}
+	return nil
+}
+
+// Masked returns the columns that were masked, as "schema.table.column".
+func (m *Writer) Masked() []string {
+	columns := make([]string, 0, len(m.masked))
+	for column := range m.masked {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func (m *Writer) line(line []byte) error {
+	content := bytes.TrimRight(line, "\r\n")
+	switch {
+	case m.copying && string(content) == `\.`:
+		m.copying = false
+		m.columns = nil
+	case m.copying && m.columns != nil:
+		line = m.row(line)
+	case !m.copying && bytes.HasPrefix(content, []byte("COPY ")) && bytes.HasSuffix(content, []byte(" FROM stdin;")):
+		m.copying = true
+		if err := m.header(string(content)); err != nil {
+			return err
+		}
+	case !m.copying:
+		if schema, ok := searchPathSetting(string(content)); ok {
+			m.schema = schema
+		}
+	}
+	_, err := m.w.Write(line)
+	return err
+}
+
+// header selects the transformers for the columns of a COPY block.
+func (m *Writer) header(stmt string) error {
+	schema, table, columns, err := parseCopyHeader(stmt)
+	if err != nil {
+		return err
+	}
+	if schema == "" {
+		if m.schema == "" {
+			return fmt.Errorf("cannot mask %q: the table is not schema-qualified and no search_path is set", stmt)
+		}
+		schema = m.schema
+	}
+	var transformers []transformer
+	for i, column := range columns {
+		rule, ok := m.rs.Rule(schema, table, column)
+		if !ok {
+			continue
+		}
+		t, err := m.rs.transformer(rule)
+		if err != nil {
+			return err
+		}
+		if transformers == nil {
+			transformers = make([]transformer, len(columns))
+		}
+		transformers[i] = t
+		m.masked[schema+"."+table+"."+column] = true
+	}
+	m.columns = transformers
+	return nil
+}
+
+// row masks one line of COPY text data.
+func (m *Writer) row(line []byte) []byte {
+	eol := line[len(bytes.TrimRight(line, "\r\n")):]
+	fields := bytes.Split(line[:len(line)-len(eol)], []byte{'\t'})
+
+	for i, field := range fields {
+		if i >= len(m.columns) || m.columns[i] == nil || string(field) == `\N` {
+			continue
+		}
+		masked := m.columns[i](decodeCopyField(field))
+		if masked == nil {
+			fields[i] = []byte(`\N`)
+		} else {
+			fields[i] = encodeCopyField(masked)
+		}
+	}
+
+	out := bytes.Join(fields, []byte{'\t'})
+	return append(out, eol...)
+}
+
+// searchPathSet matches the "SET search_path" older pg_dump versions write
+// instead of qualifying names, and the set_config call newer ones write to
+// empty it.
+var searchPathSet = regexp.MustCompile(`(?i)^(?:SET\s+search_path\s*(?:=|TO)\s*([^,;]*)|SELECT\s+pg_catalog\.set_config\('search_path',\s*'([^,']*))`)
+
+// searchPathSetting returns the first schema of a search_path setting, empty
+// when the path is emptied.
+func searchPathSetting(line string) (string, bool) {
+	m := searchPathSet.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	value := strings.Trim(strings.TrimSpace(m[1]+m[2]), "'")
+	if value == "" {
+		return "", true
+	}
+	schema, _, err := parseIdent(value)
+	if err != nil {
+		return "", true
+	}
+	return schema, true
+}
+
+// parseCopyHeader splits "COPY schema.table (a, b) FROM stdin;" into its
+// unquoted names. The schema is empty for an unqualified table.
+func parseCopyHeader(stmt string) (schema, table string, columns []string, err error) {
+	rest := strings.TrimPrefix(stmt, "COPY ")
+	name, rest, err := parseIdent(rest)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to parse %q: %w", stmt, err)
+	}
+	table = name
+	if strings.HasPrefix(rest, ".") {
+		schema = name
+		if table, rest, err = parseIdent(rest[1:]); err != nil {
+			return "", "", nil, fmt.Errorf("failed to parse %q: %w", stmt, err)
+		}
+	}
+
+	rest = strings.TrimLeft(rest, " ")
+	if !strings.HasPrefix(rest, "(") {
+		// Without the column list, the fields cannot be matched to rules.
+		return "", "", nil, fmt.Errorf("cannot mask %q: it has no column list", stmt)
+	}
+	rest = rest[1:]
+	for {
+		var column string
+		if column, rest, err = parseIdent(strings.TrimLeft(rest, " ")); err != nil {
+			return "", "", nil, fmt.Errorf("failed to parse %q: %w", stmt, err)
+		}
+		columns = append(columns, column)
+		rest = strings.TrimLeft(rest, " ")
+		switch {
+		case strings.HasPrefix(rest, ","):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, ")"):
+			return schema, table, columns, nil
+		default:
+			return "", "", nil, fmt.Errorf("failed to parse %q: unterminated column list", stmt)
+		}
+	}
+}
+
+// parseIdent reads a quoted or bare identifier from the start of s.
+func parseIdent(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != '"' {
+				b.WriteByte(s[i])
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '"' {
+				b.WriteByte('"')
+				i++
+				continue
+			}
+			return b.String(), s[i+1:], nil
+		}
+		return "", "", fmt.Errorf("unterminated quoted identifier")
+	}
+	end := strings.IndexAny(s, " .,()")
+	if end < 0 {
+		end = len(s)
+	}
+	if end == 0 {
+		return "", "", fmt.Errorf("expected an identifier")
+	}
+	return s[:end], s[end:], nil
+}
+
+// decodeCopyField resolves the backslash escapes of COPY text format.
+func decodeCopyField(field []byte) []byte {
+	if bytes.IndexByte(field, '\\') < 0 {
+		return field
+	}
+	out := make([]byte, 0, len(field))
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' || i+1 == len(field) {
+			out = append(out, c)
+			continue
+		}
+		i++
+		switch c = field[i]; c {
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'v':
+			out = append(out, '\v')
+		case 'x':
+			v, n := 0, 0
+			for n < 2 && i+1 < len(field) && isHex(field[i+1]) {
+				i++
+				v = v*16 + hexValue(field[i])
+				n++
+			}
+			if n == 0 {
+				out = append(out, 'x')
+			} else {
+				out = append(out, byte(v))
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			v := int(c - '0')
+			for n := 1; n < 3 && i+1 < len(field) && field[i+1] >= '0' && field[i+1] <= '7'; n++ {
+				i++
+				v = v*8 + int(field[i]-'0')
+			}
+			out = append(out, byte(v))
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// encodeCopyField escapes a value for COPY text format.
+func encodeCopyField(value []byte) []byte {
+	out := make([]byte, 0, len(value))
+	for _, c := range value {
+		switch c {
+		case '\\':
+			out = append(out, '\\', '\\')
+		case '\b':
+			out = append(out, '\\', 'b')
+		case '\f':
+			out = append(out, '\\', 'f')
+		case '\n':
+			out = append(out, '\\', 'n')
+		case '\r':
+			out = append(out, '\\', 'r')
+		case '\t':
+			out = append(out, '\\', 't')
+		case '\v':
+			out = append(out, '\\', 'v')
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) int {
+	switch {
+	case c >= 'a':
+		return int(c-'a') + 10
+	case c >= 'A':
+		return int(c-'A') + 10
+	default:
+		return int(c - '0')
+	}
+}
@@ -0,0 +1,259 @@
+// Package metrics records the outcome of backups, restores and retention
+// runs in a state file shared by every process, and publishes it in the
+// Prometheus text format, over HTTP or as a node_exporter textfile.
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/lockfile"
+)
+
+// Series holds the metrics of one operation on one database.
+type Series struct {
+	Operation string `json:"operation"`
+	Host      string `json:"host"`
+	Database  string `json:"database"`
+
+	LastSuccess  time.Time `json:"last_success,omitempty"`
+	LastDuration float64   `json:"last_duration_seconds"` // Of the last run, successful or not
+	LastSize     int64     `json:"last_size_bytes"`       // Of the last successful run
+	Successes    int64     `json:"successes"`
+	Failures     int64     `json:"failures"`
+
+	// RetentionDeletions counts backups removed by retention policies.
+	RetentionDeletions int64 `json:"retention_deletions"`
+
+	// Running lists the processes currently running the operation.
+	Running []Run `json:"running,omitempty"`
+}
+
+// Run is an in-flight job.
+type Run struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// State is the content of the state file.
+type State struct {
+	Series []*Series `json:"series"`
+}
+
+// Get returns the series of operation on host/database, adding it if needed.
+func (s *State) Get(operation, host, database string) *Series {
+	for _, ser := range s.Series {
+		if ser.Operation == operation && ser.Host == host && ser.Database == database {
+			return ser
+		}
+	}
+	ser := &Series{Operation: operation, Host: host, Database: database}
+	s.Series = append(s.Series, ser)
+	return ser
+}
+
+// Start records that this process started running the series' operation.
+func (ser *Series) Start() {
+	ser.Running = append(ser.Running, Run{PID: os.Getpid(), Started: time.Now().UTC()})
+}
+
+// Finish records the outcome of this process's run. A failed run leaves
+// the last success and size as they were.
+func (ser *Series) Finish(success bool, duration time.Duration, size int64) {
+	pid := os.Getpid()
+	ser.Running = removeRuns(ser.Running, func(r Run) bool { return r.PID == pid })
+	ser.LastDuration = duration.Seconds()
+	if success {
+		ser.Successes++
+		ser.LastSuccess = time.Now().UTC()
+		ser.LastSize = size
+	} else {
+		ser.Failures++
+	}
+}
+
+func removeRuns(runs []Run, drop func(Run) bool) []Run {
+	var kept []Run
+	for _, r := range runs {
+		if !drop(r) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// Load reads the state file. A missing file is an empty state. Runs of
+// processes that no longer exist, because they were killed before they
+// could finish, are dropped.
+func Load(path string) (*State, error) {
+	s := &State{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read metrics state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse metrics state %s: %w", path, err)
+	}
+	for _, ser := range s.Series {
+		ser.Running = removeRuns(ser.Running, func(r Run) bool { return !processAlive(r.PID) })
+	}
+	return s, nil
+}
+
+// processAlive reports whether a process exists. Where signal 0 is not
+// supported every process counts as gone, so only this process's runs show.
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
+
+// Update applies fn to the state file under a lock, so concurrent runs do
+// not lose each other's updates.
+func Update(path string, fn func(*State)) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create metrics state directory: %w", err)
+	}
+	unlock, err := lockfile.Lock(path)
+	if err != nil {
+		return fmt.Errorf("failed to lock metrics state: %w", err)
+	}
+	defer unlock()
+
+	s, err := Load(path)
+	if err != nil {
+		return err
+	}
+	fn(s)
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, append(data, '\n'))
+}
+
+// writeAtomic replaces path with data so readers never see a partial file.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	tmp.Close()
+	os.Chmod(tmp.Name(), 0644)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// metric is one published metric family.
+type metric struct {
+	name, kind, help string
+	value            func(*Series) (float64, bool)
+}
+
+var families = []metric{
+	{"go_pg_backup_last_success_timestamp_seconds", "gauge", "Unix time of the last successful run.",
+		func(s *Series) (float64, bool) {
+			return float64(s.LastSuccess.UnixNano()) / 1e9, !s.LastSuccess.IsZero()
+		}},
+	{"go_pg_backup_last_duration_seconds", "gauge", "Duration of the last run.",
+		func(s *Series) (float64, bool) { return s.LastDuration, s.Successes+s.Failures > 0 }},
+	{"go_pg_backup_last_size_bytes", "gauge", "Size of the backup written or restored by the last successful run.",
+		func(s *Series) (float64, bool) { return float64(s.LastSize), s.Successes > 0 }},
+	{"go_pg_backup_successes_total", "counter", "Runs that succeeded.",
+		func(s *Series) (float64, bool) { return float64(s.Successes), true }},
+	{"go_pg_backup_failures_total", "counter", "Runs that failed.",
+		func(s *Series) (float64, bool) { return float64(s.Failures), true }},
+	{"go_pg_backup_in_flight", "gauge", "Runs in progress.",
+		func(s *Series) (float64, bool) { return float64(len(s.Running)), true }},
+	{"go_pg_backup_retention_deletions_total", "counter", "Backups deleted by retention policies.",
+		func(s *Series) (float64, bool) { return float64(s.RetentionDeletions), true }},
+}
+
+// WriteText writes the state in the Prometheus text exposition format.
+func (s *State) WriteText(w io.Writer) error {
+	series := append([]*Series(nil), s.Series...)
+	sort.Slice(series, func(i, j int) bool {
+		a, b := series[i], series[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Database != b.Database {
+			return a.Database < b.Database
+		}
+		return a.Operation < b.Operation
+	})
+
+	var b strings.Builder
+	for _, m := range families {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, ser := range series {
+			if v, ok := m.value(ser); ok {
+				fmt.Fprintf(&b, "%s{operation=%s,host=%s,database=%s} %s\n", m.name,
+					labelValue(ser.Operation), labelValue(ser.Host), labelValue(ser.Database), strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelValue quotes a label value as the exposition format requires.
+func labelValue(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+// WriteTextfile writes the state at statePath to path for node_exporter's
+// textfile collector. The file is replaced atomically, as the collector
+// requires.
+func WriteTextfile(statePath, path string) error {
+	s, err := Load(statePath)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	s.WriteText(&b)
+	return writeAtomic(path, []byte(b.String()))
+}
+
+// Handler serves the state at statePath, read afresh on every scrape,
+// followed by the output of the extra writers.
+func Handler(statePath string, extra ...func(io.Writer) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := Load(statePath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.WriteText(w)
+		for _, write := range extra {
+			write(w)
+		}
+	})
+}
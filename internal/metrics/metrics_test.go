@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestUpdate verifies that concurrent updates are all kept and that the
+// exposition lists every metric.
+func TestUpdate(t *testing.T) {
+	dir := t.TempDir()
+	state := filepath.Join(dir, "metrics.json")
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := Update(state, func(s *State) {
+				s.Get("backup", "db.local", "shop").Finish(true, 3*time.Second, 2048)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	err := Update(state, func(s *State) {
+		s.Get("backup", "db.local", "shop").Finish(false, time.Second, 0)
+		s.Get("backup", "db.local", "shop").RetentionDeletions += 2
+		s.Get("restore", "db.local", "shop").Start()
+		// A run of a process that no longer exists.
+		s.Get("backup", "db.local", "crm").Running = []Run{{PID: 1 << 30}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Handler(state))
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	text := string(body)
+
+	labels := `{operation="backup",host="db.local",database="shop"}`
+	for _, want := range []string{
+		"# TYPE go_pg_backup_last_success_timestamp_seconds gauge",
+		"go_pg_backup_successes_total" + labels + " 10\n",
+		"go_pg_backup_failures_total" + labels + " 1\n",
+		"go_pg_backup_last_size_bytes" + labels + " 2048\n",
+		"go_pg_backup_last_duration_seconds" + labels + " 1\n",
+		"go_pg_backup_retention_deletions_total" + labels + " 2\n",
+		`go_pg_backup_in_flight{operation="restore",host="db.local",database="shop"} 1` + "\n",
+		`go_pg_backup_in_flight{operation="backup",host="db.local",database="crm"} 0` + "\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics lack %q:\n%s", want, text)
+		}
+	}
+
+	textfile := filepath.Join(dir, "go_pg_backup.prom")
+	if err := WriteTextfile(state, textfile); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(textfile); err != nil || string(data) != text {
+		t.Errorf("textfile differs from the endpoint: %v", err)
+	}
+}
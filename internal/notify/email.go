@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func sendEmail(t Target, e Event) error {
+	if t.SMTPHost == "" || t.From == "" || len(t.To) == 0 {
+		return fmt.Errorf("smtp_host, from and to are required")
+	}
+	port := t.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if t.Username != "" {
+		auth = smtp.PlainAuth("", t.Username, t.Password, t.SMTPHost)
+	}
+
+	var msg strings.Builder
+	// net/smtp converts the line endings to CRLF and escapes leading dots.
+	fmt.Fprintf(&msg, "From: %s\n", t.From)
+	fmt.Fprintf(&msg, "To: %s\n", strings.Join(t.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [go-pg-backup] %s\n", e.Title())
+	fmt.Fprintf(&msg, "Date: %s\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\nContent-Type: text/plain; charset=utf-8\n\n")
+	msg.WriteString(e.Text())
+
+	addr := net.JoinHostPort(t.SMTPHost, strconv.Itoa(port))
+	if err := smtp.SendMail(addr, auth, t.From, t.To, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email via %s: %w", addr, err)
+	}
+	return nil
+}
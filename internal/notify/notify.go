@@ -0,0 +1,217 @@
+// Package notify tells people about the outcome of backups and restores.
+// Each configured target is a JSON webhook, a Slack incoming webhook or an
+// SMTP mailbox, and chooses which outcomes of which jobs it hears about.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/dbpattern"
+)
+
+// Status is the outcome of a job.
+type Status string
+
+const (
+	Success Status = "success"
+	Failure Status = "failure"
+	// Warning means the job succeeded but reported problems, such as
+	// pre-flight checks that did not pass cleanly.
+	Warning Status = "warning"
+)
+
+// Event is the payload sent to every target.
+type Event struct {
+	Operation string        `json:"operation"` // "backup", "restore", ...
+	Status    Status        `json:"status"`
+	Database  string        `json:"database"`
+	Host      string        `json:"host"`
+	Port      int           `json:"port"`
+	File      string        `json:"file,omitempty"` // Backup written or restored
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"-"`
+	Size      int64         `json:"size_bytes,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Warnings  []string      `json:"warnings,omitempty"`
+	LogTail   []string      `json:"log_tail,omitempty"` // Last lines of the job's output
+	Machine   string        `json:"machine"`            // Host name of the machine that ran the job
+}
+
+// Title summarizes the event in one line, e.g. "backup failed: shop on db.local".
+func (e Event) Title() string {
+	verb := map[Status]string{Success: "succeeded", Failure: "failed", Warning: "succeeded with warnings"}[e.Status]
+	return fmt.Sprintf("%s %s: %s on %s", e.Operation, verb, e.Database, e.Host)
+}
+
+// Text renders the event as a plain-text report.
+func (e Event) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", e.Title())
+	fmt.Fprintf(&b, "Database: %s\nServer:   %s:%d\nStarted:  %s\nDuration: %s\n",
+		e.Database, e.Host, e.Port, e.StartedAt.Format(time.RFC3339), e.Duration.Round(time.Second))
+	if e.File != "" {
+		fmt.Fprintf(&b, "File:     %s\n", e.File)
+	}
+	if e.Size > 0 {
+		fmt.Fprintf(&b, "Size:     %d bytes\n", e.Size)
+	}
+	if e.Machine != "" {
+		fmt.Fprintf(&b, "Machine:  %s\n", e.Machine)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&b, "\nError: %s\n", e.Error)
+	}
+	for _, w := range e.Warnings {
+		fmt.Fprintf(&b, "Warning: %s\n", w)
+	}
+	if len(e.LogTail) > 0 {
+		fmt.Fprintf(&b, "\nLast lines of output:\n%s\n", strings.Join(e.LogTail, "\n"))
+	}
+	return b.String()
+}
+
+// Target is a configured notification destination.
+type Target struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // "webhook", "slack" or "email"
+
+	// On lists the statuses that trigger the target. Empty means failures
+	// and warnings.
+	On []Status `json:"on"`
+	// Jobs restricts the target to "host/database" glob patterns. A
+	// pattern without a slash matches the database name on any host.
+	// Empty matches every database.
+	Jobs []string `json:"jobs"`
+	// Operations restricts the target to "backup", "restore", ...
+	// Empty matches every operation.
+	Operations []string `json:"operations"`
+
+	// Webhook and Slack settings.
+	URL     string `json:"url"`
+	Secret  string `json:"secret"`  // HMAC-SHA256 key signing webhook bodies
+	Retries *int   `json:"retries"` // Retries after a failed delivery, default 3
+
+	// Email settings. Username and Password are optional.
+	SMTPHost string   `json:"smtp_host"`
+	SMTPPort int      `json:"smtp_port"` // Default 587
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// label names the target in error messages.
+func (t Target) label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Type
+}
+
+// Matches reports whether the target wants to hear about e.
+func (t Target) Matches(e Event) bool {
+	on := t.On
+	if len(on) == 0 {
+		on = []Status{Failure, Warning}
+	}
+	if !slices.Contains(on, e.Status) {
+		return false
+	}
+	if len(t.Operations) > 0 && !slices.Contains(t.Operations, e.Operation) {
+		return false
+	}
+	return len(t.Jobs) == 0 || dbpattern.MatchAny(t.Jobs, e.Host, e.Database)
+}
+
+// Deliver sends e to the target regardless of its triggers.
+func Deliver(t Target, e Event) error {
+	if e.Machine == "" {
+		e.Machine, _ = os.Hostname()
+	}
+	var err error
+	switch t.Type {
+	case "webhook":
+		err = sendWebhook(t, e)
+	case "slack":
+		err = sendSlack(t, e)
+	case "email":
+		err = sendEmail(t, e)
+	default:
+		err = fmt.Errorf("unknown type %q", t.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("notification %s: %w", t.label(), err)
+	}
+	return nil
+}
+
+// Send delivers e to every target whose triggers match it, concurrently,
+// and returns the failed deliveries joined.
+func Send(targets []Target, e Event) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(targets))
+	for i, t := range targets {
+		if !t.Matches(e) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = Deliver(t, e)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Tail is an io.Writer keeping the last lines written to it.
+type Tail struct {
+	mu      sync.Mutex
+	max     int
+	lines   []string
+	partial string
+}
+
+// NewTail returns a Tail keeping up to max lines.
+func NewTail(max int) *Tail {
+	return &Tail{max: max}
+}
+
+func (t *Tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.partial + string(p)
+	for {
+		line, rest, found := strings.Cut(s, "\n")
+		if !found {
+			break
+		}
+		t.lines = append(t.lines, line)
+		s = rest
+	}
+	t.partial = s
+	if len(t.lines) > t.max {
+		t.lines = append(t.lines[:0], t.lines[len(t.lines)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+// Lines returns the kept lines, including an unterminated last line.
+func (t *Tail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := slices.Clone(t.lines)
+	if t.partial != "" {
+		lines = append(lines, t.partial)
+	}
+	if len(lines) > t.max {
+		lines = lines[len(lines)-t.max:]
+	}
+	return lines
+}
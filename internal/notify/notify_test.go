@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testEvent() Event {
+	return Event{
+		Operation: "backup",
+		Status:    Failure,
+		Database:  "shop",
+		Host:      "db.local",
+		Port:      5432,
+		StartedAt: time.Date(2026, 1, 1, 2, 0, 0, 0, time.UTC),
+		Duration:  90 * time.Second,
+		Size:      1024,
+		Error:     "pg_dump failed: connection refused",
+		LogTail:   []string{"Pre-flight checks:", ".hidden line"},
+	}
+}
+
+func TestMatches(t *testing.T) {
+	e := testEvent()
+	tests := []struct {
+		target Target
+		want   bool
+	}{
+		{Target{}, true},
+		{Target{On: []Status{Success}}, false},
+		{Target{Jobs: []string{"db.*/shop"}}, true},
+		{Target{Jobs: []string{"shop"}}, true},
+		{Target{Jobs: []string{"other.local/*"}}, false},
+		{Target{Operations: []string{"restore"}}, false},
+		{Target{Operations: []string{"backup"}, On: []Status{Failure}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.target.Matches(e); got != tt.want {
+			t.Errorf("%+v matches = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+	e.Status = Success
+	if (Target{}).Matches(e) {
+		t.Error("successes notify by default")
+	}
+}
+
+// TestWebhook verifies the payload and signature, and that server errors
+// are retried a limited number of times.
+func TestWebhook(t *testing.T) {
+	retryDelay = time.Millisecond
+	var calls atomic.Int32
+	var payload map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		if got := r.Header.Get(SignatureHeader); got != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("signature %q", got)
+		}
+		json.Unmarshal(body, &payload)
+	}))
+	defer srv.Close()
+
+	if err := Deliver(Target{Type: "webhook", URL: srv.URL, Secret: "s3cret"}, testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("%d calls, want 3", calls.Load())
+	}
+	if payload["database"] != "shop" || payload["status"] != "failure" || payload["duration_seconds"] != 90.0 ||
+		payload["error"] == nil || len(payload["log_tail"].([]any)) != 2 {
+		t.Errorf("payload %v", payload)
+	}
+
+	var failures atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failures.Add(1)
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer down.Close()
+	retries := 1
+	if err := Deliver(Target{Type: "webhook", URL: down.URL, Retries: &retries}, testEvent()); err == nil {
+		t.Error("expected an error after the retries ran out")
+	}
+	if failures.Load() != 2 {
+		t.Errorf("%d attempts, want 2", failures.Load())
+	}
+}
+
+func TestSlack(t *testing.T) {
+	var payload struct {
+		Text        string `json:"text"`
+		Attachments []struct {
+			Color string `json:"color"`
+			Text  string `json:"text"`
+		} `json:"attachments"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer srv.Close()
+
+	if err := Deliver(Target{Type: "slack", URL: srv.URL}, testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Text != "backup failed: shop on db.local" || len(payload.Attachments) != 1 ||
+		payload.Attachments[0].Color != "danger" || !strings.Contains(payload.Attachments[0].Text, "Pre-flight") {
+		t.Errorf("payload %+v", payload)
+	}
+}
+
+// TestEmail delivers to a minimal SMTP server and checks the message.
+func TestEmail(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go serveSMTP(ln, received)
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	target := Target{Type: "email", SMTPHost: "127.0.0.1", SMTPPort: port, From: "backup@example.com", To: []string{"ops@example.com"}}
+	if err := Deliver(target, testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-received
+	for _, want := range []string{"Subject: [go-pg-backup] backup failed: shop on db.local", "Error: pg_dump failed", "\r\n.hidden line\r\n"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message lacks %q:\n%s", want, msg)
+		}
+	}
+}
+
+// serveSMTP accepts one message and sends its data, dot-unstuffed.
+func serveSMTP(ln net.Listener, received chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			received <- data.String()
+			reply("250 ok")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	tail := NewTail(2)
+	io.WriteString(tail, "one\ntwo\nthr")
+	io.WriteString(tail, "ee\nfour")
+	if got := strings.Join(tail.Lines(), "|"); got != "three|four" {
+		t.Errorf("tail %q", got)
+	}
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body, as
+// "sha256=<hex>", when the target has a secret.
+const SignatureHeader = "X-Go-Pg-Backup-Signature"
+
+// retryDelay is the wait before the first retry. It doubles on each retry.
+var retryDelay = 2 * time.Second
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// webhookPayload is the JSON body of a generic webhook.
+type webhookPayload struct {
+	Event
+	Title           string  `json:"title"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+func sendWebhook(t Target, e Event) error {
+	body, err := json.Marshal(webhookPayload{Event: e, Title: e.Title(), DurationSeconds: e.Duration.Seconds()})
+	if err != nil {
+		return err
+	}
+	return post(t, body)
+}
+
+// slackColors maps statuses to Slack attachment colors.
+var slackColors = map[Status]string{Success: "good", Failure: "danger", Warning: "warning"}
+
+func sendSlack(t Target, e Event) error {
+	type field struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Short bool   `json:"short"`
+	}
+	fields := []field{
+		{"Database", e.Database, true},
+		{"Server", fmt.Sprintf("%s:%d", e.Host, e.Port), true},
+		{"Duration", e.Duration.Round(time.Second).String(), true},
+	}
+	if e.Size > 0 {
+		fields = append(fields, field{"Size", fmt.Sprintf("%d bytes", e.Size), true})
+	}
+	if e.Error != "" {
+		fields = append(fields, field{"Error", e.Error, false})
+	}
+	for _, w := range e.Warnings {
+		fields = append(fields, field{"Warning", w, false})
+	}
+	attachment := map[string]any{
+		"color":    slackColors[e.Status],
+		"fallback": e.Title(),
+		"fields":   fields,
+		"ts":       e.StartedAt.Unix(),
+	}
+	if len(e.LogTail) > 0 {
+		attachment["text"] = "```" + strings.Join(e.LogTail, "\n") + "```"
+	}
+	body, err := json.Marshal(map[string]any{
+		"text":        e.Title(),
+		"attachments": []any{attachment},
+	})
+	if err != nil {
+		return err
+	}
+	return post(t, body)
+}
+
+// post delivers body to the target's URL, retrying network errors, rate
+// limiting and server errors with exponential backoff.
+func post(t Target, body []byte) error {
+	if t.URL == "" {
+		return fmt.Errorf("no url configured")
+	}
+	retries := 3
+	if t.Retries != nil {
+		retries = *t.Retries
+	}
+	delay := retryDelay
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		if retry, err = postOnce(t, body); err == nil || !retry || attempt >= retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// postOnce makes one delivery attempt and reports whether a failure is
+// worth retrying.
+func postOnce(t Target, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-pg-backup")
+	if t.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(t.Secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s responded %s: %s", t.URL, resp.Status, strings.TrimSpace(string(detail)))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
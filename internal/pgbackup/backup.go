@@ -14,26 +14,34 @@ func PreparePgDumpCommand(host string, port int, user, password, dbname, outputP
 		return nil, fmt.Errorf("pg_dump not found in system PATH. Please ensure PostgreSQL client tools are installed and in your PATH.")
 	}
 
+	return PrepareDumpCommand("pg_dump", host, port, user, password, dbname, outputPath), nil
+}
+
+// PrepareDumpCommand prepares the exec.Cmd for the given pg_dump binary but does not run it.
+// An empty outputPath writes the dump to stdout.
+func PrepareDumpCommand(binary, host string, port int, user, password, dbname, outputPath string) *exec.Cmd {
 	args := []string{
 		"-h", host,
 		"-U", user,
 		"-d", dbname,
-		"-f", outputPath,
-		"-F", "p", // Plain text SQL format, or 'c' for custom, 'd' for directory
 	}
+	if outputPath != "" {
+		args = append(args, "-f", outputPath)
+	}
+	args = append(args, "-F", "p") // Plain text SQL format, or 'c' for custom, 'd' for directory
 
 	if port != 0 {
 		args = append(args, "-p", fmt.Sprintf("%d", port))
 	}
 
-	cmd := exec.Command("pg_dump", args...)
+	cmd := exec.Command(binary, args...)
 
 	// Set PGPASSWORD environment variable for pg_dump
 	if password != "" {
 		cmd.Env = append(os.Environ(), "PGPASSWORD="+password)
 	}
 
-	return cmd, nil
+	return cmd
 }
 
 // CreateDestinationDir remains the same
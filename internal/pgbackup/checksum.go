@@ -0,0 +1,221 @@
+package pgbackup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TableChecksum is the row count and content checksum of one table.
+type TableChecksum struct {
+	Table string `json:"table"` // Quoted, qualified table name
+	Rows  int64  `json:"rows"`
+	// Checksum is the sum of a hash of every row's text, so it does not
+	// depend on the order the rows are stored in.
+	Checksum string `json:"checksum"`
+	// Sample is the percentage of rows hashed when the table was sampled,
+	// chosen by a hash of the primary key. Zero means every row.
+	Sample float64 `json:"sample,omitempty"`
+}
+
+// ChecksumOptions controls how tables are checksummed.
+type ChecksumOptions struct {
+	// SamplePercent, if set, hashes only that percentage of the rows of
+	// tables with a primary key and more than SampleMinRows rows. Row
+	// counts are always exact.
+	SamplePercent float64
+	SampleMinRows int64
+
+	// Samples, if set, fixes the sample of each table instead, so a second
+	// database is hashed the same way as the first. Tables missing from it
+	// are hashed in full.
+	Samples map[string]float64
+}
+
+// checksumTablesQuery lists the tables holding data, with their estimated
+// size and quoted primary key columns.
+var checksumTablesQuery = `
+	SELECT quote_ident(n.nspname) || '.' || quote_ident(c.relname), c.reltuples::bigint,
+		COALESCE((
+			SELECT array_agg(quote_ident(a.attname) ORDER BY array_position(i.indkey::int2[], a.attnum))
+			FROM pg_index i
+			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY (i.indkey)
+			WHERE i.indrelid = c.oid AND i.indisprimary
+		), '{}')
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind = 'r' AND ` + userNamespace + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+	ORDER BY 1`
+
+// TableChecksums counts and checksums the rows of every table through q.
+// Run it inside a REPEATABLE READ transaction to see a consistent snapshot.
+func TableChecksums(ctx context.Context, q querier, opts ChecksumOptions) ([]TableChecksum, error) {
+	type table struct {
+		name     string
+		estimate int64
+		key      []string
+	}
+	rows, err := q.Query(ctx, checksumTablesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []table
+	for rows.Next() {
+		var t table
+		if err := rows.Scan(&t.name, &t.estimate, &t.key); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	var sums []TableChecksum
+	for _, t := range tables {
+		sample := 0.0
+		switch {
+		case opts.Samples != nil:
+			sample = opts.Samples[t.name]
+		case opts.SamplePercent > 0 && opts.SamplePercent < 100 && t.estimate > opts.SampleMinRows && len(t.key) > 0:
+			sample = opts.SamplePercent
+		}
+		if len(t.key) == 0 {
+			// Rows are sampled by their primary key. Without one the table
+			// is hashed in full, and its Sample says so, so a comparison
+			// with a sampled copy can tell the two apart.
+			sample = 0
+		}
+		sum := TableChecksum{Table: t.name, Sample: sample}
+		if err := q.QueryRow(ctx, checksumQuery(t.name, t.key, sample)).Scan(&sum.Rows, &sum.Checksum); err != nil {
+			return nil, fmt.Errorf("failed to checksum %s: %w", t.name, err)
+		}
+		sums = append(sums, sum)
+	}
+	return sums, nil
+}
+
+// checksumQuery counts the rows of table and sums a 60-bit hash of each
+// row's text. With a sample, only rows whose primary key hashes into the
+// sample are hashed, which saves most of the work on wide rows.
+func checksumQuery(table string, key []string, sample float64) string {
+	hash := "('x' || substr(md5(t::text), 1, 15))::bit(60)::bigint::numeric"
+	if sample > 0 && len(key) > 0 {
+		keyText := "ROW(" + strings.Join(prefixAll("t.", key), ", ") + ")::text"
+		hash = fmt.Sprintf("CASE WHEN ('x' || substr(md5(%s), 1, 7))::bit(28)::int %% 10000 < %d THEN %s END",
+			keyText, int(sample*100), hash)
+	}
+	return fmt.Sprintf("SELECT count(*), COALESCE(sum(%s), 0)::text FROM %s t", hash, table)
+}
+
+func prefixAll(prefix string, names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = prefix + n
+	}
+	return out
+}
+
+// checksumSettings fix the text form of values whose output depends on
+// the session, so a row hashes the same on servers with other defaults.
+var checksumSettings = []string{
+	"SET LOCAL TimeZone = 'UTC'",
+	"SET LOCAL DateStyle = 'ISO, YMD'",
+	"SET LOCAL IntervalStyle = 'postgres'",
+	"SET LOCAL extra_float_digits = 3",
+	"SET LOCAL bytea_output = 'hex'",
+}
+
+// setChecksumSettings applies checksumSettings to tx.
+func setChecksumSettings(ctx context.Context, tx pgx.Tx) error {
+	for _, stmt := range checksumSettings {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to prepare checksum session: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadTableChecksums connects to a database and checksums its tables in
+// one snapshot.
+func ReadTableChecksums(ctx context.Context, host string, port int, user, password, dbname string, opts ChecksumOptions) ([]TableChecksum, error) {
+	conn, err := pgx.Connect(ctx, ConnString(host, port, user, password, dbname))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start snapshot: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := setChecksumSettings(ctx, tx); err != nil {
+		return nil, err
+	}
+	return TableChecksums(ctx, tx, opts)
+}
+
+// checksumSnapshot holds a transaction open whose snapshot is exported to
+// the dump, so the checksums describe exactly the data that was dumped.
+type checksumSnapshot struct {
+	conn *pgx.Conn
+	tx   pgx.Tx
+	id   string
+}
+
+func beginChecksumSnapshot(ctx context.Context, opts Options) (*checksumSnapshot, error) {
+	conn, err := pgx.Connect(ctx, ConnString(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		conn.Close(ctx)
+		return nil, fmt.Errorf("failed to start snapshot: %w", err)
+	}
+	s := &checksumSnapshot{conn: conn, tx: tx}
+	if err := setChecksumSettings(ctx, tx); err != nil {
+		s.close(ctx)
+		return nil, err
+	}
+	if err := tx.QueryRow(ctx, "SELECT pg_export_snapshot()").Scan(&s.id); err != nil {
+		s.close(ctx)
+		return nil, fmt.Errorf("failed to export snapshot: %w", err)
+	}
+	return s, nil
+}
+
+func (s *checksumSnapshot) close(ctx context.Context) {
+	s.tx.Rollback(ctx)
+	s.conn.Close(ctx)
+}
+
+// dumpWithChecksums runs dump and, when opts asks for checksums of an
+// unfiltered backup, records the table checksums of the snapshot it dumped.
+// Masked and subset backups hold different data, so they are not checksummed.
+func dumpWithChecksums(opts Options, dump func(opts Options) (*dumpResult, error)) (*dumpResult, error) {
+	if opts.Checksums == nil || opts.Masking != nil || len(opts.Subset) > 0 {
+		return dump(opts)
+	}
+	ctx := context.Background()
+	snap, err := beginChecksumSnapshot(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer snap.close(ctx)
+
+	opts.snapshot = snap.id
+	result, err := dump(opts)
+	if err != nil {
+		return nil, err
+	}
+	if result.tables, err = TableChecksums(ctx, snap.tx, *opts.Checksums); err != nil {
+		return nil, fmt.Errorf("backup written but %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,63 @@
+package pgbackup
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestChecksumQuery verifies full and sampled checksum queries.
+func TestChecksumQuery(t *testing.T) {
+	full := checksumQuery(`public.orders`, []string{"id"}, 0)
+	if full != "SELECT count(*), COALESCE(sum(('x' || substr(md5(t::text), 1, 15))::bit(60)::bigint::numeric), 0)::text FROM public.orders t" {
+		t.Errorf("unexpected full query %q", full)
+	}
+
+	sampled := checksumQuery(`public.order_items`, []string{"order_id", `"line"`}, 12.5)
+	for _, want := range []string{"md5(ROW(t.order_id, t.\"line\")::text)", "% 10000 < 1250 THEN", "count(*)"} {
+		if !strings.Contains(sampled, want) {
+			t.Errorf("sampled query %q lacks %q", sampled, want)
+		}
+	}
+}
+
+// TestChecksumsIgnoreSessionSettings verifies checksums of the same data
+// match on sessions with other time zones and output styles, and that tables
+// without a primary key are not sampled.
+func TestChecksumsIgnoreSessionSettings(t *testing.T) {
+	s := startTestServer(t)
+	s.exec(t, "testdb", `
+		CREATE TABLE events (id integer PRIMARY KEY, at timestamptz, day date, took interval, ratio float8, raw bytea);
+		INSERT INTO events SELECT i, '2024-03-01 12:00+00'::timestamptz + i * interval '1 hour',
+			'2024-03-01'::date + i, i * interval '90 minutes', 1.0 / i, int4send(i) FROM generate_series(1, 100) i;
+		CREATE TABLE log (line text);
+		INSERT INTO log SELECT 'line ' || i FROM generate_series(1, 100) i;
+		ANALYZE;`)
+	ctx := context.Background()
+	opts := ChecksumOptions{SamplePercent: 50}
+
+	read := func() []TableChecksum {
+		t.Helper()
+		sums, err := ReadTableChecksums(ctx, s.opts.Host, s.opts.Port, s.opts.User, s.opts.Password, s.opts.DBName, opts)
+		if err != nil {
+			t.Fatalf("checksums failed: %s", err)
+		}
+		return sums
+	}
+	before := read()
+	s.exec(t, "testdb", `ALTER ROLE testuser SET TimeZone = 'Asia/Tokyo';
+		ALTER ROLE testuser SET DateStyle = 'SQL, DMY';
+		ALTER ROLE testuser SET IntervalStyle = 'iso_8601';
+		ALTER ROLE testuser SET extra_float_digits = 0;
+		ALTER ROLE testuser SET bytea_output = 'escape'`)
+	after := read()
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("checksums depend on the session:\n%v\n%v", before, after)
+	}
+	for _, sum := range before {
+		if want := map[string]float64{"public.events": 50, "public.log": 0}[sum.Table]; sum.Sample != want {
+			t.Errorf("%s sampled at %g%%, want %g%%", sum.Table, sum.Sample, want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package pgbackup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Engine selects the program that produces a backup.
+type Engine string
+
+const (
+	// EngineAuto uses pg_dump and falls back to EngineGo when it is not installed.
+	EngineAuto Engine = ""
+	// EnginePgDump runs the pg_dump binary.
+	EnginePgDump Engine = "pg_dump"
+	// EngineGo reads the catalog and table data over a Go connection.
+	EngineGo Engine = "go"
+)
+
+// ParseEngine converts a user-supplied engine name.
+func ParseEngine(s string) (Engine, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return EngineAuto, nil
+	case "pg_dump", "pgdump":
+		return EnginePgDump, nil
+	case "go":
+		return EngineGo, nil
+	default:
+		return "", fmt.Errorf("unknown dump engine %q, expected auto, pg_dump or go", s)
+	}
+}
+
+// ConnString returns a keyword/value connection string for the database.
+func ConnString(host string, port int, user, password, dbname string) string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		host, port, user, password, dbname)
+}
+
+// DumpGo writes a plain SQL dump of the database to outputPath without
+// pg_dump. The schema and all table data are read inside one REPEATABLE READ
+// snapshot, so the dump is consistent like pg_dump's.
+func DumpGo(ctx context.Context, opts Options) error {
+	return writeFile(opts.OutputPath, func(w io.Writer) error {
+		_, err := writeDump(ctx, opts, EngineGo, w)
+		return err
+	})
+}
+
+// WriteGoDump streams a plain SQL dump of the database to w.
+func WriteGoDump(ctx context.Context, opts Options, w io.Writer) error {
+	conn, err := pgx.Connect(ctx, ConnString(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to start snapshot: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if opts.snapshot != "" {
+		if _, err := tx.Exec(ctx, "SET TRANSACTION SNAPSHOT "+quoteLiteral(opts.snapshot)); err != nil {
+			return fmt.Errorf("failed to import snapshot: %w", err)
+		}
+	}
+	if err := pinSearchPath(ctx, tx); err != nil {
+		return err
+	}
+
+	return writeSQLDump(ctx, tx, opts.DBName, w, func(dw *dumpWriter, table TableData) error {
+		return copyTable(ctx, tx.Conn(), dw, table, "")
+	})
+}
+
+// DumpSchema reads the schema objects of the database in one snapshot, in
+// the order the Go engine dumps them.
+func DumpSchema(ctx context.Context, opts Options) ([]SchemaObject, error) {
+	conn, err := pgx.Connect(ctx, ConnString(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start snapshot: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := pinSearchPath(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	schema, err := ReadSchema(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	return append(schema.PreData, schema.PostData...), nil
+}
+
+// WriteSchemaDump streams the schema of the database to w as the Go engine
+// writes it, without table data or sequence values.
+func WriteSchemaDump(ctx context.Context, opts Options, w io.Writer) error {
+	objects, err := DumpSchema(ctx, opts)
+	if err != nil {
+		return err
+	}
+	dw := &dumpWriter{w: w}
+	for _, obj := range objects {
+		dw.object(obj)
+	}
+	if dw.err != nil {
+		return fmt.Errorf("failed to write schema: %w", dw.err)
+	}
+	return nil
+}
+
+// pinSearchPath limits the search path of tx to pg_catalog, as pg_dump does,
+// so the catalog functions qualify every other name in the DDL they return.
+// Dumps clear search_path before creating anything and would not restore
+// otherwise, and the DDL does not depend on the connecting role's settings.
+func pinSearchPath(ctx context.Context, tx pgx.Tx) error {
+	if _, err := tx.Exec(ctx, "SET LOCAL search_path = pg_catalog"); err != nil {
+		return fmt.Errorf("failed to set search_path: %w", err)
+	}
+	return nil
+}
+
+// writeSQLDump writes the schema and, through copyData, the table data read in
+// tx as a plain SQL script, then commits tx.
+func writeSQLDump(ctx context.Context, tx pgx.Tx, dbname string, w io.Writer, copyData func(dw *dumpWriter, table TableData) error) error {
+	schema, err := ReadSchema(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	dw := &dumpWriter{w: w}
+	dw.printf("--\n-- PostgreSQL database dump of %s\n-- Dumped by go-pg-backup (Go engine) at %s\n--\n\n",
+		dbname, time.Now().UTC().Format(time.RFC3339))
+	dw.printf("SET statement_timeout = 0;\n")
+	dw.printf("SET lock_timeout = 0;\n")
+	dw.printf("SET client_encoding = 'UTF8';\n")
+	dw.printf("SET standard_conforming_strings = on;\n")
+	dw.printf("SELECT pg_catalog.set_config('search_path', '', false);\n")
+	dw.printf("SET check_function_bodies = false;\n")
+	dw.printf("SET client_min_messages = warning;\n\n")
+
+	for _, obj := range schema.PreData {
+		dw.object(obj)
+	}
+
+	for _, table := range schema.Tables {
+		if dw.err != nil {
+			return dw.err
+		}
+		if err := copyData(dw, table); err != nil {
+			return err
+		}
+	}
+
+	for _, seq := range schema.Sequences {
+		dw.printf("SELECT pg_catalog.setval('%s', %d, %t);\n", strings.ReplaceAll(seq.Name, "'", "''"), seq.Value, seq.IsCalled)
+	}
+	if len(schema.Sequences) > 0 {
+		dw.printf("\n")
+	}
+
+	for _, obj := range schema.PostData {
+		dw.object(obj)
+	}
+	dw.printf("--\n-- PostgreSQL database dump complete\n--\n")
+
+	if dw.err != nil {
+		return fmt.Errorf("failed to write backup file: %w", dw.err)
+	}
+	return tx.Commit(ctx)
+}
+
+// copyTable streams one table's rows in COPY text format, framed the way
+// pg_dump frames them so psql can restore the block. source is the query
+// the rows are copied from, empty for the whole table.
+func copyTable(ctx context.Context, conn *pgx.Conn, dw *dumpWriter, table TableData, source string) error {
+	target := table.Name
+	if len(table.Columns) > 0 {
+		target += " (" + strings.Join(table.Columns, ", ") + ")"
+	}
+	if source == "" {
+		source = target
+	}
+	dw.printf("--\n-- Data for %s\n--\n\nCOPY %s FROM stdin;\n", table.Name, target)
+	if dw.err != nil {
+		return dw.err
+	}
+	if _, err := conn.PgConn().CopyTo(ctx, dw.w, fmt.Sprintf("COPY %s TO STDOUT", source)); err != nil {
+		return fmt.Errorf("failed to copy data of %s: %w", table.Name, err)
+	}
+	dw.printf("\\.\n\n")
+	return dw.err
+}
+
+// dumpWriter remembers the first write error so output can be written
+// without checking every call.
+type dumpWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (d *dumpWriter) printf(format string, args ...any) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, format, args...)
+}
+
+func (d *dumpWriter) object(obj SchemaObject) {
+	label := obj.Name
+	if obj.Schema != "" {
+		label = obj.Schema + "." + obj.Name
+	}
+	if obj.Table != "" {
+		label = obj.Name + " on " + obj.Table
+	}
+	d.printf("--\n-- Name: %s; Type: %s\n--\n\n%s\n", label, strings.ToUpper(string(obj.Kind)), obj.SQL)
+}
@@ -0,0 +1,223 @@
+package pgbackup
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/testcontainers/testcontainers-go"
+	tcexec "github.com/testcontainers/testcontainers-go/exec"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// testServer is a PostgreSQL container for the Go engine's integration tests.
+type testServer struct {
+	container testcontainers.Container
+	opts      Options // Connects to testdb
+}
+
+// startTestServer starts a PostgreSQL container, terminated when the test ends.
+func startTestServer(t *testing.T) *testServer {
+	t.Helper()
+	ctx := context.Background()
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "postgres:13-alpine",
+			ExposedPorts: []string{"5432/tcp"},
+			Env: map[string]string{
+				"POSTGRES_USER":     "testuser",
+				"POSTGRES_PASSWORD": "testpassword",
+				"POSTGRES_DB":       "testdb",
+			},
+			WaitingFor: wait.ForListeningPort("5432/tcp").WithStartupTimeout(2 * time.Minute),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to start container: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Errorf("failed to terminate container: %s", err)
+		}
+	})
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatalf("failed to get container host: %s", err)
+	}
+	port, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		t.Fatalf("failed to get mapped port: %s", err)
+	}
+	return &testServer{
+		container: container,
+		opts:      Options{Host: host, Port: port.Int(), User: "testuser", Password: "testpassword", DBName: "testdb"},
+	}
+}
+
+// exec runs statements in dbname, retrying the first connection while the
+// server finishes starting.
+func (s *testServer) exec(t *testing.T, dbname, statements string) {
+	t.Helper()
+	db, err := sql.Open("postgres", ConnString(s.opts.Host, s.opts.Port, s.opts.User, s.opts.Password, dbname))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		if err = db.Ping(); err == nil {
+			break
+		}
+		time.Sleep(2 * time.Second)
+	}
+	if err != nil {
+		t.Fatalf("failed to ping database: %s", err)
+	}
+	if _, err := db.Exec(statements); err != nil {
+		t.Fatalf("failed to run statements: %s", err)
+	}
+}
+
+// psql runs script in dbname with the container's psql, stopping at the
+// first error as a restore does.
+func (s *testServer) psql(t *testing.T, dbname string, script []byte) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.container.CopyToContainer(ctx, script, "/tmp/script.sql", 0o644); err != nil {
+		t.Fatalf("failed to copy script: %s", err)
+	}
+	code, out, err := s.container.Exec(ctx, []string{"psql", "-U", s.opts.User, "-d", dbname,
+		"--set", "ON_ERROR_STOP=1", "-f", "/tmp/script.sql"}, tcexec.Multiplexed())
+	if err != nil {
+		t.Fatalf("failed to run psql: %s", err)
+	}
+	output, _ := io.ReadAll(out)
+	if code != 0 {
+		t.Fatalf("psql exited with %d:\n%s\nscript:\n%s", code, output, script)
+	}
+}
+
+// query returns the single value of query in dbname as text.
+func (s *testServer) query(t *testing.T, dbname, query string) string {
+	t.Helper()
+	db, err := sql.Open("postgres", ConnString(s.opts.Host, s.opts.Port, s.opts.User, s.opts.Password, dbname))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var v string
+	if err := db.QueryRow(query).Scan(&v); err != nil {
+		t.Fatalf("failed to run %q in %s: %s", query, dbname, err)
+	}
+	return v
+}
+
+// roundTripSchema uses the objects whose DDL names other objects: serial
+// defaults, foreign keys, views and columns of user-defined types, all in
+// public where an unpinned search_path leaves them unqualified.
+const roundTripSchema = `
+	CREATE TYPE mood AS ENUM ('happy', 'sad');
+	CREATE DOMAIN positive AS integer CHECK (VALUE > 0);
+	CREATE TABLE users (id serial PRIMARY KEY, name text NOT NULL, mood mood);
+	CREATE TABLE orders (
+		id serial PRIMARY KEY,
+		user_id integer NOT NULL REFERENCES users (id),
+		quantity positive NOT NULL
+	);
+	CREATE VIEW user_orders AS
+		SELECT u.name, count(o.id) AS orders FROM users u LEFT JOIN orders o ON o.user_id = u.id GROUP BY u.name;
+	INSERT INTO users (name, mood) VALUES ('ada', 'happy'), ('bob', 'sad');
+	INSERT INTO orders (user_id, quantity) VALUES (1, 2), (1, 3), (2, 1);
+`
+
+// TestGoDumpRoundTrip restores Go engine dumps, full and subset, with psql.
+func TestGoDumpRoundTrip(t *testing.T) {
+	s := startTestServer(t)
+	s.exec(t, "testdb", roundTripSchema)
+	ctx := context.Background()
+
+	// The role's own search path must not change the dump, or exports of an
+	// unchanged database would differ between users.
+	before, err := DumpSchema(ctx, s.opts)
+	if err != nil {
+		t.Fatalf("schema dump failed: %s", err)
+	}
+	s.exec(t, "testdb", "ALTER ROLE testuser SET search_path = public, pg_catalog")
+	after, err := DumpSchema(ctx, s.opts)
+	if err != nil {
+		t.Fatalf("schema dump failed: %s", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("schema depends on the search path:\n%v\n%v", before, after)
+	}
+
+	var full bytes.Buffer
+	if err := WriteGoDump(ctx, s.opts, &full); err != nil {
+		t.Fatalf("go dump failed: %s", err)
+	}
+	var subset bytes.Buffer
+	tables, err := WriteSubsetDump(ctx, s.opts, []SubsetRoot{{Table: "orders", Where: "quantity > 1"}}, &subset)
+	if err != nil {
+		t.Fatalf("subset dump failed: %s", err)
+	}
+	if want := []SubsetTable{{Table: "public.orders", Rows: 2}, {Table: "public.users", Rows: 1}}; fmt.Sprint(tables) != fmt.Sprint(want) {
+		t.Errorf("subset selected %v, want %v", tables, want)
+	}
+
+	for _, c := range []struct {
+		dbname string
+		dump   []byte
+		users  string
+		orders string
+		after  string // Orders in the view after inserting one
+	}{
+		{"full_restore", full.Bytes(), "2", "3", "4"},
+		{"subset_restore", subset.Bytes(), "1", "2", "3"},
+	} {
+		s.exec(t, "testdb", "CREATE DATABASE "+c.dbname)
+		s.psql(t, c.dbname, c.dump)
+		if got := s.query(t, c.dbname, "SELECT count(*) FROM public.users"); got != c.users {
+			t.Errorf("%s: %s users, want %s", c.dbname, got, c.users)
+		}
+		if got := s.query(t, c.dbname, "SELECT count(*) FROM public.orders"); got != c.orders {
+			t.Errorf("%s: %s orders, want %s", c.dbname, got, c.orders)
+		}
+		// The serial default, the foreign key and the types still work.
+		s.exec(t, c.dbname, "INSERT INTO public.orders (user_id, quantity) VALUES (1, 5)")
+		if got := s.query(t, c.dbname, "SELECT sum(orders)::text FROM public.user_orders"); got != c.after {
+			t.Errorf("%s: user_orders counts %s orders, want %s", c.dbname, got, c.after)
+		}
+	}
+}
+
+// TestParseSubsetRoot verifies the forms accepted by -subset.
+func TestParseSubsetRoot(t *testing.T) {
+	cases := map[string]SubsetRoot{
+		"customers":                        {Table: "customers"},
+		"public.customers 2.5%":            {Table: "public.customers", Percent: 2.5},
+		"orders where id < 100":            {Table: "orders", Where: "id < 100"},
+		"orders 10% WHERE status = 'open'": {Table: "orders", Percent: 10, Where: "status = 'open'"},
+	}
+	for in, want := range cases {
+		got, err := ParseSubsetRoot(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSubsetRoot(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+		if again, err := ParseSubsetRoot(got.String()); err != nil || again != got {
+			t.Errorf("ParseSubsetRoot(%q) does not round-trip: %+v, %v", got.String(), again, err)
+		}
+	}
+	for _, in := range []string{"", "orders 0%", "orders 150%", "orders limit 5", "orders WHERE "} {
+		if _, err := ParseSubsetRoot(in); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
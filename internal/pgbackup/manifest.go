@@ -0,0 +1,161 @@
+package pgbackup
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// ManifestSuffix is appended to a backup file's path to name its manifest.
+const ManifestSuffix = ".manifest.json"
+
+// Manifest describes a backup file and the database it was taken from.
+type Manifest struct {
+	Database  string    `json:"database"`
+	Host      string    `json:"host"`
+	Port      int       `json:"port"`
+	File      string    `json:"file"`
+	Format    string    `json:"format"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Encoding  string    `json:"encoding"`
+	Collate   string    `json:"collate"`
+	CType     string    `json:"ctype"`
+	Owner     string    `json:"owner"`
+
+	// Server is a snapshot of the source server: version, extensions,
+	// changed settings, role memberships and the database's size.
+	Server *ServerSnapshot `json:"server,omitempty"`
+
+	Engine      Engine `json:"engine"`                 // Engine that wrote the backup
+	DumpBinary  string `json:"dump_binary,omitempty"`  // pg_dump that wrote the backup
+	DumpVersion string `json:"dump_version,omitempty"` // Its version, e.g. "16.2"
+
+	// Masked is set when the backup's data was masked while it was written.
+	Masked         bool     `json:"masked,omitempty"`
+	MaskingRuleset string   `json:"masking_ruleset,omitempty"` // Name of the ruleset applied
+	MaskedColumns  []string `json:"masked_columns,omitempty"`  // "schema.table.column" of every masked column
+
+	// SubsetRoots is set when the backup holds only the rows reachable from
+	// these roots, and Subset the rows it holds per table.
+	SubsetRoots []string      `json:"subset_roots,omitempty"`
+	Subset      []SubsetTable `json:"subset,omitempty"`
+
+	// Safety is set on the automatic backup taken before a restore drops
+	// the database. It is a copy of the target rather than a scheduled
+	// backup of the source.
+	Safety bool `json:"safety,omitempty"`
+
+	// Tables records the row count and checksum of every table, when the
+	// backup was taken with checksums.
+	Tables []TableChecksum `json:"tables,omitempty"`
+
+	// Checksum is the SHA-256 of the backup file, as "sha256:<hex>".
+	Checksum string `json:"checksum,omitempty"`
+
+	// Previous links the manifest to the one of the previous backup of the
+	// same database in the same directory, chaining them so a removed or
+	// altered backup shows up.
+	Previous *ManifestLink `json:"previous,omitempty"`
+}
+
+// ManifestLink identifies another backup's manifest by content.
+type ManifestLink struct {
+	File   string `json:"file"`   // Backup file name
+	SHA256 string `json:"sha256"` // Hex SHA-256 of its manifest file
+}
+
+// ManifestPath returns the path of the manifest belonging to backupPath.
+func ManifestPath(backupPath string) string {
+	return backupPath + ManifestSuffix
+}
+
+// CaptureManifest connects to the database and records the properties needed
+// to recreate it faithfully on restore, and a snapshot of the server.
+func CaptureManifest(host string, port int, user, password, dbname string) (*Manifest, error) {
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		host, port, user, password, dbname)
+
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	m := &Manifest{
+		Database:  dbname,
+		Host:      host,
+		Port:      port,
+		Format:    "plain",
+		CreatedAt: time.Now().UTC(),
+	}
+	err = db.QueryRow(`
+		SELECT pg_encoding_to_char(encoding), datcollate, datctype, pg_get_userbyid(datdba)
+		FROM pg_database WHERE datname = $1`, dbname).Scan(&m.Encoding, &m.Collate, &m.CType, &m.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database properties: %w", err)
+	}
+	if m.Server, err = captureServer(db); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteManifest stores m next to the backup file at backupPath, filling in
+// the file name, size and checksum.
+func WriteManifest(backupPath string, m *Manifest) error {
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat backup file %s: %w", backupPath, err)
+	}
+	m.File = filepath.Base(backupPath)
+	m.Size = info.Size()
+	if m.Checksum, err = FileChecksum(backupPath); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(ManifestPath(backupPath), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// FileChecksum returns the SHA-256 of a file, as "sha256:<hex>".
+func FileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to checksum %s: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to checksum %s: %w", path, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ReadManifest loads the manifest belonging to backupPath. It returns an
+// error satisfying os.IsNotExist when the backup has no manifest.
+func ReadManifest(backupPath string) (*Manifest, error) {
+	data, err := os.ReadFile(ManifestPath(backupPath))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest for %s: %w", backupPath, err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,284 @@
+package pgbackup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/masking"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbin"
+)
+
+// Options describes a backup to run.
+type Options struct {
+	Host       string
+	Port       int
+	User       string
+	Password   string
+	DBName     string
+	OutputPath string // Full path of the backup file to write
+
+	// DumpBinary is the pg_dump to run. Empty selects the newest installed
+	// pg_dump that supports the server, searching ClientBinDirs as well.
+	DumpBinary    string
+	ClientBinDirs []string
+
+	// Engine selects pg_dump or the built-in Go engine. EngineAuto falls
+	// back to the Go engine when no pg_dump is installed.
+	Engine Engine
+
+	// Masking, if set, masks the table data as it is written.
+	Masking *masking.Ruleset
+
+	// Subset, if set, dumps only the rows reachable from these roots. It
+	// requires the Go engine.
+	Subset []SubsetRoot
+
+	// Safety marks the backup in its manifest as the safety backup taken
+	// before a restore drops the database.
+	Safety bool
+
+	// SigningKey, if set, signs the backup's manifest.
+	SigningKey ed25519.PrivateKey
+
+	// Checksums, if set, records the row count and checksum of every table
+	// in the manifest, read in the snapshot that was dumped.
+	Checksums *ChecksumOptions
+
+	// snapshot is the exported snapshot the dump reads, set while
+	// checksums are taken.
+	snapshot string
+}
+
+// OutputPath constructs a unique filename for a backup of dbname inside backupDir.
+func OutputPath(backupDir, dbname string) string {
+	timestamp := time.Now().Format("20060102-150405")
+	filename := fmt.Sprintf("%s-backup-%s.sql", dbname, timestamp)
+	return filepath.Join(backupDir, filename)
+}
+
+// Run creates the destination directory, dumps the database to
+// opts.OutputPath and records its manifest next to it.
+func Run(opts Options) (*Manifest, error) {
+	// First, create the destination directory if it doesn't exist.
+	if err := CreateDestinationDir(filepath.Dir(opts.OutputPath)); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	engine := SelectEngine(opts)
+	result, err := dumpWithChecksums(opts, func(opts Options) (*dumpResult, error) {
+		if engine == EnginePgDump && opts.Masking == nil && len(opts.Subset) == 0 {
+			// pg_dump writes the file itself when nothing filters its output.
+			binary, err := ResolveDumpBinary(opts)
+			if err != nil {
+				return nil, err
+			}
+			cmd := dumpCommand(binary.Path, opts, opts.OutputPath)
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return nil, fmt.Errorf("pg_dump failed: %s: %w", string(output), err)
+			}
+			return &dumpResult{engine: engine, binary: binary}, nil
+		}
+		var result *dumpResult
+		err := writeFile(opts.OutputPath, func(w io.Writer) error {
+			var err error
+			result, err = writeDump(context.Background(), opts, engine, w)
+			return err
+		})
+		return result, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Record the source database's properties next to the backup.
+	manifest, err := result.manifest(opts)
+	if err != nil {
+		return nil, fmt.Errorf("backup written but %w", err)
+	}
+	manifest.Previous = previousLink(filepath.Dir(opts.OutputPath), manifest)
+	if err := WriteManifest(opts.OutputPath, manifest); err != nil {
+		return nil, fmt.Errorf("backup written but failed to record manifest: %w", err)
+	}
+	if opts.SigningKey != nil {
+		if err := SignManifest(opts.OutputPath, opts.SigningKey); err != nil {
+			return nil, fmt.Errorf("backup written but %w", err)
+		}
+	}
+	return manifest, nil
+}
+
+// WriteDump streams a plain SQL dump of the database to w instead of a file
+// and returns its manifest. The manifest's File and Size are left for the
+// caller to fill in.
+func WriteDump(opts Options, w io.Writer) (*Manifest, error) {
+	result, err := dumpWithChecksums(opts, func(opts Options) (*dumpResult, error) {
+		return writeDump(context.Background(), opts, SelectEngine(opts), w)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.manifest(opts)
+}
+
+// dumpResult records how a dump was written, for its manifest.
+type dumpResult struct {
+	engine Engine
+	binary pgbin.Binary // pg_dump, for EnginePgDump
+	masked []string
+	subset []SubsetTable
+	tables []TableChecksum
+}
+
+// writeDump dumps the database to w with engine, through the masking rules
+// of opts if any.
+func writeDump(ctx context.Context, opts Options, engine Engine, w io.Writer) (*dumpResult, error) {
+	result := &dumpResult{engine: engine}
+
+	var mw *masking.Writer
+	if opts.Masking != nil {
+		mw = masking.NewWriter(w, opts.Masking)
+		w = mw
+	}
+
+	switch {
+	case len(opts.Subset) > 0:
+		if engine != EngineGo {
+			return nil, fmt.Errorf("subset dumps require the Go engine")
+		}
+		var err error
+		if result.subset, err = WriteSubsetDump(ctx, opts, opts.Subset, w); err != nil {
+			return nil, fmt.Errorf("subset dump failed: %w", err)
+		}
+	case engine == EngineGo:
+		if err := WriteGoDump(ctx, opts, w); err != nil {
+			return nil, fmt.Errorf("go dump engine failed: %w", err)
+		}
+	default:
+		binary, err := ResolveDumpBinary(opts)
+		if err != nil {
+			return nil, err
+		}
+		result.binary = binary
+		var stderr bytes.Buffer
+		cmd := dumpCommand(binary.Path, opts, "")
+		cmd.Stdout = w
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("pg_dump failed: %s: %w", stderr.String(), err)
+		}
+	}
+
+	if mw != nil {
+		if err := mw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to mask backup: %w", err)
+		}
+		result.masked = mw.Masked()
+		if missing := opts.Masking.Unapplied(result.masked); len(missing) > 0 {
+			return nil, fmt.Errorf("masking rules %s name columns the dump does not hold, so their data may be unmasked: %s",
+				opts.Masking.Name, strings.Join(missing, ", "))
+		}
+	}
+	return result, nil
+}
+
+// manifest captures the source database's properties and records how the
+// dump was written.
+func (r *dumpResult) manifest(opts Options) (*Manifest, error) {
+	manifest, err := CaptureManifest(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record manifest: %w", err)
+	}
+	manifest.Engine = r.engine
+	if r.engine == EnginePgDump {
+		manifest.DumpBinary = r.binary.Path
+		manifest.DumpVersion = pgbin.FormatVersion(r.binary.Version)
+	}
+	if opts.Masking != nil {
+		manifest.Masked = true
+		manifest.MaskingRuleset = opts.Masking.Name
+		manifest.MaskedColumns = r.masked
+	}
+	for _, root := range opts.Subset {
+		manifest.SubsetRoots = append(manifest.SubsetRoots, root.String())
+	}
+	manifest.Subset = r.subset
+	manifest.Safety = opts.Safety
+	manifest.Tables = r.tables
+	return manifest, nil
+}
+
+// dumpCommand prepares pg_dump for opts, reading the exported snapshot if
+// one is set.
+func dumpCommand(binary string, opts Options, outputPath string) *exec.Cmd {
+	cmd := PrepareDumpCommand(binary, opts.Host, opts.Port, opts.User, opts.Password, opts.DBName, outputPath)
+	if opts.snapshot != "" {
+		cmd.Args = append(cmd.Args, "--snapshot="+opts.snapshot)
+	}
+	return cmd
+}
+
+// writeFile creates path and lets write fill it through a buffer.
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	bw := bufio.NewWriterSize(f, 1<<20)
+	if err := write(bw); err != nil {
+		// A failed dump may hold data a masking rule missed.
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write backup file: %w", err)
+	}
+	return nil
+}
+
+// ResolveDumpBinary returns the pg_dump to use for opts: opts.DumpBinary if
+// set, otherwise the newest installed pg_dump supporting the server's version.
+func ResolveDumpBinary(opts Options) (pgbin.Binary, error) {
+	if opts.DumpBinary != "" {
+		version, err := pgbin.ClientVersion(opts.DumpBinary)
+		if err != nil {
+			return pgbin.Binary{}, err
+		}
+		return pgbin.Binary{Path: opts.DumpBinary, Version: version}, nil
+	}
+
+	serverVersion, err := pgbin.ServerVersion(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName)
+	if err != nil {
+		return pgbin.Binary{}, err
+	}
+	return pgbin.Resolve("pg_dump", opts.ClientBinDirs, serverVersion)
+}
+
+// SelectEngine resolves EngineAuto to the engine a backup will use: pg_dump
+// when one is installed or forced, the Go engine otherwise. Subset dumps
+// always use the Go engine.
+func SelectEngine(opts Options) Engine {
+	if opts.Engine != EngineAuto {
+		return opts.Engine
+	}
+	if len(opts.Subset) > 0 {
+		return EngineGo
+	}
+	if opts.DumpBinary != "" || len(pgbin.Discover("pg_dump", opts.ClientBinDirs)) > 0 {
+		return EnginePgDump
+	}
+	return EngineGo
+}
@@ -0,0 +1,801 @@
+package pgbackup
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ObjectKind names the kind of a schema object.
+type ObjectKind string
+
+const (
+	KindSchema           ObjectKind = "schema"
+	KindExtension        ObjectKind = "extension"
+	KindType             ObjectKind = "type"
+	KindDomain           ObjectKind = "domain"
+	KindSequence         ObjectKind = "sequence"
+	KindTable            ObjectKind = "table"
+	KindFunction         ObjectKind = "function"
+	KindDefault          ObjectKind = "default"
+	KindSequenceOwner    ObjectKind = "sequence owned by"
+	KindView             ObjectKind = "view"
+	KindMaterializedView ObjectKind = "materialized view"
+	KindConstraint       ObjectKind = "constraint"
+	KindIndex            ObjectKind = "index"
+	KindForeignKey       ObjectKind = "foreign key"
+	KindTrigger          ObjectKind = "trigger"
+	KindRefresh          ObjectKind = "materialized view data"
+)
+
+// SchemaObject is one DDL statement (or a few tightly coupled ones) of a dump.
+type SchemaObject struct {
+	Kind   ObjectKind
+	Schema string // Quoted schema name; empty for schemas and extensions
+	Name   string // Quoted object name, with the argument list for functions
+	Table  string // Quoted, qualified table for defaults, constraints, indexes and triggers
+	SQL    string // Complete statements, each terminated by a semicolon
+}
+
+// TableData describes a table whose rows are dumped with COPY.
+type TableData struct {
+	Name    string   // Quoted, qualified table name
+	Columns []string // Quoted names of the stored (non-generated) columns
+}
+
+// SequenceValue is the current position of a sequence, restored after the data.
+type SequenceValue struct {
+	Name     string // Quoted, qualified sequence name
+	Value    int64
+	IsCalled bool
+}
+
+// Schema is the DDL of a database, split around the table data the way pg_dump does.
+type Schema struct {
+	PreData   []SchemaObject
+	Tables    []TableData
+	Sequences []SequenceValue
+	PostData  []SchemaObject
+}
+
+// querier is satisfied by pgx.Conn and pgx.Tx.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// userNamespace filters out system schemas; n must be the pg_namespace alias.
+const userNamespace = `n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg\_%'`
+
+// notExtensionMember filters out objects created by an extension.
+func notExtensionMember(catalog, oidExpr string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM pg_depend e WHERE e.classid = '%s'::regclass AND e.objid = %s AND e.deptype = 'e')`, catalog, oidExpr)
+}
+
+// ReadSchema reads the catalog through q and returns the DDL needed to
+// recreate the database's schemas, types, sequences, tables, functions,
+// views, constraints, indexes and triggers. It requires PostgreSQL 12 or newer.
+func ReadSchema(ctx context.Context, q querier) (*Schema, error) {
+	var serverVersion int
+	if err := q.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&serverVersion); err != nil {
+		return nil, fmt.Errorf("failed to read server version: %w", err)
+	}
+	if serverVersion < 120000 {
+		return nil, fmt.Errorf("the Go dump engine requires PostgreSQL 12 or newer, server is %d", serverVersion)
+	}
+
+	r := &schemaReader{ctx: ctx, q: q, serverVersion: serverVersion, schema: &Schema{}}
+	steps := []func() error{
+		r.readSchemas,
+		r.readExtensions,
+		r.readTypes,
+		r.readSequences,
+		r.readTables,
+		r.readFunctions,
+		r.readDefaults,
+		r.readViews,
+		r.readSequenceValues,
+		r.readConstraints,
+		r.readIndexes,
+		r.readForeignKeys,
+		r.readTriggers,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+	return r.schema, nil
+}
+
+type schemaReader struct {
+	ctx           context.Context
+	q             querier
+	serverVersion int
+	schema        *Schema
+
+	// Filled by readSequences for readTables and readDefaults.
+	identityOptions map[uint32]map[int16]string // table OID -> column number -> identity options
+	ownedSequences  []SchemaObject
+}
+
+func (r *schemaReader) pre(obj SchemaObject) {
+	r.schema.PreData = append(r.schema.PreData, obj)
+}
+
+func (r *schemaReader) post(obj SchemaObject) {
+	r.schema.PostData = append(r.schema.PostData, obj)
+}
+
+// query runs sql and calls scan for every row.
+func (r *schemaReader) query(what, sql string, scan func(pgx.Rows) error, args ...any) error {
+	rows, err := r.q.Query(r.ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", what, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("failed to read %s: %w", what, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", what, err)
+	}
+	return nil
+}
+
+func ownerSQL(objectType, name, owner string) string {
+	return fmt.Sprintf("ALTER %s %s OWNER TO %s;\n", objectType, name, owner)
+}
+
+func (r *schemaReader) readSchemas() error {
+	return r.query("schemas", `
+		SELECT quote_ident(n.nspname), quote_ident(pg_get_userbyid(n.nspowner))
+		FROM pg_namespace n
+		WHERE `+userNamespace+` AND n.nspname <> 'public'
+		  AND `+notExtensionMember("pg_namespace", "n.oid")+`
+		ORDER BY n.nspname`, func(rows pgx.Rows) error {
+		var name, owner string
+		if err := rows.Scan(&name, &owner); err != nil {
+			return err
+		}
+		r.pre(SchemaObject{
+			Kind: KindSchema,
+			Name: name,
+			SQL:  fmt.Sprintf("CREATE SCHEMA %s;\n", name) + ownerSQL("SCHEMA", name, owner),
+		})
+		return nil
+	})
+}
+
+func (r *schemaReader) readExtensions() error {
+	return r.query("extensions", `
+		SELECT quote_ident(x.extname), quote_ident(n.nspname)
+		FROM pg_extension x
+		JOIN pg_namespace n ON n.oid = x.extnamespace
+		WHERE x.extname <> 'plpgsql'
+		ORDER BY x.extname`, func(rows pgx.Rows) error {
+		var name, schema string
+		if err := rows.Scan(&name, &schema); err != nil {
+			return err
+		}
+		r.pre(SchemaObject{
+			Kind: KindExtension,
+			Name: name,
+			SQL:  fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s WITH SCHEMA %s;\n", name, schema),
+		})
+		return nil
+	})
+}
+
+// readTypes reads enums, composite types and domains in creation order.
+func (r *schemaReader) readTypes() error {
+	return r.query("types", `
+		SELECT quote_ident(n.nspname), quote_ident(t.typname), t.typtype::text,
+		       quote_ident(pg_get_userbyid(t.typowner)),
+		       CASE t.typtype
+		         WHEN 'e' THEN (SELECT string_agg(quote_literal(e.enumlabel), ', ' ORDER BY e.enumsortorder)
+		                        FROM pg_enum e WHERE e.enumtypid = t.oid)
+		         WHEN 'c' THEN (SELECT string_agg(format('%I %s', a.attname, format_type(a.atttypid, a.atttypmod)), ', ' ORDER BY a.attnum)
+		                        FROM pg_attribute a WHERE a.attrelid = t.typrelid AND a.attnum > 0 AND NOT a.attisdropped)
+		         WHEN 'd' THEN format_type(t.typbasetype, t.typtypmod)
+		                       || coalesce(' DEFAULT ' || t.typdefault, '')
+		                       || CASE WHEN t.typnotnull THEN ' NOT NULL' ELSE '' END
+		                       || coalesce((SELECT string_agg(format(' CONSTRAINT %I %s', c.conname, pg_get_constraintdef(c.oid)), '' ORDER BY c.conname)
+		                                    FROM pg_constraint c WHERE c.contypid = t.oid AND c.contype = 'c'), '')
+		       END
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE `+userNamespace+`
+		  AND (t.typtype IN ('e', 'd')
+		       OR (t.typtype = 'c' AND (SELECT c.relkind FROM pg_class c WHERE c.oid = t.typrelid) = 'c'))
+		  AND `+notExtensionMember("pg_type", "t.oid")+`
+		ORDER BY t.oid`, func(rows pgx.Rows) error {
+		var schema, name, typtype, owner string
+		var body *string
+		if err := rows.Scan(&schema, &name, &typtype, &owner, &body); err != nil {
+			return err
+		}
+		qualified := schema + "." + name
+		def := ""
+		if body != nil {
+			def = *body
+		}
+		obj := SchemaObject{Kind: KindType, Schema: schema, Name: name}
+		switch typtype {
+		case "e":
+			obj.SQL = fmt.Sprintf("CREATE TYPE %s AS ENUM (%s);\n", qualified, def)
+		case "c":
+			obj.SQL = fmt.Sprintf("CREATE TYPE %s AS (%s);\n", qualified, def)
+		case "d":
+			obj.Kind = KindDomain
+			obj.SQL = fmt.Sprintf("CREATE DOMAIN %s AS %s;\n", qualified, def)
+		}
+		if obj.Kind == KindDomain {
+			obj.SQL += ownerSQL("DOMAIN", qualified, owner)
+		} else {
+			obj.SQL += ownerSQL("TYPE", qualified, owner)
+		}
+		r.pre(obj)
+		return nil
+	})
+}
+
+// readSequences emits standalone and serial sequences. Identity sequences are
+// created with their column, so only their options are remembered.
+func (r *schemaReader) readSequences() error {
+	r.identityOptions = map[uint32]map[int16]string{}
+	return r.query("sequences", `
+		SELECT quote_ident(n.nspname), quote_ident(c.relname), quote_ident(pg_get_userbyid(c.relowner)),
+		       format_type(s.seqtypid, NULL), s.seqstart, s.seqincrement, s.seqmin, s.seqmax, s.seqcache, s.seqcycle,
+		       d.deptype::text, d.refobjid, d.refobjsubid::int2,
+		       format('%I.%I', tn.nspname, tc.relname), quote_ident(a.attname)
+		FROM pg_sequence s
+		JOIN pg_class c ON c.oid = s.seqrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = c.oid
+		     AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+		LEFT JOIN pg_class tc ON tc.oid = d.refobjid
+		LEFT JOIN pg_namespace tn ON tn.oid = tc.relnamespace
+		LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+		WHERE `+userNamespace+` AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY c.oid`, func(rows pgx.Rows) error {
+		var schema, name, owner, typ string
+		var start, increment, min, max, cache int64
+		var cycle bool
+		var deptype, table, column *string
+		var tableOID *uint32
+		var attnum *int16
+		if err := rows.Scan(&schema, &name, &owner, &typ, &start, &increment, &min, &max, &cache, &cycle,
+			&deptype, &tableOID, &attnum, &table, &column); err != nil {
+			return err
+		}
+		options := sequenceOptions(typ, start, increment, min, max, cache, cycle)
+
+		qualified := schema + "." + name
+		if deptype != nil && *deptype == "i" {
+			if r.identityOptions[*tableOID] == nil {
+				r.identityOptions[*tableOID] = map[int16]string{}
+			}
+			r.identityOptions[*tableOID][*attnum] = fmt.Sprintf("SEQUENCE NAME %s %s", qualified, options)
+			return nil
+		}
+
+		r.pre(SchemaObject{
+			Kind:   KindSequence,
+			Schema: schema,
+			Name:   name,
+			SQL:    fmt.Sprintf("CREATE SEQUENCE %s%s %s;\n", qualified, sequenceType(typ), options) + ownerSQL("SEQUENCE", qualified, owner),
+		})
+		if deptype != nil && *deptype == "a" && table != nil && column != nil {
+			r.ownedSequences = append(r.ownedSequences, SchemaObject{
+				Kind:   KindSequenceOwner,
+				Schema: schema,
+				Name:   name,
+				Table:  *table,
+				SQL:    fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s;\n", qualified, *table, *column),
+			})
+		}
+		return nil
+	})
+}
+
+// sequenceOptions renders the options of a sequence of type typ the way
+// pg_dump does, with NO MINVALUE and NO MAXVALUE for the defaults, so schema
+// comparisons with pg_dump backups see the same definition.
+func sequenceOptions(typ string, start, increment, min, max, cache int64, cycle bool) string {
+	lowest, highest := int64(math.MinInt64), int64(math.MaxInt64)
+	switch typ {
+	case "smallint":
+		lowest, highest = math.MinInt16, math.MaxInt16
+	case "integer":
+		lowest, highest = math.MinInt32, math.MaxInt32
+	}
+	defaultMin, defaultMax := int64(1), highest
+	if increment < 0 {
+		defaultMin, defaultMax = lowest, -1
+	}
+
+	options := fmt.Sprintf("START WITH %d INCREMENT BY %d", start, increment)
+	if min == defaultMin {
+		options += " NO MINVALUE"
+	} else {
+		options += fmt.Sprintf(" MINVALUE %d", min)
+	}
+	if max == defaultMax {
+		options += " NO MAXVALUE"
+	} else {
+		options += fmt.Sprintf(" MAXVALUE %d", max)
+	}
+	options += fmt.Sprintf(" CACHE %d", cache)
+	if cycle {
+		options += " CYCLE"
+	}
+	return options
+}
+
+// sequenceType returns the AS clause of a sequence, which pg_dump leaves
+// out for bigint.
+func sequenceType(typ string) string {
+	if typ == "bigint" {
+		return ""
+	}
+	return " AS " + typ
+}
+
+type tableInfo struct {
+	oid         uint32
+	schema      string
+	name        string
+	relkind     string
+	unlogged    bool
+	owner       string
+	parent      *string // Partition parent
+	bound       *string // Partition bound
+	partitionBy *string
+	inherits    *string
+	parentOIDs  []uint32
+}
+
+type columnInfo struct {
+	name      string
+	typ       string
+	notNull   bool
+	identity  string
+	generated string
+	expr      *string
+	collation *string
+	isLocal   bool
+	attnum    int16
+}
+
+func (r *schemaReader) readTables() error {
+	var tables []*tableInfo
+	err := r.query("tables", `
+		SELECT c.oid, quote_ident(n.nspname), quote_ident(c.relname), c.relkind::text, c.relpersistence = 'u',
+		       quote_ident(pg_get_userbyid(c.relowner)),
+		       CASE WHEN c.relispartition THEN
+		         (SELECT format('%I.%I', pn.nspname, p.relname) FROM pg_inherits i
+		          JOIN pg_class p ON p.oid = i.inhparent JOIN pg_namespace pn ON pn.oid = p.relnamespace
+		          WHERE i.inhrelid = c.oid) END,
+		       CASE WHEN c.relispartition THEN pg_get_expr(c.relpartbound, c.oid) END,
+		       CASE WHEN c.relkind = 'p' THEN pg_get_partkeydef(c.oid) END,
+		       CASE WHEN NOT c.relispartition THEN
+		         (SELECT string_agg(format('%I.%I', pn.nspname, p.relname), ', ' ORDER BY i.inhseqno) FROM pg_inherits i
+		          JOIN pg_class p ON p.oid = i.inhparent JOIN pg_namespace pn ON pn.oid = p.relnamespace
+		          WHERE i.inhrelid = c.oid) END,
+		       ARRAY(SELECT i.inhparent FROM pg_inherits i WHERE i.inhrelid = c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p') AND `+userNamespace+`
+		  AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY n.nspname, c.relname`, func(rows pgx.Rows) error {
+		t := &tableInfo{}
+		if err := rows.Scan(&t.oid, &t.schema, &t.name, &t.relkind, &t.unlogged, &t.owner,
+			&t.parent, &t.bound, &t.partitionBy, &t.inherits, &t.parentOIDs); err != nil {
+			return err
+		}
+		tables = append(tables, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	columns := map[uint32][]columnInfo{}
+	err = r.query("columns", `
+		SELECT a.attrelid, quote_ident(a.attname), format_type(a.atttypid, a.atttypmod), a.attnotnull,
+		       a.attidentity::text, a.attgenerated::text,
+		       CASE WHEN a.attgenerated <> '' THEN pg_get_expr(ad.adbin, ad.adrelid) END,
+		       CASE WHEN a.attcollation <> t.typcollation THEN format('%I.%I', cn.nspname, co.collname) END,
+		       a.attislocal, a.attnum
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_type t ON t.oid = a.atttypid
+		LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+		LEFT JOIN pg_collation co ON co.oid = a.attcollation
+		LEFT JOIN pg_namespace cn ON cn.oid = co.collnamespace
+		WHERE c.relkind IN ('r', 'p') AND `+userNamespace+` AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attrelid, a.attnum`, func(rows pgx.Rows) error {
+		var oid uint32
+		var col columnInfo
+		if err := rows.Scan(&oid, &col.name, &col.typ, &col.notNull, &col.identity, &col.generated,
+			&col.expr, &col.collation, &col.isLocal, &col.attnum); err != nil {
+			return err
+		}
+		columns[oid] = append(columns[oid], col)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Parents must exist before their partitions and inheritance children.
+	byOID := map[uint32]*tableInfo{}
+	ids := make([]uint32, len(tables))
+	deps := map[uint32][]uint32{}
+	for i, t := range tables {
+		byOID[t.oid] = t
+		ids[i] = t.oid
+		deps[t.oid] = t.parentOIDs
+	}
+	for _, oid := range topoSort(ids, deps) {
+		t := byOID[oid]
+		r.pre(r.tableObject(t, columns[t.oid]))
+		if t.relkind == "r" {
+			data := TableData{Name: t.schema + "." + t.name}
+			for _, col := range columns[t.oid] {
+				if col.generated == "" {
+					data.Columns = append(data.Columns, col.name)
+				}
+			}
+			r.schema.Tables = append(r.schema.Tables, data)
+		}
+	}
+	return nil
+}
+
+func (r *schemaReader) tableObject(t *tableInfo, columns []columnInfo) SchemaObject {
+	qualified := t.schema + "." + t.name
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	if t.unlogged {
+		b.WriteString("UNLOGGED ")
+	}
+	b.WriteString("TABLE ")
+	b.WriteString(qualified)
+
+	if t.parent != nil {
+		// Partitions take their columns from the parent.
+		fmt.Fprintf(&b, " PARTITION OF %s", *t.parent)
+		if t.bound != nil {
+			fmt.Fprintf(&b, " %s", *t.bound)
+		}
+	} else {
+		var defs []string
+		for _, col := range columns {
+			if !col.isLocal {
+				continue
+			}
+			def := col.name + " " + col.typ
+			if col.collation != nil {
+				def += " COLLATE " + *col.collation
+			}
+			switch col.identity {
+			case "a", "d":
+				// Identity columns are always NOT NULL, pg_dump says so first.
+				def += " NOT NULL"
+				kind := "ALWAYS"
+				if col.identity == "d" {
+					kind = "BY DEFAULT"
+				}
+				def += " GENERATED " + kind + " AS IDENTITY"
+				if options := r.identityOptions[t.oid][col.attnum]; options != "" {
+					def += " (" + options + ")"
+				}
+			}
+			if col.generated == "s" && col.expr != nil {
+				def += " GENERATED ALWAYS AS (" + *col.expr + ") STORED"
+			}
+			if col.notNull && col.identity == "" {
+				def += " NOT NULL"
+			}
+			defs = append(defs, "    "+def)
+		}
+		b.WriteString(" (\n")
+		b.WriteString(strings.Join(defs, ",\n"))
+		b.WriteString("\n)")
+		if t.inherits != nil {
+			fmt.Fprintf(&b, "\nINHERITS (%s)", *t.inherits)
+		}
+	}
+	if t.partitionBy != nil {
+		fmt.Fprintf(&b, "\nPARTITION BY %s", *t.partitionBy)
+	}
+	b.WriteString(";\n")
+	b.WriteString(ownerSQL("TABLE", qualified, t.owner))
+
+	return SchemaObject{Kind: KindTable, Schema: t.schema, Name: t.name, SQL: b.String()}
+}
+
+func (r *schemaReader) readFunctions() error {
+	return r.query("functions", `
+		SELECT quote_ident(n.nspname), format('%I(%s)', p.proname, pg_get_function_identity_arguments(p.oid)),
+		       p.prokind::text, pg_get_functiondef(p.oid), quote_ident(pg_get_userbyid(p.proowner))
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE p.prokind IN ('f', 'p') AND `+userNamespace+`
+		  AND `+notExtensionMember("pg_proc", "p.oid")+`
+		ORDER BY n.nspname, p.proname, p.oid`, func(rows pgx.Rows) error {
+		var schema, name, kind, def, owner string
+		if err := rows.Scan(&schema, &name, &kind, &def, &owner); err != nil {
+			return err
+		}
+		objectType := "FUNCTION"
+		if kind == "p" {
+			objectType = "PROCEDURE"
+		}
+		r.pre(SchemaObject{
+			Kind:   KindFunction,
+			Schema: schema,
+			Name:   name,
+			SQL:    strings.TrimRight(def, "\n") + ";\n" + ownerSQL(objectType, schema+"."+name, owner),
+		})
+		return nil
+	})
+}
+
+// readDefaults sets column defaults once functions exist, since defaults
+// may call them. Sequences are tied to their serial columns here too.
+func (r *schemaReader) readDefaults() error {
+	err := r.query("column defaults", `
+		SELECT format('%I.%I', n.nspname, c.relname), quote_ident(a.attname), pg_get_expr(ad.adbin, ad.adrelid)
+		FROM pg_attrdef ad
+		JOIN pg_attribute a ON a.attrelid = ad.adrelid AND a.attnum = ad.adnum
+		JOIN pg_class c ON c.oid = ad.adrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p') AND a.attgenerated = '' AND `+userNamespace+`
+		  AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY n.nspname, c.relname, a.attnum`, func(rows pgx.Rows) error {
+		var table, column, expr string
+		if err := rows.Scan(&table, &column, &expr); err != nil {
+			return err
+		}
+		r.pre(SchemaObject{
+			Kind:  KindDefault,
+			Name:  column,
+			Table: table,
+			SQL:   fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s;\n", table, column, expr),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.schema.PreData = append(r.schema.PreData, r.ownedSequences...)
+	return nil
+}
+
+func (r *schemaReader) readViews() error {
+	type view struct {
+		oid                          uint32
+		schema, name, kind, def, own string
+		deps                         []uint32
+	}
+	var views []view
+	err := r.query("views", `
+		SELECT c.oid, quote_ident(n.nspname), quote_ident(c.relname), c.relkind::text, pg_get_viewdef(c.oid),
+		       quote_ident(pg_get_userbyid(c.relowner)),
+		       ARRAY(SELECT DISTINCT d.refobjid FROM pg_rewrite rw
+		             JOIN pg_depend d ON d.classid = 'pg_rewrite'::regclass AND d.objid = rw.oid
+		             WHERE rw.ev_class = c.oid AND d.refclassid = 'pg_class'::regclass AND d.refobjid <> c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('v', 'm') AND `+userNamespace+`
+		  AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY n.nspname, c.relname`, func(rows pgx.Rows) error {
+		var v view
+		if err := rows.Scan(&v.oid, &v.schema, &v.name, &v.kind, &v.def, &v.own, &v.deps); err != nil {
+			return err
+		}
+		views = append(views, v)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	byOID := map[uint32]view{}
+	ids := make([]uint32, len(views))
+	deps := map[uint32][]uint32{}
+	for i, v := range views {
+		byOID[v.oid] = v
+		ids[i] = v.oid
+		deps[v.oid] = v.deps
+	}
+	for _, oid := range topoSort(ids, deps) {
+		v := byOID[oid]
+		qualified := v.schema + "." + v.name
+		body := strings.TrimSuffix(strings.TrimSpace(v.def), ";")
+		if v.kind == "m" {
+			r.pre(SchemaObject{
+				Kind:   KindMaterializedView,
+				Schema: v.schema,
+				Name:   v.name,
+				SQL: fmt.Sprintf("CREATE MATERIALIZED VIEW %s AS\n%s\nWITH NO DATA;\n", qualified, body) +
+					ownerSQL("MATERIALIZED VIEW", qualified, v.own),
+			})
+			r.post(SchemaObject{
+				Kind:   KindRefresh,
+				Schema: v.schema,
+				Name:   v.name,
+				SQL:    fmt.Sprintf("REFRESH MATERIALIZED VIEW %s;\n", qualified),
+			})
+			continue
+		}
+		r.pre(SchemaObject{
+			Kind:   KindView,
+			Schema: v.schema,
+			Name:   v.name,
+			SQL:    fmt.Sprintf("CREATE VIEW %s AS\n%s;\n", qualified, body) + ownerSQL("VIEW", qualified, v.own),
+		})
+	}
+	return nil
+}
+
+// readSequenceValues reads the current position of every sequence,
+// including identity sequences.
+func (r *schemaReader) readSequenceValues() error {
+	var names []string
+	err := r.query("sequence names", `
+		SELECT format('%I.%I', n.nspname, c.relname)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'S' AND `+userNamespace+`
+		  AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY 1`, func(rows pgx.Rows) error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		seq := SequenceValue{Name: name}
+		if err := r.q.QueryRow(r.ctx, "SELECT last_value, is_called FROM "+name).Scan(&seq.Value, &seq.IsCalled); err != nil {
+			return fmt.Errorf("failed to read sequence %s: %w", name, err)
+		}
+		r.schema.Sequences = append(r.schema.Sequences, seq)
+	}
+	return nil
+}
+
+// constraintQuery selects local constraints of the given types on user tables.
+func constraintQuery(types string) string {
+	return `
+		SELECT format('%I.%I', n.nspname, c.relname), quote_ident(con.conname), pg_get_constraintdef(con.oid)
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE con.contype IN (` + types + `) AND con.conislocal AND con.conparentid = 0
+		  AND c.relkind IN ('r', 'p') AND ` + userNamespace + `
+		  AND ` + notExtensionMember("pg_class", "c.oid") + `
+		ORDER BY n.nspname, c.relname, con.conname`
+}
+
+func (r *schemaReader) readConstraintKind(what, types string, kind ObjectKind) error {
+	return r.query(what, constraintQuery(types), func(rows pgx.Rows) error {
+		var table, name, def string
+		if err := rows.Scan(&table, &name, &def); err != nil {
+			return err
+		}
+		r.post(SchemaObject{
+			Kind:  kind,
+			Name:  name,
+			Table: table,
+			SQL:   fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;\n", table, name, def),
+		})
+		return nil
+	})
+}
+
+func (r *schemaReader) readConstraints() error {
+	return r.readConstraintKind("constraints", "'p', 'u', 'x', 'c'", KindConstraint)
+}
+
+func (r *schemaReader) readForeignKeys() error {
+	return r.readConstraintKind("foreign keys", "'f'", KindForeignKey)
+}
+
+// readIndexes reads indexes that do not back a constraint. Indexes attached
+// to a partitioned parent's index are created by the parent's.
+func (r *schemaReader) readIndexes() error {
+	return r.query("indexes", `
+		SELECT format('%I.%I', n.nspname, c.relname), quote_ident(ic.relname), c.relkind::text, pg_get_indexdef(i.indexrelid)
+		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p', 'm') AND `+userNamespace+`
+		  AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = i.indexrelid AND con.contype IN ('p', 'u', 'x'))
+		  AND NOT EXISTS (SELECT 1 FROM pg_inherits inh WHERE inh.inhrelid = i.indexrelid)
+		  AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY n.nspname, c.relname, ic.relname`, func(rows pgx.Rows) error {
+		var table, name, relkind, def string
+		if err := rows.Scan(&table, &name, &relkind, &def); err != nil {
+			return err
+		}
+		if relkind == "p" {
+			// Without ONLY the index cascades to every partition.
+			def = strings.Replace(def, " ON ONLY ", " ON ", 1)
+		}
+		r.post(SchemaObject{Kind: KindIndex, Name: name, Table: table, SQL: def + ";\n"})
+		return nil
+	})
+}
+
+func (r *schemaReader) readTriggers() error {
+	// Triggers cloned onto partitions are created by the parent's.
+	clone := ""
+	if r.serverVersion >= 130000 {
+		clone = "AND t.tgparentid = 0"
+	}
+	return r.query("triggers", `
+		SELECT format('%I.%I', n.nspname, c.relname), quote_ident(t.tgname), pg_get_triggerdef(t.oid)
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE NOT t.tgisinternal `+clone+` AND `+userNamespace+`
+		  AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY n.nspname, c.relname, t.tgname`, func(rows pgx.Rows) error {
+		var table, name, def string
+		if err := rows.Scan(&table, &name, &def); err != nil {
+			return err
+		}
+		r.post(SchemaObject{Kind: KindTrigger, Name: name, Table: table, SQL: def + ";\n"})
+		return nil
+	})
+}
+
+// topoSort orders ids so that each comes after the ids it depends on,
+// keeping the input order otherwise. Dependencies outside ids are ignored and
+// cycles are broken in input order.
+func topoSort(ids []uint32, deps map[uint32][]uint32) []uint32 {
+	present := map[uint32]bool{}
+	for _, id := range ids {
+		present[id] = true
+	}
+
+	done := map[uint32]bool{}
+	visiting := map[uint32]bool{}
+	var sorted []uint32
+	var visit func(id uint32)
+	visit = func(id uint32) {
+		if done[id] || visiting[id] {
+			return
+		}
+		visiting[id] = true
+		for _, dep := range deps[id] {
+			if present[dep] {
+				visit(dep)
+			}
+		}
+		visiting[id] = false
+		done[id] = true
+		sorted = append(sorted, id)
+	}
+	for _, id := range ids {
+		visit(id)
+	}
+	return sorted
+}
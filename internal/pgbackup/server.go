@@ -0,0 +1,117 @@
+package pgbackup
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ServerSnapshot describes the server a backup was taken from, so a restore
+// that misbehaves can be compared with where the data came from. The
+// database's encoding and collation are recorded in the manifest itself.
+type ServerSnapshot struct {
+	Version         string           `json:"version"`     // server_version, e.g. "16.2 (Debian 16.2-1.pgdg120+2)"
+	VersionNum      int              `json:"version_num"` // server_version_num, e.g. 160002
+	Extensions      []Extension      `json:"extensions"`
+	Settings        []Setting        `json:"settings"` // Settings not at their built-in default
+	RoleMemberships []RoleMembership `json:"role_memberships"`
+	DatabaseSize    int64            `json:"database_size"` // Bytes, as reported by pg_database_size
+}
+
+// Extension is an extension installed in the backed-up database.
+type Extension struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Schema  string `json:"schema"`
+}
+
+// Setting is a server setting that was changed from its default, and where.
+type Setting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Unit   string `json:"unit,omitempty"`
+	Source string `json:"source"` // pg_settings.source, e.g. "configuration file"
+}
+
+// RoleMembership records that Member is a member of Role.
+type RoleMembership struct {
+	Role        string `json:"role"`
+	Member      string `json:"member"`
+	AdminOption bool   `json:"admin_option,omitempty"`
+}
+
+// captureServer reads the server snapshot through db, connected to the
+// backed-up database.
+func captureServer(db *sql.DB) (*ServerSnapshot, error) {
+	s := &ServerSnapshot{}
+	err := db.QueryRow(`
+		SELECT current_setting('server_version'), current_setting('server_version_num')::int,
+			pg_database_size(current_database())`).Scan(&s.Version, &s.VersionNum, &s.DatabaseSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server version: %w", err)
+	}
+
+	err = queryRows(db, `
+		SELECT e.extname, e.extversion, n.nspname
+		FROM pg_extension e JOIN pg_namespace n ON n.oid = e.extnamespace
+		ORDER BY e.extname`, func(rows *sql.Rows) error {
+		var e Extension
+		if err := rows.Scan(&e.Name, &e.Version, &e.Schema); err != nil {
+			return err
+		}
+		s.Extensions = append(s.Extensions, e)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extensions: %w", err)
+	}
+
+	// Settings made by this connection say nothing about the server.
+	err = queryRows(db, `
+		SELECT name, setting, coalesce(unit, ''), source
+		FROM pg_settings
+		WHERE source NOT IN ('default', 'override', 'client', 'session')
+		ORDER BY name`, func(rows *sql.Rows) error {
+		var st Setting
+		if err := rows.Scan(&st.Name, &st.Value, &st.Unit, &st.Source); err != nil {
+			return err
+		}
+		s.Settings = append(s.Settings, st)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings: %w", err)
+	}
+
+	err = queryRows(db, `
+		SELECT r.rolname, m.rolname, am.admin_option
+		FROM pg_auth_members am
+		JOIN pg_roles r ON r.oid = am.roleid
+		JOIN pg_roles m ON m.oid = am.member
+		ORDER BY 1, 2`, func(rows *sql.Rows) error {
+		var rm RoleMembership
+		if err := rows.Scan(&rm.Role, &rm.Member, &rm.AdminOption); err != nil {
+			return err
+		}
+		s.RoleMemberships = append(s.RoleMemberships, rm)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read role memberships: %w", err)
+	}
+	return s, nil
+}
+
+// queryRows runs query and calls scan for every row.
+func queryRows(db *sql.DB, query string, scan func(*sql.Rows) error) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,345 @@
+package pgbackup
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SignatureSuffix is appended to a manifest's path to name its signature.
+const SignatureSuffix = ".sig"
+
+// SignaturePath returns the path of the signature of backupPath's manifest.
+func SignaturePath(backupPath string) string {
+	return ManifestPath(backupPath) + SignatureSuffix
+}
+
+// Signature is a detached Ed25519 signature over the exact bytes of a
+// manifest file. The manifest holds the backup's checksum and the hash of
+// the previous manifest, so the signature covers both.
+type Signature struct {
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+// GenerateSigningKey writes a new Ed25519 private key to privPath and its
+// public key to privPath + ".pub", both PEM encoded.
+func GenerateSigningKey(privPath string) (ed25519.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	if err := os.WriteFile(privPath+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write public key: %w", err)
+	}
+	return pub, nil
+}
+
+// LoadSigningKey reads a PEM encoded Ed25519 private key.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an Ed25519 key", path)
+	}
+	return priv, nil
+}
+
+// LoadVerifyKeys reads PEM encoded Ed25519 public keys. A private key file
+// contributes its public key. Empty paths are skipped.
+func LoadVerifyKeys(paths ...string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		block, err := readPEM(path)
+		if err != nil {
+			return nil, err
+		}
+		if block.Type == "PRIVATE KEY" {
+			priv, err := LoadSigningKey(path)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, priv.Public().(ed25519.PublicKey))
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key %s is not an Ed25519 key", path)
+		}
+		keys = append(keys, pub)
+	}
+	return keys, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM encoded key", path)
+	}
+	return block, nil
+}
+
+// KeyFingerprint returns a short hex identifier for a public key.
+func KeyFingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignManifest signs the manifest of the backup at backupPath with key.
+func SignManifest(backupPath string, key ed25519.PrivateKey) error {
+	data, err := os.ReadFile(ManifestPath(backupPath))
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	sig := Signature{
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(key, data),
+	}
+	out, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(SignaturePath(backupPath), append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest signature: %w", err)
+	}
+	return nil
+}
+
+// previousLink finds the newest manifest in dir of an earlier backup of the
+// same database and server as m.
+func previousLink(dir string, m *Manifest) *ManifestLink {
+	var link *ManifestLink
+	var newest *Manifest
+	for _, e := range chainEntries(dir) {
+		if !sameChain(e.manifest, m) || !e.manifest.CreatedAt.Before(m.CreatedAt) {
+			continue
+		}
+		if newest == nil || e.manifest.CreatedAt.After(newest.CreatedAt) {
+			newest = e.manifest
+			link = &ManifestLink{File: e.file, SHA256: e.hash}
+		}
+	}
+	return link
+}
+
+// chainEntry is a manifest found in a backup directory.
+type chainEntry struct {
+	file     string // Backup file name
+	hash     string // Hex SHA-256 of the manifest file
+	manifest *Manifest
+}
+
+// chainEntries reads every parseable manifest in dir.
+func chainEntries(dir string) []chainEntry {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+ManifestSuffix))
+	var entries []chainEntry
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var m Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		entries = append(entries, chainEntry{
+			file:     strings.TrimSuffix(filepath.Base(path), ManifestSuffix),
+			hash:     hex.EncodeToString(sum[:]),
+			manifest: &m,
+		})
+	}
+	return entries
+}
+
+func sameChain(a, b *Manifest) bool {
+	return a.Database == b.Database && a.Host == b.Host && a.Port == b.Port
+}
+
+// Trust is how far a backup can be trusted to be unmodified.
+type Trust int
+
+const (
+	// TrustUnsigned means the backup carries no signature.
+	TrustUnsigned Trust = iota
+	// TrustVerified means a trusted key signed the manifest, the file
+	// matches its checksum and the chain is intact.
+	TrustVerified
+	// TrustUnknownKey means the signature is valid but made by a key that
+	// is not trusted.
+	TrustUnknownKey
+	// TrustTampered means the signature, checksum or chain does not match.
+	TrustTampered
+)
+
+func (t Trust) String() string {
+	switch t {
+	case TrustVerified:
+		return "verified"
+	case TrustUnknownKey:
+		return "unknown key"
+	case TrustTampered:
+		return "TAMPERED"
+	default:
+		return "unsigned"
+	}
+}
+
+// Verification is the result of checking one backup.
+type Verification struct {
+	Path     string
+	Manifest *Manifest // Nil when the manifest is missing or unreadable
+	Trust    Trust
+	SignedBy string // Fingerprint of the signing key
+	Problems []string
+}
+
+func (v *Verification) tampered(format string, args ...any) {
+	v.Trust = TrustTampered
+	v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+}
+
+// VerifyBackup checks the signature and checksum of one backup against the
+// trusted keys, and its link to the previous backup in its directory.
+func VerifyBackup(backupPath string, keys []ed25519.PublicKey) Verification {
+	v := verifyFile(backupPath, keys)
+	if v.Manifest != nil {
+		verifyChain(&v, chainEntries(filepath.Dir(backupPath)))
+	}
+	return v
+}
+
+// VerifyDir checks every backup in dir that has a manifest, newest first.
+func VerifyDir(dir string, keys []ed25519.PublicKey) ([]Verification, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+	entries := chainEntries(dir)
+	var results []Verification
+	for _, e := range entries {
+		v := verifyFile(filepath.Join(dir, e.file), keys)
+		if v.Manifest != nil {
+			verifyChain(&v, entries)
+		}
+		results = append(results, v)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i].Manifest, results[j].Manifest
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+	return results, nil
+}
+
+// verifyFile checks a backup's manifest signature and file checksum.
+func verifyFile(backupPath string, keys []ed25519.PublicKey) Verification {
+	v := Verification{Path: backupPath}
+	data, err := os.ReadFile(ManifestPath(backupPath))
+	if err != nil {
+		v.Problems = append(v.Problems, "no manifest")
+		return v
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		v.tampered("manifest is unreadable: %v", err)
+		return v
+	}
+	v.Manifest = &m
+
+	if sigData, err := os.ReadFile(SignaturePath(backupPath)); err == nil {
+		var sig Signature
+		switch {
+		case json.Unmarshal(sigData, &sig) != nil || len(sig.PublicKey) != ed25519.PublicKeySize:
+			v.tampered("signature file is unreadable")
+		case !ed25519.Verify(sig.PublicKey, data, sig.Signature):
+			v.tampered("signature does not match the manifest")
+		default:
+			v.SignedBy = KeyFingerprint(sig.PublicKey)
+			v.Trust = TrustUnknownKey
+			for _, k := range keys {
+				if bytes.Equal(k, sig.PublicKey) {
+					v.Trust = TrustVerified
+				}
+			}
+			if v.Trust == TrustUnknownKey {
+				v.Problems = append(v.Problems, "signed by untrusted key "+v.SignedBy)
+			}
+		}
+	}
+
+	if m.Checksum == "" {
+		v.Problems = append(v.Problems, "no checksum recorded")
+	} else if sum, err := FileChecksum(backupPath); err != nil {
+		v.tampered("backup file is unreadable: %v", err)
+	} else if sum != m.Checksum {
+		v.tampered("backup file was modified after it was created")
+	}
+	return v
+}
+
+// verifyChain checks v's link to the previous backup of the same database.
+func verifyChain(v *Verification, entries []chainEntry) {
+	m := v.Manifest
+	if m.Previous == nil {
+		// A manifest without a link is the start of a chain, unless an
+		// earlier backup of the database was already chained.
+		for _, e := range entries {
+			if sameChain(e.manifest, m) && e.manifest.CreatedAt.Before(m.CreatedAt) && e.manifest.Checksum != "" {
+				v.tampered("not chained to the earlier backup %s", e.file)
+				return
+			}
+		}
+		return
+	}
+	for _, e := range entries {
+		if e.file != m.Previous.File {
+			continue
+		}
+		if e.hash != m.Previous.SHA256 {
+			v.tampered("manifest of the previous backup %s was changed", e.file)
+		}
+		return
+	}
+	v.tampered("previous backup %s is missing", m.Previous.File)
+}
@@ -0,0 +1,100 @@
+package pgbackup
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSignedManifestChain verifies that signed backups verify, and that a
+// modified file, a foreign key and a removed backup are all detected.
+func TestSignedManifestChain(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "signing.pem")
+	if _, err := GenerateSigningKey(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadSigningKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadVerifyKeys(keyPath + ".pub")
+	if err != nil || len(keys) != 1 || !keys[0].Equal(key.Public()) {
+		t.Fatalf("public key %v, %v", keys, err)
+	}
+
+	backups := filepath.Join(dir, "backups")
+	os.Mkdir(backups, 0755)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var paths []string
+	for i := range 3 {
+		path := filepath.Join(backups, "shop-"+string(rune('a'+i))+".sql")
+		writeSignedBackup(t, path, start.Add(time.Duration(i)*time.Hour), key)
+		paths = append(paths, path)
+	}
+
+	results, err := VerifyDir(backups, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Path != paths[2] {
+		t.Fatalf("got %d results, newest %v", len(results), results[0].Path)
+	}
+	for _, v := range results {
+		if v.Trust != TrustVerified {
+			t.Errorf("%s: %s %v", v.Path, v.Trust, v.Problems)
+		}
+	}
+	if v := VerifyBackup(paths[0], nil); v.Trust != TrustUnknownKey {
+		t.Errorf("without trusted keys: %s", v.Trust)
+	}
+
+	// Appending to a backup breaks its checksum.
+	f, _ := os.OpenFile(paths[1], os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("DROP TABLE orders;\n")
+	f.Close()
+	if v := VerifyBackup(paths[1], keys); v.Trust != TrustTampered {
+		t.Errorf("modified backup: %s", v.Trust)
+	}
+
+	// Rewriting a manifest breaks its signature and the next link.
+	m, err := ReadManifest(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Database = "shop2"
+	if err := WriteManifest(paths[0], m); err != nil {
+		t.Fatal(err)
+	}
+	if v := VerifyBackup(paths[0], keys); v.Trust != TrustTampered {
+		t.Errorf("rewritten manifest: %s", v.Trust)
+	}
+	if v := VerifyBackup(paths[1], keys); v.Trust != TrustTampered {
+		t.Errorf("successor of rewritten manifest: %s", v.Trust)
+	}
+
+	// Removing a backup breaks the chain of the next one.
+	os.Remove(ManifestPath(paths[1]))
+	if v := VerifyBackup(paths[2], keys); v.Trust != TrustTampered {
+		t.Errorf("successor of removed backup: %s", v.Trust)
+	}
+}
+
+// writeSignedBackup writes a backup file with a chained, signed manifest the
+// way Run does.
+func writeSignedBackup(t *testing.T, path string, created time.Time, key ed25519.PrivateKey) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("CREATE TABLE orders (id int);\n"+created.String()+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manifest{Database: "shop", Host: "localhost", Port: 5432, CreatedAt: created}
+	m.Previous = previousLink(filepath.Dir(path), m)
+	if err := WriteManifest(path, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := SignManifest(path, key); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,291 @@
+package pgbackup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SubsetRoot selects the rows a subset dump starts from.
+type SubsetRoot struct {
+	Table   string  // Table name, optionally schema-qualified
+	Percent float64 // Random sample of the table's rows; 0 keeps every row
+	Where   string  // SQL condition on the table's rows; empty keeps every row
+}
+
+// ParseSubsetRoot parses "table [N%] [WHERE condition]", for example
+// "public.customers 10%" or "orders WHERE created_at > now() - interval '7 days'".
+func ParseSubsetRoot(s string) (SubsetRoot, error) {
+	s = strings.TrimSpace(s)
+	table, rest, _ := strings.Cut(s, " ")
+	if table == "" {
+		return SubsetRoot{}, fmt.Errorf("subset root %q names no table", s)
+	}
+	root := SubsetRoot{Table: table}
+
+	rest = strings.TrimSpace(rest)
+	if first, after, _ := strings.Cut(rest, " "); strings.HasSuffix(first, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(first, "%"), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return SubsetRoot{}, fmt.Errorf("subset root %q: sample must be a percentage between 0 and 100", s)
+		}
+		root.Percent = p
+		rest = strings.TrimSpace(after)
+	}
+
+	if rest != "" {
+		if len(rest) < 6 || !strings.EqualFold(rest[:6], "where ") {
+			return SubsetRoot{}, fmt.Errorf("subset root %q: expected a percentage or WHERE after the table", s)
+		}
+		root.Where = strings.TrimSpace(rest[6:])
+		if root.Where == "" {
+			return SubsetRoot{}, fmt.Errorf("subset root %q: empty WHERE condition", s)
+		}
+	}
+	return root, nil
+}
+
+// String formats the root the way ParseSubsetRoot reads it.
+func (r SubsetRoot) String() string {
+	s := r.Table
+	if r.Percent > 0 {
+		s += " " + strconv.FormatFloat(r.Percent, 'f', -1, 64) + "%"
+	}
+	if r.Where != "" {
+		s += " WHERE " + r.Where
+	}
+	return s
+}
+
+// SubsetTable is the number of rows a subset dump selected from a table.
+type SubsetTable struct {
+	Table string `json:"table"` // Quoted, qualified table name
+	Rows  int64  `json:"rows"`
+}
+
+// foreignKey is a foreign key edge between two tables.
+type foreignKey struct {
+	childName, parentName   string // Quoted, qualified table names
+	childPlain, parentPlain bool   // Plain tables rather than partitioned ones
+	child, parent           string // The tables as read in FROM clauses
+	childCols, parentCols   []string
+}
+
+// WriteSubsetDump streams a plain SQL dump of the full schema but only the
+// rows reachable from roots to w. Starting from the root rows it follows
+// foreign keys in both directions until nothing changes: every selected row
+// pulls in the parent rows it references, and every root row or row pulled
+// in as a child pulls in the rows referencing it. Parents pulled in for
+// their children do not pull in their other children, which would select
+// most of a connected database. The result restores without foreign key
+// violations.
+func WriteSubsetDump(ctx context.Context, opts Options, roots []SubsetRoot, w io.Writer) ([]SubsetTable, error) {
+	conn, err := pgx.Connect(ctx, ConnString(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	// The selection lives in a temporary table, so the snapshot cannot be
+	// read only.
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start snapshot: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `CREATE TEMPORARY TABLE subset_rows (
+		rel oid NOT NULL, id tid NOT NULL, down boolean NOT NULL, PRIMARY KEY (rel, id)) ON COMMIT DROP`); err != nil {
+		return nil, fmt.Errorf("failed to create subset selection: %w", err)
+	}
+	for _, root := range roots {
+		if err := selectRoot(ctx, tx, root); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := readForeignKeys(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := followForeignKeys(ctx, tx, keys); err != nil {
+		return nil, err
+	}
+
+	tables, err := countSubset(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	selected := map[string]bool{}
+	for _, t := range tables {
+		selected[t.Table] = true
+	}
+	// Roots and their conditions were read under the role's search path,
+	// the schema is not.
+	if err := pinSearchPath(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	err = writeSQLDump(ctx, tx, opts.DBName, w, func(dw *dumpWriter, table TableData) error {
+		columns := "*"
+		if len(table.Columns) > 0 {
+			columns = strings.Join(table.Columns, ", ")
+		}
+		// Tables without selected rows get an empty block, as pg_dump writes
+		// for empty tables, so masking rules for them still find their columns.
+		source := fmt.Sprintf("(SELECT %s FROM ONLY %s LIMIT 0)", columns, table.Name)
+		if selected[table.Name] {
+			source = fmt.Sprintf("(SELECT %s FROM ONLY %s WHERE ctid = ANY (ARRAY(SELECT id FROM pg_temp.subset_rows WHERE rel = %s::regclass)))",
+				columns, table.Name, quoteLiteral(table.Name))
+		}
+		return copyTable(ctx, tx.Conn(), dw, table, source)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// selectRoot adds a root's rows to the selection.
+func selectRoot(ctx context.Context, tx pgx.Tx, root SubsetRoot) error {
+	var name, relkind string
+	err := tx.QueryRow(ctx, `
+		SELECT format('%I.%I', n.nspname, c.relname), c.relkind::text
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = $1::regclass`, root.Table).Scan(&name, &relkind)
+	if err != nil {
+		return fmt.Errorf("failed to find subset root %s: %w", root.Table, err)
+	}
+	if relkind != "r" && relkind != "p" {
+		return fmt.Errorf("subset root %s is not a table", root.Table)
+	}
+
+	from := relation(name, relkind == "r")
+	if root.Percent > 0 {
+		from += fmt.Sprintf(" TABLESAMPLE BERNOULLI (%s)", strconv.FormatFloat(root.Percent, 'f', -1, 64))
+	}
+	query := "INSERT INTO pg_temp.subset_rows (rel, id, down) SELECT tableoid, ctid, true FROM " + from
+	if root.Where != "" {
+		query += " WHERE " + root.Where
+	}
+	query += " ON CONFLICT (rel, id) DO UPDATE SET down = true"
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to select rows of subset root %s: %w", root, err)
+	}
+	return nil
+}
+
+// readForeignKeys returns the foreign keys between user tables. Keys on
+// partitioned tables are read once from the partitioned table.
+func readForeignKeys(ctx context.Context, tx pgx.Tx) ([]foreignKey, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT format('%I.%I', n.nspname, c.relname), c.relkind = 'r',
+		       format('%I.%I', pn.nspname, p.relname), p.relkind = 'r',
+		       ARRAY(SELECT quote_ident(a.attname) FROM unnest(con.conkey) WITH ORDINALITY k(attnum, ord)
+		             JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum ORDER BY k.ord),
+		       ARRAY(SELECT quote_ident(a.attname) FROM unnest(con.confkey) WITH ORDINALITY k(attnum, ord)
+		             JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum ORDER BY k.ord)
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_class p ON p.oid = con.confrelid
+		JOIN pg_namespace pn ON pn.oid = p.relnamespace
+		WHERE con.contype = 'f' AND con.conparentid = 0 AND `+userNamespace+`
+		ORDER BY con.conname`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign keys: %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (foreignKey, error) {
+		var fk foreignKey
+		err := row.Scan(&fk.childName, &fk.childPlain, &fk.parentName, &fk.parentPlain, &fk.childCols, &fk.parentCols)
+		fk.child = relation(fk.childName, fk.childPlain)
+		fk.parent = relation(fk.parentName, fk.parentPlain)
+		return fk, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign keys: %w", err)
+	}
+	return keys, nil
+}
+
+// followForeignKeys grows the selection until every foreign key is satisfied.
+func followForeignKeys(ctx context.Context, tx pgx.Tx, keys []foreignKey) error {
+	for {
+		var added int64
+		for _, fk := range keys {
+			var join []string
+			for i := range fk.childCols {
+				join = append(join, fmt.Sprintf("c.%s = p.%s", fk.childCols[i], fk.parentCols[i]))
+			}
+			on := strings.Join(join, " AND ")
+
+			// Parents referenced by any selected child.
+			tag, err := tx.Exec(ctx, fmt.Sprintf(`
+				INSERT INTO pg_temp.subset_rows (rel, id, down)
+				SELECT p.tableoid, p.ctid, false
+				FROM %s c JOIN pg_temp.subset_rows s ON s.rel = c.tableoid AND s.id = c.ctid
+				JOIN %s p ON %s
+				ON CONFLICT (rel, id) DO NOTHING`, fk.child, fk.parent, on))
+			if err != nil {
+				return fmt.Errorf("failed to follow foreign key from %s to %s: %w", fk.childName, fk.parentName, err)
+			}
+			added += tag.RowsAffected()
+
+			// Children referencing a root row or a row pulled in as a child.
+			tag, err = tx.Exec(ctx, fmt.Sprintf(`
+				INSERT INTO pg_temp.subset_rows (rel, id, down)
+				SELECT DISTINCT c.tableoid, c.ctid, true
+				FROM %s p JOIN pg_temp.subset_rows s ON s.rel = p.tableoid AND s.id = p.ctid AND s.down
+				JOIN %s c ON %s
+				ON CONFLICT (rel, id) DO UPDATE SET down = true WHERE NOT subset_rows.down`, fk.parent, fk.child, on))
+			if err != nil {
+				return fmt.Errorf("failed to follow foreign key from %s to %s: %w", fk.parentName, fk.childName, err)
+			}
+			added += tag.RowsAffected()
+		}
+		if added == 0 {
+			return nil
+		}
+	}
+}
+
+// countSubset returns the number of rows selected per table.
+func countSubset(ctx context.Context, tx pgx.Tx) ([]SubsetTable, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT format('%I.%I', n.nspname, c.relname), count(*)
+		FROM pg_temp.subset_rows s
+		JOIN pg_class c ON c.oid = s.rel
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		GROUP BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subset rows: %w", err)
+	}
+	tables, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (SubsetTable, error) {
+		var t SubsetTable
+		err := row.Scan(&t.Table, &t.Rows)
+		return t, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subset rows: %w", err)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Table < tables[j].Table })
+	return tables, nil
+}
+
+// relation returns name for a FROM clause. Plain tables are read with ONLY,
+// since their foreign keys do not cover inheritance children; partitioned
+// tables are read whole, their keys covering every partition.
+func relation(name string, plain bool) string {
+	if plain {
+		return "ONLY " + name
+	}
+	return name
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,112 @@
+package pgbin
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	_ "github.com/lib/pq"
+)
+
+// searchPatterns are the well-known install locations of versioned client
+// tools, searched after PATH: Debian/Ubuntu and RHEL/PGDG packages.
+var searchPatterns = []string{
+	"/usr/lib/postgresql/*/bin",
+	"/usr/pgsql-*/bin",
+}
+
+// Binary is an installed client tool and its version.
+type Binary struct {
+	Path    string
+	Version int // Numeric version, e.g. 160002
+}
+
+// String renders the binary as "path (version)".
+func (b Binary) String() string {
+	return fmt.Sprintf("%s (%s)", b.Path, FormatVersion(b.Version))
+}
+
+// Discover finds every installed copy of the named tool on PATH, in the
+// well-known install locations and in extraDirs. Copies that resolve to the
+// same file are reported once. The result is sorted newest first.
+func Discover(name string, extraDirs []string) []Binary {
+	var dirs []string
+	dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+	for _, pattern := range searchPatterns {
+		matches, _ := filepath.Glob(pattern)
+		dirs = append(dirs, matches...)
+	}
+	dirs = append(dirs, extraDirs...)
+
+	seen := map[string]bool{}
+	var found []Binary
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			continue
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			resolved = path
+		}
+		if seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+
+		version, err := ClientVersion(path)
+		if err != nil {
+			continue
+		}
+		found = append(found, Binary{Path: path, Version: version})
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Version > found[j].Version
+	})
+	return found
+}
+
+// Select picks the newest binary whose major version is at least the
+// server's. binaries must be sorted newest first, as returned by Discover.
+func Select(name string, binaries []Binary, serverVersion int) (Binary, error) {
+	if len(binaries) == 0 {
+		return Binary{}, fmt.Errorf("%s not found in PATH or the PostgreSQL install directories. Please ensure PostgreSQL client tools are installed.", name)
+	}
+	newest := binaries[0]
+	if MajorVersion(newest.Version) < MajorVersion(serverVersion) {
+		return newest, fmt.Errorf("no %s for server version %s is installed, the newest is %s",
+			name, FormatMajor(MajorVersion(serverVersion)), newest)
+	}
+	return newest, nil
+}
+
+// Resolve discovers the named tool and selects the copy to use against a
+// server of the given version.
+func Resolve(name string, extraDirs []string, serverVersion int) (Binary, error) {
+	return Select(name, Discover(name, extraDirs), serverVersion)
+}
+
+// ServerVersion connects to the database and returns the server's numeric version.
+func ServerVersion(host string, port int, user, password, dbname string) (int, error) {
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		host, port, user, password, dbname)
+
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var version int
+	if err := db.QueryRow("SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read server version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,77 @@
+package pgbin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestParseVersion checks both the 9.x and 10+ numbering schemes.
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		in    string
+		num   int
+		major string
+	}{
+		{"pg_dump (PostgreSQL) 16.2 (Ubuntu 16.2-1.pgdg22.04+1)", 160002, "16"},
+		{"psql (PostgreSQL) 9.6.24", 90624, "9.6"},
+		{"13.14", 130014, "13"},
+	}
+	for _, c := range cases {
+		num, err := ParseVersion(c.in)
+		if err != nil {
+			t.Fatalf("ParseVersion(%q): %s", c.in, err)
+		}
+		if num != c.num {
+			t.Errorf("ParseVersion(%q) = %d, want %d", c.in, num, c.num)
+		}
+		if got := FormatMajor(MajorVersion(num)); got != c.major {
+			t.Errorf("major of %q = %s, want %s", c.in, got, c.major)
+		}
+	}
+	if MajorVersion(90624) >= MajorVersion(100001) {
+		t.Error("9.6 must sort before 10")
+	}
+}
+
+// TestDiscoverAndSelect installs fake pg_dump scripts and checks that the
+// newest one supporting the server is picked.
+func TestDiscoverAndSelect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binaries are shell scripts")
+	}
+
+	root := t.TempDir()
+	var dirs []string
+	for _, version := range []string{"13.14", "16.2", "15.6"} {
+		dir := filepath.Join(root, version)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		script := fmt.Sprintf("#!/bin/sh\necho 'pg_dump (PostgreSQL) %s'\n", version)
+		if err := os.WriteFile(filepath.Join(dir, "pg_dump"), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, dir)
+	}
+	t.Setenv("PATH", "")
+
+	binaries := Discover("pg_dump", dirs)
+	if len(binaries) != 3 {
+		t.Fatalf("found %d binaries, want 3", len(binaries))
+	}
+
+	chosen, err := Select("pg_dump", binaries, 150004)
+	if err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+	if chosen.Version != 160002 {
+		t.Errorf("chose %s, want 16.2", chosen)
+	}
+
+	if _, err := Select("pg_dump", binaries, 170000); err == nil {
+		t.Error("expected an error for a server newer than every pg_dump")
+	}
+}
@@ -0,0 +1,64 @@
+package pgbin
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+var versionPattern = regexp.MustCompile(`(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+// ParseVersion converts a version string such as "16.2" or the output of
+// "pg_dump --version" into PostgreSQL's numeric form (160002, 90603, ...).
+func ParseVersion(s string) (int, error) {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("no version number in %q", s)
+	}
+	parts := make([]int, 3)
+	for i := range parts {
+		if m[i+1] != "" {
+			parts[i], _ = strconv.Atoi(m[i+1])
+		}
+	}
+	if parts[0] >= 10 {
+		// Since PostgreSQL 10 the version has two parts: major.minor.
+		return parts[0]*10000 + parts[1], nil
+	}
+	return parts[0]*10000 + parts[1]*100 + parts[2], nil
+}
+
+// MajorVersion returns the major release of a numeric version, comparable
+// across the 9.x and 10+ numbering schemes (906 for 9.6, 1600 for 16).
+func MajorVersion(num int) int {
+	if num >= 100000 {
+		return num / 10000 * 100
+	}
+	return num / 100
+}
+
+// FormatMajor renders a major release returned by MajorVersion.
+func FormatMajor(major int) string {
+	if major >= 1000 {
+		return strconv.Itoa(major / 100)
+	}
+	return fmt.Sprintf("%d.%d", major/100, major%100)
+}
+
+// FormatVersion renders a numeric version as PostgreSQL prints it ("16.2", "9.6.24").
+func FormatVersion(num int) string {
+	if num >= 100000 {
+		return fmt.Sprintf("%d.%d", num/10000, num%10000)
+	}
+	return fmt.Sprintf("%d.%d.%d", num/10000, num/100%100, num%100)
+}
+
+// ClientVersion runs "<binary> --version" and returns its numeric version.
+func ClientVersion(binary string) (int, error) {
+	out, err := exec.Command(binary, "--version").Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to run %s --version: %w", binary, err)
+	}
+	return ParseVersion(string(out))
+}
@@ -0,0 +1,415 @@
+package pgclone
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbin"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+	_ "github.com/lib/pq"
+)
+
+// Endpoint identifies a database on a server.
+type Endpoint struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DBName   string
+}
+
+func (e Endpoint) String() string {
+	return fmt.Sprintf("%s@%s:%d/%s", e.User, e.Host, e.Port, e.DBName)
+}
+
+// Options describes a clone to run.
+type Options struct {
+	Source Endpoint
+	Target Endpoint // Created by the clone, it must not exist yet
+
+	// Jobs is the number of tables copied at once. Zero or one pipes a
+	// single pg_dump into psql.
+	Jobs int
+
+	// DumpBinary and RestoreBinary force a pg_dump and psql. Empty selects
+	// the newest installed ones, searching ClientBinDirs as well.
+	DumpBinary    string
+	RestoreBinary string
+	ClientBinDirs []string
+
+	// Progress, if set, is called as data is piped into the target.
+	Progress func(Progress)
+}
+
+// Phase names the step a clone is in.
+type Phase string
+
+const (
+	PhaseCreate  Phase = "Creating target database"
+	PhaseSchema  Phase = "Copying schema"
+	PhaseData    Phase = "Copying data"
+	PhaseIndexes Phase = "Creating indexes and constraints"
+	PhaseAnalyze Phase = "Analyzing target database"
+	PhaseCopy    Phase = "Copying database"
+)
+
+// Progress reports how far a clone has got.
+type Progress struct {
+	Phase       Phase
+	Bytes       int64 // Bytes piped from pg_dump into psql
+	TablesDone  int   // Tables copied, in parallel clones
+	TablesTotal int
+}
+
+// String renders the progress for display, e.g.
+// "Copying data: 12 of 40 tables, 123.4 MiB copied".
+func (p Progress) String() string {
+	const mib = 1 << 20
+	s := string(p.Phase)
+	if p.TablesTotal > 0 {
+		s += fmt.Sprintf(": %d of %d tables", p.TablesDone, p.TablesTotal)
+		s += fmt.Sprintf(", %.1f MiB copied", float64(p.Bytes)/mib)
+	} else {
+		s += fmt.Sprintf(": %.1f MiB copied", float64(p.Bytes)/mib)
+	}
+	return s
+}
+
+// Result reports what a clone did.
+type Result struct {
+	DumpBinary    pgbin.Binary
+	RestoreBinary pgbin.Binary
+	Bytes         int64
+	Tables        int // Tables copied in parallel, zero for a single pipe
+}
+
+// Run creates the target database and copies the source into it by piping
+// pg_dump into psql, without writing a file. The target is analyzed
+// afterwards so the planner has statistics straight away.
+func Run(opts Options) (*Result, error) {
+	result := &Result{}
+
+	dumpBinary, err := pgbackup.ResolveDumpBinary(pgbackup.Options{
+		Host:          opts.Source.Host,
+		Port:          opts.Source.Port,
+		User:          opts.Source.User,
+		Password:      opts.Source.Password,
+		DBName:        opts.Source.DBName,
+		DumpBinary:    opts.DumpBinary,
+		ClientBinDirs: opts.ClientBinDirs,
+	})
+	if err != nil {
+		return result, err
+	}
+	result.DumpBinary = dumpBinary
+
+	restoreBinary, err := pgrestore.ResolveRestoreBinary(pgrestore.Options{
+		RestoreBinary: opts.RestoreBinary,
+		ClientBinDirs: opts.ClientBinDirs,
+	})
+	if err != nil {
+		return result, err
+	}
+	result.RestoreBinary = restoreBinary
+
+	c := &cloner{opts: opts, dumpBinary: dumpBinary.Path, restoreBinary: restoreBinary.Path}
+
+	c.setPhase(PhaseCreate)
+	target := opts.Target
+	if err := pgrestore.CreateNewDB(target.Host, target.Port, target.User, target.Password, target.DBName); err != nil {
+		return result, fmt.Errorf("failed to create target database: %w", err)
+	}
+
+	if opts.Jobs > 1 {
+		err = c.copyParallel()
+	} else {
+		c.setPhase(PhaseCopy)
+		err = c.pipe()
+	}
+	result.Bytes = c.progress.Bytes
+	result.Tables = c.progress.TablesTotal
+	if err != nil {
+		return result, fmt.Errorf("clone failed, target database %s is incomplete: %w", target.DBName, err)
+	}
+
+	c.setPhase(PhaseAnalyze)
+	if err := analyze(target); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// cloner holds the state shared by the pipes of one clone.
+type cloner struct {
+	opts          Options
+	dumpBinary    string
+	restoreBinary string
+
+	mu       sync.Mutex
+	progress Progress
+}
+
+func (c *cloner) update(f func(p *Progress)) {
+	c.mu.Lock()
+	f(&c.progress)
+	p := c.progress
+	c.mu.Unlock()
+	if c.opts.Progress != nil {
+		c.opts.Progress(p)
+	}
+}
+
+func (c *cloner) setPhase(phase Phase) {
+	c.update(func(p *Progress) { p.Phase = phase })
+}
+
+// Write counts the bytes piped into psql.
+func (c *cloner) Write(b []byte) (int, error) {
+	c.update(func(p *Progress) { p.Bytes += int64(len(b)) })
+	return len(b), nil
+}
+
+// copyParallel copies the schema, then the tables' data with opts.Jobs
+// pipes at a time, then the indexes, constraints and triggers. All pg_dump
+// runs share one exported snapshot, so the clone is as consistent as a
+// single pg_dump.
+func (c *cloner) copyParallel() error {
+	ctx := context.Background()
+	src := c.opts.Source
+
+	db, err := sql.Open("postgres", pgbackup.ConnString(src.Host, src.Port, src.User, src.Password, src.DBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer db.Close()
+
+	// The snapshot stays valid while the transaction that exported it is open.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer conn.Close()
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to start snapshot: %w", err)
+	}
+	defer tx.Rollback()
+
+	var snapshot string
+	if err := tx.QueryRow("SELECT pg_export_snapshot()").Scan(&snapshot); err != nil {
+		return fmt.Errorf("failed to export snapshot: %w", err)
+	}
+	tables, err := listTables(tx)
+	if err != nil {
+		return err
+	}
+	c.update(func(p *Progress) { p.TablesTotal = len(tables) })
+
+	c.setPhase(PhaseSchema)
+	if err := c.pipe("--snapshot="+snapshot, "--section=pre-data"); err != nil {
+		return err
+	}
+
+	c.setPhase(PhaseData)
+	// Sequence values and large objects: the data section without table data.
+	jobs := []job{{args: []string{"--section=data", "--exclude-table-data=*.*"}}}
+	for _, table := range tables {
+		jobs = append(jobs, job{args: []string{"--data-only", "--table=" + table}, table: true})
+	}
+	err = c.runJobs(jobs, func(j job) error {
+		return c.pipe(append([]string{"--snapshot=" + snapshot}, j.args...)...)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.setPhase(PhaseIndexes)
+	return c.pipe("--snapshot="+snapshot, "--section=post-data")
+}
+
+// job is one pg_dump invocation of the data phase.
+type job struct {
+	args  []string
+	table bool // Counts towards Progress.TablesDone
+}
+
+// runJobs runs each job with run, opts.Jobs at a time, and stops starting
+// new ones after the first failure.
+func (c *cloner) runJobs(jobs []job, run func(job) error) error {
+	work := make(chan job)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		failed   = make(chan struct{})
+	)
+	for i := 0; i < c.opts.Jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				select {
+				case <-failed:
+					continue // Handed over as the failure happened
+				default:
+				}
+				if err := run(j); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+					continue
+				}
+				if j.table {
+					c.update(func(p *Progress) { p.TablesDone++ })
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, j := range jobs {
+		select {
+		case work <- j:
+		case <-failed:
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	return firstErr
+}
+
+// pipe runs pg_dump with args against the source and feeds its output to
+// psql connected to the target.
+func (c *cloner) pipe(args ...string) error {
+	src, dst := c.opts.Source, c.opts.Target
+
+	dump := DumpCommand(c.dumpBinary, src, args...)
+	restore := RestoreCommand(c.restoreBinary, dst)
+
+	var dumpErr, restoreErr bytes.Buffer
+	dump.Stderr = &dumpErr
+	restore.Stderr = &restoreErr
+	restore.Stdout = io.Discard
+
+	out, err := dump.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	in, err := restore.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := restore.Start(); err != nil {
+		return fmt.Errorf("failed to start psql: %w", err)
+	}
+	if err := dump.Start(); err != nil {
+		in.Close()
+		restore.Wait()
+		return fmt.Errorf("failed to start pg_dump: %w", err)
+	}
+
+	_, copyErr := io.Copy(io.MultiWriter(in, c), out)
+	if copyErr != nil {
+		// psql went away, pg_dump would block writing to it.
+		dump.Process.Kill()
+	}
+	in.Close()
+	waitDump := dump.Wait()
+	waitRestore := restore.Wait()
+
+	if waitRestore != nil {
+		return fmt.Errorf("psql failed: %s: %w", strings.TrimSpace(restoreErr.String()), waitRestore)
+	}
+	if waitDump != nil {
+		return fmt.Errorf("pg_dump failed: %s: %w", strings.TrimSpace(dumpErr.String()), waitDump)
+	}
+	return copyErr
+}
+
+// DumpCommand prepares pg_dump to write a plain SQL dump of src to stdout.
+func DumpCommand(binary string, src Endpoint, args ...string) *exec.Cmd {
+	args = append([]string{
+		"-h", src.Host,
+		"-U", src.User,
+		"-d", src.DBName,
+		"-F", "p",
+	}, args...)
+
+	if src.Port != 0 {
+		args = append(args, "-p", fmt.Sprintf("%d", src.Port))
+	}
+
+	cmd := exec.Command(binary, args...)
+
+	if src.Password != "" {
+		cmd.Env = append(os.Environ(), "PGPASSWORD="+src.Password)
+	}
+
+	return cmd
+}
+
+// RestoreCommand prepares psql to run the script on its stdin against dst.
+// Like a restore it stops at the first error, a partial clone should not
+// look successful.
+func RestoreCommand(binary string, dst Endpoint) *exec.Cmd {
+	cmd := pgrestore.PrepareRestoreCommand(binary, dst.Host, dst.Port, dst.User, dst.Password, dst.DBName, "-")
+	cmd.Args = append(cmd.Args, "--quiet")
+	return cmd
+}
+
+// listTables returns the tables with data to copy as quoted pg_dump
+// patterns, largest first so the long copies start early. Tables created by
+// extensions are left to the extension, except its configuration tables,
+// whose rows pg_dump copies like a single pipe does.
+func listTables(tx *sql.Tx) ([]string, error) {
+	rows, err := tx.Query(`
+		SELECT '"' || replace(n.nspname, '"', '""') || '"."' || replace(c.relname, '"', '""') || '"'
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'r'
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		  AND n.nspname NOT LIKE 'pg_toast%'
+		  AND (NOT EXISTS (
+				SELECT 1 FROM pg_depend d
+				WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
+			OR c.oid IN (SELECT unnest(extconfig) FROM pg_extension))
+		ORDER BY pg_relation_size(c.oid) DESC, 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// analyze collects planner statistics for the whole target database.
+func analyze(target Endpoint) error {
+	db, err := sql.Open("postgres", pgbackup.ConnString(target.Host, target.Port, target.User, target.Password, target.DBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("ANALYZE"); err != nil {
+		return fmt.Errorf("clone succeeded but ANALYZE failed: %w", err)
+	}
+	return nil
+}
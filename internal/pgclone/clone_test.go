@@ -0,0 +1,204 @@
+package pgclone
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	_ "github.com/lib/pq"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// extensionDir is where the server image looks for extension scripts.
+const extensionDir = "/usr/local/share/postgresql/extension/"
+
+// cloneTestExtension keeps its settings in a configuration table, whose
+// rows pg_dump copies as data of the database.
+var cloneTestExtension = map[string]string{
+	"clonetest.control": "default_version = '1.0'\nrelocatable = false\nschema = public\n",
+	"clonetest--1.0.sql": `CREATE TABLE clonetest_settings (key text PRIMARY KEY, value text);
+SELECT pg_catalog.pg_extension_config_dump('clonetest_settings', '');
+`,
+}
+
+// TestCloneProcess runs an integration test cloning a database with a single
+// pipe and in parallel.
+func TestCloneProcess(t *testing.T) {
+	ctx := context.Background()
+
+	// Define the PostgreSQL container request
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:13-alpine",
+		ExposedPorts: []string{"5432/tcp"},
+		Env: map[string]string{
+			"POSTGRES_USER":     "testuser",
+			"POSTGRES_PASSWORD": "testpassword",
+			"POSTGRES_DB":       "testdb",
+		},
+		WaitingFor: wait.ForListeningPort("5432/tcp").WithStartupTimeout(2 * time.Minute),
+	}
+
+	// Create and start the PostgreSQL container
+	pgContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		t.Fatalf("failed to start container: %s", err)
+	}
+	defer func() {
+		if err := pgContainer.Terminate(ctx); err != nil {
+			t.Fatalf("failed to terminate container: %s", err)
+		}
+	}()
+
+	for name, content := range cloneTestExtension {
+		if err := pgContainer.CopyToContainer(ctx, []byte(content), extensionDir+name, 0o644); err != nil {
+			t.Fatalf("failed to install test extension: %s", err)
+		}
+	}
+
+	// Get container details
+	host, err := pgContainer.Host(ctx)
+	if err != nil {
+		t.Fatalf("failed to get container host: %s", err)
+	}
+	mappedPort, err := pgContainer.MappedPort(ctx, "5432")
+	if err != nil {
+		t.Fatalf("failed to get mapped port: %s", err)
+	}
+	source := Endpoint{Host: host, Port: mappedPort.Int(), User: "testuser", Password: "testpassword", DBName: "testdb"}
+
+	// Prepare the source database
+	if err := prepareSource(source); err != nil {
+		t.Fatalf("failed to prepare database: %s", err)
+	}
+
+	for _, jobs := range []int{0, 4} {
+		target := source
+		target.DBName = fmt.Sprintf("clone_%d", jobs)
+		result, err := Run(Options{Source: source, Target: target, Jobs: jobs})
+		if err != nil {
+			t.Fatalf("clone with %d jobs failed: %s", jobs, err)
+		}
+		if jobs > 1 && result.Tables != 3 {
+			t.Errorf("parallel clone copied %d tables, want 3", result.Tables)
+		}
+
+		for query, want := range map[string]string{
+			"SELECT count(*)::text FROM public.customers":                    "2",
+			"SELECT count(*)::text FROM public.orders":                       "100",
+			"SELECT value FROM public.clonetest_settings WHERE key = 'mode'": "strict",
+			"SELECT nextval('public.orders_id_seq')::text":                   "101",
+		} {
+			got, err := queryValue(target, query)
+			if err != nil {
+				t.Errorf("clone with %d jobs: %s: %s", jobs, query, err)
+			} else if got != want {
+				t.Errorf("clone with %d jobs: %s returned %s, want %s", jobs, query, got, want)
+			}
+		}
+	}
+}
+
+// prepareSource creates tables, data and an extension configuration table.
+func prepareSource(e Endpoint) error {
+	db, err := sql.Open("postgres", pgbackup.ConnString(e.Host, e.Port, e.User, e.Password, e.DBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	// Retry connection
+	for i := 0; i < 5; i++ {
+		err = db.Ping()
+		if err == nil {
+			break
+		}
+		time.Sleep(2 * time.Second)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE EXTENSION clonetest;
+		INSERT INTO clonetest_settings VALUES ('mode', 'strict');
+		CREATE TABLE customers (id integer PRIMARY KEY, name text NOT NULL);
+		CREATE TABLE orders (
+			id serial PRIMARY KEY,
+			customer_id integer NOT NULL REFERENCES customers (id),
+			total numeric NOT NULL
+		);
+		INSERT INTO customers VALUES (1, 'ada'), (2, 'bob');
+		INSERT INTO orders (customer_id, total) SELECT 1 + i % 2, i FROM generate_series(1, 100) i;
+	`)
+	return err
+}
+
+func queryValue(e Endpoint, query string) (string, error) {
+	db, err := sql.Open("postgres", pgbackup.ConnString(e.Host, e.Port, e.User, e.Password, e.DBName))
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	var v string
+	err = db.QueryRow(query).Scan(&v)
+	return v, err
+}
+
+// TestRunJobs verifies the data jobs stop at the first failure and only
+// finished tables are counted.
+func TestRunJobs(t *testing.T) {
+	jobs := []job{{args: []string{"--section=data"}}}
+	for i := 0; i < 5; i++ {
+		jobs = append(jobs, job{args: []string{fmt.Sprintf("--table=t%d", i)}, table: true})
+	}
+
+	c := &cloner{opts: Options{Jobs: 3}}
+	if err := c.runJobs(jobs, func(job) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if c.progress.TablesDone != 5 {
+		t.Errorf("%d tables done, want 5", c.progress.TablesDone)
+	}
+
+	// With one job at a time, nothing starts after the failing job.
+	failure := errors.New("psql failed")
+	var (
+		mu  sync.Mutex
+		ran []string
+	)
+	c = &cloner{opts: Options{Jobs: 1}}
+	err := c.runJobs(jobs, func(j job) error {
+		mu.Lock()
+		ran = append(ran, j.args[0])
+		mu.Unlock()
+		if j.args[0] == "--table=t1" {
+			return failure
+		}
+		return nil
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("runJobs returned %v, want %v", err, failure)
+	}
+	if fmt.Sprint(ran) != "[--section=data --table=t0 --table=t1]" {
+		t.Errorf("ran %v after the failure", ran)
+	}
+	if c.progress.TablesDone != 1 {
+		t.Errorf("%d tables done, want 1", c.progress.TablesDone)
+	}
+
+	// In parallel, every job fails, and the first error is reported once.
+	c = &cloner{opts: Options{Jobs: 4}}
+	err = c.runJobs(jobs, func(j job) error { return fmt.Errorf("%s: %w", j.args[0], failure) })
+	if !errors.Is(err, failure) || c.progress.TablesDone != 0 {
+		t.Errorf("runJobs returned %v with %d tables done", err, c.progress.TablesDone)
+	}
+}
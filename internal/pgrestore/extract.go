@@ -0,0 +1,770 @@
+package pgrestore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// qualifiedName is a schema-qualified object name with its identifiers
+// unquoted and folded the way the server folds them.
+type qualifiedName struct {
+	schema, name string
+}
+
+// String returns the name as it can be given to Extract, quoting
+// identifiers that would not read back the same unquoted.
+func (q qualifiedName) String() string {
+	if q.schema == "" {
+		return quoteIdentIfNeeded(q.name)
+	}
+	return quoteIdentIfNeeded(q.schema) + "." + quoteIdentIfNeeded(q.name)
+}
+
+var plainIdent = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+func quoteIdentIfNeeded(s string) string {
+	if plainIdent.MatchString(s) {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// Extraction reports what Extract copied.
+type Extraction struct {
+	Tables  []string // Tables extracted, as "schema.name", in script order
+	Rows    int64    // Rows of COPY data copied
+	Skipped []string // Statements left out because they need tables that were not extracted
+}
+
+// ExtractFile writes the tables of the plain SQL backup at backupPath to a
+// new, smaller SQL script at outputPath. See Extract.
+func ExtractFile(backupPath, outputPath string, tables []string) (*Extraction, error) {
+	in, err := os.Open(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer in.Close()
+	if err := checkPlainFormat(in); err != nil {
+		return nil, err
+	}
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	result, err := Extract(in, out, tables)
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write output file: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkPlainFormat rejects pg_dump's custom format, which is not a script,
+// and rewinds f.
+func checkPlainFormat(f *os.File) error {
+	magic := make([]byte, 5)
+	n, _ := io.ReadFull(f, magic)
+	if string(magic[:n]) == "PGDMP" {
+		return fmt.Errorf("%s is a pg_dump custom-format archive; tables can only be extracted from plain SQL backups (use pg_restore -t for archives)", f.Name())
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read backup file: %w", err)
+	}
+	return nil
+}
+
+// Extract streams the plain SQL script r, such as a pg_dump or Go engine
+// backup, and writes to w only what restores the given tables: their
+// CREATE TABLE, defaults, constraints, indexes, triggers, rules, policies,
+// comments, grants and owners, the sequences they own or use, and their
+// COPY data. Session settings are kept so the script restores the same
+// way. Everything else, including the schemas, types and functions the
+// tables depend on, is left out and must exist in the target.
+//
+// Tables are "table" or "schema.table"; a name without a schema matches
+// the table in every schema. Foreign keys to tables that are not
+// extracted are left out and reported in Skipped. Only the sequence
+// definitions seen so far are held in memory, so backups of any size can
+// be scanned.
+func Extract(r io.Reader, w io.Writer, tables []string) (*Extraction, error) {
+	x := &extractor{
+		w:         bufio.NewWriterSize(w, 1<<16),
+		found:     map[qualifiedName]bool{},
+		indexes:   map[qualifiedName]bool{},
+		sequences: map[qualifiedName]*pendingSequence{},
+	}
+	for _, t := range tables {
+		c := cursor{s: strings.TrimSpace(t)}
+		q, ok := c.name()
+		if !ok || strings.TrimSpace(c.s) != "" {
+			return nil, fmt.Errorf("invalid table name %q", t)
+		}
+		x.wanted = append(x.wanted, q)
+	}
+	if len(x.wanted) == 0 {
+		return nil, fmt.Errorf("no tables to extract")
+	}
+
+	x.printf("--\n-- Tables %s extracted by go-pg-backup\n--\n\n", strings.Join(tables, ", "))
+	script := NewScriptReader(r)
+	for {
+		stmt, err := script.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup file at line %d: %w", script.Line(), err)
+		}
+		if stmt.IsCopyFromStdin() {
+			if err := x.copyData(stmt, script.CopyData()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		x.statement(stmt)
+		if x.err != nil {
+			return nil, fmt.Errorf("failed to write extracted tables: %w", x.err)
+		}
+	}
+	if err := x.w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write extracted tables: %w", err)
+	}
+
+	var missing []string
+	for _, q := range x.wanted {
+		if !x.foundWanted(q) {
+			missing = append(missing, q.String())
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("table %s not found in the backup", strings.Join(missing, ", "))
+	}
+	return &x.result, nil
+}
+
+// ListTables returns the tables created by the plain SQL backup at path,
+// as "schema.name", reading the whole file but none of it into memory.
+func ListTables(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer f.Close()
+	if err := checkPlainFormat(f); err != nil {
+		return nil, err
+	}
+
+	var tables []string
+	searchPath := ""
+	script := NewScriptReader(f)
+	for {
+		stmt, err := script.Next()
+		if err == io.EOF {
+			return tables, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup file at line %d: %w", script.Line(), err)
+		}
+		if stmt.IsCopyFromStdin() {
+			if _, err := io.Copy(io.Discard, script.CopyData()); err != nil {
+				return nil, fmt.Errorf("failed to read backup file: %w", err)
+			}
+			continue
+		}
+		if s, ok := searchPathSetting(stmt.SQL); ok {
+			searchPath = s
+		}
+		if q, ok := createdTable(stmt.SQL); ok {
+			if q.schema == "" {
+				q.schema = searchPath
+			}
+			tables = append(tables, q.String())
+		}
+	}
+}
+
+// pendingSequence holds the statements of a sequence until it is known
+// whether an extracted table needs it.
+type pendingSequence struct {
+	wanted     bool
+	statements []string
+}
+
+type extractor struct {
+	w          *bufio.Writer
+	err        error
+	wanted     []qualifiedName
+	found      map[qualifiedName]bool // Extracted tables
+	indexes    map[qualifiedName]bool // Indexes of extracted tables
+	sequences  map[qualifiedName]*pendingSequence
+	searchPath string // First schema of the script's search_path, for unqualified names
+	result     Extraction
+}
+
+func (x *extractor) printf(format string, args ...any) {
+	if x.err != nil {
+		return
+	}
+	_, x.err = fmt.Fprintf(x.w, format, args...)
+}
+
+func (x *extractor) write(sql string) {
+	x.printf("%s\n\n", sql)
+}
+
+// qualify fills in the schema of an unqualified name from the search_path.
+func (x *extractor) qualify(q qualifiedName) qualifiedName {
+	if q.schema == "" {
+		q.schema = x.searchPath
+	}
+	return q
+}
+
+// selected reports whether table q is one of those being extracted.
+func (x *extractor) selected(q qualifiedName) bool {
+	q = x.qualify(q)
+	for _, w := range x.wanted {
+		if w.name == q.name && (w.schema == "" || w.schema == q.schema) {
+			return true
+		}
+	}
+	return false
+}
+
+func (x *extractor) foundWanted(w qualifiedName) bool {
+	for q := range x.found {
+		if w.name == q.name && (w.schema == "" || w.schema == q.schema) {
+			return true
+		}
+	}
+	return false
+}
+
+// sequence returns the pending state of sequence q.
+func (x *extractor) sequence(q qualifiedName) *pendingSequence {
+	q = x.qualify(q)
+	s := x.sequences[q]
+	if s == nil {
+		s = &pendingSequence{}
+		x.sequences[q] = s
+	}
+	return s
+}
+
+// sequenceStatement writes a statement about sequence q if an extracted
+// table needs the sequence, and holds it back otherwise.
+func (x *extractor) sequenceStatement(q qualifiedName, sql string) {
+	s := x.sequence(q)
+	if s.wanted {
+		x.write(sql)
+		return
+	}
+	s.statements = append(s.statements, sql)
+}
+
+// wantSequence marks sequence q as needed and writes what was held back.
+func (x *extractor) wantSequence(q qualifiedName) {
+	s := x.sequence(q)
+	if s.wanted {
+		return
+	}
+	s.wanted = true
+	for _, sql := range s.statements {
+		x.write(sql)
+	}
+	s.statements = nil
+}
+
+var (
+	nextvalCall  = regexp.MustCompile(`(?i)nextval\('((?:[^']|'')*)'`)
+	sequenceName = regexp.MustCompile(`(?i)\bSEQUENCE\s+NAME\s+((?:"(?:[^"]|"")*"|[\w$]+)(?:\.(?:"(?:[^"]|"")*"|[\w$]+))?)`)
+	setvalCall   = regexp.MustCompile(`(?i)^SELECT\s+pg_catalog\.setval\('((?:[^']|'')*)'`)
+)
+
+// tableStatement writes a statement about an extracted table, first
+// writing the sequences it uses.
+func (x *extractor) tableStatement(sql string) {
+	for _, m := range nextvalCall.FindAllStringSubmatch(sql, -1) {
+		c := cursor{s: strings.ReplaceAll(m[1], "''", "'")}
+		if q, ok := c.name(); ok {
+			x.wantSequence(q)
+		}
+	}
+	for _, m := range sequenceName.FindAllStringSubmatch(sql, -1) {
+		c := cursor{s: m[1]}
+		if q, ok := c.name(); ok {
+			// Identity sequences are created with their column.
+			x.sequence(q).wanted = true
+		}
+	}
+	x.write(sql)
+}
+
+// skip records a statement left out because it needs a table that is not
+// extracted.
+func (x *extractor) skip(sql string) {
+	first, _, _ := strings.Cut(sql, "\n")
+	x.result.Skipped = append(x.result.Skipped, first)
+}
+
+// statement routes one statement of the script.
+func (x *extractor) statement(stmt Statement) {
+	if stmt.Meta {
+		// The target is chosen by the caller, not by the script.
+		if name, _ := stmt.MetaCommand(); name != "connect" && name != "c" {
+			x.printf("%s\n", stmt.SQL)
+		}
+		return
+	}
+	if isSessionSetting(stmt.SQL) {
+		if s, ok := searchPathSetting(stmt.SQL); ok {
+			x.searchPath = s
+		}
+		x.write(stmt.SQL)
+		return
+	}
+	if m := setvalCall.FindStringSubmatch(stmt.SQL); m != nil {
+		c := cursor{s: strings.ReplaceAll(m[1], "''", "'")}
+		if q, ok := c.name(); ok {
+			x.sequenceStatement(q, stmt.SQL)
+		}
+		return
+	}
+
+	c := cursor{s: stmt.SQL}
+	switch {
+	case c.keyword("CREATE"):
+		x.create(c, stmt.SQL)
+	case c.keyword("ALTER"):
+		x.alter(c, stmt.SQL)
+	case c.keyword("COMMENT"):
+		if c.keyword("ON") {
+			x.comment(c, stmt.SQL)
+		}
+	case c.keyword("GRANT"), c.keyword("REVOKE"):
+		if !c.skipTo("ON") {
+			return
+		}
+		if c.keyword("SEQUENCE") {
+			if q, ok := c.name(); ok {
+				x.sequenceStatement(q, stmt.SQL)
+			}
+			return
+		}
+		c.keyword("TABLE")
+		if q, ok := c.name(); ok && x.selected(q) {
+			x.write(stmt.SQL)
+		}
+	}
+}
+
+func (x *extractor) create(c cursor, sql string) {
+	if c.keyword("OR") {
+		c.keyword("REPLACE")
+	}
+	c.skipKeywords("UNLOGGED", "TEMP", "TEMPORARY", "GLOBAL", "LOCAL", "FOREIGN", "UNIQUE", "CONSTRAINT")
+	switch {
+	case c.keyword("TABLE"):
+		if q, ok := createdTable(sql); ok && x.selected(q) {
+			q = x.qualify(q)
+			if !x.found[q] {
+				x.found[q] = true
+				x.result.Tables = append(x.result.Tables, q.String())
+			}
+			x.tableStatement(sql)
+		}
+	case c.keyword("INDEX"):
+		c.keyword("CONCURRENTLY")
+		if c.keyword("IF") {
+			c.keyword("NOT")
+			c.keyword("EXISTS")
+		}
+		var index qualifiedName
+		if !c.peekKeyword("ON") {
+			index, _ = c.name()
+		}
+		if !c.skipTo("ON") {
+			return
+		}
+		c.keyword("ONLY")
+		if q, ok := c.name(); ok && x.selected(q) {
+			// Indexes live in their table's schema.
+			index.schema = x.qualify(q).schema
+			x.indexes[index] = true
+			x.write(sql)
+		}
+	case c.keyword("TRIGGER"):
+		if c.skipTo("ON") {
+			if q, ok := c.name(); ok && x.selected(q) {
+				x.write(sql)
+			}
+		}
+	case c.keyword("RULE"):
+		if c.skipTo("TO") {
+			if q, ok := c.name(); ok && x.selected(q) {
+				x.write(sql)
+			}
+		}
+	case c.keyword("POLICY"):
+		c.name()
+		if c.keyword("ON") {
+			if q, ok := c.name(); ok && x.selected(q) {
+				x.write(sql)
+			}
+		}
+	case c.keyword("SEQUENCE"):
+		if c.keyword("IF") {
+			c.keyword("NOT")
+			c.keyword("EXISTS")
+		}
+		if q, ok := c.name(); ok {
+			x.sequenceStatement(q, sql)
+		}
+	}
+}
+
+func (x *extractor) alter(c cursor, sql string) {
+	c.keyword("FOREIGN")
+	switch {
+	case c.keyword("TABLE"):
+		if c.keyword("IF") {
+			c.keyword("EXISTS")
+		}
+		c.keyword("ONLY")
+		q, ok := c.name()
+		if !ok || !x.selected(q) {
+			return
+		}
+		// Foreign keys and partitions need the other table too.
+		if other, ok := c.after("REFERENCES"); ok && !x.selected(other) {
+			x.skip(sql)
+			return
+		}
+		if other, ok := c.after("ATTACH", "PARTITION"); ok && !x.selected(other) {
+			x.skip(sql)
+			return
+		}
+		x.tableStatement(sql)
+	case c.keyword("SEQUENCE"):
+		if c.keyword("IF") {
+			c.keyword("EXISTS")
+		}
+		seq, ok := c.name()
+		if !ok {
+			return
+		}
+		if owner := ownerTable(sql); owner.name != "" && x.selected(owner) {
+			x.wantSequence(seq)
+		}
+		x.sequenceStatement(seq, sql)
+	case c.keyword("INDEX"):
+		if c.keyword("IF") {
+			c.keyword("EXISTS")
+		}
+		if q, ok := c.name(); ok && x.indexes[x.qualify(q)] {
+			if other, ok := c.after("ATTACH", "PARTITION"); ok && !x.indexes[x.qualify(other)] {
+				x.skip(sql)
+				return
+			}
+			x.write(sql)
+		}
+	}
+}
+
+// ownerTable returns the table of "ALTER SEQUENCE s OWNED BY table.column".
+func ownerTable(sql string) qualifiedName {
+	c := cursor{s: sql}
+	if !c.skipTo("OWNED") || !c.keyword("BY") {
+		return qualifiedName{}
+	}
+	var parts []string
+	for {
+		part, ok := c.ident()
+		if !ok {
+			break
+		}
+		parts = append(parts, part)
+		if !strings.HasPrefix(c.s, ".") {
+			break
+		}
+		c.s = c.s[1:]
+	}
+	switch len(parts) {
+	case 3:
+		return qualifiedName{schema: parts[0], name: parts[1]}
+	case 2:
+		return qualifiedName{name: parts[0]}
+	}
+	return qualifiedName{}
+}
+
+func (x *extractor) comment(c cursor, sql string) {
+	switch {
+	case c.keyword("TABLE"), c.keyword("VIEW"):
+		if q, ok := c.name(); ok && x.selected(q) {
+			x.write(sql)
+		}
+	case c.keyword("FOREIGN"), c.keyword("MATERIALIZED"):
+		c.keyword("TABLE", "VIEW")
+		if q, ok := c.name(); ok && x.selected(q) {
+			x.write(sql)
+		}
+	case c.keyword("COLUMN"):
+		var parts []string
+		for {
+			part, ok := c.ident()
+			if !ok {
+				break
+			}
+			parts = append(parts, part)
+			if !strings.HasPrefix(c.s, ".") {
+				break
+			}
+			c.s = c.s[1:]
+		}
+		var q qualifiedName
+		switch len(parts) {
+		case 3:
+			q = qualifiedName{schema: parts[0], name: parts[1]}
+		case 2:
+			q = qualifiedName{name: parts[0]}
+		}
+		if q.name != "" && x.selected(q) {
+			x.write(sql)
+		}
+	case c.keyword("INDEX"):
+		if q, ok := c.name(); ok && x.indexes[x.qualify(q)] {
+			x.write(sql)
+		}
+	case c.keyword("SEQUENCE"):
+		if q, ok := c.name(); ok {
+			x.sequenceStatement(q, sql)
+		}
+	case c.keyword("CONSTRAINT", "TRIGGER", "POLICY", "RULE"):
+		c.ident()
+		if c.keyword("ON") {
+			c.keyword("DOMAIN")
+			if q, ok := c.name(); ok && x.selected(q) {
+				x.write(sql)
+			}
+		}
+	}
+}
+
+// copyData writes the COPY statement and data of an extracted table, and
+// skips the data of any other table.
+func (x *extractor) copyData(stmt Statement, data io.Reader) error {
+	c := cursor{s: stmt.SQL}
+	c.keyword("COPY")
+	if q, ok := c.name(); !ok || !x.selected(q) {
+		if _, err := io.Copy(io.Discard, data); err != nil {
+			return fmt.Errorf("failed to read backup file: %w", err)
+		}
+		return nil
+	}
+	x.printf("%s\n", stmt.SQL)
+	if x.err != nil {
+		return fmt.Errorf("failed to write extracted tables: %w", x.err)
+	}
+	lines := &lineCounter{w: x.w}
+	if _, err := io.Copy(lines, data); err != nil {
+		return fmt.Errorf("failed to copy data of %s: %w", stmt.SQL, err)
+	}
+	x.result.Rows += lines.lines
+	x.printf("\\.\n\n")
+	return x.err
+}
+
+// lineCounter counts the lines written through it. A COPY text row is one
+// line, since line breaks in values are escaped.
+type lineCounter struct {
+	w     io.Writer
+	lines int64
+}
+
+func (l *lineCounter) Write(p []byte) (int, error) {
+	l.lines += int64(bytes.Count(p, []byte{'\n'}))
+	return l.w.Write(p)
+}
+
+// isSessionSetting reports whether a statement only configures the
+// restoring session.
+func isSessionSetting(sql string) bool {
+	upper := strings.ToUpper(sql)
+	return strings.HasPrefix(upper, "SET ") || strings.HasPrefix(upper, "SELECT PG_CATALOG.SET_CONFIG(")
+}
+
+var searchPathSet = regexp.MustCompile(`(?i)^SET\s+search_path\s*(?:=|TO)\s*([^,;]+)`)
+
+// searchPathSetting returns the first schema of a "SET search_path"
+// statement, which older pg_dump versions use instead of qualified names.
+func searchPathSetting(sql string) (string, bool) {
+	m := searchPathSet.FindStringSubmatch(sql)
+	if m == nil {
+		return "", false
+	}
+	c := cursor{s: strings.Trim(strings.TrimSpace(m[1]), "'")}
+	schema, ok := c.ident()
+	return schema, ok
+}
+
+// createdTable returns the table a CREATE TABLE statement creates.
+func createdTable(sql string) (qualifiedName, bool) {
+	c := cursor{s: sql}
+	if !c.keyword("CREATE") {
+		return qualifiedName{}, false
+	}
+	c.skipKeywords("UNLOGGED", "TEMP", "TEMPORARY", "GLOBAL", "LOCAL", "FOREIGN")
+	if !c.keyword("TABLE") {
+		return qualifiedName{}, false
+	}
+	if c.keyword("IF") {
+		c.keyword("NOT")
+		c.keyword("EXISTS")
+	}
+	return c.name()
+}
+
+// cursor reads the words of a statement from the front.
+type cursor struct {
+	s string
+}
+
+func (c *cursor) space() {
+	c.s = strings.TrimLeft(c.s, " \t\r\n")
+}
+
+// peekKeyword reports whether the next word is kw.
+func (c *cursor) peekKeyword(kw string) bool {
+	c.space()
+	n := len(kw)
+	return len(c.s) >= n && strings.EqualFold(c.s[:n], kw) && (len(c.s) == n || !isWordByte(c.s[n]))
+}
+
+// keyword consumes the next word if it is one of kws.
+func (c *cursor) keyword(kws ...string) bool {
+	for _, kw := range kws {
+		if c.peekKeyword(kw) {
+			c.s = c.s[len(kw):]
+			return true
+		}
+	}
+	return false
+}
+
+// skipKeywords consumes any run of the keywords kws.
+func (c *cursor) skipKeywords(kws ...string) {
+	for c.keyword(kws...) {
+		// Consumed.
+	}
+}
+
+// ident consumes an identifier, unquoting a quoted one and folding an
+// unquoted one to lower case.
+func (c *cursor) ident() (string, bool) {
+	c.space()
+	if strings.HasPrefix(c.s, `"`) {
+		var b strings.Builder
+		for i := 1; i < len(c.s); i++ {
+			if c.s[i] != '"' {
+				b.WriteByte(c.s[i])
+				continue
+			}
+			if i+1 < len(c.s) && c.s[i+1] == '"' {
+				b.WriteByte('"')
+				i++
+				continue
+			}
+			c.s = c.s[i+1:]
+			return b.String(), true
+		}
+		return "", false
+	}
+	i := 0
+	for i < len(c.s) && (isWordByte(c.s[i]) || (i > 0 && c.s[i] == '$')) {
+		i++
+	}
+	if i == 0 {
+		return "", false
+	}
+	ident := strings.ToLower(c.s[:i])
+	c.s = c.s[i:]
+	return ident, true
+}
+
+// name consumes a possibly schema-qualified name.
+func (c *cursor) name() (qualifiedName, bool) {
+	first, ok := c.ident()
+	if !ok {
+		return qualifiedName{}, false
+	}
+	if strings.HasPrefix(c.s, ".") {
+		rest := cursor{s: c.s[1:]}
+		if second, ok := rest.ident(); ok {
+			c.s = rest.s
+			return qualifiedName{schema: first, name: second}, true
+		}
+	}
+	return qualifiedName{name: first}, true
+}
+
+// skipTo consumes everything up to and including the next keyword kw
+// outside quotes, reporting whether it was found.
+func (c *cursor) skipTo(kw string) bool {
+	for {
+		c.space()
+		if c.s == "" {
+			return false
+		}
+		if c.keyword(kw) {
+			return true
+		}
+		switch c.s[0] {
+		case '"':
+			if _, ok := c.ident(); !ok {
+				return false
+			}
+		case '\'':
+			end := 1
+			for end < len(c.s) {
+				if c.s[end] == '\'' {
+					if end+1 < len(c.s) && c.s[end+1] == '\'' {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			c.s = c.s[min(end+1, len(c.s)):]
+		default:
+			if _, ok := c.ident(); !ok {
+				c.s = c.s[1:]
+			}
+		}
+	}
+}
+
+// after returns the name following the next occurrence of the keywords
+// kws, without consuming anything.
+func (c cursor) after(kws ...string) (qualifiedName, bool) {
+	if !c.skipTo(kws[0]) {
+		return qualifiedName{}, false
+	}
+	for _, kw := range kws[1:] {
+		if !c.keyword(kw) {
+			return qualifiedName{}, false
+		}
+	}
+	c.keyword("ONLY")
+	return c.name()
+}
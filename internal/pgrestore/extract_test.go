@@ -0,0 +1,187 @@
+package pgrestore
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const extractScript = `--
+-- PostgreSQL database dump
+--
+
+\restrict k3y
+
+SET statement_timeout = 0;
+SELECT pg_catalog.set_config('search_path', '', false);
+
+CREATE FUNCTION public.touch() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$BEGIN NEW.updated_at = now(); RETURN NEW; END;$$;
+
+CREATE TABLE public.customers (
+    id integer NOT NULL,
+    name text
+);
+
+ALTER TABLE public.customers OWNER TO shop;
+
+CREATE SEQUENCE public.customers_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1;
+
+ALTER SEQUENCE public.customers_id_seq OWNED BY public.customers.id;
+
+CREATE TABLE public."Orders" (
+    id bigint NOT NULL,
+    customer_id integer,
+    note text
+);
+
+ALTER TABLE public."Orders" OWNER TO shop;
+
+CREATE SEQUENCE public."Orders_id_seq"
+    START WITH 1
+    INCREMENT BY 1;
+
+ALTER SEQUENCE public."Orders_id_seq" OWNER TO shop;
+
+ALTER SEQUENCE public."Orders_id_seq" OWNED BY public."Orders".id;
+
+CREATE TABLE audit.events (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY (SEQUENCE NAME audit.events_id_seq START WITH 1),
+    body jsonb
+);
+
+ALTER TABLE ONLY public.customers ALTER COLUMN id SET DEFAULT nextval('public.customers_id_seq'::regclass);
+
+ALTER TABLE ONLY public."Orders" ALTER COLUMN id SET DEFAULT nextval('public."Orders_id_seq"'::regclass);
+
+COPY public.customers (id, name) FROM stdin;
+1	Ada
+\.
+
+COPY public."Orders" (id, customer_id, note) FROM stdin;
+1	1	first; not a statement
+2	1	line\nbreak
+\.
+
+COPY audit.events (id, body) FROM stdin;
+1	{}
+\.
+
+SELECT pg_catalog.setval('public.customers_id_seq', 1, true);
+
+SELECT pg_catalog.setval('public."Orders_id_seq"', 2, true);
+
+SELECT pg_catalog.setval('audit.events_id_seq', 1, true);
+
+ALTER TABLE ONLY public."Orders"
+    ADD CONSTRAINT "Orders_pkey" PRIMARY KEY (id);
+
+CREATE INDEX orders_note_idx ON public."Orders" USING btree (note);
+
+CREATE TRIGGER orders_touch BEFORE UPDATE ON public."Orders" FOR EACH ROW EXECUTE FUNCTION public.touch();
+
+ALTER TABLE ONLY public."Orders"
+    ADD CONSTRAINT orders_customer_fk FOREIGN KEY (customer_id) REFERENCES public.customers(id);
+
+COMMENT ON COLUMN public."Orders".note IS 'free text; ON customers';
+
+COMMENT ON INDEX public.orders_note_idx IS 'search';
+
+GRANT SELECT ON TABLE public."Orders" TO reporting;
+
+GRANT SELECT ON TABLE public.customers TO reporting;
+
+\unrestrict k3y
+`
+
+func TestExtract(t *testing.T) {
+	var out strings.Builder
+	result, err := Extract(strings.NewReader(extractScript), &out, []string{`"Orders"`, "audit.events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`public."Orders"`, "audit.events"}; !reflect.DeepEqual(result.Tables, want) {
+		t.Errorf("tables %q, want %q", result.Tables, want)
+	}
+	if result.Rows != 3 {
+		t.Errorf("%d rows copied, want 3", result.Rows)
+	}
+	if want := []string{"ALTER TABLE ONLY public.\"Orders\""}; !reflect.DeepEqual(result.Skipped, want) {
+		t.Errorf("skipped %q, want %q", result.Skipped, want)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"\\restrict k3y\n",
+		"SET statement_timeout = 0;",
+		"CREATE TABLE public.\"Orders\" (",
+		"ALTER TABLE public.\"Orders\" OWNER TO shop;",
+		"CREATE SEQUENCE public.\"Orders_id_seq\"",
+		"ALTER SEQUENCE public.\"Orders_id_seq\" OWNER TO shop;",
+		"ALTER SEQUENCE public.\"Orders_id_seq\" OWNED BY public.\"Orders\".id;",
+		"nextval('public.\"Orders_id_seq\"'::regclass);",
+		"COPY public.\"Orders\" (id, customer_id, note) FROM stdin;\n1\t1\tfirst; not a statement\n2\t1\tline\\nbreak\n\\.\n",
+		"CREATE TABLE audit.events (",
+		"COPY audit.events (id, body) FROM stdin;\n1\t{}\n\\.\n",
+		"SELECT pg_catalog.setval('public.\"Orders_id_seq\"', 2, true);",
+		"SELECT pg_catalog.setval('audit.events_id_seq', 1, true);",
+		"ADD CONSTRAINT \"Orders_pkey\" PRIMARY KEY (id);",
+		"CREATE INDEX orders_note_idx ON public.\"Orders\"",
+		"CREATE TRIGGER orders_touch",
+		"COMMENT ON COLUMN public.\"Orders\".note",
+		"COMMENT ON INDEX public.orders_note_idx",
+		"GRANT SELECT ON TABLE public.\"Orders\" TO reporting;",
+		"\\unrestrict k3y\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("extracted script lacks %q", want)
+		}
+	}
+	for _, unwanted := range []string{"customers (", "customers_id_seq", "Ada", "CREATE FUNCTION", "orders_customer_fk", "customers TO"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("extracted script holds %q:\n%s", unwanted, got)
+		}
+	}
+	// The sequence must exist before the default that uses it.
+	if strings.Index(got, "CREATE SEQUENCE public.\"Orders_id_seq\"") > strings.Index(got, "nextval(") {
+		t.Errorf("sequence created after its use:\n%s", got)
+	}
+}
+
+func TestExtractMissingTable(t *testing.T) {
+	var out strings.Builder
+	_, err := Extract(strings.NewReader(extractScript), &out, []string{"public.orders"})
+	if err == nil || !strings.Contains(err.Error(), "public.orders not found") {
+		t.Errorf("got %v, want the unquoted name to be reported missing", err)
+	}
+}
+
+func TestListTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.sql")
+	if err := os.WriteFile(path, []byte(extractScript), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tables, err := ListTables(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"public.customers", `public."Orders"`, "audit.events"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("tables %q, want %q", tables, want)
+	}
+
+	// The names listed are accepted by ExtractFile.
+	output := filepath.Join(t.TempDir(), "orders.sql")
+	result, err := ExtractFile(path, output, tables[1:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rows != 2 {
+		t.Errorf("%d rows extracted, want 2", result.Rows)
+	}
+}
@@ -0,0 +1,205 @@
+package pgrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Engine selects the program that runs a restore.
+type Engine string
+
+const (
+	// EngineAuto uses psql and falls back to EngineGo when it is not installed.
+	EngineAuto Engine = ""
+	// EnginePsql runs the psql binary.
+	EnginePsql Engine = "psql"
+	// EngineGo executes the script over a Go connection.
+	EngineGo Engine = "go"
+)
+
+// ParseEngine converts a user-supplied engine name.
+func ParseEngine(s string) (Engine, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return EngineAuto, nil
+	case "psql":
+		return EnginePsql, nil
+	case "go":
+		return EngineGo, nil
+	default:
+		return "", fmt.Errorf("unknown restore engine %q, expected auto, psql or go", s)
+	}
+}
+
+// Progress reports how far the Go engine has got through a backup.
+type Progress struct {
+	Bytes      int64 // Bytes of the backup consumed
+	TotalBytes int64 // Size of the backup
+	Statements int   // Statements executed
+}
+
+// Percent returns the share of the backup consumed, from 0 to 100.
+func (p Progress) Percent() float64 {
+	if p.TotalBytes <= 0 {
+		return 0
+	}
+	return float64(p.Bytes) * 100 / float64(p.TotalBytes)
+}
+
+// String renders the progress for display, e.g. "45% (12.3 of 27.1 MiB), 1203 statements".
+func (p Progress) String() string {
+	const mib = 1 << 20
+	return fmt.Sprintf("%.0f%% (%.1f of %.1f MiB), %d statements",
+		p.Percent(), float64(p.Bytes)/mib, float64(p.TotalBytes)/mib, p.Statements)
+}
+
+// StatementError reports a statement of the backup that failed.
+type StatementError struct {
+	Line int    // Line of the backup the error points at
+	SQL  string // The failing statement
+	Err  error
+}
+
+func (e *StatementError) Error() string {
+	sql := e.SQL
+	if len(sql) > 200 {
+		sql = sql[:200] + "..."
+	}
+	return fmt.Sprintf("line %d: %v\nstatement: %s", e.Line, e.Err, sql)
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// newStatementError points the error at the line of the statement the
+// server reported, when it reported a position.
+func newStatementError(stmt Statement, err error) *StatementError {
+	line := stmt.Line
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Position > 0 {
+		// Position counts characters from 1.
+		chars := 0
+		for _, r := range stmt.SQL {
+			chars++
+			if chars >= int(pgErr.Position) {
+				break
+			}
+			if r == '\n' {
+				line++
+			}
+		}
+	}
+	return &StatementError{Line: line, SQL: stmt.SQL, Err: err}
+}
+
+// RestoreGo restores the plain SQL backup at opts.BackupPath into dbname
+// without psql. Statements run one at a time outside a transaction, as psql
+// runs them, but the restore stops at the first failing statement.
+func RestoreGo(ctx context.Context, opts Options, dbname string) error {
+	f, err := os.Open(opts.BackupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+
+	return execScript(ctx, opts, dbname, f, info.Size())
+}
+
+// execScript runs the plain SQL script read from r, totalBytes long, against
+// dbname. psql meta-commands that matter for restores are honoured: \connect
+// switches databases and \encoding sets the client encoding. Progress is
+// reported after each statement and COPY block.
+func execScript(ctx context.Context, opts Options, dbname string, r io.Reader, totalBytes int64) error {
+	conn, err := pgconn.Connect(ctx, pgbackup.ConnString(opts.Host, opts.Port, opts.User, opts.Password, dbname))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database %s: %w", dbname, err)
+	}
+	defer func() { conn.Close(ctx) }()
+
+	script := NewScriptReader(r)
+	progress := Progress{TotalBytes: totalBytes}
+	for {
+		stmt, err := script.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup file at line %d: %w", script.Line(), err)
+		}
+
+		switch {
+		case stmt.Meta:
+			next, err := execMetaCommand(ctx, opts, conn, stmt)
+			if err != nil {
+				return newStatementError(stmt, err)
+			}
+			conn = next
+		case stmt.IsCopyFromStdin():
+			if _, err := conn.CopyFrom(ctx, script.CopyData(), stmt.SQL); err != nil {
+				return newStatementError(stmt, err)
+			}
+		default:
+			if _, err := conn.Exec(ctx, stmt.SQL).ReadAll(); err != nil {
+				return newStatementError(stmt, err)
+			}
+		}
+
+		progress.Statements++
+		if opts.Progress != nil {
+			progress.Bytes = script.Offset()
+			opts.Progress(progress)
+		}
+	}
+}
+
+// execMetaCommand runs a psql meta-command and returns the connection to use
+// from then on.
+func execMetaCommand(ctx context.Context, opts Options, conn *pgconn.PgConn, stmt Statement) (*pgconn.PgConn, error) {
+	name, args := stmt.MetaCommand()
+	switch name {
+	case "connect", "c":
+		if len(args) == 0 || args[0] == "-" {
+			return conn, nil
+		}
+		dbname := unquoteIdent(args[0])
+		next, err := pgconn.Connect(ctx, pgbackup.ConnString(opts.Host, opts.Port, opts.User, opts.Password, dbname))
+		if err != nil {
+			return conn, fmt.Errorf("failed to connect to database %s: %w", dbname, err)
+		}
+		conn.Close(ctx)
+		return next, nil
+	case "encoding":
+		if len(args) == 0 {
+			return conn, nil
+		}
+		_, err := conn.Exec(ctx, "SET client_encoding = '"+strings.ReplaceAll(args[0], "'", "''")+"'").ReadAll()
+		return conn, err
+	case ".", "set", "unset", "restrict", "unrestrict", "echo", "qecho":
+		// Terminators, psql variables and pg_dump's \restrict guard have no
+		// effect on the data.
+		return conn, nil
+	default:
+		return conn, fmt.Errorf("unsupported psql meta-command \\%s", name)
+	}
+}
+
+// unquoteIdent removes psql's double quotes from a database name.
+func unquoteIdent(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+	}
+	return s
+}
@@ -0,0 +1,313 @@
+package pgrestore
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbin"
+	"github.com/lib/pq"
+)
+
+// Maintenance selects the steps run on a database after it is restored.
+type Maintenance struct {
+	// Analyze refreshes the planner statistics, which a restore leaves empty.
+	Analyze bool `json:"analyze"`
+	// AnalyzeJobs above 1 runs vacuumdb --analyze-only with that many
+	// parallel jobs instead of a single ANALYZE.
+	AnalyzeJobs int `json:"analyze_jobs"`
+
+	// ResetSequences sets every serial and identity sequence to the
+	// maximum value of its column, which data-only restores leave behind.
+	ResetSequences bool `json:"reset_sequences"`
+
+	// Reindex lists the objects to rebuild, as "TABLE orders",
+	// "INDEX public.orders_pkey", "SCHEMA public" or "DATABASE".
+	Reindex []string `json:"reindex"`
+
+	// Checks are validation queries the restored data must pass.
+	Checks []Check `json:"checks"`
+}
+
+// Check is a validation query. With Expect set, the first column of the
+// first row must equal it as text; otherwise the query only fails if it
+// errors or returns false.
+type Check struct {
+	Name   string `json:"name"`
+	Query  string `json:"query"`
+	Expect string `json:"expect"`
+}
+
+func (c Check) label() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Query
+}
+
+// Enabled reports whether any step is selected.
+func (m Maintenance) Enabled() bool {
+	return m.Analyze || m.AnalyzeJobs > 1 || m.ResetSequences || len(m.Reindex) > 0 || len(m.Checks) > 0
+}
+
+// StepResult is the outcome of one maintenance step.
+type StepResult struct {
+	Step     string
+	Detail   string // What the step did, or why it failed
+	Err      error
+	Duration time.Duration
+}
+
+func (s StepResult) String() string {
+	status := "ok"
+	if s.Err != nil {
+		status = "FAILED"
+	}
+	line := fmt.Sprintf("%s: %s", s.Step, status)
+	if s.Detail != "" {
+		line += " (" + s.Detail + ")"
+	}
+	return line
+}
+
+// MaintenanceError reports the steps that failed after the data was restored.
+type MaintenanceError struct {
+	Failed []StepResult
+}
+
+func (e *MaintenanceError) Error() string {
+	names := make([]string, len(e.Failed))
+	for i, s := range e.Failed {
+		names[i] = fmt.Sprintf("%s: %v", s.Step, s.Err)
+	}
+	return "post-restore maintenance failed: " + strings.Join(names, "; ")
+}
+
+// RunMaintenance runs the selected steps against dbname in order: ANALYZE,
+// the sequence reset, REINDEX and the checks. Every step runs even when an
+// earlier one fails; the error lists the failed ones.
+func RunMaintenance(opts Options, dbname string) ([]StepResult, error) {
+	m := opts.Maintenance
+	if !m.Enabled() {
+		return nil, nil
+	}
+
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		opts.Host, opts.Port, opts.User, opts.Password, dbname)
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var steps []StepResult
+	step := func(name string, run func() (string, error)) {
+		start := time.Now()
+		detail, err := run()
+		if err != nil {
+			detail = err.Error()
+		}
+		steps = append(steps, StepResult{Step: name, Detail: detail, Err: err, Duration: time.Since(start)})
+	}
+
+	if m.Analyze || m.AnalyzeJobs > 1 {
+		step("ANALYZE", func() (string, error) { return analyze(db, opts, dbname) })
+	}
+	if m.ResetSequences {
+		step("Reset sequences", func() (string, error) { return resetSequences(db) })
+	}
+	for _, target := range m.Reindex {
+		step("REINDEX "+target, func() (string, error) { return reindex(db, target) })
+	}
+	for _, c := range m.Checks {
+		step("Check "+c.label(), func() (string, error) { return runCheck(db, c) })
+	}
+
+	var failed []StepResult
+	for _, s := range steps {
+		if s.Err != nil {
+			failed = append(failed, s)
+		}
+	}
+	if len(failed) > 0 {
+		return steps, &MaintenanceError{Failed: failed}
+	}
+	return steps, nil
+}
+
+// analyze runs vacuumdb with parallel jobs when asked to and installed,
+// and a plain ANALYZE otherwise.
+func analyze(db *sql.DB, opts Options, dbname string) (string, error) {
+	jobs := opts.Maintenance.AnalyzeJobs
+	if jobs > 1 {
+		if binaries := pgbin.Discover("vacuumdb", opts.ClientBinDirs); len(binaries) > 0 {
+			cmd := exec.Command(binaries[0].Path, "--analyze-only", "--jobs", fmt.Sprint(jobs),
+				"-h", opts.Host, "-p", fmt.Sprint(opts.Port), "-U", opts.User, "-d", dbname)
+			if opts.Password != "" {
+				cmd.Env = append(os.Environ(), "PGPASSWORD="+opts.Password)
+			}
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return "", fmt.Errorf("vacuumdb failed: %s: %w", strings.TrimSpace(string(output)), err)
+			}
+			return fmt.Sprintf("vacuumdb with %d jobs", jobs), nil
+		}
+	}
+	if _, err := db.Exec("ANALYZE"); err != nil {
+		return "", err
+	}
+	if jobs > 1 {
+		return "vacuumdb not found, ran a single ANALYZE", nil
+	}
+	return "", nil
+}
+
+// ownedSequencesQuery lists the sequences owned by a column: those behind
+// serial columns (dependency type 'a') and identity columns ('i'), with
+// their start value and increment.
+const ownedSequencesQuery = `
+	SELECT s.oid::regclass::text, t.oid::regclass::text, quote_ident(a.attname), q.start_value, q.increment_by
+	FROM pg_class s
+	JOIN pg_namespace n ON n.oid = s.relnamespace
+	JOIN pg_sequences q ON q.schemaname = n.nspname AND q.sequencename = s.relname
+	JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = s.oid
+		AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+	JOIN pg_class t ON t.oid = d.refobjid
+	JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+	WHERE s.relkind = 'S'
+	ORDER BY 1`
+
+// ownedSequence is a sequence and the column it numbers.
+type ownedSequence struct {
+	sequence, table, column string
+	start, increment        int64
+}
+
+// resetQuery sets the sequence, given as $1, so its next value follows the
+// largest value in its column, or the smallest for a descending sequence.
+// The sequence of an empty table restarts at its start value.
+func (o ownedSequence) resetQuery() (string, []any) {
+	last := "MAX"
+	if o.increment < 0 {
+		last = "MIN"
+	}
+	// The table and column come from regclass and quote_ident, so they are quoted already.
+	query := fmt.Sprintf("SELECT setval($1, COALESCE(%s(%s), $2), %s(%s) IS NOT NULL) FROM %s", last, o.column, last, o.column, o.table)
+	return query, []any{o.sequence, o.start}
+}
+
+// resetSequences sets each owned sequence so its next value follows the
+// values already in its column. A sequence of an empty table restarts.
+func resetSequences(db *sql.DB) (string, error) {
+	rows, err := db.Query(ownedSequencesQuery)
+	if err != nil {
+		return "", fmt.Errorf("failed to list sequences: %w", err)
+	}
+	var sequences []ownedSequence
+	for rows.Next() {
+		var o ownedSequence
+		if err := rows.Scan(&o.sequence, &o.table, &o.column, &o.start, &o.increment); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("failed to list sequences: %w", err)
+		}
+		sequences = append(sequences, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to list sequences: %w", err)
+	}
+
+	for _, o := range sequences {
+		query, args := o.resetQuery()
+		if _, err := db.Exec(query, args...); err != nil {
+			return "", fmt.Errorf("failed to reset %s: %w", o.sequence, err)
+		}
+	}
+	return fmt.Sprintf("%d sequences", len(sequences)), nil
+}
+
+// reindex rebuilds one "KIND name" target.
+func reindex(db *sql.DB, target string) (string, error) {
+	kind, name, _ := strings.Cut(strings.TrimSpace(target), " ")
+	kind = strings.ToUpper(kind)
+	var statement string
+	switch kind {
+	case "TABLE", "INDEX", "SCHEMA":
+		if name == "" {
+			return "", fmt.Errorf("REINDEX %s needs a name", kind)
+		}
+		statement = fmt.Sprintf("REINDEX %s %s", kind, quoteQualified(strings.TrimSpace(name)))
+	case "DATABASE":
+		var dbname string
+		if err := db.QueryRow("SELECT current_database()").Scan(&dbname); err != nil {
+			return "", err
+		}
+		statement = "REINDEX DATABASE " + pq.QuoteIdentifier(dbname)
+	default:
+		return "", fmt.Errorf("unknown REINDEX target %q, expected TABLE, INDEX, SCHEMA or DATABASE", target)
+	}
+	if _, err := db.Exec(statement); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// quoteQualified quotes each part of a possibly schema-qualified name.
+func quoteQualified(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = pq.QuoteIdentifier(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// runCheck runs a validation query and compares its result with c.Expect.
+func runCheck(db *sql.DB, c Check) (string, error) {
+	if c.Expect == "" {
+		if err := runValidationQuery(db, c.Query); err != nil {
+			return "", err
+		}
+		return "", nil
+	}
+
+	got, err := firstValue(db, c.Query)
+	switch {
+	case err == sql.ErrNoRows:
+		return "", fmt.Errorf("returned no rows, expected %q", c.Expect)
+	case err != nil:
+		return "", err
+	case !got.Valid:
+		return "", fmt.Errorf("returned NULL, expected %q", c.Expect)
+	case got.String != c.Expect:
+		return "", fmt.Errorf("returned %q, expected %q", got.String, c.Expect)
+	}
+	return "returned " + got.String, nil
+}
+
+// firstValue returns the first column of the first row of query as text.
+func firstValue(db *sql.DB, query string) (sql.NullString, error) {
+	var got sql.NullString
+	rows, err := db.Query(query)
+	if err != nil {
+		return got, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return got, err
+		}
+		return got, sql.ErrNoRows
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return got, err
+	}
+	values := make([]any, len(cols))
+	values[0] = &got
+	for i := 1; i < len(values); i++ {
+		values[i] = new(any)
+	}
+	return got, rows.Scan(values...)
+}
@@ -0,0 +1,60 @@
+package pgrestore
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestMaintenanceSummary verifies how step outcomes are reported.
+func TestMaintenanceSummary(t *testing.T) {
+	ok := StepResult{Step: "Reset sequences", Detail: "3 sequences"}
+	if got := ok.String(); got != "Reset sequences: ok (3 sequences)" {
+		t.Errorf("unexpected summary %q", got)
+	}
+
+	failed := StepResult{Step: "Check orders", Detail: `returned "0", expected "42"`, Err: errors.New(`returned "0", expected "42"`)}
+	if got := failed.String(); got != `Check orders: FAILED (returned "0", expected "42")` {
+		t.Errorf("unexpected summary %q", got)
+	}
+	err := &MaintenanceError{Failed: []StepResult{failed}}
+	if got := err.Error(); got != `post-restore maintenance failed: Check orders: returned "0", expected "42"` {
+		t.Errorf("unexpected error %q", got)
+	}
+
+	if (Maintenance{}).Enabled() {
+		t.Error("empty maintenance should be disabled")
+	}
+	if !(Maintenance{Checks: []Check{{Query: "SELECT true"}}}).Enabled() {
+		t.Error("maintenance with a check should be enabled")
+	}
+}
+
+// TestReindexTargets verifies REINDEX targets are validated and quoted.
+func TestReindexTargets(t *testing.T) {
+	if got := quoteQualified("public.Orders"); got != `"public"."Orders"` {
+		t.Errorf("unexpected quoting %q", got)
+	}
+	for _, target := range []string{"VIEW totals", "TABLE", ""} {
+		if _, err := reindex(nil, target); err == nil {
+			t.Errorf("expected target %q to be rejected", target)
+		}
+	}
+}
+
+// TestResetQuery verifies sequences restart at their own start value and
+// follow the smallest value when they descend.
+func TestResetQuery(t *testing.T) {
+	up := ownedSequence{sequence: "public.orders_id_seq", table: "public.orders", column: "id", start: 1000, increment: 1}
+	query, args := up.resetQuery()
+	if want := "SELECT setval($1, COALESCE(MAX(id), $2), MAX(id) IS NOT NULL) FROM public.orders"; query != want {
+		t.Errorf("unexpected query %q", query)
+	}
+	if len(args) != 2 || args[0] != "public.orders_id_seq" || args[1] != int64(1000) {
+		t.Errorf("unexpected arguments %v", args)
+	}
+
+	down := ownedSequence{sequence: "public.refunds_id_seq", table: "public.refunds", column: "id", start: -1, increment: -1}
+	if query, _ := down.resetQuery(); query != "SELECT setval($1, COALESCE(MIN(id), $2), MIN(id) IS NOT NULL) FROM public.refunds" {
+		t.Errorf("unexpected query %q", query)
+	}
+}
@@ -0,0 +1,161 @@
+package pgrestore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/dbpattern"
+)
+
+// Mode selects how a restore treats the target database.
+type Mode int
+
+const (
+	// ModeExisting restores into a database that already exists.
+	ModeExisting Mode = iota
+	// ModeCreate creates the target database before restoring.
+	ModeCreate
+	// ModeRecreate drops the target database and creates it again before restoring.
+	ModeRecreate
+	// ModeSwap restores into a staging database and swaps it in place of the target.
+	ModeSwap
+)
+
+// String returns a human-readable description of the mode.
+func (m Mode) String() string {
+	switch m {
+	case ModeExisting:
+		return "Restore to an existing database"
+	case ModeCreate:
+		return "Create a new database and restore into it"
+	case ModeRecreate:
+		return "Drop and recreate the database, then restore into it"
+	case ModeSwap:
+		return "Restore into a staging database, then swap it in"
+	default:
+		return "Unknown restore mode"
+	}
+}
+
+// Destructive reports whether the mode overwrites or removes existing data.
+func (m Mode) Destructive() bool {
+	return m == ModeExisting || m == ModeRecreate || m == ModeSwap
+}
+
+// CheckProtected returns an error if host/dbname matches one of the protected
+// target patterns, see dbpattern.Match.
+func CheckProtected(host, dbname string, patterns []string) error {
+	for _, pattern := range patterns {
+		match, err := dbpattern.Match(pattern, host, dbname)
+		if err != nil {
+			return fmt.Errorf("invalid protected target pattern %q: %w", pattern, err)
+		}
+		if match {
+			return fmt.Errorf("refusing to drop %s/%s: it matches the protected target pattern %q", host, dbname, pattern)
+		}
+	}
+	return nil
+}
+
+// DatabaseProperties reads the encoding, locale and owner of an existing database.
+func DatabaseProperties(host string, port int, user, password, dbname string) (CreateDBOptions, error) {
+	var opts CreateDBOptions
+
+	db, err := openMaintenanceDB(host, port, user, password)
+	if err != nil {
+		return opts, err
+	}
+	defer db.Close()
+
+	err = db.QueryRow(`
+		SELECT pg_encoding_to_char(encoding), datcollate, datctype, pg_get_userbyid(datdba)
+		FROM pg_database WHERE datname = $1`, dbname).Scan(&opts.Encoding, &opts.Collate, &opts.CType, &opts.Owner)
+	if err != nil {
+		return opts, fmt.Errorf("failed to read properties of database %s: %w", dbname, err)
+	}
+	return opts, nil
+}
+
+// TerminateConnections disconnects every other session connected to dbname.
+func TerminateConnections(host string, port int, user, password, dbname string) error {
+	db, err := openMaintenanceDB(host, port, user, password)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		SELECT pg_terminate_backend(pid)
+		FROM pg_stat_activity
+		WHERE datname = $1 AND pid <> pg_backend_pid()`, dbname)
+	if err != nil {
+		return fmt.Errorf("failed to terminate connections to %s: %w", dbname, err)
+	}
+	return nil
+}
+
+// DropDatabase drops dbname if it exists. On PostgreSQL 13 and newer it
+// disconnects sessions that connected after TerminateConnections as well.
+func DropDatabase(host string, port int, user, password, dbname string) error {
+	db, err := openMaintenanceDB(host, port, user, password)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var serverVersion int
+	if err := db.QueryRow("SELECT current_setting('server_version_num')::int").Scan(&serverVersion); err != nil {
+		return fmt.Errorf("failed to read server version: %w", err)
+	}
+	if _, err := db.Exec(dropStatement(dbname, serverVersion)); err != nil {
+		return fmt.Errorf("failed to drop database %s: %w", dbname, err)
+	}
+	return nil
+}
+
+// dropStatement returns the DROP DATABASE statement for dbname, forcing
+// other sessions out where the server supports it.
+func dropStatement(dbname string, serverVersion int) string {
+	stmt := "DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(dbname)
+	if serverVersion >= 130000 {
+		stmt += " WITH (FORCE)"
+	}
+	return stmt
+}
+
+// RecreateDB replaces dbname with an empty database created with the given
+// options. The new database is created under a temporary name first, so an
+// owner, encoding or locale the server does not have fails the recreation
+// before dbname is dropped.
+func RecreateDB(host string, port int, user, password, dbname string, opts CreateDBOptions) error {
+	temp := sideName(dbname, "new", time.Now())
+	if err := CreateNewDBWithOptions(host, port, user, password, temp, opts); err != nil {
+		return fmt.Errorf("%w, %s was not dropped", err, dbname)
+	}
+
+	err := TerminateConnections(host, port, user, password, dbname)
+	if err == nil {
+		err = DropDatabase(host, port, user, password, dbname)
+	}
+	if err != nil {
+		DropDatabase(host, port, user, password, temp)
+		return err
+	}
+	return renameDatabase(host, port, user, password, temp, dbname)
+}
+
+// renameDatabase renames the database from to to.
+func renameDatabase(host string, port int, user, password, from, to string) error {
+	db, err := openMaintenanceDB(host, port, user, password)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", pq.QuoteIdentifier(from), pq.QuoteIdentifier(to))); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", from, to, err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package pgrestore
+
+import "testing"
+
+// TestCheckProtected verifies matching of protected "host/database" patterns.
+func TestCheckProtected(t *testing.T) {
+	patterns := []string{"*prod*/*", "db.internal/billing", "analytics"}
+
+	cases := []struct {
+		host, dbname string
+		protected    bool
+	}{
+		{"prod-db-1.example.com", "app", true},
+		{"localhost", "app", false},
+		{"db.internal", "billing", true},
+		{"db.internal", "billing_copy", false},
+		{"localhost", "analytics", true},
+	}
+
+	for _, c := range cases {
+		err := CheckProtected(c.host, c.dbname, patterns)
+		if (err != nil) != c.protected {
+			t.Errorf("CheckProtected(%q, %q) = %v, want protected=%v", c.host, c.dbname, err, c.protected)
+		}
+	}
+}
+
+// TestDropStatement verifies sessions are forced out where supported.
+func TestDropStatement(t *testing.T) {
+	if got, want := dropStatement("app", 120017), `DROP DATABASE IF EXISTS "app"`; got != want {
+		t.Errorf("PostgreSQL 12: %s, want %s", got, want)
+	}
+	if got, want := dropStatement("app", 160002), `DROP DATABASE IF EXISTS "app" WITH (FORCE)`; got != want {
+		t.Errorf("PostgreSQL 16: %s, want %s", got, want)
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"os"
 	"os/exec"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // PreparePgRestoreCommand prepares the exec.Cmd for psql to restore a database.
@@ -16,41 +16,91 @@ func PreparePgRestoreCommand(host string, port int, user, password, dbname, back
 		return nil, fmt.Errorf("psql not found in system PATH. Please ensure PostgreSQL client tools are installed and in your PATH.")
 	}
 
+	return PrepareRestoreCommand("psql", host, port, user, password, dbname, backupPath), nil
+}
+
+// PrepareRestoreCommand prepares the exec.Cmd for the given psql binary to restore a database.
+// psql stops at the first failing statement and exits non-zero, so a partial
+// restore is reported as failed.
+func PrepareRestoreCommand(binary, host string, port int, user, password, dbname, backupPath string) *exec.Cmd {
 	args := []string{
 		"-h", host,
 		"-U", user,
 		"-d", dbname,
 		"-f", backupPath,
+		"--set", "ON_ERROR_STOP=1",
 	}
 
 	if port != 0 {
 		args = append(args, "-p", fmt.Sprintf("%d", port))
 	}
 
-	cmd := exec.Command("psql", args...)
+	cmd := exec.Command(binary, args...)
 
 	if password != "" {
 		cmd.Env = append(os.Environ(), "PGPASSWORD="+password)
 	}
 
-	return cmd, nil
+	return cmd
+}
+
+// CreateDBOptions controls the properties of a database created by CreateNewDBWithOptions.
+// Empty fields fall back to the server defaults.
+type CreateDBOptions struct {
+	Encoding string
+	Collate  string
+	CType    string
+	Owner    string
 }
 
 // CreateNewDB creates a new database.
 func CreateNewDB(host string, port int, user, password, dbname string) error {
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=postgres sslmode=disable",
-		host, port, user, password)
+	return CreateNewDBWithOptions(host, port, user, password, dbname, CreateDBOptions{})
+}
 
-	db, err := sql.Open("postgres", connStr)
+// CreateNewDBWithOptions creates a new database with the given encoding, locale and owner.
+func CreateNewDBWithOptions(host string, port int, user, password, dbname string, opts CreateDBOptions) error {
+	db, err := openMaintenanceDB(host, port, user, password)
 	if err != nil {
-		return fmt.Errorf("failed to connect to postgres database: %w", err)
+		return err
 	}
 	defer db.Close()
 
-	_, err = db.Exec(fmt.Sprintf("CREATE DATABASE %s", dbname))
+	stmt := "CREATE DATABASE " + pq.QuoteIdentifier(dbname)
+	if opts.Owner != "" {
+		stmt += " OWNER " + pq.QuoteIdentifier(opts.Owner)
+	}
+	if opts.Encoding != "" || opts.Collate != "" || opts.CType != "" {
+		// template1 may use a different encoding or locale, template0 never conflicts.
+		stmt += " TEMPLATE template0"
+	}
+	if opts.Encoding != "" {
+		stmt += " ENCODING " + pq.QuoteLiteral(opts.Encoding)
+	}
+	if opts.Collate != "" {
+		stmt += " LC_COLLATE " + pq.QuoteLiteral(opts.Collate)
+	}
+	if opts.CType != "" {
+		stmt += " LC_CTYPE " + pq.QuoteLiteral(opts.CType)
+	}
+
+	_, err = db.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("failed to create new database: %w", err)
 	}
 
 	return nil
 }
+
+// openMaintenanceDB connects to the "postgres" database, used for statements
+// that cannot run inside the database they affect.
+func openMaintenanceDB(host string, port int, user, password string) (*sql.DB, error) {
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=postgres sslmode=disable",
+		host, port, user, password)
+
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres database: %w", err)
+	}
+	return db, nil
+}
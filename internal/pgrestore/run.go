@@ -0,0 +1,246 @@
+package pgrestore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbin"
+)
+
+// Options describes a restore to run.
+type Options struct {
+	Host       string
+	Port       int
+	User       string
+	Password   string
+	DBName     string
+	BackupPath string
+	Mode       Mode
+
+	// ProtectedTargets are the "host/database" patterns ModeRecreate refuses to drop.
+	ProtectedTargets []string
+	// SafetyBackupDir is where ModeRecreate writes its safety backup.
+	// Empty means the directory of BackupPath.
+	SafetyBackupDir string
+	// ValidationQueries are run against the staging database in ModeSwap
+	// before it is swapped in.
+	ValidationQueries []string
+
+	// Tables, if set, restores only these tables of a plain SQL backup,
+	// as "schema.table" or "table", with their sequences, indexes and
+	// constraints. Only ModeExisting and ModeCreate support it.
+	Tables []string
+
+	// Engine selects psql or the built-in Go executor. EngineAuto uses psql
+	// when one is installed.
+	Engine Engine
+	// RestoreBinary is the psql to run. Empty selects the newest installed
+	// psql, searching ClientBinDirs as well.
+	RestoreBinary string
+	ClientBinDirs []string
+
+	// Maintenance selects the steps run on the restored database. In
+	// ModeSwap they run on the staging database, and a failure keeps it
+	// from being swapped in.
+	Maintenance Maintenance
+
+	// Progress, if set, is called as the Go engine reads through the backup.
+	Progress func(Progress)
+}
+
+// Result reports what a restore did besides restoring the data.
+type Result struct {
+	SafetyBackupPath string       // Set by ModeRecreate
+	PreviousDatabase string       // Set by ModeSwap when an old database was renamed aside
+	Engine           Engine       // The engine that ran the restore
+	Binary           pgbin.Binary // The psql that ran the restore, unset for EngineGo
+	Maintenance      []StepResult // Post-restore steps that ran, in order
+	Extraction       *Extraction  // Set when Tables restored part of the backup
+}
+
+// Run prepares the target database according to opts.Mode and restores the backup into it.
+func Run(opts Options) (*Result, error) {
+	result := &Result{}
+
+	if len(opts.Tables) > 0 {
+		if opts.Mode != ModeExisting && opts.Mode != ModeCreate {
+			return result, fmt.Errorf("chosen tables can only be restored into an existing or a new database")
+		}
+		path, extraction, err := extractTables(opts)
+		if err != nil {
+			return result, err
+		}
+		defer os.Remove(path)
+		result.Extraction = extraction
+		opts.BackupPath = path
+	}
+
+	opts.Engine = SelectEngine(opts)
+	result.Engine = opts.Engine
+	if opts.Engine == EnginePsql {
+		binary, err := ResolveRestoreBinary(opts)
+		if err != nil {
+			return result, err
+		}
+		result.Binary = binary
+		opts.RestoreBinary = binary.Path
+	}
+
+	switch opts.Mode {
+	case ModeCreate:
+		// If the user wants to create a new database, do that first.
+		if err := CreateNewDB(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName); err != nil {
+			return result, fmt.Errorf("failed to create new database: %w", err)
+		}
+	case ModeRecreate:
+		safetyPath, err := recreateTarget(opts)
+		result.SafetyBackupPath = safetyPath
+		if err != nil {
+			return result, err
+		}
+	case ModeSwap:
+		previous, err := restoreAndSwap(opts, result)
+		result.PreviousDatabase = previous
+		return result, err
+	}
+
+	if err := restoreInto(opts, opts.DBName, false); err != nil {
+		return result, err
+	}
+	steps, err := RunMaintenance(opts, opts.DBName)
+	result.Maintenance = steps
+	return result, err
+}
+
+// restoreInto restores opts.BackupPath into dbname with the engine selected by
+// Run. With singleTransaction psql restores the whole backup or nothing.
+func restoreInto(opts Options, dbname string, singleTransaction bool) error {
+	if opts.Engine == EngineGo {
+		if err := RestoreGo(context.Background(), opts, dbname); err != nil {
+			return fmt.Errorf("go restore engine failed: %w", err)
+		}
+		return nil
+	}
+
+	cmd := PrepareRestoreCommand(opts.RestoreBinary, opts.Host, opts.Port, opts.User, opts.Password, dbname, opts.BackupPath)
+	if singleTransaction {
+		cmd.Args = append(cmd.Args, "--single-transaction")
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pg_restore failed: %s: %w", string(output), err)
+	}
+	return nil
+}
+
+// extractTables writes the tables chosen in opts to a temporary SQL file
+// and returns its path.
+func extractTables(opts Options) (string, *Extraction, error) {
+	f, err := os.CreateTemp("", "go-pg-backup-extract-*.sql")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create extraction file: %w", err)
+	}
+	path := f.Name()
+	f.Close()
+	extraction, err := ExtractFile(opts.BackupPath, path, opts.Tables)
+	if err != nil {
+		os.Remove(path)
+		return "", nil, err
+	}
+	return path, extraction, nil
+}
+
+// createOptionsFor returns the properties a database restored from backupPath
+// should be created with. It prefers the properties recorded in the backup's
+// manifest and falls back to those of the existing database dbname.
+func createOptionsFor(opts Options, dbname string) (CreateDBOptions, error) {
+	manifest, err := pgbackup.ReadManifest(opts.BackupPath)
+	if err == nil {
+		return CreateDBOptions{
+			Encoding: manifest.Encoding,
+			Collate:  manifest.Collate,
+			CType:    manifest.CType,
+			Owner:    manifest.Owner,
+		}, nil
+	}
+	if !os.IsNotExist(err) {
+		return CreateDBOptions{}, err
+	}
+	return DatabaseProperties(opts.Host, opts.Port, opts.User, opts.Password, dbname)
+}
+
+// recreateTarget drops and recreates the target ahead of a restore. It refuses
+// protected targets and takes a safety backup of the database before dropping
+// it, returning the safety backup's path.
+func recreateTarget(opts Options) (string, error) {
+	if err := CheckProtected(opts.Host, opts.DBName, opts.ProtectedTargets); err != nil {
+		return "", err
+	}
+
+	createOpts, err := createOptionsFor(opts, opts.DBName)
+	if err != nil {
+		return "", err
+	}
+
+	safetyDir := opts.SafetyBackupDir
+	if safetyDir == "" {
+		safetyDir = filepath.Dir(opts.BackupPath)
+	}
+	if err := pgbackup.CreateDestinationDir(safetyDir); err != nil {
+		return "", fmt.Errorf("failed to create safety backup directory: %w", err)
+	}
+	safetyPath := filepath.Join(safetyDir, fmt.Sprintf("%s-pre-drop-%s.sql", opts.DBName, time.Now().Format("20060102-150405")))
+	// pgbackup.Run falls back to the Go engine when pg_dump is not installed.
+	_, err = pgbackup.Run(pgbackup.Options{
+		Host:          opts.Host,
+		Port:          opts.Port,
+		User:          opts.User,
+		Password:      opts.Password,
+		DBName:        opts.DBName,
+		OutputPath:    safetyPath,
+		ClientBinDirs: opts.ClientBinDirs,
+		Safety:        true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("safety backup failed, database was not dropped: %w", err)
+	}
+
+	if err := RecreateDB(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName, createOpts); err != nil {
+		return safetyPath, fmt.Errorf("failed to recreate database (safety backup at %s): %w", safetyPath, err)
+	}
+	return safetyPath, nil
+}
+
+// ResolveRestoreBinary returns the psql to use for opts: opts.RestoreBinary if
+// set, otherwise the newest installed psql. A psql older than the server is
+// accepted since it can usually still restore a plain dump.
+func ResolveRestoreBinary(opts Options) (pgbin.Binary, error) {
+	if opts.RestoreBinary != "" {
+		version, err := pgbin.ClientVersion(opts.RestoreBinary)
+		if err != nil {
+			return pgbin.Binary{}, err
+		}
+		return pgbin.Binary{Path: opts.RestoreBinary, Version: version}, nil
+	}
+
+	binaries := pgbin.Discover("psql", opts.ClientBinDirs)
+	if len(binaries) == 0 {
+		return pgbin.Binary{}, fmt.Errorf("psql not found in PATH or the PostgreSQL install directories. Please ensure PostgreSQL client tools are installed.")
+	}
+	return binaries[0], nil
+}
+
+// SelectEngine resolves EngineAuto to the engine a restore will use: psql
+// when one is installed or forced, the Go executor otherwise.
+func SelectEngine(opts Options) Engine {
+	if opts.Engine != EngineAuto {
+		return opts.Engine
+	}
+	if opts.RestoreBinary != "" || len(pgbin.Discover("psql", opts.ClientBinDirs)) > 0 {
+		return EnginePsql
+	}
+	return EngineGo
+}
@@ -0,0 +1,374 @@
+package pgrestore
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Statement is one command read from a plain SQL script.
+type Statement struct {
+	SQL  string // The statement including its semicolon, or the whole meta-command line
+	Line int    // Line the statement starts on, counting from 1
+	Meta bool   // A psql meta-command such as \connect
+}
+
+var copyFromStdin = regexp.MustCompile(`(?is)^COPY\s.*\sFROM\s+stdin\b`)
+
+// IsCopyFromStdin reports whether the statement is followed by inline COPY data.
+func (s Statement) IsCopyFromStdin() bool {
+	return !s.Meta && copyFromStdin.MatchString(s.SQL)
+}
+
+// MetaCommand splits a meta-command into its name, without the backslash, and arguments.
+func (s Statement) MetaCommand() (string, []string) {
+	fields := strings.Fields(strings.TrimPrefix(s.SQL, `\`))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+// ScriptReader splits a plain SQL script, such as one written by pg_dump, into
+// statements the way psql does: semicolons inside quotes, dollar-quoted bodies,
+// comments, parentheses and BEGIN ATOMIC bodies do not end a statement, and a
+// backslash at the start of a statement begins a meta-command line.
+type ScriptReader struct {
+	r      *bufio.Reader
+	line   int
+	offset int64
+}
+
+// NewScriptReader returns a ScriptReader reading from r.
+func NewScriptReader(r io.Reader) *ScriptReader {
+	return &ScriptReader{r: bufio.NewReaderSize(r, 1<<16), line: 1}
+}
+
+// Offset returns the number of bytes consumed so far.
+func (s *ScriptReader) Offset() int64 {
+	return s.offset
+}
+
+// Line returns the line the reader is on.
+func (s *ScriptReader) Line() int {
+	return s.line
+}
+
+func (s *ScriptReader) readByte() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	s.offset++
+	if c == '\n' {
+		s.line++
+	}
+	return c, nil
+}
+
+func (s *ScriptReader) peekByte() byte {
+	b, err := s.r.Peek(1)
+	if err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+// readLine consumes the rest of the current line, including its newline.
+func (s *ScriptReader) readLine() ([]byte, error) {
+	line, err := s.r.ReadBytes('\n')
+	s.offset += int64(len(line))
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		s.line++
+	}
+	return line, err
+}
+
+// lexer states
+const (
+	stateNormal = iota
+	stateQuote
+	stateEscapeQuote
+	stateIdent
+	stateDollar
+	stateLineComment
+	stateBlockComment
+)
+
+// Next returns the next statement. It returns io.EOF when the script is
+// exhausted. After a statement for which IsCopyFromStdin is true, the caller
+// must consume its data with CopyData before calling Next again.
+func (s *ScriptReader) Next() (Statement, error) {
+	if err := s.skipBlank(); err != nil {
+		return Statement{}, err
+	}
+
+	stmt := Statement{Line: s.line}
+	if s.peekByte() == '\\' {
+		line, err := s.readLine()
+		if err != nil && err != io.EOF {
+			return Statement{}, err
+		}
+		stmt.SQL = strings.TrimRight(string(line), "\r\n")
+		stmt.Meta = true
+		return stmt, nil
+	}
+
+	var (
+		buf        bytes.Buffer
+		state      = stateNormal
+		tag        []byte // closing tag of the current dollar quote
+		parens     int
+		comments   int // nesting depth of block comments
+		word       []byte
+		words      []string // leading words, to recognise CREATE FUNCTION
+		beginDepth int
+	)
+
+	// endWord tracks keywords that open and close BEGIN ATOMIC bodies.
+	endWord := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := strings.ToLower(string(word))
+		word = word[:0]
+		if len(words) < 4 {
+			words = append(words, w)
+		}
+		if !isRoutineDefinition(words) {
+			return
+		}
+		switch {
+		case w == "begin":
+			beginDepth++
+		case w == "case" && beginDepth > 0:
+			beginDepth++
+		case w == "end" && beginDepth > 0:
+			beginDepth--
+		}
+	}
+
+	for {
+		c, err := s.readByte()
+		if err == io.EOF {
+			endWord()
+			stmt.SQL = strings.TrimSpace(buf.String())
+			if stmt.SQL == "" {
+				return Statement{}, io.EOF
+			}
+			// psql runs an unterminated final statement too.
+			return stmt, nil
+		}
+		if err != nil {
+			return Statement{}, err
+		}
+		buf.WriteByte(c)
+
+		switch state {
+		case stateNormal:
+			if isWordByte(c) {
+				word = append(word, c)
+				continue
+			}
+			if c == '$' && len(word) > 0 {
+				// A dollar inside an identifier, not a quote.
+				word = append(word, c)
+				continue
+			}
+			prev := word
+			endWord()
+
+			switch c {
+			case '\'':
+				state = stateQuote
+				if len(prev) == 1 && (prev[0] == 'E' || prev[0] == 'e') {
+					state = stateEscapeQuote
+				}
+			case '"':
+				state = stateIdent
+			case '-':
+				if s.peekByte() == '-' {
+					state = stateLineComment
+				}
+			case '/':
+				if s.peekByte() == '*' {
+					c, _ = s.readByte()
+					buf.WriteByte(c)
+					state = stateBlockComment
+					comments = 1
+				}
+			case '$':
+				if t := s.dollarTag(); t != nil {
+					buf.Write(t[1:])
+					tag = t
+					state = stateDollar
+				}
+			case '(':
+				parens++
+			case ')':
+				if parens > 0 {
+					parens--
+				}
+			case ';':
+				if parens == 0 && beginDepth == 0 {
+					stmt.SQL = strings.TrimSpace(buf.String())
+					return stmt, nil
+				}
+			}
+		case stateQuote, stateEscapeQuote:
+			if c == '\\' && state == stateEscapeQuote {
+				if c, err = s.readByte(); err == nil {
+					buf.WriteByte(c)
+				}
+			} else if c == '\'' {
+				if s.peekByte() == '\'' {
+					c, _ = s.readByte()
+					buf.WriteByte(c)
+				} else {
+					state = stateNormal
+				}
+			}
+		case stateIdent:
+			if c == '"' {
+				if s.peekByte() == '"' {
+					c, _ = s.readByte()
+					buf.WriteByte(c)
+				} else {
+					state = stateNormal
+				}
+			}
+		case stateDollar:
+			if c == '$' && bytes.HasSuffix(buf.Bytes(), tag) {
+				state = stateNormal
+			}
+		case stateLineComment:
+			if c == '\n' {
+				state = stateNormal
+			}
+		case stateBlockComment:
+			switch {
+			case c == '/' && s.peekByte() == '*':
+				c, _ = s.readByte()
+				buf.WriteByte(c)
+				comments++
+			case c == '*' && s.peekByte() == '/':
+				c, _ = s.readByte()
+				buf.WriteByte(c)
+				comments--
+				if comments == 0 {
+					state = stateNormal
+				}
+			}
+		}
+	}
+}
+
+// skipBlank consumes whitespace and line comments ahead of a statement so
+// statements report the line their text starts on.
+func (s *ScriptReader) skipBlank() error {
+	for {
+		b, err := s.r.Peek(2)
+		if len(b) == 0 {
+			if err == io.EOF {
+				return io.EOF
+			}
+			return err
+		}
+		switch {
+		case b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n':
+			s.readByte()
+		case len(b) == 2 && b[0] == '-' && b[1] == '-':
+			if _, err := s.readLine(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// dollarTag is called after a '$' and, if it opens a dollar quote, consumes
+// the rest of the opening delimiter and returns the whole delimiter.
+func (s *ScriptReader) dollarTag() []byte {
+	for n := 1; n <= 64; n++ {
+		b, err := s.r.Peek(n)
+		if err != nil {
+			return nil
+		}
+		c := b[n-1]
+		if c == '$' {
+			tag := append([]byte{'$'}, b...)
+			for i := 0; i < n; i++ {
+				s.readByte()
+			}
+			return tag
+		}
+		if !isWordByte(c) || (n == 1 && c >= '0' && c <= '9') {
+			// $1 is a parameter, not a quote.
+			return nil
+		}
+	}
+	return nil
+}
+
+// CopyData returns the inline data following a COPY ... FROM stdin
+// statement, up to but not including the terminating \. line.
+func (s *ScriptReader) CopyData() io.Reader {
+	return &copyReader{s: s}
+}
+
+type copyReader struct {
+	s       *ScriptReader
+	started bool
+	done    bool
+	pending []byte
+}
+
+func (c *copyReader) Read(p []byte) (int, error) {
+	if !c.started {
+		// The data starts on the line after the COPY statement.
+		c.started = true
+		if _, err := c.s.readLine(); err != nil {
+			c.done = true
+		}
+	}
+	for len(c.pending) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		line, err := c.s.readLine()
+		if t := bytes.TrimRight(line, "\r\n"); string(t) == `\.` {
+			c.done = true
+			return 0, io.EOF
+		}
+		if err == io.EOF {
+			c.done = true
+		} else if err != nil {
+			return 0, err
+		}
+		c.pending = line
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// isRoutineDefinition reports whether the leading words start a CREATE
+// FUNCTION or CREATE PROCEDURE, whose SQL-standard bodies contain semicolons.
+func isRoutineDefinition(words []string) bool {
+	if len(words) < 2 || words[0] != "create" {
+		return false
+	}
+	i := 1
+	if len(words) >= 3 && words[1] == "or" && words[2] == "replace" {
+		i = 3
+	}
+	return i < len(words) && (words[i] == "function" || words[i] == "procedure")
+}
@@ -0,0 +1,84 @@
+package pgrestore
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestScriptReader verifies statements are split the way psql splits them.
+func TestScriptReader(t *testing.T) {
+	script := `--
+-- PostgreSQL database dump
+--
+
+\restrict abc123
+SET client_encoding = 'UTF8';
+CREATE FUNCTION public.f() RETURNS text
+    LANGUAGE plpgsql
+    AS $_$
+BEGIN
+  RETURN 'a;b';
+END;
+$_$;
+CREATE FUNCTION public.g(a integer) RETURNS integer
+    LANGUAGE sql
+    BEGIN ATOMIC
+ SELECT CASE WHEN (a > 0) THEN 1 ELSE 0 END;
+ SELECT $1;
+END;
+INSERT INTO "semi;colon" VALUES (E'it\'s;', 'x''y;', (1;2)) /* c; /* nested; */ */;
+COPY public.t (id, name) FROM stdin;
+1	one
+2	a\.b
+\.
+
+SELECT 1 -- trailing; comment
+;
+\connect other
+SELECT 2`
+
+	want := []struct {
+		line int
+		sql  string
+		meta bool
+		copy string
+	}{
+		{5, `\restrict abc123`, true, ""},
+		{6, "SET client_encoding = 'UTF8';", false, ""},
+		{7, "CREATE FUNCTION public.f()", false, ""},
+		{14, "CREATE FUNCTION public.g(a integer)", false, ""},
+		{20, `INSERT INTO "semi;colon"`, false, ""},
+		{21, "COPY public.t (id, name) FROM stdin;", false, "1\tone\n2\ta\\.b\n"},
+		{26, "SELECT 1 -- trailing; comment\n;", false, ""},
+		{28, `\connect other`, true, ""},
+		{29, "SELECT 2", false, ""},
+	}
+
+	r := NewScriptReader(strings.NewReader(script))
+	for i, w := range want {
+		stmt, err := r.Next()
+		if err != nil {
+			t.Fatalf("statement %d: %v", i, err)
+		}
+		if stmt.Line != w.line || stmt.Meta != w.meta || !strings.HasPrefix(stmt.SQL, w.sql) {
+			t.Errorf("statement %d = line %d meta %t %q, want line %d meta %t %q",
+				i, stmt.Line, stmt.Meta, stmt.SQL, w.line, w.meta, w.sql)
+		}
+		if stmt.IsCopyFromStdin() != (w.copy != "") {
+			t.Errorf("statement %d: IsCopyFromStdin = %t", i, stmt.IsCopyFromStdin())
+		}
+		if w.copy != "" {
+			data, err := io.ReadAll(r.CopyData())
+			if err != nil || string(data) != w.copy {
+				t.Errorf("statement %d: copy data %q, %v; want %q", i, data, err, w.copy)
+			}
+		}
+	}
+	if stmt, err := r.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %q, %v", stmt.SQL, err)
+	}
+	if r.Offset() != int64(len(script)) {
+		t.Errorf("consumed %d bytes of %d", r.Offset(), len(script))
+	}
+}
@@ -0,0 +1,195 @@
+package pgrestore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// maxIdentifierLength is PostgreSQL's default NAMEDATALEN minus one.
+const maxIdentifierLength = 63
+
+// swapRetries is how often the rename is attempted when new sessions race in.
+const swapRetries = 3
+
+// sideName returns "<dbname>_<tag>_<timestamp>", shortening dbname so the
+// result fits in a PostgreSQL identifier.
+func sideName(dbname, tag string, at time.Time) string {
+	suffix := fmt.Sprintf("_%s_%s", tag, at.Format("20060102150405"))
+	if len(dbname)+len(suffix) > maxIdentifierLength {
+		n := maxIdentifierLength - len(suffix)
+		// Cut at a character boundary, a partial one is not valid UTF-8.
+		for n > 0 && !utf8.RuneStart(dbname[n]) {
+			n--
+		}
+		dbname = dbname[:n]
+	}
+	return dbname + suffix
+}
+
+// restoreAndSwap restores the backup into a staging database, validates it and
+// swaps it into place of the target. The previous target is renamed aside and
+// kept for rollback; its new name is returned. The maintenance steps run on
+// the staging database and are recorded in result.
+func restoreAndSwap(opts Options, result *Result) (string, error) {
+	now := time.Now()
+	staging := sideName(opts.DBName, "staging", now)
+	previous := sideName(opts.DBName, "old", now)
+
+	exists, err := databaseExists(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName)
+	if err != nil {
+		return "", err
+	}
+
+	var createOpts CreateDBOptions
+	if exists {
+		createOpts, err = createOptionsFor(opts, opts.DBName)
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := CreateNewDBWithOptions(opts.Host, opts.Port, opts.User, opts.Password, staging, createOpts); err != nil {
+		return "", fmt.Errorf("failed to create staging database: %w", err)
+	}
+
+	// A failed restore leaves nothing worth inspecting, the backup is
+	// restored whole or not at all.
+	if err := restoreInto(opts, staging, true); err != nil {
+		if dropErr := DropDatabase(opts.Host, opts.Port, opts.User, opts.Password, staging); dropErr != nil {
+			return "", fmt.Errorf("restore into staging database %s failed, target left untouched (%v): %w", staging, dropErr, err)
+		}
+		return "", fmt.Errorf("restore into staging database failed, target left untouched and staging database dropped: %w", err)
+	}
+	if err := RunValidationQueries(opts.Host, opts.Port, opts.User, opts.Password, staging, opts.ValidationQueries); err != nil {
+		return "", fmt.Errorf("validation of staging database %s failed, target left untouched: %w", staging, err)
+	}
+	steps, err := RunMaintenance(opts, staging)
+	result.Maintenance = steps
+	if err != nil {
+		return "", fmt.Errorf("staging database %s was not swapped in, target left untouched: %w", staging, err)
+	}
+
+	if !exists {
+		previous = ""
+	}
+	for attempt := 1; ; attempt++ {
+		err = swapDatabases(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName, staging, previous)
+		if err == nil || attempt == swapRetries {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to swap in staging database %s: %w", staging, err)
+	}
+	return previous, nil
+}
+
+// RunValidationQueries runs each query against dbname. A query fails the
+// validation if it errors or if its first column of the first row is false.
+func RunValidationQueries(host string, port int, user, password, dbname string, queries []string) error {
+	if len(queries) == 0 {
+		return nil
+	}
+
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		host, port, user, password, dbname)
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	for _, query := range queries {
+		if err := runValidationQuery(db, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runValidationQuery(db *sql.DB, query string) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("validation query %q failed: %w", query, err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		cols, err := rows.Columns()
+		if err != nil {
+			return fmt.Errorf("validation query %q failed: %w", query, err)
+		}
+		values := make([]any, len(cols))
+		for i := range values {
+			values[i] = new(any)
+		}
+		if err := rows.Scan(values...); err != nil {
+			return fmt.Errorf("validation query %q failed: %w", query, err)
+		}
+		if ok, isBool := (*values[0].(*any)).(bool); isBool && !ok {
+			return fmt.Errorf("validation query %q returned false", query)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("validation query %q failed: %w", query, err)
+	}
+	return nil
+}
+
+// databaseExists reports whether dbname exists on the server.
+func databaseExists(host string, port int, user, password, dbname string) (bool, error) {
+	db, err := openMaintenanceDB(host, port, user, password)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var exists bool
+	err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", dbname).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether database %s exists: %w", dbname, err)
+	}
+	return exists, nil
+}
+
+// swapDatabases renames target to previous (when previous is set) and staging
+// to target in a single transaction, after terminating sessions on both.
+func swapDatabases(host string, port int, user, password, target, staging, previous string) error {
+	db, err := openMaintenanceDB(host, port, user, password)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin swap transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		SELECT pg_terminate_backend(pid)
+		FROM pg_stat_activity
+		WHERE datname = ANY($1) AND pid <> pg_backend_pid()`, pq.Array([]string{target, staging}))
+	if err != nil {
+		return fmt.Errorf("failed to terminate sessions: %w", err)
+	}
+
+	if previous != "" {
+		if _, err := tx.Exec(fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", pq.QuoteIdentifier(target), pq.QuoteIdentifier(previous))); err != nil {
+			return fmt.Errorf("failed to rename %s aside: %w", target, err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", pq.QuoteIdentifier(staging), pq.QuoteIdentifier(target))); err != nil {
+		return fmt.Errorf("failed to rename %s into place: %w", staging, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit swap: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package pgrestore
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// TestSideName verifies staging and rollback names fit in an identifier.
+func TestSideName(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	if got := sideName("shop", "staging", at); got != "shop_staging_20240506070809" {
+		t.Errorf("unexpected name %q", got)
+	}
+
+	long := strings.Repeat("a", 60)
+	got := sideName(long, "old", at)
+	if len(got) > maxIdentifierLength {
+		t.Errorf("name %q is %d bytes, longer than %d", got, len(got), maxIdentifierLength)
+	}
+	if !strings.HasSuffix(got, "_old_20240506070809") {
+		t.Errorf("name %q lost its suffix", got)
+	}
+
+	// Multibyte names are cut between characters.
+	got = sideName("a"+strings.Repeat("ü", 30), "staging", at)
+	if len(got) > maxIdentifierLength || !utf8.ValidString(got) {
+		t.Errorf("name %q is %d bytes, valid UTF-8: %v", got, len(got), utf8.ValidString(got))
+	}
+}
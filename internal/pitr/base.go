@@ -0,0 +1,258 @@
+// Package pitr takes physical base backups with pg_basebackup, archives WAL
+// segments and lays out data directories for point-in-time recovery.
+//
+// An archive directory holds both:
+//
+//	<archive>/base/<label>/base.tar.gz   the data directory
+//	<archive>/base/<label>/pg_wal.tar.gz the WAL needed to make it consistent
+//	<archive>/base/<label>/base.json     the BaseBackup describing it
+//	<archive>/wal/<segment>              WAL archived by archive_command
+package pitr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbin"
+)
+
+// BaseInfoFile names the description written next to each base backup.
+const BaseInfoFile = "base.json"
+
+// LSN is a position in the write-ahead log.
+type LSN uint64
+
+// ParseLSN parses the "16/B374D848" form PostgreSQL prints.
+func ParseLSN(s string) (LSN, error) {
+	hi, lo, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid LSN %q, expected the form 16/B374D848", s)
+	}
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q, expected the form 16/B374D848", s)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q, expected the form 16/B374D848", s)
+	}
+	return LSN(h<<32 | l), nil
+}
+
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint64(l)>>32, uint64(l)&0xFFFFFFFF)
+}
+
+// MarshalText writes the LSN in PostgreSQL's form.
+func (l LSN) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText reads the LSN in PostgreSQL's form.
+func (l *LSN) UnmarshalText(b []byte) error {
+	v, err := ParseLSN(string(b))
+	*l = v
+	return err
+}
+
+// BaseBackup describes a base backup in an archive directory.
+type BaseBackup struct {
+	Label         string    `json:"label"`
+	Host          string    `json:"host"`
+	Port          int       `json:"port"`
+	ServerVersion int       `json:"server_version"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	StartLSN      LSN       `json:"start_lsn"`
+	EndLSN        LSN       `json:"end_lsn"` // Recovery is consistent from here on
+	Timeline      int       `json:"timeline"`
+	Binary        string    `json:"binary"`         // pg_basebackup that took the backup
+	BinaryVersion string    `json:"binary_version"` // Its version, e.g. "16.2"
+
+	Dir string `json:"-"` // Directory holding the backup
+}
+
+// BaseOptions describes a base backup to take.
+type BaseOptions struct {
+	Host     string
+	Port     int
+	User     string // Needs the REPLICATION attribute
+	Password string
+	DBName   string // Database connected to for the version check
+
+	ArchiveDir string
+
+	// Binary is the pg_basebackup to run. Empty selects the newest installed
+	// one that supports the server, searching ClientBinDirs as well.
+	Binary        string
+	ClientBinDirs []string
+}
+
+// BaseDir returns the directory holding the base backups of an archive.
+func BaseDir(archiveDir string) string {
+	return filepath.Join(archiveDir, "base")
+}
+
+// WALDir returns the directory holding the archived WAL of an archive.
+func WALDir(archiveDir string) string {
+	return filepath.Join(archiveDir, "wal")
+}
+
+// checkServerVersion refuses servers older than PostgreSQL 12, which have no
+// recovery.signal and read recovery settings from recovery.conf.
+func checkServerVersion(serverVersion int) error {
+	if serverVersion < 120000 {
+		return fmt.Errorf("point-in-time recovery needs PostgreSQL 12 or newer, the server is %s", pgbin.FormatVersion(serverVersion))
+	}
+	return nil
+}
+
+// TakeBaseBackup runs pg_basebackup into a new directory of the archive. The
+// backup is written as compressed tar files and includes the WAL streamed
+// while it ran, so it can be restored even before any WAL is archived.
+func TakeBaseBackup(opts BaseOptions) (*BaseBackup, error) {
+	dbname := opts.DBName
+	if dbname == "" {
+		dbname = "postgres"
+	}
+	serverVersion, err := pgbin.ServerVersion(opts.Host, opts.Port, opts.User, opts.Password, dbname)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkServerVersion(serverVersion); err != nil {
+		return nil, err
+	}
+
+	binary := pgbin.Binary{Path: opts.Binary}
+	if binary.Path != "" {
+		if binary.Version, err = pgbin.ClientVersion(binary.Path); err != nil {
+			return nil, err
+		}
+	} else if binary, err = pgbin.Resolve("pg_basebackup", opts.ClientBinDirs, serverVersion); err != nil {
+		return nil, err
+	}
+
+	started := time.Now().UTC()
+	base := &BaseBackup{
+		Label:         started.Format("20060102-150405"),
+		Host:          opts.Host,
+		Port:          opts.Port,
+		ServerVersion: serverVersion,
+		StartedAt:     started,
+		Binary:        binary.Path,
+		BinaryVersion: pgbin.FormatVersion(binary.Version),
+	}
+	base.Dir = filepath.Join(BaseDir(opts.ArchiveDir), base.Label)
+	if err := os.MkdirAll(BaseDir(opts.ArchiveDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if _, err := os.Stat(base.Dir); err == nil {
+		return nil, fmt.Errorf("base backup %s already exists", base.Dir)
+	}
+
+	cmd := exec.Command(binary.Path,
+		"-h", opts.Host,
+		"-p", strconv.Itoa(opts.Port),
+		"-U", opts.User,
+		"-D", base.Dir,
+		"--format=tar",
+		"--gzip",
+		"--wal-method=stream",
+		"--checkpoint=fast",
+		"--label=go-pg-backup "+base.Label,
+		"--no-password",
+		"--verbose",
+	)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+opts.Password)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(base.Dir)
+		return nil, fmt.Errorf("pg_basebackup failed: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	base.FinishedAt = time.Now().UTC()
+
+	if err := parseBaseBackupLog(stderr.String(), base); err != nil {
+		return nil, fmt.Errorf("base backup written but %w", err)
+	}
+	if err := writeBaseInfo(base); err != nil {
+		return nil, fmt.Errorf("base backup written but failed to record it: %w", err)
+	}
+	return base, nil
+}
+
+var (
+	startPointRE = regexp.MustCompile(`write-ahead log start point: ([0-9A-Fa-f]+/[0-9A-Fa-f]+) on timeline (\d+)`)
+	endPointRE   = regexp.MustCompile(`write-ahead log end point: ([0-9A-Fa-f]+/[0-9A-Fa-f]+)`)
+)
+
+// parseBaseBackupLog reads the WAL range of a backup from pg_basebackup's
+// verbose output.
+func parseBaseBackupLog(log string, base *BaseBackup) error {
+	start := startPointRE.FindStringSubmatch(log)
+	end := endPointRE.FindStringSubmatch(log)
+	if start == nil || end == nil {
+		return fmt.Errorf("pg_basebackup did not report its WAL start and end points")
+	}
+	var err error
+	if base.StartLSN, err = ParseLSN(start[1]); err != nil {
+		return err
+	}
+	if base.EndLSN, err = ParseLSN(end[1]); err != nil {
+		return err
+	}
+	base.Timeline, err = strconv.Atoi(start[2])
+	return err
+}
+
+func writeBaseInfo(base *BaseBackup) error {
+	data, err := json.MarshalIndent(base, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(base.Dir, BaseInfoFile), append(data, '\n'), 0644)
+}
+
+// ListBaseBackups returns the base backups of an archive, oldest first.
+// Directories without a description, such as a backup still being taken,
+// are skipped.
+func ListBaseBackups(archiveDir string) ([]BaseBackup, error) {
+	entries, err := os.ReadDir(BaseDir(archiveDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list base backups: %w", err)
+	}
+	var backups []BaseBackup
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(BaseDir(archiveDir), e.Name())
+		data, err := os.ReadFile(filepath.Join(dir, BaseInfoFile))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read base backup %s: %w", dir, err)
+		}
+		var base BaseBackup
+		if err := json.Unmarshal(data, &base); err != nil {
+			return nil, fmt.Errorf("failed to parse base backup %s: %w", dir, err)
+		}
+		base.Dir = dir
+		backups = append(backups, base)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].FinishedAt.Before(backups[j].FinishedAt)
+	})
+	return backups, nil
+}
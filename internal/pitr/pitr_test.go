@@ -0,0 +1,353 @@
+package pitr
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbin"
+	_ "github.com/lib/pq"
+)
+
+// TestCheckServerVersion verifies servers before PostgreSQL 12 are refused.
+func TestCheckServerVersion(t *testing.T) {
+	for version, ok := range map[int]bool{90624: false, 110022: false, 120000: true, 160002: true} {
+		if err := checkServerVersion(version); (err == nil) != ok {
+			t.Errorf("checkServerVersion(%d) = %v", version, err)
+		}
+	}
+}
+
+// TestLSN verifies LSNs round-trip and compare in WAL order.
+func TestLSN(t *testing.T) {
+	a, err := ParseLSN("0/3000060")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseLSN("16/B374D848")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.String() != "0/3000060" || b.String() != "16/B374D848" || a >= b {
+		t.Errorf("got %s and %s", a, b)
+	}
+	for _, bad := range []string{"", "3000060", "0/xyz", "1/2/3"} {
+		if _, err := ParseLSN(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+// TestArchiveWAL verifies retried segments are accepted and conflicting ones refused.
+func TestArchiveWAL(t *testing.T) {
+	dir := t.TempDir()
+	segment := filepath.Join(dir, "000000010000000000000001")
+	os.WriteFile(segment, []byte("wal"), 0600)
+	archive := filepath.Join(dir, "archive")
+
+	if err := ArchiveWAL(archive, segment, filepath.Base(segment)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ArchiveWAL(archive, segment, filepath.Base(segment)); err != nil {
+		t.Errorf("re-archiving the same segment failed: %v", err)
+	}
+	os.WriteFile(segment, []byte("other"), 0600)
+	if err := ArchiveWAL(archive, segment, filepath.Base(segment)); err == nil {
+		t.Error("expected an error for a segment archived with different content")
+	}
+	if err := ArchiveWAL(archive, segment, "../escape"); err == nil {
+		t.Error("expected an error for a name outside the archive")
+	}
+
+	entries, _ := os.ReadDir(WALDir(archive))
+	if len(entries) != 1 {
+		t.Errorf("archive holds %d files, want 1", len(entries))
+	}
+	if data, _ := os.ReadFile(filepath.Join(WALDir(archive), filepath.Base(segment))); string(data) != "wal" {
+		t.Errorf("archived segment holds %q", data)
+	}
+}
+
+// TestSelectBase verifies the newest base backup before the target is chosen.
+func TestSelectBase(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	backups := []BaseBackup{
+		{Label: "a", FinishedAt: t0, EndLSN: 0x1000},
+		{Label: "b", FinishedAt: t0.Add(time.Hour), EndLSN: 0x2000},
+	}
+	cases := []struct {
+		target Target
+		label  string
+		want   string
+	}{
+		{Target{}, "", "b"},
+		{Target{Name: "before_upgrade"}, "", "b"},
+		{Target{Time: t0.Add(30 * time.Minute)}, "", "a"},
+		{Target{Time: t0.Add(2 * time.Hour)}, "", "b"},
+		{Target{LSN: 0x1800}, "", "a"},
+		{Target{LSN: 0x2000}, "", "b"},
+		{Target{}, "a", "a"},
+	}
+	for _, c := range cases {
+		got, err := SelectBase(backups, c.target, c.label)
+		if err != nil || got.Label != c.want {
+			t.Errorf("SelectBase(%s, %q) = %q, %v; want %q", c.target, c.label, got.Label, err, c.want)
+		}
+	}
+	if _, err := SelectBase(backups, Target{Time: t0.Add(-time.Minute)}, ""); err == nil {
+		t.Error("expected an error for a target before every base backup")
+	}
+}
+
+// TestRestoreLayout verifies a data directory is laid out from a base backup.
+func TestRestoreLayout(t *testing.T) {
+	archive := t.TempDir()
+	base := BaseBackup{Label: "20240101-000000", FinishedAt: time.Now().Add(-time.Hour), ServerVersion: 160002}
+	base.Dir = filepath.Join(BaseDir(archive), base.Label)
+	os.MkdirAll(base.Dir, 0755)
+	writeTarGz(t, filepath.Join(base.Dir, "base.tar.gz"), map[string]string{
+		"PG_VERSION":           "16\n",
+		"global/pg_control":    "control",
+		"postgresql.auto.conf": "# Do not edit this file manually!\n",
+	})
+	writeTarGz(t, filepath.Join(base.Dir, "pg_wal.tar.gz"), map[string]string{
+		"000000010000000000000002": "wal",
+	})
+	if err := writeBaseInfo(&base); err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir := filepath.Join(t.TempDir(), "data")
+	target := Target{Name: "before 'upgrade'"}
+	used, err := Restore(RestoreOptions{ArchiveDir: archive, DataDir: dataDir, Target: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used.Label != base.Label {
+		t.Errorf("restored from %s, want %s", used.Label, base.Label)
+	}
+
+	for _, file := range []string{"PG_VERSION", "global/pg_control", "pg_wal/000000010000000000000002", "recovery.signal"} {
+		if _, err := os.Stat(filepath.Join(dataDir, file)); err != nil {
+			t.Errorf("missing %s: %v", file, err)
+		}
+	}
+	conf, _ := os.ReadFile(filepath.Join(dataDir, "postgresql.auto.conf"))
+	for _, want := range []string{
+		"# Do not edit this file manually!\n",
+		"recovery_target_name = 'before ''upgrade'''\n",
+		"recovery_target_action = 'promote'\n",
+		"/wal/%f'' \"%p\"'\n",
+	} {
+		if !strings.Contains(string(conf), want) {
+			t.Errorf("postgresql.auto.conf lacks %q:\n%s", want, conf)
+		}
+	}
+	if info, _ := os.Stat(dataDir); info.Mode().Perm() != 0700 {
+		t.Errorf("data directory mode is %v, want 0700", info.Mode().Perm())
+	}
+
+	if _, err := Restore(RestoreOptions{ArchiveDir: archive, DataDir: dataDir}); err == nil {
+		t.Error("expected an error restoring into a non-empty data directory")
+	}
+}
+
+// TestRestoreRejectsLinks verifies a base backup cannot write outside the
+// data directory through a symlink.
+func TestRestoreRejectsLinks(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "base.tar.gz")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	outside := t.TempDir()
+	tw.WriteHeader(&tar.Header{Name: "x", Linkname: outside, Typeflag: tar.TypeSymlink})
+	tw.WriteHeader(&tar.Header{Name: "x/passwd", Mode: 0600, Size: 4, Typeflag: tar.TypeReg})
+	tw.Write([]byte("root"))
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	if err := extractTarGz(file, filepath.Join(t.TempDir(), "data")); err == nil {
+		t.Error("expected an error for an archive holding a symlink")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "passwd")); err == nil {
+		t.Error("the archive wrote outside the data directory")
+	}
+}
+
+func writeTarGz(t *testing.T, file string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+}
+
+// TestPointInTimeRecovery runs a base backup, WAL archiving and a restore to
+// a target time against a local server started with initdb. It is skipped
+// when the PostgreSQL server binaries are not installed.
+func TestPointInTimeRecovery(t *testing.T) {
+	initdbs := pgbin.Discover("initdb", nil)
+	if len(initdbs) == 0 {
+		t.Skip("initdb not installed")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("initdb refuses to run as root")
+	}
+	binDir := filepath.Dir(initdbs[0].Path)
+	pgCtl := filepath.Join(binDir, "pg_ctl")
+	work := t.TempDir()
+	archive := filepath.Join(work, "archive")
+	os.MkdirAll(WALDir(archive), 0755)
+
+	primary := filepath.Join(work, "primary")
+	run(t, initdbs[0].Path, "-D", primary, "-U", "postgres", "--auth=trust")
+	port := freePort(t)
+	appendConf(t, primary, fmt.Sprintf(`
+port = %d
+listen_addresses = 'localhost'
+unix_socket_directories = '%s'
+wal_level = replica
+max_wal_senders = 4
+archive_mode = on
+archive_command = 'cp %%p %s/%%f'
+`, port, work, WALDir(archive)))
+	run(t, pgCtl, "-D", primary, "-l", filepath.Join(work, "primary.log"), "-w", "start")
+	defer exec.Command(pgCtl, "-D", primary, "-m", "immediate", "stop").Run()
+
+	db := openLocal(t, port)
+	defer db.Close()
+	mustExec(t, db, "CREATE TABLE events (id int)")
+
+	base, err := TakeBaseBackup(BaseOptions{Host: "localhost", Port: port, User: "postgres", ArchiveDir: archive, ClientBinDirs: []string{binDir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.EndLSN < base.StartLSN || base.Timeline != 1 {
+		t.Errorf("unexpected WAL range %s-%s on timeline %d", base.StartLSN, base.EndLSN, base.Timeline)
+	}
+
+	mustExec(t, db, "INSERT INTO events VALUES (1)")
+	time.Sleep(time.Second)
+	target := time.Now()
+	time.Sleep(time.Second)
+	mustExec(t, db, "INSERT INTO events VALUES (2)")
+
+	var segment string
+	if err := db.QueryRow("SELECT pg_walfile_name(pg_switch_wal())").Scan(&segment); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(WALDir(archive), segment)); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("segment %s was not archived", segment)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	restored := filepath.Join(work, "restored")
+	if _, err := Restore(RestoreOptions{ArchiveDir: archive, DataDir: restored, Target: Target{Time: target}}); err != nil {
+		t.Fatal(err)
+	}
+	restoredPort := freePort(t)
+	appendConf(t, restored, fmt.Sprintf("port = %d\narchive_mode = off\n", restoredPort))
+	run(t, pgCtl, "-D", restored, "-l", filepath.Join(work, "restored.log"), "-w", "start")
+	defer exec.Command(pgCtl, "-D", restored, "-m", "immediate", "stop").Run()
+
+	rdb := openLocal(t, restoredPort)
+	defer rdb.Close()
+	deadline = time.Now().Add(30 * time.Second)
+	for {
+		var inRecovery bool
+		if err := rdb.QueryRow("SELECT pg_is_in_recovery()").Scan(&inRecovery); err == nil && !inRecovery {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("restored server did not finish recovery")
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	var ids []int
+	rows, err := rdb.Query("SELECT id FROM events ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("restored rows %v, want [1]", ids)
+	}
+}
+
+func run(t *testing.T, name string, args ...string) {
+	t.Helper()
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		t.Fatalf("%s failed: %s: %v", filepath.Base(name), out, err)
+	}
+}
+
+func appendConf(t *testing.T, dataDir, settings string) {
+	t.Helper()
+	f, err := os.OpenFile(filepath.Join(dataDir, "postgresql.conf"), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(settings); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func openLocal(t *testing.T, port int) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("postgres", fmt.Sprintf("host=localhost port=%d user=postgres dbname=postgres sslmode=disable", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func mustExec(t *testing.T, db *sql.DB, query string) {
+	t.Helper()
+	if _, err := db.Exec(query); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
@@ -0,0 +1,284 @@
+package pitr
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Target is the point recovery stops at. At most one field is set; the
+// zero Target replays all archived WAL.
+type Target struct {
+	Time time.Time
+	LSN  LSN
+	Name string // A restore point created with pg_create_restore_point
+}
+
+// IsZero reports whether the target is the end of the archive.
+func (t Target) IsZero() bool {
+	return t.Time.IsZero() && t.LSN == 0 && t.Name == ""
+}
+
+func (t Target) String() string {
+	switch {
+	case !t.Time.IsZero():
+		return "time " + t.Time.Format(time.RFC3339)
+	case t.LSN != 0:
+		return "LSN " + t.LSN.String()
+	case t.Name != "":
+		return "restore point " + t.Name
+	default:
+		return "end of archived WAL"
+	}
+}
+
+// ParseTime reads a recovery target time as RFC 3339 or as
+// "2006-01-02 15:04:05" in local time.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid target time %q, expected 2006-01-02T15:04:05Z07:00 or 2006-01-02 15:04:05", s)
+	}
+	return t, nil
+}
+
+// RestoreOptions describes a point-in-time restore.
+type RestoreOptions struct {
+	ArchiveDir string
+	DataDir    string // Created by the restore, it must not exist or be empty
+	Target     Target
+
+	// Base is the label of the base backup to start from. Empty selects the
+	// newest one finished before the target.
+	Base string
+}
+
+// Restore lays out a data directory that recovers to opts.Target when the
+// server is started on it: the base backup is extracted, restore_command
+// points at the WAL archive and the recovery target is set. The server
+// promotes itself once the target is reached.
+func Restore(opts RestoreOptions) (*BaseBackup, error) {
+	backups, err := ListBaseBackups(opts.ArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+	base, err := SelectBase(backups, opts.Target, opts.Base)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkEmptyDir(opts.DataDir); err != nil {
+		return nil, err
+	}
+	if err := checkTablespaces(base.Dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.DataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	// The server refuses to start on a data directory others can read.
+	if err := os.Chmod(opts.DataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	if err := extractTarGz(filepath.Join(base.Dir, "base.tar.gz"), opts.DataDir); err != nil {
+		return nil, err
+	}
+	if err := extractTarGz(filepath.Join(base.Dir, "pg_wal.tar.gz"), filepath.Join(opts.DataDir, "pg_wal")); err != nil {
+		return nil, err
+	}
+
+	walDir, err := filepath.Abs(WALDir(opts.ArchiveDir))
+	if err != nil {
+		return nil, err
+	}
+	if err := writeRecoveryConfig(opts.DataDir, walDir, opts.Target); err != nil {
+		return nil, err
+	}
+	return &base, nil
+}
+
+// SelectBase picks the base backup to recover from: the one labelled label
+// if given, otherwise the newest that finished before the target time or
+// LSN. Restore points cannot be located without replaying WAL, so the
+// newest backup is used for them; pass the label of an older backup if the
+// restore point predates it.
+func SelectBase(backups []BaseBackup, target Target, label string) (BaseBackup, error) {
+	if len(backups) == 0 {
+		return BaseBackup{}, fmt.Errorf("the archive holds no base backups")
+	}
+	if label != "" {
+		for _, b := range backups {
+			if b.Label == label {
+				return b, nil
+			}
+		}
+		return BaseBackup{}, fmt.Errorf("base backup %s not found", label)
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		switch {
+		case !target.Time.IsZero() && !b.FinishedAt.Before(target.Time):
+		case target.LSN != 0 && b.EndLSN > target.LSN:
+		default:
+			return b, nil
+		}
+	}
+	return BaseBackup{}, fmt.Errorf("no base backup finished before the target %s", target)
+}
+
+func checkEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read data directory: %w", err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("data directory %s is not empty", dir)
+	}
+	return nil
+}
+
+// checkTablespaces refuses backups of clusters with tablespaces, whose
+// locations would have to be remapped.
+func checkTablespaces(dir string) error {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tar.gz"))
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		if name := filepath.Base(m); name != "base.tar.gz" && name != "pg_wal.tar.gz" {
+			return fmt.Errorf("base backup %s contains tablespace %s, which restore does not support", dir, strings.TrimSuffix(name, ".tar.gz"))
+		}
+	}
+	return nil
+}
+
+// extractTarGz unpacks a pg_basebackup tar file into dir.
+func extractTarGz(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open base backup: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	tr := tar.NewReader(gz)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if name == "." {
+			continue
+		}
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s contains an unsafe path %q", file, hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+			}
+		case tar.TypeReg:
+			if err := extractFile(tr, target, mode); err != nil {
+				return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+			}
+		case tar.TypeSymlink, tar.TypeLink:
+			// Base backups hold no links once tablespaces are ruled out, and a
+			// link would let later entries escape dir.
+			return fmt.Errorf("%s contains a link %q to %q", file, hdr.Name, hdr.Linkname)
+		default:
+			return fmt.Errorf("%s contains unsupported entry %q", file, hdr.Name)
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeRecoveryConfig appends the recovery settings to postgresql.auto.conf,
+// which overrides postgresql.conf, and creates recovery.signal so the server
+// starts in targeted recovery.
+func writeRecoveryConfig(dataDir, walDir string, target Target) error {
+	f, err := os.OpenFile(filepath.Join(dataDir, "postgresql.auto.conf"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write recovery settings: %w", err)
+	}
+	_, err = io.WriteString(f, RecoverySettings(walDir, target))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write recovery settings: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "recovery.signal"), nil, 0600); err != nil {
+		return fmt.Errorf("failed to write recovery.signal: %w", err)
+	}
+	return nil
+}
+
+// RecoverySettings returns the postgresql.conf lines recovering from the
+// WAL archive in walDir to target.
+func RecoverySettings(walDir string, target Target) string {
+	var b strings.Builder
+	b.WriteString("\n# Point-in-time recovery settings written by go-pg-backup\n")
+	restore := fmt.Sprintf("cp %s %s", shellQuote(filepath.Join(walDir, "%f")), `"%p"`)
+	fmt.Fprintf(&b, "restore_command = %s\n", confQuote(restore))
+	switch {
+	case !target.Time.IsZero():
+		fmt.Fprintf(&b, "recovery_target_time = %s\n", confQuote(target.Time.UTC().Format("2006-01-02 15:04:05.999999+00")))
+	case target.LSN != 0:
+		fmt.Fprintf(&b, "recovery_target_lsn = %s\n", confQuote(target.LSN.String()))
+	case target.Name != "":
+		fmt.Fprintf(&b, "recovery_target_name = %s\n", confQuote(target.Name))
+	}
+	if !target.IsZero() {
+		b.WriteString("recovery_target_action = 'promote'\n")
+	}
+	return b.String()
+}
+
+// confQuote quotes a postgresql.conf string value.
+func confQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// shellQuote quotes a word for the shell running restore_command.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
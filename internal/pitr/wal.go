@@ -0,0 +1,91 @@
+package pitr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ArchiveWAL copies the WAL file at path into the archive as name. It is
+// meant to be run by the server's archive_command with %p and %f.
+//
+// The server retries a segment until archive_command succeeds, so a segment
+// already archived with the same content is accepted, while one archived
+// with different content is refused rather than overwritten. The copy is
+// synced and renamed into place, so the archive never holds a partial
+// segment.
+func ArchiveWAL(archiveDir, path, name string) error {
+	if name == "" || filepath.Base(name) != name {
+		return fmt.Errorf("invalid WAL file name %q", name)
+	}
+	dir := WALDir(archiveDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create WAL archive: %w", err)
+	}
+	dest := filepath.Join(dir, name)
+
+	if _, err := os.Stat(dest); err == nil {
+		same, err := sameContent(path, dest)
+		if err != nil {
+			return err
+		}
+		if !same {
+			return fmt.Errorf("%s is already archived with different content", name)
+		}
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read WAL file: %w", err)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return fmt.Errorf("failed to archive %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to archive %s: %w", name, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to archive %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", name, err)
+	}
+	return syncDir(dir)
+}
+
+func sameContent(a, b string) (bool, error) {
+	da, err := os.ReadFile(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to read WAL file: %w", err)
+	}
+	db, err := os.ReadFile(b)
+	if err != nil {
+		return false, fmt.Errorf("failed to read archived WAL file: %w", err)
+	}
+	return bytes.Equal(da, db), nil
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL archive: %w", err)
+	}
+	return nil
+}
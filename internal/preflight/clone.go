@@ -0,0 +1,104 @@
+package preflight
+
+import (
+	"database/sql"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbin"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgclone"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+)
+
+// CloneOptions describes the clone to check.
+type CloneOptions struct {
+	Source pgclone.Endpoint
+	Target pgclone.Endpoint
+
+	// DumpBinary and RestoreBinary force a pg_dump and psql; empty selects
+	// them from the installed copies.
+	DumpBinary    string
+	RestoreBinary string
+	ClientBinDirs []string
+}
+
+// Clone checks that a clone can run: both connections, pg_dump for the
+// source and psql for the target, read privileges on the source, and that
+// the target database does not exist yet and can hold the source's
+// extensions and owners. The clone stops at the first failing statement, so
+// missing roles fail the check instead of warning.
+func Clone(opts CloneOptions) Report {
+	var r Report
+	src, dst := opts.Source, opts.Target
+
+	source, sourceVersion, ok := connectAs(&r, "Source connection", src.Host, src.Port, src.User, src.Password, src.DBName)
+	if ok {
+		defer source.Close()
+		// pg_dump refuses to dump servers newer than itself.
+		checkBinary(&r, "pg_dump", opts.DumpBinary, opts.ClientBinDirs, sourceVersion, Fail)
+		checkReadPrivileges(&r, source)
+	} else {
+		checkBinary(&r, "pg_dump", opts.DumpBinary, opts.ClientBinDirs, 0, Fail)
+	}
+
+	target, targetVersion, ok := connectAs(&r, "Target connection", dst.Host, dst.Port, dst.User, dst.Password, "postgres")
+	if !ok {
+		return r
+	}
+	defer target.Close()
+
+	checkBinary(&r, "psql", opts.RestoreBinary, opts.ClientBinDirs, targetVersion, Warn)
+	checkTarget(&r, target, dst.DBName, pgrestore.ModeCreate)
+	if source == nil {
+		return r
+	}
+
+	extensions, err := queryNames(source, "SELECT extname FROM pg_extension WHERE extname <> 'plpgsql' ORDER BY 1")
+	if err != nil {
+		r.add("Extensions", Warn, "failed to list source extensions: %v", err)
+	} else {
+		checkExtensions(&r, target, extensions)
+	}
+	owners, err := queryNames(source, sourceOwnersQuery)
+	if err != nil {
+		r.add("Roles", Warn, "failed to list source owners: %v", err)
+	} else {
+		checkRoles(&r, target, owners, Fail)
+	}
+	if sourceVersion > targetVersion {
+		r.add("Server versions", Warn, "cloning from %s to the older %s may fail",
+			pgbin.FormatVersion(sourceVersion), pgbin.FormatVersion(targetVersion))
+	}
+	return r
+}
+
+// sourceOwnersQuery lists the roles owning the objects pg_dump writes.
+const sourceOwnersQuery = `
+	SELECT DISTINCT pg_get_userbyid(owner) FROM (
+		SELECT n.nspowner AS owner FROM pg_namespace n
+		WHERE n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+		UNION
+		SELECT c.relowner FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+		UNION
+		SELECT p.proowner FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+	) o
+	ORDER BY 1`
+
+// queryNames returns the first column of every row of the query.
+func queryNames(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
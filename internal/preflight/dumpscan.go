@@ -0,0 +1,92 @@
+package preflight
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	extensionPattern = regexp.MustCompile(`^CREATE EXTENSION (?:IF NOT EXISTS )?("(?:[^"]|"")+"|[A-Za-z0-9_\-]+)`)
+	rolePatterns     = []*regexp.Regexp{
+		regexp.MustCompile(`\bOWNER TO ("(?:[^"]|"")+"|[A-Za-z0-9_]+);`),
+		regexp.MustCompile(`^(?:GRANT|REVOKE) .* (?:TO|FROM) ("(?:[^"]|"")+"|[A-Za-z0-9_]+)(?: WITH GRANT OPTION)?;`),
+		regexp.MustCompile(`^SET ROLE ("(?:[^"]|"")+"|[A-Za-z0-9_]+);`),
+		regexp.MustCompile(`^ALTER DEFAULT PRIVILEGES FOR ROLE ("(?:[^"]|"")+"|[A-Za-z0-9_]+)`),
+	}
+	// Roles every cluster has, which need not be checked.
+	builtinRoles = map[string]bool{"public": true, "PUBLIC": true}
+)
+
+// DumpRequirements lists the extensions and roles a plain SQL dump refers to.
+type DumpRequirements struct {
+	Extensions []string
+	Roles      []string
+}
+
+// ScanDump reads a plain SQL dump and collects the extensions it creates and
+// the roles it assigns ownership or privileges to. COPY data is skipped.
+func ScanDump(path string) (DumpRequirements, error) {
+	var req DumpRequirements
+
+	f, err := os.Open(path)
+	if err != nil {
+		return req, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer f.Close()
+
+	extensions := map[string]bool{}
+	roles := map[string]bool{}
+	inCopy := false
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inCopy {
+			inCopy = line != `\.`
+			continue
+		}
+		if strings.HasPrefix(line, "COPY ") && strings.HasSuffix(line, "FROM stdin;") {
+			inCopy = true
+			continue
+		}
+		if m := extensionPattern.FindStringSubmatch(line); m != nil {
+			extensions[unquoteIdent(m[1])] = true
+		}
+		for _, p := range rolePatterns {
+			if m := p.FindStringSubmatch(line); m != nil {
+				if role := unquoteIdent(m[1]); !builtinRoles[role] {
+					roles[role] = true
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return req, fmt.Errorf("failed to read backup file: %w", err)
+	}
+
+	req.Extensions = sortedKeys(extensions)
+	req.Roles = sortedKeys(roles)
+	return req, nil
+}
+
+// unquoteIdent removes the double quotes of a quoted SQL identifier.
+func unquoteIdent(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+	}
+	return s
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,491 @@
+package preflight
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/masking"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbin"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+	"github.com/lib/pq"
+)
+
+// Status is the outcome of a single check.
+type Status int
+
+const (
+	// Pass means the check found no problem.
+	Pass Status = iota
+	// Warn means the operation can run but may not behave as expected.
+	Warn
+	// Fail means the operation would fail and must not be started.
+	Fail
+)
+
+// String returns the label used when printing the checklist.
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return " ok "
+	case Warn:
+		return "warn"
+	default:
+		return "FAIL"
+	}
+}
+
+// Check is one line of the pre-flight checklist.
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Report is the result of a pre-flight phase.
+type Report struct {
+	Checks []Check
+
+	// Binary is the client tool selected for the server, if one was found.
+	Binary pgbin.Binary
+}
+
+func (r *Report) add(name string, status Status, format string, args ...any) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Blocking reports whether any check failed.
+func (r Report) Blocking() bool {
+	for _, c := range r.Checks {
+		if c.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the report as a plain-text checklist.
+func (r Report) String() string {
+	var b strings.Builder
+	for _, c := range r.Checks {
+		fmt.Fprintf(&b, "[%s] %s: %s\n", c.Status, c.Name, c.Detail)
+	}
+	return b.String()
+}
+
+// BackupOptions describes the backup to check.
+type BackupOptions struct {
+	Host       string
+	Port       int
+	User       string
+	Password   string
+	DBName     string
+	OutputPath string
+
+	// DumpBinary forces a pg_dump; empty selects one from the installed copies.
+	DumpBinary    string
+	ClientBinDirs []string
+
+	// Engine is the requested dump engine; see pgbackup.Engine.
+	Engine pgbackup.Engine
+
+	// Masking is the ruleset the backup will be masked with, if any.
+	Masking *masking.Ruleset
+}
+
+// RestoreOptions describes the restore to check.
+type RestoreOptions struct {
+	Host       string
+	Port       int
+	User       string
+	Password   string
+	DBName     string
+	BackupPath string
+	Mode       pgrestore.Mode
+
+	// RestoreBinary forces a psql; empty selects one from the installed copies.
+	RestoreBinary string
+	ClientBinDirs []string
+	Engine        pgrestore.Engine
+}
+
+// Backup checks that a backup can run: client version, connectivity, read
+// privileges and free space at the destination.
+func Backup(opts BackupOptions) Report {
+	var r Report
+
+	engine := pgbackup.SelectEngine(pgbackup.Options{
+		DumpBinary:    opts.DumpBinary,
+		ClientBinDirs: opts.ClientBinDirs,
+		Engine:        opts.Engine,
+	})
+
+	db, serverVersion, ok := connect(&r, opts.Host, opts.Port, opts.User, opts.Password, opts.DBName)
+	if !ok {
+		if engine == pgbackup.EnginePgDump {
+			checkBinary(&r, "pg_dump", opts.DumpBinary, opts.ClientBinDirs, 0, Fail)
+		}
+		return r
+	}
+	defer db.Close()
+
+	if engine == pgbackup.EngineGo {
+		checkGoEngine(&r, opts.Engine, serverVersion)
+	} else {
+		// pg_dump refuses to dump servers newer than itself.
+		checkBinary(&r, "pg_dump", opts.DumpBinary, opts.ClientBinDirs, serverVersion, Fail)
+	}
+	checkReadPrivileges(&r, db)
+	if opts.Masking != nil {
+		checkMasking(&r, db, opts.Masking)
+	}
+	checkFreeSpace(&r, db, opts.OutputPath)
+	return r
+}
+
+// Restore checks that a restore can run: client version, connectivity, the
+// target database, and the extensions and roles the backup needs. It warns
+// where the target differs from the source server recorded in the manifest.
+func Restore(opts RestoreOptions) Report {
+	var r Report
+
+	_, fileErr := os.Stat(opts.BackupPath)
+	if fileErr != nil {
+		r.add("Backup file", Fail, "%v", fileErr)
+	} else {
+		r.add("Backup file", Pass, "%s", opts.BackupPath)
+	}
+
+	engine := pgrestore.SelectEngine(pgrestore.Options{
+		RestoreBinary: opts.RestoreBinary,
+		ClientBinDirs: opts.ClientBinDirs,
+		Engine:        opts.Engine,
+	})
+
+	db, serverVersion, ok := connect(&r, opts.Host, opts.Port, opts.User, opts.Password, "postgres")
+	if !ok {
+		if engine == pgrestore.EnginePsql {
+			checkBinary(&r, "psql", opts.RestoreBinary, opts.ClientBinDirs, 0, Warn)
+		}
+		return r
+	}
+	defer db.Close()
+
+	if engine == pgrestore.EngineGo {
+		if opts.Engine == pgrestore.EngineAuto {
+			r.add("Restore engine", Warn, "psql is not installed, using the built-in Go executor")
+		} else {
+			r.add("Restore engine", Pass, "using the built-in Go executor")
+		}
+	} else {
+		// An older psql can usually restore into a newer server, but not always.
+		checkBinary(&r, "psql", opts.RestoreBinary, opts.ClientBinDirs, serverVersion, Warn)
+	}
+	checkTarget(&r, db, opts.DBName, opts.Mode)
+
+	if fileErr == nil {
+		req, err := ScanDump(opts.BackupPath)
+		if err != nil {
+			r.add("Backup contents", Warn, "%v", err)
+		} else {
+			checkExtensions(&r, db, req.Extensions)
+			checkRoles(&r, db, req.Roles, Warn)
+		}
+		checkSource(&r, db, opts)
+	}
+	return r
+}
+
+// connect opens and pings the database, recording the connectivity check.
+func connect(r *Report, host string, port int, user, password, dbname string) (*sql.DB, int, bool) {
+	return connectAs(r, "Connection", host, port, user, password, dbname)
+}
+
+// connectAs is connect with the check recorded under the given name.
+func connectAs(r *Report, check, host string, port int, user, password, dbname string) (*sql.DB, int, bool) {
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		host, port, user, password, dbname)
+
+	db, err := sql.Open("postgres", connStr)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		r.add(check, Fail, "cannot connect to %s:%d as %s: %v", host, port, user, err)
+		if db != nil {
+			db.Close()
+		}
+		return nil, 0, false
+	}
+
+	var serverVersion int
+	if err := db.QueryRow("SELECT current_setting('server_version_num')::int").Scan(&serverVersion); err != nil {
+		r.add(check, Fail, "connected but failed to read the server version: %v", err)
+		db.Close()
+		return nil, 0, false
+	}
+	r.add(check, Pass, "connected to %s:%d as %s (server %s)", host, port, user, pgbin.FormatVersion(serverVersion))
+	return db, serverVersion, true
+}
+
+// checkBinary selects the client tool for the server and records the
+// version check. A client older than the server is reported with olderStatus.
+// A zero serverVersion only checks that the tool is installed.
+func checkBinary(r *Report, name, explicit string, extraDirs []string, serverVersion int, olderStatus Status) {
+	check := name + " version"
+
+	var binaries []pgbin.Binary
+	if explicit != "" {
+		version, err := pgbin.ClientVersion(explicit)
+		if err != nil {
+			r.add(check, Fail, "%v", err)
+			return
+		}
+		binaries = []pgbin.Binary{{Path: explicit, Version: version}}
+	} else {
+		binaries = pgbin.Discover(name, extraDirs)
+	}
+
+	binary, err := pgbin.Select(name, binaries, serverVersion)
+	if len(binaries) == 0 {
+		r.add(check, Fail, "%v", err)
+		return
+	}
+	r.Binary = binary
+	if err != nil {
+		r.add(check, olderStatus, "%v", err)
+		return
+	}
+	if serverVersion == 0 {
+		r.add(check, Pass, "using %s", binary)
+		return
+	}
+	r.add(check, Pass, "using %s for server %s", binary, pgbin.FormatMajor(pgbin.MajorVersion(serverVersion)))
+}
+
+// checkGoEngine reports the use of the built-in dump engine, which needs
+// catalog features of PostgreSQL 12.
+func checkGoEngine(r *Report, requested pgbackup.Engine, serverVersion int) {
+	if serverVersion < 120000 {
+		r.add("Dump engine", Fail, "the Go engine requires PostgreSQL 12 or newer, server is %s", pgbin.FormatVersion(serverVersion))
+		return
+	}
+	if requested == pgbackup.EngineAuto {
+		r.add("Dump engine", Warn, "pg_dump is not installed, using the built-in Go engine")
+		return
+	}
+	r.add("Dump engine", Pass, "using the built-in Go engine")
+}
+
+// checkMasking warns about masking rules naming columns that do not exist,
+// which usually means a typo that would leave real data unmasked.
+func checkMasking(r *Report, db *sql.DB, rs *masking.Ruleset) {
+	var missing []string
+	for column := range rs.Columns {
+		if strings.ContainsAny(column, "*?[") {
+			continue
+		}
+		parts := strings.SplitN(column, ".", 3)
+		var exists bool
+		err := db.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM pg_attribute a
+				JOIN pg_class c ON c.oid = a.attrelid
+				JOIN pg_namespace n ON n.oid = c.relnamespace
+				WHERE n.nspname = $1 AND c.relname = $2 AND a.attname = $3
+				  AND a.attnum > 0 AND NOT a.attisdropped)`, parts[0], parts[1], parts[2]).Scan(&exists)
+		if err != nil {
+			r.add("Masking rules", Warn, "failed to check masked columns: %v", err)
+			return
+		}
+		if !exists {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		r.add("Masking rules", Warn, "ruleset %s names columns that do not exist: %s", rs.Name, summarize(missing))
+		return
+	}
+	r.add("Masking rules", Pass, "masking with ruleset %s (%d rules)", rs.Name, len(rs.Columns))
+}
+
+// checkReadPrivileges lists the tables and sequences the user cannot read.
+func checkReadPrivileges(r *Report, db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT format('%I.%I', n.nspname, c.relname)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p', 'm', 'S')
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		  AND n.nspname NOT LIKE 'pg_toast%'
+		  AND NOT has_table_privilege(c.oid, 'SELECT')
+		ORDER BY 1`)
+	if err != nil {
+		r.add("Read privileges", Fail, "failed to check privileges: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var denied []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			r.add("Read privileges", Fail, "failed to check privileges: %v", err)
+			return
+		}
+		denied = append(denied, name)
+	}
+	if err := rows.Err(); err != nil {
+		r.add("Read privileges", Fail, "failed to check privileges: %v", err)
+		return
+	}
+	if len(denied) > 0 {
+		r.add("Read privileges", Fail, "no SELECT privilege on %s", summarize(denied))
+		return
+	}
+	r.add("Read privileges", Pass, "all tables and sequences are readable")
+}
+
+// checkFreeSpace compares the database size with the free space at the
+// destination. A plain dump is usually smaller than the database because it
+// holds no indexes, so a shortfall is only a warning.
+func checkFreeSpace(r *Report, db *sql.DB, outputPath string) {
+	var size int64
+	if err := db.QueryRow("SELECT pg_database_size(current_database())").Scan(&size); err != nil {
+		r.add("Disk space", Warn, "failed to read the database size: %v", err)
+		return
+	}
+
+	// The destination directory may not exist yet; check its nearest existing parent.
+	dir := filepath.Dir(outputPath)
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		r.add("Disk space", Warn, "failed to read free space at %s: %v", dir, err)
+		return
+	}
+	if free < uint64(size) {
+		r.add("Disk space", Warn, "%s free at %s, database is %s", FormatBytes(int64(free)), dir, FormatBytes(size))
+		return
+	}
+	r.add("Disk space", Pass, "%s free at %s, database is %s", FormatBytes(int64(free)), dir, FormatBytes(size))
+}
+
+// checkTarget verifies the target database exists or not, as the mode requires.
+func checkTarget(r *Report, db *sql.DB, dbname string, mode pgrestore.Mode) {
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", dbname).Scan(&exists); err != nil {
+		r.add("Target database", Fail, "failed to look up %s: %v", dbname, err)
+		return
+	}
+	switch {
+	case mode == pgrestore.ModeExisting && !exists:
+		r.add("Target database", Fail, "%s does not exist", dbname)
+	case mode == pgrestore.ModeCreate && exists:
+		r.add("Target database", Fail, "%s already exists", dbname)
+	case exists:
+		r.add("Target database", Pass, "%s exists", dbname)
+	default:
+		r.add("Target database", Pass, "%s will be created", dbname)
+	}
+}
+
+// checkExtensions fails for extensions the backup creates that the target
+// server cannot install.
+func checkExtensions(r *Report, db *sql.DB, extensions []string) {
+	if len(extensions) == 0 {
+		r.add("Extensions", Pass, "backup uses no extensions")
+		return
+	}
+	missing, err := missingNames(db, "SELECT name FROM pg_available_extensions WHERE name = ANY($1)", extensions)
+	if err != nil {
+		r.add("Extensions", Warn, "failed to check extensions: %v", err)
+		return
+	}
+	if len(missing) > 0 {
+		r.add("Extensions", Fail, "not available on the target server: %s", summarize(missing))
+		return
+	}
+	r.add("Extensions", Pass, "all available: %s", summarize(extensions))
+}
+
+// checkRoles reports roles the backup refers to that do not exist on the
+// target with missingStatus; psql reports an error for every statement using them.
+func checkRoles(r *Report, db *sql.DB, roles []string, missingStatus Status) {
+	if len(roles) == 0 {
+		r.add("Roles", Pass, "backup refers to no roles")
+		return
+	}
+	missing, err := missingNames(db, "SELECT rolname FROM pg_roles WHERE rolname = ANY($1)", roles)
+	if err != nil {
+		r.add("Roles", Warn, "failed to check roles: %v", err)
+		return
+	}
+	if len(missing) > 0 {
+		r.add("Roles", missingStatus, "missing on the target, ownership and grants will fail: %s", summarize(missing))
+		return
+	}
+	r.add("Roles", Pass, "all present: %s", summarize(roles))
+}
+
+// missingNames returns the names that the query, given the names as $1, does not return.
+func missingNames(db *sql.DB, query string, names []string) ([]string, error) {
+	rows, err := db.Query(query, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		found[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// summarize joins names, shortening long lists.
+func summarize(names []string) string {
+	const max = 5
+	if len(names) <= max {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:max], ", "), len(names)-max)
+}
+
+// FormatBytes renders n using binary units.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
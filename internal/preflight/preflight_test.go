@@ -0,0 +1,94 @@
+package preflight
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+// TestScanDump checks that extensions and roles are found outside COPY data.
+func TestScanDump(t *testing.T) {
+	dump := `CREATE EXTENSION IF NOT EXISTS pgcrypto WITH SCHEMA public;
+CREATE TABLE public.t (id integer, note text);
+ALTER TABLE public.t OWNER TO app_owner;
+COPY public.t (id, note) FROM stdin;
+1	ALTER TABLE x OWNER TO not_a_role;
+\.
+GRANT SELECT ON TABLE public.t TO "Reporting";
+GRANT USAGE ON SCHEMA public TO PUBLIC;
+`
+	path := filepath.Join(t.TempDir(), "dump.sql")
+	if err := os.WriteFile(path, []byte(dump), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := ScanDump(path)
+	if err != nil {
+		t.Fatalf("ScanDump: %s", err)
+	}
+	if want := []string{"pgcrypto"}; !reflect.DeepEqual(req.Extensions, want) {
+		t.Errorf("extensions = %v, want %v", req.Extensions, want)
+	}
+	if want := []string{"Reporting", "app_owner"}; !reflect.DeepEqual(req.Roles, want) {
+		t.Errorf("roles = %v, want %v", req.Roles, want)
+	}
+}
+
+// TestCompareSource checks the warnings for a target that differs from the
+// server a backup was taken from.
+func TestCompareSource(t *testing.T) {
+	m := &pgbackup.Manifest{
+		Encoding: "UTF8",
+		Collate:  "en_US.UTF-8",
+		CType:    "en_US.UTF-8",
+		Owner:    "shop",
+		Server: &pgbackup.ServerSnapshot{
+			Version: "16.2",
+			Extensions: []pgbackup.Extension{
+				{Name: "plpgsql", Version: "1.0"},
+				{Name: "postgis", Version: "3.4.2"},
+				{Name: "not_installable", Version: "1.0"},
+			},
+		},
+	}
+	tests := []struct {
+		name   string
+		target target
+		want   map[string]Status
+	}{
+		{
+			name:   "same",
+			target: target{name: "db", encoding: "UTF8", collate: "en_US.UTF-8", ctype: "en_US.UTF-8", extensions: map[string]string{"plpgsql": "1.0", "postgis": "3.4.2"}},
+			want:   map[string]Status{"Source server": Pass, "Extension versions": Pass, "Encoding": Pass, "Collation": Pass},
+		},
+		{
+			name:   "different",
+			target: target{name: "db", encoding: "LATIN1", collate: "C", ctype: "en_US.UTF-8", extensions: map[string]string{"plpgsql": "1.0", "postgis": "3.3.0"}},
+			want:   map[string]Status{"Source server": Pass, "Extension versions": Warn, "Encoding": Warn, "Collation": Warn},
+		},
+		{
+			name:   "created with the backup's locale",
+			target: target{name: "server", extensions: map[string]string{"postgis": "3.4.2"}},
+			want:   map[string]Status{"Source server": Pass, "Extension versions": Pass, "Database owner": Pass, "Collation": Pass},
+		},
+		{
+			name:   "created without the backup's owner and locale",
+			target: target{name: "server", extensions: map[string]string{}, missingOwner: true, missingLocales: []string{"en_US.UTF-8"}},
+			want:   map[string]Status{"Source server": Pass, "Extension versions": Pass, "Database owner": Fail, "Collation": Warn},
+		},
+	}
+	for _, tt := range tests {
+		var r Report
+		compareSource(&r, m, tt.target)
+		got := map[string]Status{}
+		for _, c := range r.Checks {
+			got[c.Name] = c.Status
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: checks %v, want %v\n%s", tt.name, got, tt.want, r)
+		}
+	}
+}
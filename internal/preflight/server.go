@@ -0,0 +1,173 @@
+package preflight
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+)
+
+// target is what the database restored into will look like, to compare
+// with the source recorded in the backup's manifest.
+type target struct {
+	name       string // Describes the target in check details
+	encoding   string // Empty when the database is created with the backup's own
+	collate    string
+	ctype      string
+	extensions map[string]string // Extension versions installed, or installed by CREATE EXTENSION
+
+	// When the database is created with the backup's own encoding, the
+	// owner and locales of the manifest the server lacks.
+	missingOwner   bool
+	missingLocales []string
+}
+
+// checkSource compares the source recorded in the backup's manifest with
+// the target, warning about differences that change how the restored
+// database behaves. Backups without a manifest are not compared.
+func checkSource(r *Report, db *sql.DB, opts RestoreOptions) {
+	m, err := pgbackup.ReadManifest(opts.BackupPath)
+	if err != nil {
+		return
+	}
+	t, err := readTarget(db, opts, m)
+	if err != nil {
+		r.add("Source server", Warn, "failed to read the target to compare with the backup: %v", err)
+		return
+	}
+	compareSource(r, m, t)
+}
+
+// readTarget reads the encoding, collation and extension versions the
+// restored database will have under the mode, or whether the server has the
+// owner and locales of m to create it with.
+func readTarget(db *sql.DB, opts RestoreOptions, m *pgbackup.Manifest) (target, error) {
+	t := target{extensions: map[string]string{}}
+	switch opts.Mode {
+	case pgrestore.ModeExisting:
+		t.name = "the target database " + opts.DBName
+		err := db.QueryRow(`
+			SELECT pg_encoding_to_char(encoding), datcollate, datctype
+			FROM pg_database WHERE datname = $1`, opts.DBName).Scan(&t.encoding, &t.collate, &t.ctype)
+		if err == sql.ErrNoRows {
+			return t, fmt.Errorf("%s does not exist", opts.DBName)
+		} else if err != nil {
+			return t, err
+		}
+		// Installed versions are per database.
+		targetDB, err := sql.Open("postgres", fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+			opts.Host, opts.Port, opts.User, opts.Password, opts.DBName))
+		if err != nil {
+			return t, err
+		}
+		defer targetDB.Close()
+		db = targetDB
+	case pgrestore.ModeCreate:
+		// CREATE DATABASE copies template1.
+		t.name = "new databases (template1)"
+		err := db.QueryRow(`
+			SELECT pg_encoding_to_char(encoding), datcollate, datctype
+			FROM pg_database WHERE datname = 'template1'`).Scan(&t.encoding, &t.collate, &t.ctype)
+		if err != nil {
+			return t, err
+		}
+	default:
+		// The database is created with the backup's encoding, collation and owner.
+		t.name = "the target server"
+		if m.Owner != "" {
+			missing, err := missingNames(db, "SELECT rolname FROM pg_roles WHERE rolname = ANY($1)", []string{m.Owner})
+			if err != nil {
+				return t, err
+			}
+			t.missingOwner = len(missing) > 0
+		}
+		var locales []string
+		for _, l := range []string{m.Collate, m.CType} {
+			if l != "" && (len(locales) == 0 || locales[0] != l) {
+				locales = append(locales, l)
+			}
+		}
+		if len(locales) > 0 {
+			// Spellings of the codeset differ, en_US.UTF-8 is en_US.utf8.
+			missing, err := missingNames(db, `
+				SELECT l FROM unnest($1::text[]) l
+				WHERE lower(replace(l, '-', '')) IN ('c', 'posix') OR EXISTS (
+					SELECT 1 FROM pg_collation
+					WHERE lower(replace(l, '-', '')) IN (lower(replace(collname, '-', '')), lower(replace(collcollate, '-', ''))))`, locales)
+			if err != nil {
+				return t, err
+			}
+			t.missingLocales = missing
+		}
+	}
+
+	rows, err := db.Query(`SELECT name, coalesce(installed_version, default_version) FROM pg_available_extensions`)
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var version sql.NullString
+		if err := rows.Scan(&name, &version); err != nil {
+			return t, err
+		}
+		t.extensions[name] = version.String
+	}
+	return t, rows.Err()
+}
+
+// compareSource records the extension version, encoding and collation
+// checks of the backup's manifest against t.
+func compareSource(r *Report, m *pgbackup.Manifest, t target) {
+	if m.Server != nil {
+		r.add("Source server", Pass, "backup taken from PostgreSQL %s, database of %s", m.Server.Version, FormatBytes(m.Server.DatabaseSize))
+
+		// Extensions missing altogether are reported by the Extensions check.
+		var differing []string
+		for _, e := range m.Server.Extensions {
+			if version, ok := t.extensions[e.Name]; ok && version != e.Version {
+				differing = append(differing, fmt.Sprintf("%s %s in the backup, %s on %s", e.Name, e.Version, version, t.name))
+			}
+		}
+		if len(differing) > 0 {
+			r.add("Extension versions", Warn, "%s", summarize(differing))
+		} else {
+			r.add("Extension versions", Pass, "match the backup")
+		}
+	}
+
+	if t.encoding == "" {
+		if t.missingOwner {
+			r.add("Database owner", Fail, "%s does not exist on %s, the database cannot be created", m.Owner, t.name)
+		} else if m.Owner != "" {
+			r.add("Database owner", Pass, "%s", m.Owner)
+		}
+		if len(t.missingLocales) > 0 {
+			r.add("Collation", Warn, "%s not among the collations of %s, creating the database will fail if the locale is not installed", summarize(t.missingLocales), t.name)
+		} else if m.Collate != "" {
+			r.add("Collation", Pass, "%s available", localeName(m.Collate, m.CType))
+		}
+		return
+	}
+	if m.Encoding != "" && m.Encoding != t.encoding {
+		r.add("Encoding", Warn, "backup is %s, %s is %s; text that does not convert fails to restore", m.Encoding, t.name, t.encoding)
+	} else if m.Encoding != "" {
+		r.add("Encoding", Pass, "%s", t.encoding)
+	}
+	if (m.Collate != "" && m.Collate != t.collate) || (m.CType != "" && m.CType != t.ctype) {
+		r.add("Collation", Warn, "backup uses %s, %s uses %s; text sorts and compares differently, check indexes on text", localeName(m.Collate, m.CType), t.name, localeName(t.collate, t.ctype))
+	} else if m.Collate != "" {
+		r.add("Collation", Pass, "%s", localeName(t.collate, t.ctype))
+	}
+}
+
+// localeName renders a collation and character classification, once if
+// they are the same.
+func localeName(collate, ctype string) string {
+	if collate == ctype {
+		return collate
+	}
+	return fmt.Sprintf("%s (ctype %s)", collate, ctype)
+}
@@ -0,0 +1,105 @@
+package repo
+
+// Chunk sizes. Boundaries are placed where a rolling hash of the content
+// matches, so an insertion early in a dump only changes the chunks around
+// it and the rest still deduplicate against earlier backups.
+const (
+	MinChunkSize = 256 << 10
+	AvgChunkSize = 1 << 20
+	MaxChunkSize = 8 << 20
+)
+
+// Normalized chunking: below the average size a boundary needs more hash
+// bits to match, above it fewer, which narrows the spread of chunk sizes.
+// The gear hash shifts left once per byte, so its high bits cover the last
+// 64 bytes and the masks use those.
+const (
+	maskSmall = uint64(1<<22-1) << (64 - 22)
+	maskLarge = uint64(1<<18-1) << (64 - 18)
+)
+
+// gear maps each byte to a random 64-bit value. It must never change:
+// different values would move every boundary and defeat deduplication
+// against existing backups.
+var gear [256]uint64
+
+func init() {
+	// splitmix64 with a fixed seed.
+	x := uint64(0x6a09e667f3bcc908)
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// chunker is an io.Writer splitting the stream written to it into
+// content-defined chunks and passing each to emit. The slice passed to emit
+// is reused afterwards.
+type chunker struct {
+	emit func(chunk []byte) error
+	buf  []byte
+	hash uint64
+}
+
+func newChunker(emit func(chunk []byte) error) *chunker {
+	return &chunker{emit: emit, buf: make([]byte, 0, MaxChunkSize)}
+}
+
+func (c *chunker) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		cut := c.boundary(p)
+		if cut < 0 {
+			c.buf = append(c.buf, p...)
+			return n, nil
+		}
+		c.buf = append(c.buf, p[:cut]...)
+		if err := c.flush(); err != nil {
+			return 0, err
+		}
+		p = p[cut:]
+	}
+	return n, nil
+}
+
+// boundary feeds p to the rolling hash and returns the length of p that
+// completes the current chunk, or -1 if the chunk continues past p.
+func (c *chunker) boundary(p []byte) int {
+	size := len(c.buf)
+	for i, b := range p {
+		size++
+		c.hash = c.hash<<1 + gear[b]
+		switch {
+		case size < MinChunkSize:
+		case size >= MaxChunkSize:
+			return i + 1
+		case size < AvgChunkSize:
+			if c.hash&maskSmall == 0 {
+				return i + 1
+			}
+		default:
+			if c.hash&maskLarge == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+func (c *chunker) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	err := c.emit(c.buf)
+	c.buf = c.buf[:0]
+	c.hash = 0
+	return err
+}
+
+// Close emits the final, possibly short, chunk.
+func (c *chunker) Close() error {
+	return c.flush()
+}
@@ -0,0 +1,317 @@
+// Package repo stores backups in a content-addressed, deduplicating
+// repository. A dump is split into content-defined chunks, each unique
+// chunk is stored once, compressed and optionally encrypted, and a backup
+// is a snapshot listing its chunks in order.
+//
+// A repository directory holds:
+//
+//	config.json         the format, compression and encryption settings
+//	chunks/<ab>/<id>    one file per unique chunk, named by its hash
+//	snapshots/<id>.json one file per backup
+package repo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/crypto/argon2"
+)
+
+// PasswordEnv names the environment variable holding the password of an
+// encrypted repository.
+const PasswordEnv = "GO_PG_BACKUP_REPO_PASSWORD"
+
+const (
+	configFile    = "config.json"
+	lockFile      = "lock"
+	formatVersion = 1
+	encryptionGCM = "aes-256-gcm"
+	keyCheckText  = "go-pg-backup repository key"
+)
+
+// Config is the repository's config.json.
+type Config struct {
+	Version     int    `json:"version"`
+	Compression string `json:"compression"`
+	Encryption  string `json:"encryption,omitempty"` // Empty for an unencrypted repository
+
+	// KDF derives the keys from the password. KeyCheck is a known text
+	// sealed with the key, to tell a wrong password from corrupt chunks.
+	KDF      *KDF   `json:"kdf,omitempty"`
+	KeyCheck []byte `json:"key_check,omitempty"`
+}
+
+// KDF holds the Argon2id parameters of an encrypted repository.
+type KDF struct {
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // KiB
+	Threads uint8  `json:"threads"`
+}
+
+// Repo is an open repository.
+type Repo struct {
+	dir string
+	cfg Config
+
+	aead  cipher.AEAD // nil for an unencrypted repository
+	idKey []byte      // keys chunk hashes of an encrypted repository
+
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+// Init creates a repository in dir, which must not hold one already. An
+// empty password creates an unencrypted repository.
+func Init(dir, password string) (*Repo, error) {
+	if _, err := os.Stat(filepath.Join(dir, configFile)); err == nil {
+		return nil, fmt.Errorf("%s already holds a repository", dir)
+	}
+	for _, sub := range []string{"chunks", "snapshots"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create repository: %w", err)
+		}
+	}
+
+	cfg := Config{Version: formatVersion, Compression: "zstd"}
+	if password != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		cfg.Encryption = encryptionGCM
+		cfg.KDF = &KDF{Salt: salt, Time: 3, Memory: 64 << 10, Threads: 4}
+	}
+	r, err := open(dir, cfg, password)
+	if err != nil {
+		return nil, err
+	}
+	if r.aead != nil {
+		if r.cfg.KeyCheck, err = r.seal([]byte(keyCheckText)); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(r.cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, configFile), append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write repository config: %w", err)
+	}
+	return r, nil
+}
+
+// Open opens the repository in dir. The password is required for an
+// encrypted repository and ignored otherwise.
+func Open(dir, password string) (*Repo, error) {
+	data, err := os.ReadFile(filepath.Join(dir, configFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s is not a repository, create one with 'repo init'", dir)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read repository config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse repository config: %w", err)
+	}
+	if cfg.Version != formatVersion {
+		return nil, fmt.Errorf("repository format version %d is not supported", cfg.Version)
+	}
+	if cfg.Encryption != "" && password == "" {
+		return nil, fmt.Errorf("repository %s is encrypted, set %s", dir, PasswordEnv)
+	}
+
+	r, err := open(dir, cfg, password)
+	if err != nil {
+		return nil, err
+	}
+	if r.aead != nil {
+		if check, err := r.open(cfg.KeyCheck); err != nil || string(check) != keyCheckText {
+			r.Close()
+			return nil, fmt.Errorf("wrong password for repository %s", dir)
+		}
+	}
+	return r, nil
+}
+
+func open(dir string, cfg Config, password string) (*Repo, error) {
+	if cfg.Compression != "zstd" {
+		return nil, fmt.Errorf("repository compression %q is not supported", cfg.Compression)
+	}
+	r := &Repo{dir: dir, cfg: cfg}
+
+	switch cfg.Encryption {
+	case "":
+	case encryptionGCM:
+		if cfg.KDF == nil {
+			return nil, fmt.Errorf("encrypted repository has no key derivation settings")
+		}
+		key := argon2.IDKey([]byte(password), cfg.KDF.Salt, cfg.KDF.Time, cfg.KDF.Memory, cfg.KDF.Threads, 64)
+		block, err := aes.NewCipher(key[:32])
+		if err != nil {
+			return nil, err
+		}
+		if r.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+		r.idKey = key[32:]
+	default:
+		return nil, fmt.Errorf("repository encryption %q is not supported", cfg.Encryption)
+	}
+
+	var err error
+	if r.enc, err = zstd.NewWriter(nil); err != nil {
+		return nil, err
+	}
+	if r.dec, err = zstd.NewReader(nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close releases the repository's compressors.
+func (r *Repo) Close() {
+	r.enc.Close()
+	r.dec.Close()
+}
+
+// Dir returns the repository's directory.
+func (r *Repo) Dir() string {
+	return r.dir
+}
+
+// Encrypted reports whether the repository's chunks are encrypted.
+func (r *Repo) Encrypted() bool {
+	return r.aead != nil
+}
+
+// chunkID names a chunk by its content. Encrypted repositories key the
+// hash, so chunk names do not reveal whether a known text is stored.
+func (r *Repo) chunkID(data []byte) string {
+	if r.idKey != nil {
+		h := hmac.New(sha256.New, r.idKey)
+		h.Write(data)
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *Repo) chunkPath(id string) string {
+	return filepath.Join(r.dir, "chunks", id[:2], id)
+}
+
+// putChunk stores a chunk unless it is stored already. It returns the
+// chunk's ID and the bytes written, zero for a duplicate.
+func (r *Repo) putChunk(data []byte) (string, int64, error) {
+	id := r.chunkID(data)
+	path := r.chunkPath(id)
+	if _, err := os.Stat(path); err == nil {
+		return id, 0, nil
+	}
+
+	stored := r.enc.EncodeAll(data, nil)
+	if r.aead != nil {
+		var err error
+		if stored, err = r.seal(stored); err != nil {
+			return "", 0, err
+		}
+	}
+	if err := writeAtomic(path, stored); err != nil {
+		return "", 0, fmt.Errorf("failed to store chunk: %w", err)
+	}
+	return id, int64(len(stored)), nil
+}
+
+// getChunk reads a chunk and verifies its content against its ID.
+func (r *Repo) getChunk(id string) ([]byte, error) {
+	stored, err := os.ReadFile(r.chunkPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %s: %w", id, err)
+	}
+	if r.aead != nil {
+		if stored, err = r.open(stored); err != nil {
+			return nil, fmt.Errorf("failed to decrypt chunk %s: %w", id, err)
+		}
+	}
+	data, err := r.dec.DecodeAll(stored, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress chunk %s: %w", id, err)
+	}
+	if r.chunkID(data) != id {
+		return nil, fmt.Errorf("chunk %s is corrupt", id)
+	}
+	return data, nil
+}
+
+// seal encrypts data, prefixing the random nonce.
+func (r *Repo) seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, r.aead.NonceSize(), r.aead.NonceSize()+len(data)+r.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return r.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (r *Repo) open(data []byte) ([]byte, error) {
+	n := r.aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("ciphertext too short")
+	}
+	return r.aead.Open(nil, data[:n], data[n:], nil)
+}
+
+// lock takes the repository's lock, so a prune cannot delete chunks a
+// running backup is about to reference.
+func (r *Repo) lock() (func(), error) {
+	path := filepath.Join(r.dir, lockFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		owner, _ := os.ReadFile(path)
+		return nil, fmt.Errorf("repository is locked by %s; remove %s if no backup or prune is running",
+			strings.TrimSpace(string(owner)), path)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to lock repository: %w", err)
+	}
+	host, _ := os.Hostname()
+	fmt.Fprintf(f, "pid %d on %s\n", os.Getpid(), host)
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
+
+// writeAtomic writes a file through a temporary file and a rename, so
+// readers never see it partially written.
+func writeAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,164 @@
+package repo
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+// chunks splits data with a chunker fed in small, uneven writes.
+func chunks(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	var out [][]byte
+	c := newChunker(func(chunk []byte) error {
+		out = append(out, append([]byte(nil), chunk...))
+		return nil
+	})
+	for p := data; len(p) > 0; {
+		n := min(len(p), 1+len(p)%7919)
+		if _, err := c.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// TestChunkerBoundaries verifies chunk sizes stay in bounds and that an
+// insertion only changes the chunks around it.
+func TestChunkerBoundaries(t *testing.T) {
+	data := make([]byte, 24<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	before := chunks(t, data)
+	if !bytes.Equal(bytes.Join(before, nil), data) {
+		t.Fatal("chunks do not reassemble the input")
+	}
+	for i, c := range before {
+		if len(c) > MaxChunkSize || (len(c) < MinChunkSize && i != len(before)-1) {
+			t.Errorf("chunk %d has %d bytes", i, len(c))
+		}
+	}
+	if avg := len(data) / len(before); avg < AvgChunkSize/2 || avg > AvgChunkSize*2 {
+		t.Errorf("average chunk size %d, want about %d", avg, AvgChunkSize)
+	}
+
+	edited := append([]byte("INSERT INTO changed VALUES (1);\n"), data...)
+	after := chunks(t, edited)
+	known := map[string]bool{}
+	for _, c := range before {
+		known[string(c)] = true
+	}
+	shared := 0
+	for _, c := range after {
+		if known[string(c)] {
+			shared++
+		}
+	}
+	if shared < len(before)-2 {
+		t.Errorf("only %d of %d chunks survived an insertion at the start", shared, len(before))
+	}
+}
+
+// TestRepository verifies backups deduplicate, round-trip, survive pruning
+// and stay unreadable without the password.
+func TestRepository(t *testing.T) {
+	for _, password := range []string{"", "secret"} {
+		dir := t.TempDir()
+		r, err := Init(dir, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dump := make([]byte, 6<<20)
+		rand.New(rand.NewSource(2)).Read(dump)
+		first := storeBytes(t, r, "shop-1", dump)
+		second := storeBytes(t, r, "shop-2", append(dump, "-- one more line\n"...))
+		if second.NewBytes >= first.NewBytes/2 {
+			t.Errorf("second backup added %d bytes, the first %d", second.NewBytes, first.NewBytes)
+		}
+		if same := storeBytes(t, r, "shop-3", dump); same.NewBytes != 0 || !math.IsInf(same.Ratio(), 1) {
+			t.Errorf("unchanged backup added %d bytes, ratio %v", same.NewBytes, same.Ratio())
+		} else if err := r.Forget(same.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := r.WriteSnapshot(first.ID, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), dump) {
+			t.Error("restored dump differs from the original")
+		}
+
+		path := filepath.Join(t.TempDir(), "shop.sql")
+		if _, err := r.Extract(second.ID, path); err != nil {
+			t.Fatal(err)
+		}
+		if m, err := pgbackup.ReadManifest(path); err != nil || m.Database != "shop" {
+			t.Errorf("extracted manifest %+v, %v", m, err)
+		}
+
+		if err := r.Forget(first.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Prune(); err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		if err := r.WriteSnapshot(second.ID, &buf); err != nil {
+			t.Fatalf("snapshot unreadable after prune: %v", err)
+		}
+		st, err := r.Stats()
+		if err != nil || st.Snapshots != 1 || st.Chunks != len(unique(second.Chunks)) {
+			t.Errorf("stats after prune %+v, %v", st, err)
+		}
+		r.Close()
+
+		if password != "" {
+			if _, err := Open(dir, "wrong"); err == nil {
+				t.Error("expected an error for a wrong password")
+			}
+			if _, err := Open(dir, ""); err == nil {
+				t.Error("expected an error for a missing password")
+			}
+		}
+		if r, err = Open(dir, password); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+}
+
+// storeBytes stores data as a snapshot with a fixed ID.
+func storeBytes(t *testing.T, r *Repo, id string, data []byte) *Snapshot {
+	t.Helper()
+	snap, err := r.store("shop", func(w io.Writer) (*pgbackup.Manifest, error) {
+		_, err := w.Write(data)
+		return &pgbackup.Manifest{Database: "shop"}, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rename the snapshot so backups within one second do not collide.
+	os.Rename(r.snapshotPath(snap.ID), r.snapshotPath(id))
+	snap.ID = id
+	return snap
+}
+
+func unique(ids []string) map[string]bool {
+	m := map[string]bool{}
+	for _, id := range ids {
+		m[id] = true
+	}
+	return m
+}
@@ -0,0 +1,312 @@
+package repo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+// Snapshot is one backup stored in the repository.
+type Snapshot struct {
+	ID        string    `json:"id"`
+	Database  string    `json:"database"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"` // Bytes of the dump
+
+	// NewChunks and NewBytes count the chunks this backup added and their
+	// stored size, compressed and encrypted. The rest were already stored.
+	NewChunks int   `json:"new_chunks"`
+	NewBytes  int64 `json:"new_bytes"`
+
+	Chunks   []string           `json:"chunks"`
+	Manifest *pgbackup.Manifest `json:"manifest"`
+}
+
+// Ratio is the backup's size over the bytes it added to the repository. It
+// is +Inf for a backup whose chunks were all stored already, and 0 for an
+// empty one.
+func (s Snapshot) Ratio() float64 {
+	if s.Size == 0 {
+		return 0
+	}
+	if s.NewBytes == 0 {
+		return math.Inf(1)
+	}
+	return float64(s.Size) / float64(s.NewBytes)
+}
+
+// Backup dumps the database described by opts into a new snapshot.
+// opts.OutputPath is ignored.
+func (r *Repo) Backup(opts pgbackup.Options) (*Snapshot, error) {
+	return r.store(opts.DBName, func(w io.Writer) (*pgbackup.Manifest, error) {
+		return pgbackup.WriteDump(opts, w)
+	})
+}
+
+// store streams the dump written by dump into a new snapshot.
+func (r *Repo) store(dbname string, dump func(w io.Writer) (*pgbackup.Manifest, error)) (*Snapshot, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	created := time.Now().UTC()
+	snap := &Snapshot{
+		ID:        fmt.Sprintf("%s-%s", dbname, created.Format("20060102-150405")),
+		Database:  dbname,
+		CreatedAt: created,
+	}
+	if _, err := os.Stat(r.snapshotPath(snap.ID)); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", snap.ID)
+	}
+
+	c := newChunker(func(chunk []byte) error {
+		id, stored, err := r.putChunk(chunk)
+		if err != nil {
+			return err
+		}
+		snap.Chunks = append(snap.Chunks, id)
+		snap.Size += int64(len(chunk))
+		if stored > 0 {
+			snap.NewChunks++
+			snap.NewBytes += stored
+		}
+		return nil
+	})
+	manifest, err := dump(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Close(); err != nil {
+		return nil, err
+	}
+
+	manifest.File = snap.ID
+	manifest.Size = snap.Size
+	snap.Manifest = manifest
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAtomic(r.snapshotPath(snap.ID), data); err != nil {
+		return nil, fmt.Errorf("failed to record snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+func (r *Repo) snapshotPath(id string) string {
+	return filepath.Join(r.dir, "snapshots", id+".json")
+}
+
+// Snapshots returns the repository's snapshots, oldest first.
+func (r *Repo) Snapshots() ([]Snapshot, error) {
+	matches, err := filepath.Glob(filepath.Join(r.dir, "snapshots", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var snaps []Snapshot
+	for _, m := range matches {
+		snap, err := r.Snapshot(strings.TrimSuffix(filepath.Base(m), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, *snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].CreatedAt.Before(snaps[j].CreatedAt)
+	})
+	return snaps, nil
+}
+
+// Snapshot reads the snapshot with the given ID.
+func (r *Repo) Snapshot(id string) (*Snapshot, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, fmt.Errorf("invalid snapshot ID %q", id)
+	}
+	data, err := os.ReadFile(r.snapshotPath(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("snapshot %s not found", id)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", id, err)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", id, err)
+	}
+	return &snap, nil
+}
+
+// WriteSnapshot reassembles a snapshot's dump into w, verifying every chunk.
+func (r *Repo) WriteSnapshot(id string, w io.Writer) error {
+	snap, err := r.Snapshot(id)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range snap.Chunks {
+		data, err := r.getChunk(chunk)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extract reassembles a snapshot into a plain SQL backup file at path, with
+// its manifest next to it, ready for pgrestore.
+func (r *Repo) Extract(id, path string) (*pgbackup.Manifest, error) {
+	snap, err := r.Snapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	bw := bufio.NewWriterSize(f, 1<<20)
+	if err := r.WriteSnapshot(id, bw); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if snap.Manifest != nil {
+		if err := pgbackup.WriteManifest(path, snap.Manifest); err != nil {
+			return nil, err
+		}
+	}
+	return snap.Manifest, nil
+}
+
+// Forget removes snapshots. Their chunks stay until Prune.
+func (r *Repo) Forget(ids ...string) error {
+	for _, id := range ids {
+		if _, err := r.Snapshot(id); err != nil {
+			return err
+		}
+		if err := os.Remove(r.snapshotPath(id)); err != nil {
+			return fmt.Errorf("failed to forget snapshot %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// KeepLast returns the snapshots beyond the newest n of each database.
+func KeepLast(snaps []Snapshot, n int) []string {
+	seen := map[string]int{}
+	var drop []string
+	for i := len(snaps) - 1; i >= 0; i-- {
+		s := snaps[i]
+		seen[s.Database]++
+		if seen[s.Database] > n {
+			drop = append(drop, s.ID)
+		}
+	}
+	return drop
+}
+
+// PruneResult reports what a prune removed.
+type PruneResult struct {
+	Chunks int
+	Bytes  int64
+}
+
+// Prune deletes the chunks no snapshot references, and any temporary files
+// left behind by interrupted backups.
+func (r *Repo) Prune() (PruneResult, error) {
+	var result PruneResult
+	unlock, err := r.lock()
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+
+	snaps, err := r.Snapshots()
+	if err != nil {
+		return result, err
+	}
+	used := map[string]bool{}
+	for _, s := range snaps {
+		for _, c := range s.Chunks {
+			used[c] = true
+		}
+	}
+
+	err = r.walkChunks(func(path string, info os.FileInfo) error {
+		if used[info.Name()] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to delete chunk: %w", err)
+		}
+		if !strings.HasPrefix(info.Name(), ".") {
+			result.Chunks++
+			result.Bytes += info.Size()
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (r *Repo) walkChunks(fn func(path string, info os.FileInfo) error) error {
+	return filepath.Walk(filepath.Join(r.dir, "chunks"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return fn(path, info)
+	})
+}
+
+// Stats summarizes a repository.
+type Stats struct {
+	Snapshots   int
+	Chunks      int
+	LogicalSize int64 // Total size of all dumps
+	StoredSize  int64 // Total size of the stored chunks
+}
+
+// Ratio is the size of all dumps over the space they take in the repository.
+func (s Stats) Ratio() float64 {
+	if s.StoredSize == 0 {
+		return 0
+	}
+	return float64(s.LogicalSize) / float64(s.StoredSize)
+}
+
+// Stats adds up the repository's snapshots and chunks.
+func (r *Repo) Stats() (Stats, error) {
+	var st Stats
+	snaps, err := r.Snapshots()
+	if err != nil {
+		return st, err
+	}
+	st.Snapshots = len(snaps)
+	for _, s := range snaps {
+		st.LogicalSize += s.Size
+	}
+	err = r.walkChunks(func(path string, info os.FileInfo) error {
+		if !strings.HasPrefix(info.Name(), ".") {
+			st.Chunks++
+			st.StoredSize += info.Size()
+		}
+		return nil
+	})
+	return st, err
+}
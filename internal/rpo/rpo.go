@@ -0,0 +1,361 @@
+// Package rpo checks that every database has a recent, plausibly sized
+// backup, so a silently skipped or truncated backup is noticed before the
+// recovery point objective is missed.
+//
+// The catalog checked is the manifests in a backup directory or the
+// snapshots of a deduplicating repository.
+package rpo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/dbpattern"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/repo"
+)
+
+// DefaultWindow is the number of earlier backups a size is compared with.
+const DefaultWindow = 7
+
+// Policy is the recovery point objective of the databases matching
+// Database, whose backups are found in Dir or Repo.
+type Policy struct {
+	// Database is a "host/database" glob pattern. A pattern without a
+	// slash matches the database name on any host.
+	Database string `json:"database"`
+	Dir      string `json:"dir"`  // Directory of backup files with manifests
+	Repo     string `json:"repo"` // Deduplicating repository
+
+	MaxAge  Duration `json:"max_age"`  // Oldest acceptable newest backup
+	MinSize int64    `json:"min_size"` // Smallest acceptable backup, in bytes
+
+	// MaxSizeDeviation is the largest fraction, e.g. 0.5, by which the
+	// newest backup may differ in size from the average of the Window
+	// backups before it. Zero disables the comparison.
+	MaxSizeDeviation float64 `json:"max_size_deviation"`
+	Window           int     `json:"window"`
+}
+
+// Duration is a time.Duration written as "26h" or "90m" in JSON. A "d"
+// suffix counts days.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"26h\": %w", err)
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ParseDuration parses a time.Duration, also accepting whole days as "2d".
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		if _, err := fmt.Sscanf(days, "%d", &n); err == nil && fmt.Sprint(n) == days {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// Status is the outcome of a check, ordered by severity. The values are
+// the Nagios plugin exit codes.
+type Status int
+
+const (
+	OK Status = iota
+	Warning
+	Critical
+	Unknown
+)
+
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "OK"
+	case Warning:
+		return "WARNING"
+	case Critical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Backup is one backup in the catalog.
+type Backup struct {
+	Host      string
+	Database  string
+	CreatedAt time.Time
+	Size      int64
+	Location  string // Backup file or repository snapshot
+}
+
+// Result is the freshness of one database.
+type Result struct {
+	Host     string
+	Database string
+	Status   Status
+	Latest   *Backup       // Newest backup, nil if there is none
+	Age      time.Duration // Age of Latest
+	Average  int64         // Average size of the backups Latest is compared with
+	Problems []string
+	Policy   Policy
+}
+
+func (r *Result) raise(s Status, format string, args ...any) {
+	r.Status = max(r.Status, s)
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Name identifies the database as "host/database".
+func (r Result) Name() string {
+	return r.Host + "/" + r.Database
+}
+
+// Check evaluates every policy against its catalog at time now. A database
+// matched by several policies is checked against each.
+func Check(policies []Policy, password string, now time.Time) []Result {
+	var results []Result
+	for _, p := range policies {
+		backups, err := Catalog(p, password)
+		if err != nil {
+			r := Result{Host: "*", Database: p.Database, Policy: p}
+			r.raise(Unknown, "cannot read the catalog: %v", err)
+			results = append(results, r)
+			continue
+		}
+		byDB := map[string][]Backup{}
+		for _, b := range backups {
+			if ok, _ := dbpattern.Match(p.Database, b.Host, b.Database); ok {
+				key := b.Host + "/" + b.Database
+				byDB[key] = append(byDB[key], b)
+			}
+		}
+		if len(byDB) == 0 {
+			host, db, found := strings.Cut(p.Database, "/")
+			if !found {
+				host, db = "*", p.Database
+			}
+			r := Result{Host: host, Database: db, Policy: p}
+			r.raise(Critical, "no backups found in %s", p.location())
+			results = append(results, r)
+			continue
+		}
+		keys := make([]string, 0, len(byDB))
+		for k := range byDB {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			results = append(results, evaluate(p, byDB[k], now))
+		}
+	}
+	return results
+}
+
+// evaluate checks the backups of one database, sorted oldest first.
+func evaluate(p Policy, backups []Backup, now time.Time) Result {
+	latest := backups[len(backups)-1]
+	r := Result{Host: latest.Host, Database: latest.Database, Latest: &latest, Age: now.Sub(latest.CreatedAt), Policy: p}
+
+	if p.MaxAge > 0 && r.Age > time.Duration(p.MaxAge) {
+		r.raise(Critical, "newest backup is %s old, more than %s", FormatAge(r.Age), FormatAge(time.Duration(p.MaxAge)))
+	}
+	if p.MinSize > 0 && latest.Size < p.MinSize {
+		r.raise(Critical, "newest backup has %d bytes, less than %d", latest.Size, p.MinSize)
+	}
+
+	window := p.Window
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	earlier := backups[max(0, len(backups)-1-window) : len(backups)-1]
+	if len(earlier) > 0 {
+		var sum int64
+		for _, b := range earlier {
+			sum += b.Size
+		}
+		r.Average = sum / int64(len(earlier))
+	}
+	if p.MaxSizeDeviation > 0 && r.Average > 0 {
+		deviation := float64(latest.Size-r.Average) / float64(r.Average)
+		if deviation > p.MaxSizeDeviation || -deviation > p.MaxSizeDeviation {
+			r.raise(Warning, "newest backup has %d bytes, %+.0f%% from the average of %d", latest.Size, deviation*100, r.Average)
+		}
+	}
+	return r
+}
+
+func (p Policy) location() string {
+	if p.Repo != "" {
+		return "repository " + p.Repo
+	}
+	return p.Dir
+}
+
+// Catalog lists the backups in the policy's directory or repository that
+// count towards its objective, oldest first.
+func Catalog(p Policy, password string) ([]Backup, error) {
+	var backups []Backup
+	switch {
+	case p.Repo != "":
+		r, err := repo.Open(p.Repo, password)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		snaps, err := r.Snapshots()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range snaps {
+			host := ""
+			if s.Manifest != nil {
+				if !counts(s.Manifest) {
+					continue
+				}
+				host = s.Manifest.Host
+			}
+			backups = append(backups, Backup{Host: host, Database: s.Database, CreatedAt: s.CreatedAt, Size: s.Size, Location: p.Repo + ":" + s.ID})
+		}
+	case p.Dir != "":
+		if _, err := os.Stat(p.Dir); err != nil {
+			return nil, err
+		}
+		manifests, err := filepath.Glob(filepath.Join(p.Dir, "*"+pgbackup.ManifestSuffix))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range manifests {
+			file := strings.TrimSuffix(path, pgbackup.ManifestSuffix)
+			m, err := pgbackup.ReadManifest(file)
+			if err != nil || !counts(m) {
+				continue
+			}
+			backups = append(backups, Backup{Host: m.Host, Database: m.Database, CreatedAt: m.CreatedAt, Size: m.Size, Location: file})
+		}
+	default:
+		return nil, fmt.Errorf("policy for %s has neither dir nor repo", p.Database)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.Before(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// counts reports whether a backup can recover its database: masked and
+// subset backups hold other data, and safety backups are copies of a
+// restore's target rather than of the database they are named after.
+func counts(m *pgbackup.Manifest) bool {
+	return !m.Masked && len(m.SubsetRoots) == 0 && !m.Safety
+}
+
+// Worst returns the most severe status among results, OK for none.
+func Worst(results []Result) Status {
+	worst := OK
+	for _, r := range results {
+		worst = max(worst, r.Status)
+	}
+	return worst
+}
+
+// FormatAge renders an age with at most two units, e.g. "1d3h" or "42m".
+func FormatAge(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days, hours, minutes := int(d/(24*time.Hour)), int(d/time.Hour)%24, int(d/time.Minute)%60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+// Nagios renders results as Nagios plugin output: a status line with
+// performance data, then one line per database.
+func Nagios(results []Result) string {
+	worst := Worst(results)
+	var bad []string
+	var perf []string
+	for _, r := range results {
+		if r.Status != OK {
+			bad = append(bad, r.Name())
+		}
+		if r.Latest != nil {
+			label := strings.NewReplacer("'", "", "=", "_").Replace(r.Name())
+			maxAge := ""
+			if r.Policy.MaxAge > 0 {
+				maxAge = fmt.Sprint(int64(time.Duration(r.Policy.MaxAge).Seconds()))
+			}
+			perf = append(perf, fmt.Sprintf("'%s age'=%ds;;%s", label, int64(r.Age.Seconds()), maxAge))
+			perf = append(perf, fmt.Sprintf("'%s size'=%dB;;%d", label, r.Latest.Size, r.Policy.MinSize))
+		}
+	}
+
+	var b strings.Builder
+	switch {
+	case len(results) == 0:
+		b.WriteString("RPO UNKNOWN - no policies configured")
+	case len(bad) == 0:
+		fmt.Fprintf(&b, "RPO OK - %d databases within their objectives", len(results))
+	default:
+		fmt.Fprintf(&b, "RPO %s - %s", worst, strings.Join(bad, ", "))
+	}
+	if len(perf) > 0 {
+		b.WriteString(" | " + strings.Join(perf, " "))
+	}
+	b.WriteString("\n")
+	for _, r := range results {
+		line := fmt.Sprintf("[%s] %s", r.Status, r.Name())
+		if r.Latest != nil {
+			line += fmt.Sprintf(": newest backup %s ago", FormatAge(r.Age))
+		}
+		if len(r.Problems) > 0 {
+			line += "; " + strings.Join(r.Problems, "; ")
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// WriteMetrics writes the results in the Prometheus text exposition format.
+func WriteMetrics(w io.Writer, results []Result) error {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var b strings.Builder
+	b.WriteString("# HELP go_pg_backup_rpo_status Result of the last RPO check: 0 ok, 1 warning, 2 critical, 3 unknown.\n")
+	b.WriteString("# TYPE go_pg_backup_rpo_status gauge\n")
+	for _, r := range results {
+		fmt.Fprintf(&b, "go_pg_backup_rpo_status{host=\"%s\",database=\"%s\"} %d\n", quote.Replace(r.Host), quote.Replace(r.Database), r.Status)
+	}
+	b.WriteString("# HELP go_pg_backup_newest_backup_age_seconds Age of the newest backup in the catalog at the last RPO check.\n")
+	b.WriteString("# TYPE go_pg_backup_newest_backup_age_seconds gauge\n")
+	for _, r := range results {
+		if r.Latest != nil {
+			fmt.Fprintf(&b, "go_pg_backup_newest_backup_age_seconds{host=\"%s\",database=\"%s\"} %d\n", quote.Replace(r.Host), quote.Replace(r.Database), int64(r.Age.Seconds()))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
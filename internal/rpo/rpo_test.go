@@ -0,0 +1,117 @@
+package rpo
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+var now = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// writeBackup writes a backup file of size bytes with its manifest.
+func writeBackup(t *testing.T, dir, host, db string, age time.Duration, size int) {
+	t.Helper()
+	path := filepath.Join(dir, db+"-"+now.Add(-age).Format("20060102-150405")+".sql")
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &pgbackup.Manifest{Database: db, Host: host, Port: 5432, CreatedAt: now.Add(-age)}
+	if err := pgbackup.WriteManifest(path, m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	for day := 7; day >= 1; day-- {
+		writeBackup(t, dir, "db.local", "shop", time.Duration(day)*24*time.Hour, 1000)
+		writeBackup(t, dir, "db.local", "crm", time.Duration(day)*24*time.Hour+time.Hour, 1000)
+	}
+	writeBackup(t, dir, "db.local", "shop", 2*time.Hour, 300) // Truncated
+	writeBackup(t, dir, "db.local", "crm", 3*time.Hour, 1100)
+
+	var policies []Policy
+	err := json.Unmarshal([]byte(`[
+		{"database": "db.local/*", "dir": "`+dir+`", "max_age": "1d", "max_size_deviation": 0.5},
+		{"database": "crm", "dir": "`+dir+`", "max_age": "2h", "min_size": 500},
+		{"database": "billing", "dir": "`+dir+`", "max_age": "26h"}
+	]`), &policies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := Check(policies, "", now)
+	got := map[string]Status{}
+	for _, r := range results {
+		got[r.Name()+" "+r.Policy.Database] = r.Status
+	}
+	want := map[string]Status{
+		"db.local/crm db.local/*":  OK,
+		"db.local/shop db.local/*": Warning, // 70% smaller than usual
+		"db.local/crm crm":         Critical,
+		"*/billing billing":        Critical,
+	}
+	for k, s := range want {
+		if got[k] != s {
+			t.Errorf("%s: %s, want %s", k, got[k], s)
+		}
+	}
+	if len(results) != len(want) {
+		t.Errorf("%d results, want %d", len(results), len(want))
+	}
+	if Worst(results) != Critical {
+		t.Errorf("worst %s", Worst(results))
+	}
+
+	out := Nagios(results)
+	first, _, _ := strings.Cut(out, "\n")
+	if !strings.HasPrefix(first, "RPO CRITICAL - ") || !strings.Contains(first, "'db.local/crm age'=10800s;;7200") {
+		t.Errorf("status line %q", first)
+	}
+	if !strings.Contains(out, "[WARNING] db.local/shop: newest backup 2h0m ago; newest backup has 300 bytes, -70% from the average of 1000") {
+		t.Errorf("output:\n%s", out)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for in, want := range map[string]time.Duration{"26h": 26 * time.Hour, "2d": 48 * time.Hour, "90m": 90 * time.Minute} {
+		if got, err := ParseDuration(in); err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %v, %v", in, got, err)
+		}
+	}
+	if _, err := ParseDuration("1.5d"); err == nil {
+		t.Error("expected an error for fractional days")
+	}
+}
+
+// TestCatalogSkipsOtherBackups verifies masked, subset and safety backups do
+// not satisfy an objective.
+func TestCatalogSkipsOtherBackups(t *testing.T) {
+	dir := t.TempDir()
+	writeBackup(t, dir, "db.local", "shop", 48*time.Hour, 1000)
+	for i, mark := range []func(m *pgbackup.Manifest){
+		func(m *pgbackup.Manifest) { m.Masked = true },
+		func(m *pgbackup.Manifest) { m.SubsetRoots = []string{"orders"} },
+		func(m *pgbackup.Manifest) { m.Safety = true; m.Host = "staging.local" },
+	} {
+		path := filepath.Join(dir, "shop-other-"+string(rune('a'+i))+".sql")
+		if err := os.WriteFile(path, make([]byte, 1000), 0644); err != nil {
+			t.Fatal(err)
+		}
+		m := &pgbackup.Manifest{Database: "shop", Host: "db.local", CreatedAt: now.Add(-time.Hour)}
+		mark(m)
+		if err := pgbackup.WriteManifest(path, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := Check([]Policy{{Database: "shop", Dir: dir, MaxAge: Duration(24 * time.Hour)}}, "", now)
+	if len(results) != 1 || results[0].Status != Critical || results[0].Age != 48*time.Hour {
+		t.Errorf("results %+v, want the 48h old backup to be critical", results)
+	}
+}
@@ -0,0 +1,556 @@
+package schemadiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+)
+
+// Kind is the kind of a schema object.
+type Kind string
+
+const (
+	KindSchema     Kind = "schema"
+	KindExtension  Kind = "extension"
+	KindType       Kind = "type"
+	KindSequence   Kind = "sequence"
+	KindTable      Kind = "table"
+	KindColumn     Kind = "column"
+	KindConstraint Kind = "constraint"
+	KindIndex      Kind = "index"
+	KindView       Kind = "view"
+	KindFunction   Kind = "function"
+	KindTrigger    Kind = "trigger"
+	KindGrant      Kind = "grant"
+	KindStatement  Kind = "statement" // Any other DDL, keyed by its text
+)
+
+// kindOrder is the order changes are listed in.
+var kindOrder = []Kind{
+	KindSchema, KindExtension, KindType, KindSequence, KindTable, KindColumn, KindConstraint,
+	KindIndex, KindView, KindFunction, KindTrigger, KindGrant, KindStatement,
+}
+
+func kindRank(k Kind) int {
+	for i, o := range kindOrder {
+		if o == k {
+			return i
+		}
+	}
+	return len(kindOrder)
+}
+
+// Object is one schema object. Columns and constraints are named after
+// their table, grants after the object they apply to.
+type Object struct {
+	Kind Kind
+	Name string
+	SQL  string // Definition, one statement or column per line
+}
+
+// Schema is the set of objects read from a DDL script.
+type Schema struct {
+	Objects []Object // Sorted by kind and name
+	index   map[string]int
+}
+
+func objectKey(kind Kind, name string) string {
+	return string(kind) + "\x00" + name
+}
+
+// Find returns the object of the given kind and name, or nil.
+func (s *Schema) Find(kind Kind, name string) *Object {
+	i, ok := s.index[objectKey(kind, name)]
+	if !ok {
+		return nil
+	}
+	return &s.Objects[i]
+}
+
+// add records an object, appending its definition to an existing object of
+// the same kind and name, e.g. several grants on one table.
+func (s *Schema) add(kind Kind, name, sql string) {
+	if o := s.Find(kind, name); o != nil {
+		o.SQL += "\n" + sql
+		return
+	}
+	s.index[objectKey(kind, name)] = len(s.Objects)
+	s.Objects = append(s.Objects, Object{Kind: kind, Name: name, SQL: sql})
+}
+
+// sort orders the objects and the lines of grants, whose order in a dump
+// carries no meaning.
+func (s *Schema) sort() {
+	for i, o := range s.Objects {
+		if o.Kind == KindGrant {
+			lines := strings.Split(o.SQL, "\n")
+			sort.Strings(lines)
+			s.Objects[i].SQL = strings.Join(lines, "\n")
+		}
+	}
+	sort.SliceStable(s.Objects, func(i, j int) bool {
+		a, b := s.Objects[i], s.Objects[j]
+		if kindRank(a.Kind) != kindRank(b.Kind) {
+			return kindRank(a.Kind) < kindRank(b.Kind)
+		}
+		return a.Name < b.Name
+	})
+	for i, o := range s.Objects {
+		s.index[objectKey(o.Kind, o.Name)] = i
+	}
+}
+
+// Parse reads the schema objects from a plain SQL script such as pg_dump
+// --schema-only writes. Table data, session settings, sequence values and
+// ownership are skipped.
+func Parse(r io.Reader) (*Schema, error) {
+	s := &Schema{index: map[string]int{}}
+	script := pgrestore.NewScriptReader(r)
+	for {
+		stmt, err := script.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+		if stmt.Meta {
+			continue
+		}
+		if stmt.IsCopyFromStdin() {
+			if _, err := io.Copy(io.Discard, script.CopyData()); err != nil {
+				return nil, fmt.Errorf("failed to read schema: %w", err)
+			}
+			continue
+		}
+		s.statement(stripComments(stmt.SQL))
+	}
+	s.sort()
+	return s, nil
+}
+
+// statement classifies one statement into the objects it defines.
+func (s *Schema) statement(sql string) {
+	sql = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(sql), ";"))
+	words := splitWords(sql)
+	if len(words) == 0 {
+		return
+	}
+	lead := strings.ToUpper(words[0])
+	switch lead {
+	case "SET", "SELECT", "BEGIN", "COMMIT", "REFRESH":
+		return
+	case "GRANT", "REVOKE":
+		s.grant(sql, words)
+		return
+	case "ALTER":
+		if i := indexWord(words, "OWNER"); i > 0 && i == len(words)-3 && strings.EqualFold(words[i+1], "TO") {
+			return
+		}
+		if len(words) > 1 && strings.EqualFold(words[1], "DATABASE") {
+			return
+		}
+		if len(words) > 3 && strings.EqualFold(words[1], "TABLE") && s.alterTable(sql, words) {
+			return
+		}
+		if len(words) > 4 && strings.EqualFold(words[1], "SEQUENCE") && strings.EqualFold(words[3], "OWNED") {
+			if o := s.Find(KindSequence, words[2]); o != nil {
+				o.SQL += " " + strings.Join(words[3:], " ")
+				return
+			}
+		}
+	case "CREATE":
+		if s.create(sql, words[1:]) {
+			return
+		}
+	}
+	s.add(KindStatement, normalize(sql), sql)
+}
+
+// create records a CREATE statement and reports whether it was recognised.
+func (s *Schema) create(sql string, words []string) bool {
+	words = skipWords(words, "OR", "REPLACE")
+	if len(words) == 0 {
+		return false
+	}
+	kind := strings.ToUpper(words[0])
+	switch kind {
+	case "UNIQUE", "INDEX":
+		words = skipWords(words, "UNIQUE")
+		words = skipWords(skipWords(words[1:], "CONCURRENTLY"), "IF", "NOT", "EXISTS")
+		on := indexWord(words, "ON")
+		if on != 1 || len(words) < 3 {
+			return false
+		}
+		table := words[2]
+		if strings.EqualFold(table, "ONLY") && len(words) > 3 {
+			table = words[3]
+		}
+		// Partitioned parents are indexed ON ONLY by pg_dump, without by the Go engine.
+		s.add(KindIndex, qualifyLike(table, words[0]), strings.Replace(sql, " ON ONLY ", " ON ", 1))
+		return true
+	case "TABLE", "UNLOGGED", "FOREIGN":
+		words = skipWords(skipWords(words, "UNLOGGED"), "FOREIGN")
+		if len(words) < 2 || !strings.EqualFold(words[0], "TABLE") {
+			return false
+		}
+		s.table(sql)
+		return true
+	case "FUNCTION", "PROCEDURE":
+		if len(words) < 2 {
+			return false
+		}
+		s.add(KindFunction, words[1], plainDollarQuotes(dropOrReplace(sql)))
+		return true
+	case "VIEW", "MATERIALIZED", "RECURSIVE":
+		words = skipWords(skipWords(words, "MATERIALIZED"), "RECURSIVE")
+		if len(words) < 2 {
+			return false
+		}
+		s.add(KindView, words[1], dropOrReplace(sql))
+		return true
+	case "SEQUENCE":
+		words = skipWords(words[1:], "IF", "NOT", "EXISTS")
+		if len(words) == 0 {
+			return false
+		}
+		s.add(KindSequence, words[0], sql)
+		return true
+	case "TYPE", "DOMAIN":
+		if len(words) < 2 {
+			return false
+		}
+		s.add(KindType, words[1], sql)
+		return true
+	case "SCHEMA", "EXTENSION":
+		words = skipWords(words[1:], "IF", "NOT", "EXISTS")
+		if len(words) == 0 {
+			return false
+		}
+		k := KindSchema
+		if kind == "EXTENSION" {
+			k = KindExtension
+		}
+		s.add(k, words[0], sql)
+		return true
+	case "TRIGGER", "CONSTRAINT":
+		words = skipWords(words, "CONSTRAINT")
+		on := indexWord(words, "ON")
+		if len(words) < 2 || on < 0 || on+1 >= len(words) {
+			return false
+		}
+		s.add(KindTrigger, words[on+1]+"."+words[1], dropOrReplace(sql))
+		return true
+	case "DATABASE":
+		return true
+	}
+	return false
+}
+
+// table records a CREATE TABLE statement as the table itself, its columns
+// and its inline constraints, so a changed column shows as just that.
+func (s *Schema) table(sql string) {
+	open := topLevelIndex(sql, '(')
+	header := sql
+	var elements []string
+	suffix := ""
+	if open >= 0 && !strings.Contains(strings.ToUpper(sql[:open]), " PARTITION OF ") {
+		end := matchingParen(sql, open)
+		header = strings.TrimSpace(sql[:open])
+		elements = splitTopLevel(sql[open+1:end], ',')
+		if end < len(sql) {
+			suffix = strings.TrimSpace(sql[end+1:])
+		}
+	}
+
+	words := splitWords(header)
+	name := words[len(words)-1]
+	if table := indexWord(words, "TABLE"); table >= 0 {
+		if rest := skipWords(words[table+1:], "IF", "NOT", "EXISTS"); len(rest) > 0 {
+			name = rest[0]
+		}
+	}
+	var columns []string
+	for _, e := range elements {
+		e = strings.TrimSpace(e)
+		w := splitWords(e)
+		if len(w) == 0 {
+			continue
+		}
+		switch strings.ToUpper(w[0]) {
+		case "CONSTRAINT":
+			if len(w) > 2 {
+				s.add(KindConstraint, name+"."+w[1], fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", name, w[1], strings.Join(w[2:], " ")))
+				continue
+			}
+		case "PRIMARY", "UNIQUE", "CHECK", "FOREIGN", "EXCLUDE":
+			s.add(KindConstraint, name+"."+normalize(e), fmt.Sprintf("ALTER TABLE %s ADD %s", name, e))
+			continue
+		case "LIKE":
+			columns = append(columns, e)
+			continue
+		}
+		s.add(KindColumn, name+"."+w[0], e)
+	}
+
+	def := header
+	if len(columns) > 0 {
+		def += " (" + strings.Join(columns, ", ") + ")"
+	}
+	if suffix != "" {
+		def += " " + suffix
+	}
+	s.add(KindTable, name, def)
+}
+
+// alterTable folds an ALTER TABLE into the objects it changes and reports
+// whether it did: constraints become objects of their own, column changes
+// such as defaults and identities become part of the column.
+func (s *Schema) alterTable(sql string, words []string) bool {
+	rest := skipWords(skipWords(words[2:], "IF", "EXISTS"), "ONLY")
+	if len(rest) < 3 {
+		return false
+	}
+	table := rest[0]
+	action := strings.ToUpper(rest[1])
+	switch {
+	case action == "ADD" && strings.EqualFold(rest[2], "CONSTRAINT") && len(rest) > 4:
+		s.add(KindConstraint, table+"."+rest[3], fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", table, rest[3], strings.Join(rest[4:], " ")))
+		return true
+	case action == "ALTER" && len(rest) > 3:
+		column := rest[2]
+		change := rest[3:]
+		if strings.EqualFold(column, "COLUMN") {
+			column, change = rest[3], rest[4:]
+		}
+		o := s.Find(KindColumn, table+"."+column)
+		if o == nil || len(change) == 0 {
+			return false
+		}
+		if w := strings.ToUpper(change[0]); w == "SET" || w == "ADD" {
+			change = change[1:]
+		}
+		o.SQL += " " + strings.Join(change, " ")
+		return true
+	}
+	return false
+}
+
+// grant groups GRANT and REVOKE statements by the object they apply to.
+// Role memberships, which have no ON, are keyed by the statement.
+func (s *Schema) grant(sql string, words []string) {
+	on := indexWord(words, "ON")
+	to := indexWord(words, "TO")
+	if strings.EqualFold(words[0], "REVOKE") {
+		to = indexWord(words, "FROM")
+	}
+	if on < 0 || to < on {
+		s.add(KindGrant, normalize(sql), sql)
+		return
+	}
+	s.add(KindGrant, strings.Join(words[on+1:to], " "), sql)
+}
+
+// splitWords splits sql at whitespace outside quotes and parentheses, so a
+// qualified name with its argument list stays one word.
+func splitWords(sql string) []string {
+	var words []string
+	var word strings.Builder
+	depth := 0
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && (c == ' ' || c == '\t' || c == '\n' || c == '\r'):
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+			continue
+		}
+		word.WriteByte(c)
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// skipWords drops the leading keywords of words if they are all present.
+func skipWords(words []string, keywords ...string) []string {
+	if len(words) < len(keywords) {
+		return words
+	}
+	for i, k := range keywords {
+		if !strings.EqualFold(words[i], k) {
+			return words
+		}
+	}
+	return words[len(keywords):]
+}
+
+// indexWord returns the index of the first word equal to keyword, or -1.
+func indexWord(words []string, keyword string) int {
+	for i, w := range words {
+		if strings.EqualFold(w, keyword) {
+			return i
+		}
+	}
+	return -1
+}
+
+// qualifyLike qualifies name with the schema of the qualified name like,
+// as index names are unqualified but live in their table's schema.
+func qualifyLike(like, name string) string {
+	parts := splitTopLevel(like, '.')
+	if len(parts) < 2 || strings.Contains(name, ".") {
+		return name
+	}
+	return parts[0] + "." + name
+}
+
+// dropOrReplace removes the OR REPLACE pg_get_functiondef adds, which
+// pg_dump leaves out.
+func dropOrReplace(sql string) string {
+	words := splitWords(sql)
+	if len(words) > 2 && strings.EqualFold(words[1], "OR") && strings.EqualFold(words[2], "REPLACE") {
+		return "CREATE" + sql[strings.Index(strings.ToUpper(sql), "REPLACE")+len("REPLACE"):]
+	}
+	return sql
+}
+
+// plainDollarQuotes quotes a function body quoted with $function$, as
+// pg_get_functiondef does, with $$ like pg_dump, unless the body holds $$.
+func plainDollarQuotes(sql string) string {
+	const tag = "$function$"
+	if strings.Count(sql, tag) != 2 || strings.Contains(sql, "$$") {
+		return sql
+	}
+	return strings.ReplaceAll(sql, tag, "$$")
+}
+
+// topLevelIndex returns the index of the first c outside quotes, or -1.
+func topLevelIndex(sql string, c byte) int {
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		switch {
+		case quote != 0:
+			if sql[i] == quote {
+				quote = 0
+			}
+		case sql[i] == '\'' || sql[i] == '"':
+			quote = sql[i]
+		case sql[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+// matchingParen returns the index of the parenthesis closing the one at
+// open, or the end of sql.
+func matchingParen(sql string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(sql)
+}
+
+// splitTopLevel splits s at sep outside quotes and parentheses.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// stripComments removes whole-line comments and trailing blanks from a
+// statement's lines.
+func stripComments(sql string) string {
+	var lines []string
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// normalize collapses whitespace outside string literals and drops it just
+// inside parentheses, so objects that only differ in layout compare equal:
+// pg_dump writes enum labels and identity options one per line, the Go
+// engine on one.
+func normalize(sql string) string {
+	var b strings.Builder
+	space := false
+	inString := false
+	var last byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		if !inString && (c == ' ' || c == '\t' || c == '\n' || c == '\r') {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 && last != '(' && c != ')' {
+			b.WriteByte(' ')
+		}
+		last = c
+		space = false
+		if c == '\'' {
+			inString = !inString
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,227 @@
+// Package schemadiff compares the schema of a backup with that of a live
+// database object by object, so the effect of a restore on the target's
+// tables, columns, indexes, constraints, functions and grants is known
+// before it runs.
+package schemadiff
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbin"
+)
+
+// Status is how an object differs between the two schemas.
+type Status string
+
+const (
+	Added   Status = "added"   // Only in the backup
+	Removed Status = "removed" // Only in the database
+	Changed Status = "changed"
+)
+
+// Change is one object that differs. From is its definition in the
+// database, To its definition in the backup.
+type Change struct {
+	Kind   Kind
+	Name   string
+	Status Status
+	From   string
+	To     string
+}
+
+// Diff lists the objects that differ between from and to, sorted by kind
+// and name. Definitions are compared with their whitespace collapsed.
+func Diff(from, to *Schema) []Change {
+	var changes []Change
+	for _, o := range to.Objects {
+		old := from.Find(o.Kind, o.Name)
+		switch {
+		case old == nil:
+			changes = append(changes, Change{Kind: o.Kind, Name: o.Name, Status: Added, To: o.SQL})
+		case normalize(old.SQL) != normalize(o.SQL):
+			changes = append(changes, Change{Kind: o.Kind, Name: o.Name, Status: Changed, From: old.SQL, To: o.SQL})
+		}
+	}
+	for _, o := range from.Objects {
+		if to.Find(o.Kind, o.Name) == nil {
+			changes = append(changes, Change{Kind: o.Kind, Name: o.Name, Status: Removed, From: o.SQL})
+		}
+	}
+	sortChanges(changes)
+	return foldTables(changes)
+}
+
+// foldTables moves the columns and constraints of added and removed tables
+// into the table's change, so a whole table shows as one hunk.
+func foldTables(changes []Change) []Change {
+	tables := map[string]int{}
+	var out []Change
+	for _, c := range changes {
+		if c.Kind == KindTable && c.Status != Changed {
+			tables[c.Name] = len(out)
+			out = append(out, c)
+			continue
+		}
+		if c.Kind == KindColumn || c.Kind == KindConstraint {
+			if i, ok := tables[tableOf(c.Name)]; ok && out[i].Status == c.Status {
+				out[i].From = appendLine(out[i].From, c.From)
+				out[i].To = appendLine(out[i].To, c.To)
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// tableOf returns the table a column or constraint is named after.
+func tableOf(name string) string {
+	parts := splitTopLevel(name, '.')
+	return strings.Join(parts[:len(parts)-1], ".")
+}
+
+func appendLine(def, line string) string {
+	if line == "" {
+		return def
+	}
+	return def + "\n    " + line
+}
+
+// ReadFile reads the schema of a backup file. Plain SQL backups are parsed
+// directly, skipping their data; custom-format archives are read through
+// pg_restore --schema-only.
+func ReadFile(path string, clientBinDirs []string) (*Schema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 1<<20)
+	if magic, _ := r.Peek(5); string(magic) == "PGDMP" {
+		binaries := pgbin.Discover("pg_restore", clientBinDirs)
+		if len(binaries) == 0 {
+			return nil, fmt.Errorf("pg_restore not found; it is needed to read the custom-format backup %s", path)
+		}
+		return parseCommand(exec.Command(binaries[0].Path, "--schema-only", "-f", "-", path), "pg_restore")
+	}
+	return Parse(r)
+}
+
+// Database is a live database to read the schema of.
+type Database struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DBName   string
+
+	// Engine dumps the schema. Both engines write tables, sequences,
+	// types, views, functions and constraints alike, but the backup's own
+	// is the safest choice for anything else.
+	Engine        pgbackup.Engine
+	DumpBinary    string
+	ClientBinDirs []string
+}
+
+func (d Database) String() string {
+	return fmt.Sprintf("%s:%d/%s", d.Host, d.Port, d.DBName)
+}
+
+// ReadDatabase reads the schema of a live database with pg_dump
+// --schema-only or the Go engine.
+func ReadDatabase(d Database) (*Schema, error) {
+	opts := pgbackup.Options{
+		Host: d.Host, Port: d.Port, User: d.User, Password: d.Password, DBName: d.DBName,
+		Engine: d.Engine, DumpBinary: d.DumpBinary, ClientBinDirs: d.ClientBinDirs,
+	}
+	if pgbackup.SelectEngine(opts) == pgbackup.EngineGo {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(pgbackup.WriteSchemaDump(context.Background(), opts, pw))
+		}()
+		schema, err := Parse(pr)
+		pr.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", d, err)
+		}
+		return schema, nil
+	}
+
+	binary, err := pgbackup.ResolveDumpBinary(opts)
+	if err != nil {
+		return nil, err
+	}
+	cmd := pgbackup.PrepareDumpCommand(binary.Path, d.Host, d.Port, d.User, d.Password, d.DBName, "")
+	cmd.Args = append(cmd.Args, "--schema-only")
+	return parseCommand(cmd, "pg_dump")
+}
+
+// parseCommand parses the DDL script cmd writes to its standard output.
+func parseCommand(cmd *exec.Cmd, name string) (*Schema, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	schema, parseErr := Parse(stdout)
+	if parseErr != nil {
+		io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("%s failed: %s: %w", name, bytes.TrimSpace(stderr.Bytes()), err)
+	}
+	return schema, parseErr
+}
+
+// Result is the schema diff of a backup against a database.
+type Result struct {
+	Backup  string
+	Target  string
+	Changes []Change
+}
+
+// Backup compares the schema of the backup file at path with the target
+// database. Unless the target sets an engine, its schema is dumped with the
+// engine recorded in the backup's manifest.
+func Backup(path string, target Database) (*Result, error) {
+	if target.Engine == pgbackup.EngineAuto {
+		if m, err := pgbackup.ReadManifest(path); err == nil {
+			target.Engine = m.Engine
+		}
+	}
+	backup, err := ReadFile(path, target.ClientBinDirs)
+	if err != nil {
+		return nil, err
+	}
+	live, err := ReadDatabase(target)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Backup: path, Target: target.String(), Changes: Diff(live, backup)}, nil
+}
+
+// Summary is a one-line account of the differences.
+func (r *Result) Summary() string {
+	if len(r.Changes) == 0 {
+		return "The schemas match."
+	}
+	counts := map[Status]int{}
+	for _, c := range r.Changes {
+		counts[c.Status]++
+	}
+	return fmt.Sprintf("%d objects differ: %d only in the backup, %d only in the database, %d changed",
+		len(r.Changes), counts[Added], counts[Removed], counts[Changed])
+}
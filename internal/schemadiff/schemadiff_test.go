@@ -0,0 +1,291 @@
+package schemadiff
+
+import (
+	"strings"
+	"testing"
+)
+
+const databaseSchema = `--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+SELECT pg_catalog.set_config('search_path', '', false);
+
+CREATE TABLE public.orders (
+    id integer NOT NULL,
+    customer text NOT NULL,
+    total numeric(10,2),
+    CONSTRAINT orders_total_check CHECK ((total >= (0)::numeric))
+);
+
+ALTER TABLE public.orders OWNER TO shop;
+
+CREATE SEQUENCE public.orders_id_seq
+    AS integer
+    START WITH 1;
+
+ALTER SEQUENCE public.orders_id_seq OWNED BY public.orders.id;
+
+ALTER TABLE ONLY public.orders ALTER COLUMN id SET DEFAULT nextval('public.orders_id_seq'::regclass);
+
+CREATE TABLE public.audit (
+    at timestamp with time zone
+);
+
+CREATE FUNCTION public.total(o public.orders) RETURNS numeric
+    LANGUAGE sql
+    AS $$ SELECT o.total; $$;
+
+COPY public.orders (id, customer, total) FROM stdin;
+1	alice	10.00
+\.
+
+ALTER TABLE ONLY public.orders
+    ADD CONSTRAINT orders_pkey PRIMARY KEY (id);
+
+CREATE INDEX orders_customer_idx ON public.orders USING btree (customer);
+
+GRANT SELECT ON TABLE public.orders TO reporting;
+`
+
+const backupSchema = `SET statement_timeout = 0;
+
+CREATE TABLE public.orders (
+    id integer NOT NULL,
+    customer character varying(200) NOT NULL,
+    total numeric(10,2),
+    placed_at timestamp with time zone,
+    CONSTRAINT orders_total_check CHECK ((total >= (0)::numeric))
+);
+
+CREATE SEQUENCE public.orders_id_seq
+    AS integer
+    START WITH 1;
+
+ALTER SEQUENCE public.orders_id_seq OWNED BY public.orders.id;
+
+ALTER TABLE ONLY public.orders ALTER COLUMN id SET DEFAULT nextval('public.orders_id_seq'::regclass);
+
+CREATE FUNCTION public.total(o public.orders) RETURNS numeric
+    LANGUAGE sql
+    AS $$ SELECT coalesce(o.total, 0); $$;
+
+ALTER TABLE ONLY public.orders
+    ADD CONSTRAINT orders_pkey PRIMARY KEY (id);
+
+CREATE INDEX orders_customer_idx ON public.orders USING btree (customer);
+
+GRANT SELECT ON TABLE public.orders TO reporting;
+GRANT SELECT,INSERT ON TABLE public.orders TO app;
+`
+
+func parse(t *testing.T, script string) *Schema {
+	t.Helper()
+	s, err := Parse(strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	s := parse(t, databaseSchema)
+	want := map[string]Kind{
+		"public.orders":                    KindTable,
+		"public.orders.id":                 KindColumn,
+		"public.orders.orders_total_check": KindConstraint,
+		"public.orders.orders_pkey":        KindConstraint,
+		"public.orders_customer_idx":       KindIndex,
+		"public.orders_id_seq":             KindSequence,
+		"public.total(o public.orders)":    KindFunction,
+		"TABLE public.orders":              KindGrant,
+	}
+	for name, kind := range want {
+		if s.Find(kind, name) == nil {
+			t.Errorf("no %s %s", kind, name)
+		}
+	}
+	if id := s.Find(KindColumn, "public.orders.id"); id == nil || !strings.Contains(id.SQL, "DEFAULT nextval") {
+		t.Errorf("the column default was not folded into the column: %+v", id)
+	}
+	for _, o := range s.Objects {
+		if o.Kind == KindStatement {
+			t.Errorf("unrecognised statement %q", o.SQL)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	changes := Diff(parse(t, databaseSchema), parse(t, backupSchema))
+	got := map[string]Status{}
+	for _, c := range changes {
+		got[string(c.Kind)+" "+c.Name] = c.Status
+	}
+	want := map[string]Status{
+		"table public.audit":                     Removed,
+		"column public.orders.customer":          Changed,
+		"column public.orders.placed_at":         Added,
+		"function public.total(o public.orders)": Changed,
+		"grant TABLE public.orders":              Changed,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got changes %v, want %v", got, want)
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("%s: %q, want %q", name, got[name], status)
+		}
+	}
+}
+
+// pgDumpSchema and goEngineSchema are the same database as pg_dump and the
+// Go engine write it.
+const pgDumpSchema = `SELECT pg_catalog.set_config('search_path', '', false);
+
+CREATE TYPE public.mood AS ENUM (
+    'happy',
+    'sad'
+);
+
+ALTER TYPE public.mood OWNER TO shop;
+
+CREATE DOMAIN public.positive AS integer
+	CONSTRAINT positive_check CHECK ((VALUE > 0));
+
+CREATE FUNCTION public.touch() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$BEGIN NEW.quantity = NEW.quantity; RETURN NEW; END;$$;
+
+CREATE TABLE public.users (
+    id integer NOT NULL,
+    name text NOT NULL,
+    mood public.mood
+);
+
+CREATE SEQUENCE public.users_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;
+
+CREATE TABLE public.orders (
+    id bigint NOT NULL,
+    user_id integer NOT NULL,
+    quantity public.positive NOT NULL
+);
+
+ALTER TABLE public.orders ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME public.orders_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+CREATE VIEW public.user_orders AS
+ SELECT u.name,
+    count(o.id) AS orders
+   FROM (public.users u
+     LEFT JOIN public.orders o ON ((o.user_id = u.id)))
+  GROUP BY u.name;
+
+ALTER TABLE ONLY public.users ALTER COLUMN id SET DEFAULT nextval('public.users_id_seq'::regclass);
+
+ALTER TABLE ONLY public.orders
+    ADD CONSTRAINT orders_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.users
+    ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+
+CREATE INDEX orders_user_id_idx ON public.orders USING btree (user_id);
+
+CREATE TRIGGER orders_touch BEFORE UPDATE ON public.orders FOR EACH ROW EXECUTE FUNCTION public.touch();
+
+ALTER TABLE ONLY public.orders
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id);
+`
+
+const goEngineSchema = `CREATE TYPE public.mood AS ENUM ('happy', 'sad');
+ALTER TYPE public.mood OWNER TO shop;
+
+CREATE DOMAIN public.positive AS integer CONSTRAINT positive_check CHECK ((VALUE > 0));
+ALTER DOMAIN public.positive OWNER TO shop;
+
+CREATE SEQUENCE public.users_id_seq AS integer START WITH 1 INCREMENT BY 1 NO MINVALUE NO MAXVALUE CACHE 1;
+ALTER SEQUENCE public.users_id_seq OWNER TO shop;
+
+CREATE TABLE public.orders (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY (SEQUENCE NAME public.orders_id_seq START WITH 1 INCREMENT BY 1 NO MINVALUE NO MAXVALUE CACHE 1),
+    user_id integer NOT NULL,
+    quantity public.positive NOT NULL
+);
+ALTER TABLE public.orders OWNER TO shop;
+
+CREATE TABLE public.users (
+    id integer NOT NULL,
+    name text NOT NULL,
+    mood public.mood
+);
+ALTER TABLE public.users OWNER TO shop;
+
+CREATE OR REPLACE FUNCTION public.touch()
+ RETURNS trigger
+ LANGUAGE plpgsql
+AS $function$BEGIN NEW.quantity = NEW.quantity; RETURN NEW; END;$function$;
+ALTER FUNCTION public.touch() OWNER TO shop;
+
+ALTER TABLE public.users ALTER COLUMN id SET DEFAULT nextval('public.users_id_seq'::regclass);
+
+ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;
+
+CREATE VIEW public.user_orders AS
+SELECT u.name,
+    count(o.id) AS orders
+   FROM (public.users u
+     LEFT JOIN public.orders o ON ((o.user_id = u.id)))
+  GROUP BY u.name;
+ALTER VIEW public.user_orders OWNER TO shop;
+
+ALTER TABLE public.orders ADD CONSTRAINT orders_pkey PRIMARY KEY (id);
+
+ALTER TABLE public.users ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+
+CREATE INDEX orders_user_id_idx ON public.orders USING btree (user_id);
+
+ALTER TABLE public.orders ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id);
+
+CREATE TRIGGER orders_touch BEFORE UPDATE ON public.orders FOR EACH ROW EXECUTE FUNCTION public.touch();
+`
+
+// TestDiffAcrossEngines verifies a pg_dump backup and the Go engine's read
+// of the same database show no differences.
+func TestDiffAcrossEngines(t *testing.T) {
+	for _, c := range Diff(parse(t, goEngineSchema), parse(t, pgDumpSchema)) {
+		t.Errorf("%s %s %s:\n%s\n%s", c.Kind, c.Name, c.Status, c.From, c.To)
+	}
+}
+
+func TestLines(t *testing.T) {
+	r := &Result{Backup: "shop.sql", Target: "localhost:5432/shop", Changes: Diff(parse(t, databaseSchema), parse(t, backupSchema))}
+	lines := strings.Join(r.Lines(), "\n")
+	for _, want := range []string{
+		"--- database localhost:5432/shop",
+		"+++ backup shop.sql",
+		"@@ grant TABLE public.orders (changed) @@\n GRANT SELECT ON TABLE public.orders TO reporting\n+GRANT SELECT,INSERT ON TABLE public.orders TO app",
+		"-customer text NOT NULL\n+customer character varying(200) NOT NULL",
+		"@@ table public.audit (removed) @@\n-CREATE TABLE public.audit\n-    at timestamp with time zone",
+	} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("diff is missing %q:\n%s", want, lines)
+		}
+	}
+	if same := (&Result{}); same.Lines() != nil || same.Summary() != "The schemas match." {
+		t.Errorf("empty result: %q, %q", same.Lines(), same.Summary())
+	}
+}
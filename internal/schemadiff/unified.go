@@ -0,0 +1,102 @@
+package schemadiff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// headerWidth caps the object names in hunk headers; statements are named
+// by their whole text.
+const headerWidth = 100
+
+func sortChanges(changes []Change) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if kindRank(a.Kind) != kindRank(b.Kind) {
+			return kindRank(a.Kind) < kindRank(b.Kind)
+		}
+		return a.Name < b.Name
+	})
+}
+
+// Lines renders the result as a unified diff from the database to the
+// backup, one hunk per object: lines starting with "-" are only in the
+// database, lines starting with "+" only in the backup.
+func (r *Result) Lines() []string {
+	if len(r.Changes) == 0 {
+		return nil
+	}
+	lines := []string{"--- database " + r.Target, "+++ backup " + r.Backup}
+	for _, c := range r.Changes {
+		name := strings.ReplaceAll(c.Name, "\n", " ")
+		if len(name) > headerWidth {
+			name = name[:headerWidth-3] + "..."
+		}
+		lines = append(lines, fmt.Sprintf("@@ %s %s (%s) @@", c.Kind, name, c.Status))
+		lines = append(lines, diffLines(splitLines(c.From), splitLines(c.To))...)
+	}
+	return lines
+}
+
+// WriteUnified writes the unified diff followed by the summary.
+func (r *Result) WriteUnified(w io.Writer) error {
+	for _, line := range r.Lines() {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, r.Summary())
+	return err
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines diffs two definitions line by line through their longest common
+// subsequence, comparing lines with their whitespace collapsed.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if normalize(a[i]) == normalize(b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case normalize(a[i]) == normalize(b[j]):
+			out = append(out, " "+b[j])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		out = append(out, "+"+b[j])
+	}
+	return out
+}
@@ -0,0 +1,330 @@
+// Package schemaexport writes the DDL of a database as one file per object,
+// in a directory tree meant to be kept in version control. The output is
+// deterministic: re-exporting an unchanged database rewrites no file.
+package schemaexport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+// object is one DDL entry of a dump, with unquoted names.
+type object struct {
+	kind   string // Upper case, as in pg_dump's table of contents, e.g. "TABLE" or "FK CONSTRAINT"
+	schema string // Empty for objects outside a schema
+	name   string // With the argument types for functions
+	parent string // Table, view or sequence the entry belongs to, if any
+	sql    string
+	line   int // Line of the pg_dump header the entry follows
+}
+
+// skipped kinds hold data or session state rather than schema.
+var skipped = map[string]bool{
+	"TABLE DATA": true, "SEQUENCE SET": true, "MATERIALIZED VIEW DATA": true,
+	"BLOBS": true, "LARGE OBJECT": true, "DATABASE": true, "DATABASE PROPERTIES": true,
+	"ENCODING": true, "STDSTRINGS": true, "SEARCHPATH": true,
+}
+
+// attached kinds are written into the file of the object they belong to.
+var attached = map[string]bool{
+	"DEFAULT": true, "CONSTRAINT": true, "FK CONSTRAINT": true, "FOREIGN KEY": true,
+	"INDEX": true, "TRIGGER": true, "RULE": true, "POLICY": true, "ROW SECURITY": true,
+	"SEQUENCE OWNED BY": true, "TABLE ATTACH": true, "INDEX ATTACH": true,
+	"ACL": true, "COMMENT": true, "SECURITY LABEL": true,
+}
+
+// kindDirs names the directories of the common kinds; others are named
+// after their kind.
+var kindDirs = map[string]string{
+	"TABLE":             "tables",
+	"FOREIGN TABLE":     "tables",
+	"VIEW":              "views",
+	"MATERIALIZED VIEW": "materialized_views",
+	"FUNCTION":          "functions",
+	"PROCEDURE":         "procedures",
+	"AGGREGATE":         "aggregates",
+	"SEQUENCE":          "sequences",
+	"TYPE":              "types",
+	"DOMAIN":            "domains",
+	"EXTENSION":         "extensions",
+}
+
+func kindDir(kind string) string {
+	if dir, ok := kindDirs[kind]; ok {
+		return dir
+	}
+	return strings.ReplaceAll(strings.ToLower(kind), " ", "_") + "s"
+}
+
+// Result reports what an export changed on disk.
+type Result struct {
+	Dir       string
+	Files     int      // Files in the export
+	Written   []string // Files created or changed, relative to Dir
+	Removed   []string // Files of objects that no longer exist
+	Unchanged int
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("%d files in %s: %d written, %d removed, %d unchanged",
+		r.Files, r.Dir, len(r.Written), len(r.Removed), r.Unchanged)
+}
+
+// Export dumps the schema of the database with the engine opts selects and
+// writes it into dir as <schema>/<kind>/<name>.sql. Files of objects that
+// no longer exist are removed, so dir should hold nothing but the export.
+func Export(opts pgbackup.Options, dir string) (*Result, error) {
+	var objects []object
+	var err error
+	if pgbackup.SelectEngine(opts) == pgbackup.EngineGo {
+		objects, err = readGo(opts)
+	} else {
+		objects, err = readPgDump(opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return writeTree(dir, layout(objects))
+}
+
+// readGo reads the schema through the Go engine's catalog queries.
+func readGo(opts pgbackup.Options) ([]object, error) {
+	schema, err := pgbackup.DumpSchema(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	var objects []object
+	for _, o := range schema {
+		obj := object{kind: strings.ToUpper(string(o.Kind)), schema: unquote(o.Schema), name: unquote(o.Name), sql: o.SQL}
+		switch {
+		case o.Kind == pgbackup.KindSequenceOwner:
+			obj.parent = obj.name
+		case o.Table != "":
+			obj.schema, obj.parent = splitQualified(o.Table)
+		}
+		if o.Kind == pgbackup.KindSchema {
+			obj.schema = obj.name
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// layout assigns every object to a file and returns the file contents by
+// path relative to the export directory. Objects keep their dump order
+// within a file.
+func layout(objects []object) map[string]string {
+	paths := map[string]string{} // schema and object name to the file holding it
+	key := func(schema, name string) string { return schema + "\x00" + name }
+	contents := map[string]*bytes.Buffer{}
+
+	for _, o := range objects {
+		if skipped[o.kind] {
+			continue
+		}
+		var path string
+		switch {
+		case o.kind == "SCHEMA":
+			path = filepath.Join(fileName(o.name), "schema.sql")
+		case attached[o.kind] && strings.HasPrefix(o.name, "SCHEMA "):
+			path = filepath.Join(fileName(strings.TrimPrefix(o.name, "SCHEMA ")), "schema.sql")
+		case attached[o.kind]:
+			parent := o.parent
+			if parent == "" {
+				parent = target(o)
+			}
+			path = paths[key(o.schema, parent)]
+			if path == "" && o.kind == "INDEX" {
+				path = paths[key(o.schema, indexTable(o.sql))]
+			}
+		}
+		if path == "" {
+			path = filepath.Join(fileName(o.schema), kindDir(o.kind), fileName(o.name)+".sql")
+			if o.schema == "" {
+				path = filepath.Join(kindDir(o.kind), fileName(o.name)+".sql")
+			}
+		}
+		if _, ok := paths[key(o.schema, o.name)]; !ok && (!attached[o.kind] || o.kind == "INDEX") {
+			paths[key(o.schema, o.name)] = path
+		}
+
+		b := contents[path]
+		if b == nil {
+			b = &bytes.Buffer{}
+			contents[path] = b
+		} else {
+			b.WriteString("\n")
+		}
+		b.WriteString(strings.TrimRight(o.sql, "\n") + "\n")
+	}
+
+	files := make(map[string]string, len(contents))
+	for path, b := range contents {
+		files[path] = b.String()
+	}
+	return files
+}
+
+// target returns the name of the object an ACL or comment applies to, as
+// in pg_dump's "TABLE orders" or "COLUMN orders.id".
+func target(o object) string {
+	kind, name, ok := strings.Cut(o.name, " ")
+	if !ok {
+		return o.name
+	}
+	for _, prefix := range []string{"VIEW ", "TABLE ", "SEARCH CONFIGURATION ", "SEARCH DICTIONARY "} {
+		name = strings.TrimPrefix(name, prefix) // MATERIALIZED VIEW, FOREIGN TABLE, TEXT SEARCH ...
+	}
+	if kind == "COLUMN" {
+		if i := strings.LastIndex(name, "."); i > 0 {
+			return name[:i]
+		}
+	}
+	return name
+}
+
+// indexTable returns the unqualified table a CREATE INDEX statement indexes.
+func indexTable(sql string) string {
+	words := strings.Fields(sql)
+	for i, w := range words {
+		if w != "ON" || i+1 == len(words) {
+			continue
+		}
+		table := words[i+1]
+		if table == "ONLY" && i+2 < len(words) {
+			table = words[i+2]
+		}
+		_, name := splitQualified(table)
+		return name
+	}
+	return ""
+}
+
+// ListFile lists the files the last export wrote into its directory, so the
+// next one removes only its own files.
+const ListFile = ".schema-export"
+
+// writeTree writes the files into dir, leaving files whose content did not
+// change untouched and removing the files the previous export listed that
+// are no longer part of the export.
+func writeTree(dir string, files map[string]string) (*Result, error) {
+	result := &Result{Dir: dir, Files: len(files)}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		full := filepath.Join(dir, path)
+		if old, err := os.ReadFile(full); err == nil && string(old) == files[path] {
+			result.Unchanged++
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create export directory: %w", err)
+		}
+		if err := os.WriteFile(full, []byte(files[path]), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		result.Written = append(result.Written, path)
+	}
+
+	listPath := filepath.Join(dir, ListFile)
+	previous, err := os.ReadFile(listPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", ListFile, err)
+	}
+	dirs := map[string]bool{}
+	for _, rel := range strings.Split(string(previous), "\n") {
+		// Never follow an edited list outside dir.
+		if _, ok := files[rel]; ok || rel == "" || !filepath.IsLocal(rel) {
+			continue
+		}
+		err := os.Remove(filepath.Join(dir, rel))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to remove old files: %w", err)
+		}
+		result.Removed = append(result.Removed, rel)
+		for parent := filepath.Dir(rel); parent != "."; parent = filepath.Dir(parent) {
+			dirs[parent] = true
+		}
+	}
+	// Deepest first, so emptied parents go too. Non-empty ones fail and stay.
+	emptied := make([]string, 0, len(dirs))
+	for d := range dirs {
+		emptied = append(emptied, d)
+	}
+	sort.Slice(emptied, func(i, j int) bool { return len(emptied[i]) > len(emptied[j]) })
+	for _, d := range emptied {
+		os.Remove(filepath.Join(dir, d))
+	}
+
+	list := strings.Join(paths, "\n") + "\n"
+	if string(previous) != list {
+		if err := os.WriteFile(listPath, []byte(list), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", ListFile, err)
+		}
+	}
+	return result, nil
+}
+
+// fileName turns an object name into a portable file name: argument lists
+// lose their spaces and characters that are unsafe in paths become "_".
+func fileName(name string) string {
+	name = strings.ReplaceAll(name, ", ", ",")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(` /\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// unquote removes the double quotes of quoted identifiers in name, leaving
+// any argument list as it is.
+func unquote(name string) string {
+	var b strings.Builder
+	inQuote := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '"' && inQuote && i+1 < len(name) && name[i+1] == '"':
+			b.WriteByte('"')
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// splitQualified splits a possibly quoted "schema.name" and unquotes both.
+func splitQualified(qualified string) (schema, name string) {
+	inQuote := false
+	for i := 0; i < len(qualified); i++ {
+		switch qualified[i] {
+		case '"':
+			inQuote = !inQuote
+		case '.':
+			if !inQuote {
+				return unquote(qualified[:i]), unquote(qualified[i+1:])
+			}
+		}
+	}
+	return "", unquote(qualified)
+}
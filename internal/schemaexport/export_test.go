@@ -0,0 +1,186 @@
+package schemaexport
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const pgDumpScript = `--
+-- PostgreSQL database dump
+--
+
+\restrict 3yQ8cUaYfTq0wRZ
+
+-- Dumped from database version 16.4
+-- Dumped by pg_dump version 17.6
+
+SET statement_timeout = 0;
+SELECT pg_catalog.set_config('search_path', '', false);
+
+--
+-- Name: billing; Type: SCHEMA; Schema: -; Owner: shop
+--
+
+CREATE SCHEMA billing;
+
+
+ALTER SCHEMA billing OWNER TO shop;
+
+--
+-- Name: add(integer, integer); Type: FUNCTION; Schema: public; Owner: shop
+--
+
+CREATE FUNCTION public.add(a integer, b integer) RETURNS integer
+    LANGUAGE sql
+    AS $$
+-- adds
+SELECT a + b;
+$$;
+
+SET default_tablespace = '';
+
+--
+-- Name: orders; Type: TABLE; Schema: public; Owner: shop
+--
+
+CREATE TABLE public.orders (
+    id integer NOT NULL,
+    total numeric
+);
+
+
+ALTER TABLE public.orders OWNER TO shop;
+
+--
+-- Name: orders id; Type: DEFAULT; Schema: public; Owner: shop
+--
+
+ALTER TABLE ONLY public.orders ALTER COLUMN id SET DEFAULT nextval('public.orders_id_seq'::regclass);
+
+--
+-- Name: orders orders_pkey; Type: CONSTRAINT; Schema: public; Owner: shop
+--
+
+ALTER TABLE ONLY public.orders
+    ADD CONSTRAINT orders_pkey PRIMARY KEY (id);
+
+--
+-- Name: orders_total_idx; Type: INDEX; Schema: public; Owner: shop
+--
+
+CREATE INDEX orders_total_idx ON public.orders USING btree (total);
+
+--
+-- Name: TABLE orders; Type: ACL; Schema: public; Owner: shop
+--
+
+GRANT SELECT ON TABLE public.orders TO reporting;
+
+--
+-- Name: SCHEMA billing; Type: ACL; Schema: -; Owner: shop
+--
+
+GRANT USAGE ON SCHEMA billing TO reporting;
+
+--
+-- PostgreSQL database dump complete
+--
+
+\unrestrict 3yQ8cUaYfTq0wRZ
+`
+
+func TestLayout(t *testing.T) {
+	objects, err := parseDump([]byte(pgDumpScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := layout(objects)
+
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	want := []string{
+		filepath.Join("billing", "schema.sql"),
+		filepath.Join("public", "functions", "add(integer,integer).sql"),
+		filepath.Join("public", "tables", "orders.sql"),
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("files %q, want %q", paths, want)
+	}
+
+	orders := files[filepath.Join("public", "tables", "orders.sql")]
+	wantOrders := `CREATE TABLE public.orders (
+    id integer NOT NULL,
+    total numeric
+);
+ALTER TABLE public.orders OWNER TO shop;
+
+ALTER TABLE ONLY public.orders ALTER COLUMN id SET DEFAULT nextval('public.orders_id_seq'::regclass);
+
+ALTER TABLE ONLY public.orders
+    ADD CONSTRAINT orders_pkey PRIMARY KEY (id);
+
+CREATE INDEX orders_total_idx ON public.orders USING btree (total);
+
+GRANT SELECT ON TABLE public.orders TO reporting;
+`
+	if orders != wantOrders {
+		t.Errorf("orders.sql:\n%s\nwant:\n%s", orders, wantOrders)
+	}
+	if add := files[filepath.Join("public", "functions", "add(integer,integer).sql")]; !strings.Contains(add, "-- adds\n") {
+		t.Errorf("the function lost its body comment:\n%s", add)
+	}
+	for path, content := range files {
+		if strings.Contains(content, "restrict") || strings.Contains(content, "Dumped") || strings.Contains(content, "SET default_tablespace") {
+			t.Errorf("%s holds volatile content:\n%s", path, content)
+		}
+	}
+}
+
+func TestWriteTree(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"public/tables/orders.sql":   "CREATE TABLE public.orders ();\n",
+		"public/tables/old.sql":      "CREATE TABLE public.old ();\n",
+		"public/views/old_view.sql":  "CREATE VIEW public.old_view AS SELECT 1;\n",
+		"public/functions/add().sql": "CREATE FUNCTION public.add() RETURNS integer LANGUAGE sql AS 'SELECT 1';\n",
+	}
+	if _, err := writeTree(dir, files); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("schema\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// SQL files the export did not write, such as migrations, are kept.
+	if err := os.WriteFile(filepath.Join(dir, "public", "tables", "001_migration.sql"), []byte("ALTER TABLE public.orders;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(files, "public/tables/old.sql")
+	delete(files, "public/views/old_view.sql")
+	result, err := writeTree(dir, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Written) != 0 || result.Unchanged != 2 || len(result.Removed) != 2 {
+		t.Errorf("second export: %s, written %q, removed %q", result, result.Written, result.Removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "public", "views")); !os.IsNotExist(err) {
+		t.Errorf("the emptied views directory was kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "README.md")); err != nil {
+		t.Errorf("a file that is not SQL was removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "public", "tables", "001_migration.sql")); err != nil {
+		t.Errorf("a file the export did not write was removed: %v", err)
+	}
+	if list, _ := os.ReadFile(filepath.Join(dir, ListFile)); string(list) != "public/functions/add().sql\npublic/tables/orders.sql\n" {
+		t.Errorf("unexpected file list %q", list)
+	}
+}
@@ -0,0 +1,140 @@
+package schemaexport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+)
+
+// readPgDump reads the schema with pg_dump --schema-only.
+func readPgDump(opts pgbackup.Options) ([]object, error) {
+	binary, err := pgbackup.ResolveDumpBinary(opts)
+	if err != nil {
+		return nil, err
+	}
+	cmd := pgbackup.PrepareDumpCommand(binary.Path, opts.Host, opts.Port, opts.User, opts.Password, opts.DBName, "")
+	cmd.Args = append(cmd.Args, "--schema-only")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pg_dump failed: %s: %w", bytes.TrimSpace(stderr.Bytes()), err)
+	}
+	return parseDump(stdout.Bytes())
+}
+
+// header is a table of contents comment of a pg_dump script:
+// "-- Name: orders; Type: TABLE; Schema: public; Owner: shop".
+type header struct {
+	line         int
+	kind, schema string
+	name         string
+}
+
+func parseHeader(line string) (header, bool) {
+	if !strings.HasPrefix(line, "-- Name: ") {
+		return header{}, false
+	}
+	var h header
+	for _, field := range strings.Split(strings.TrimPrefix(line, "-- "), "; ") {
+		key, value, _ := strings.Cut(field, ": ")
+		switch key {
+		case "Name":
+			h.name = value
+		case "Type":
+			h.kind = value
+		case "Schema":
+			if value != "-" {
+				h.schema = value
+			}
+		}
+	}
+	return h, h.kind != ""
+}
+
+// parseDump splits a pg_dump schema script into its entries by their table
+// of contents comments. The script's own comments, session settings and
+// psql meta-commands, which hold the dump's version and random keys, are
+// left out.
+func parseDump(script []byte) ([]object, error) {
+	var headers []header
+	for i, line := range strings.Split(string(script), "\n") {
+		if h, ok := parseHeader(strings.TrimRight(line, "\r")); ok {
+			h.line = i + 1
+			headers = append(headers, h)
+		}
+	}
+
+	var objects []object
+	relations := map[string][]string{} // by schema, to find the table of "table constraint" names
+	r := pgrestore.NewScriptReader(bytes.NewReader(script))
+	next := 0 // index of the first header after the current entry's
+	for {
+		stmt, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pg_dump output: %w", err)
+		}
+		if stmt.IsCopyFromStdin() {
+			if _, err := io.Copy(io.Discard, r.CopyData()); err != nil {
+				return nil, fmt.Errorf("failed to read pg_dump output: %w", err)
+			}
+			continue
+		}
+		for next < len(headers) && headers[next].line < stmt.Line {
+			next++
+		}
+		if stmt.Meta || next == 0 || isSessionSetting(stmt.SQL) {
+			continue
+		}
+
+		// Entries can have several statements, e.g. a table and its OWNER TO.
+		h := headers[next-1]
+		if len(objects) > 0 && objects[len(objects)-1].line == h.line {
+			objects[len(objects)-1].sql += "\n" + stmt.SQL
+			continue
+		}
+		o := object{kind: h.kind, schema: h.schema, name: h.name, sql: stmt.SQL, line: h.line}
+		switch h.kind {
+		case "SCHEMA":
+			o.schema = h.name
+		case "TABLE", "FOREIGN TABLE", "VIEW", "MATERIALIZED VIEW":
+			relations[h.schema] = append(relations[h.schema], h.name)
+		case "DEFAULT", "CONSTRAINT", "FK CONSTRAINT", "TRIGGER", "RULE", "POLICY":
+			o.parent = owningRelation(relations[h.schema], h.name)
+		case "ROW SECURITY", "SEQUENCE OWNED BY", "TABLE ATTACH":
+			o.parent = h.name
+		}
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
+
+// owningRelation finds the relation a "table name" entry belongs to, the
+// longest known relation name its name starts with.
+func owningRelation(relations []string, name string) string {
+	parent := ""
+	for _, rel := range relations {
+		if strings.HasPrefix(name, rel+" ") && len(rel) > len(parent) {
+			parent = rel
+		}
+	}
+	if parent == "" {
+		parent, _, _ = strings.Cut(name, " ")
+	}
+	return parent
+}
+
+// isSessionSetting reports whether a statement only configures the
+// restoring session.
+func isSessionSetting(sql string) bool {
+	upper := strings.ToUpper(sql)
+	return strings.HasPrefix(upper, "SET ") || strings.HasPrefix(upper, "SELECT PG_CATALOG.SET_CONFIG(")
+}
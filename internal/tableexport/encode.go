@@ -0,0 +1,396 @@
+package tableexport
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// kind is how a column's text values are written.
+type kind int
+
+const (
+	kindText kind = iota
+	kindBool
+	kindNumber
+	kindJSON
+	kindBytea
+	kindTimestamp // timestamptz
+	kindArray
+)
+
+// column is a result column and how to write its values.
+type column struct {
+	name  string
+	kind  kind
+	elem  kind // Kind of the elements of an array
+	delim byte // Element delimiter of the type, or of its elements for an array
+}
+
+// encoder writes rows of text values, nil for NULL, in one format.
+type encoder interface {
+	// header appends what starts every file, nil if nothing.
+	header(b []byte, columns []column) []byte
+	// row appends one row, including its line end.
+	row(b []byte, columns []column, values [][]byte) ([]byte, error)
+}
+
+func newEncoder(f Format) encoder {
+	switch f {
+	case TSV:
+		return tsvEncoder{}
+	case JSONLines:
+		return jsonEncoder{}
+	default:
+		return csvEncoder{}
+	}
+}
+
+// flatValue converts a value for the delimited formats: bytea is base64
+// encoded, everything else is kept in PostgreSQL's text form, so arrays
+// stay array literals.
+func flatValue(c column, v []byte) ([]byte, error) {
+	if c.kind == kindBytea {
+		s, err := byteaBase64(string(v))
+		return []byte(s), err
+	}
+	return v, nil
+}
+
+type csvEncoder struct{}
+
+func (csvEncoder) header(b []byte, columns []column) []byte {
+	for i, c := range columns {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendCSVField(b, []byte(c.name))
+	}
+	return append(b, '\n')
+}
+
+func (csvEncoder) row(b []byte, columns []column, values [][]byte) ([]byte, error) {
+	for i, v := range values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if v == nil {
+			continue
+		}
+		v, err := flatValue(columns[i], v)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", columns[i].name, err)
+		}
+		b = appendCSVField(b, v)
+	}
+	return append(b, '\n'), nil
+}
+
+// appendCSVField appends a non-NULL field, quoting it when it is empty, so
+// it differs from NULL, or holds a delimiter, quote or line break.
+func appendCSVField(b, v []byte) []byte {
+	if len(v) > 0 && !bytes.ContainsAny(v, ",\"\r\n") {
+		return append(b, v...)
+	}
+	b = append(b, '"')
+	b = append(b, bytes.ReplaceAll(v, []byte(`"`), []byte(`""`))...)
+	return append(b, '"')
+}
+
+type tsvEncoder struct{}
+
+func (tsvEncoder) header(b []byte, columns []column) []byte {
+	for i, c := range columns {
+		if i > 0 {
+			b = append(b, '\t')
+		}
+		b = appendTSVField(b, []byte(c.name))
+	}
+	return append(b, '\n')
+}
+
+func (tsvEncoder) row(b []byte, columns []column, values [][]byte) ([]byte, error) {
+	for i, v := range values {
+		if i > 0 {
+			b = append(b, '\t')
+		}
+		if v == nil {
+			b = append(b, `\N`...)
+			continue
+		}
+		v, err := flatValue(columns[i], v)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", columns[i].name, err)
+		}
+		b = appendTSVField(b, v)
+	}
+	return append(b, '\n'), nil
+}
+
+// appendTSVField appends a field escaped as in COPY's text format.
+func appendTSVField(b, v []byte) []byte {
+	for _, c := range v {
+		switch c {
+		case '\\':
+			b = append(b, `\\`...)
+		case '\t':
+			b = append(b, `\t`...)
+		case '\n':
+			b = append(b, `\n`...)
+		case '\r':
+			b = append(b, `\r`...)
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) header(b []byte, columns []column) []byte {
+	return b
+}
+
+func (jsonEncoder) row(b []byte, columns []column, values [][]byte) ([]byte, error) {
+	b = append(b, '{')
+	for i, v := range values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		c := columns[i]
+		b = appendJSONString(b, c.name)
+		b = append(b, ':')
+		var err error
+		switch {
+		case v == nil:
+			b = append(b, "null"...)
+		case c.kind == kindArray:
+			var arr any
+			if arr, err = parseArray(string(v), c.delim); err == nil {
+				b, err = appendJSONArray(b, arr, c.elem)
+			}
+		default:
+			b, err = appendJSONValue(b, c.kind, string(v))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.name, err)
+		}
+	}
+	return append(b, "}\n"...), nil
+}
+
+// appendJSONValue appends the JSON form of a non-NULL scalar value.
+func appendJSONValue(b []byte, k kind, s string) ([]byte, error) {
+	switch k {
+	case kindBool:
+		if s == "t" {
+			return append(b, "true"...), nil
+		}
+		return append(b, "false"...), nil
+	case kindNumber:
+		// JSON has no NaN or infinities. Numbers are written as PostgreSQL
+		// prints them, so numeric and bigint keep their precision.
+		if s == "NaN" || s == "Infinity" || s == "-Infinity" {
+			return appendJSONString(b, s), nil
+		}
+		return append(b, s...), nil
+	case kindJSON:
+		// json keeps its input's line breaks, which JSON Lines cannot hold.
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(s)); err != nil {
+			return nil, fmt.Errorf("invalid JSON value: %w", err)
+		}
+		return append(b, buf.Bytes()...), nil
+	case kindBytea:
+		s, err := byteaBase64(s)
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONString(b, s), nil
+	case kindTimestamp:
+		return appendJSONString(b, rfc3339(s)), nil
+	default:
+		return appendJSONString(b, s), nil
+	}
+}
+
+// appendJSONArray appends an array parsed by parseArray.
+func appendJSONArray(b []byte, v any, elem kind) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case string:
+		return appendJSONValue(b, elem, v)
+	case []any:
+		b = append(b, '[')
+		for i, item := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = appendJSONArray(b, item, elem); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, ']'), nil
+	}
+	return nil, fmt.Errorf("unexpected array element %T", v)
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	quoted, _ := json.Marshal(s) // Cannot fail for a string
+	return append(b, quoted...)
+}
+
+// byteaBase64 converts a bytea in hex output format, "\x0a1b", to base64.
+func byteaBase64(s string) (string, error) {
+	if !strings.HasPrefix(s, `\x`) {
+		return "", fmt.Errorf("bytea value is not in hex format")
+	}
+	data, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return "", fmt.Errorf("invalid bytea value: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// rfc3339 turns a timestamptz printed in the ISO DateStyle, e.g.
+// "2024-03-01 12:30:00.5+00", into RFC 3339: "2024-03-01T12:30:00.5+00:00".
+// Values RFC 3339 cannot express, infinities and BC dates, are returned as
+// they are.
+func rfc3339(s string) string {
+	if len(s) < 22 || s[10] != ' ' || strings.HasSuffix(s, " BC") {
+		return s
+	}
+	offset := strings.LastIndexAny(s[19:], "+-")
+	if offset < 0 {
+		return s
+	}
+	offset += 19
+	zone := s[offset:]
+	if len(zone) == 3 {
+		zone += ":00"
+	}
+	return s[:10] + "T" + s[11:offset] + zone
+}
+
+// parseArray parses PostgreSQL's text output of an array. Arrays become
+// []any, elements string, and NULL elements nil.
+func parseArray(s string, delim byte) (any, error) {
+	if strings.HasPrefix(s, "[") { // Explicit bounds: "[0:1]={a,b}"
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid array %q", s)
+		}
+		s = s[i+1:]
+	}
+	p := arrayParser{s: s, delim: delim}
+	v, err := p.array()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(s) {
+		return nil, fmt.Errorf("invalid array %q: trailing characters", s)
+	}
+	return v, nil
+}
+
+type arrayParser struct {
+	s     string
+	pos   int
+	delim byte
+}
+
+func (p *arrayParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid array %q at offset %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *arrayParser) array() ([]any, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '{' {
+		return nil, p.errorf("expected {")
+	}
+	p.pos++
+	items := []any{}
+	if p.pos < len(p.s) && p.s[p.pos] == '}' {
+		p.pos++
+		return items, nil
+	}
+	for {
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("unterminated array")
+		}
+		var item any
+		switch p.s[p.pos] {
+		case '{':
+			sub, err := p.array()
+			if err != nil {
+				return nil, err
+			}
+			item = sub
+		case '"':
+			s, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			item = s
+		default:
+			if s := p.unquoted(); !strings.EqualFold(s, "NULL") {
+				item = s
+			}
+		}
+		items = append(items, item)
+
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.s[p.pos] {
+		case p.delim:
+			p.pos++
+		case '}':
+			p.pos++
+			return items, nil
+		default:
+			return nil, p.errorf("expected %q or }", p.delim)
+		}
+	}
+}
+
+func (p *arrayParser) quoted() (string, error) {
+	p.pos++ // Opening quote
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == '"':
+			return b.String(), nil
+		case c == '\\' && p.pos < len(p.s):
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated quoted element")
+}
+
+func (p *arrayParser) unquoted() string {
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == p.delim || c == '}' {
+			break
+		}
+		p.pos++
+		if c == '\\' && p.pos < len(p.s) {
+			c = p.s[p.pos]
+			p.pos++
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
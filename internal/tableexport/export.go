@@ -0,0 +1,322 @@
+// Package tableexport streams tables or the result of a query out of a
+// database as CSV, TSV or JSON Lines files, optionally compressed and split
+// by size. All sources are read in one snapshot.
+package tableexport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/jackc/pgx/v5"
+)
+
+// Format is the file format rows are written in.
+type Format string
+
+const (
+	// CSV writes RFC 4180 CSV with a header row. NULL is an empty unquoted
+	// field, an empty string is "".
+	CSV Format = "csv"
+	// TSV writes PostgreSQL's COPY text format with a header row: tab
+	// separated, backslash escaped, NULL as \N.
+	TSV Format = "tsv"
+	// JSONLines writes one JSON object per row, keyed by column name.
+	JSONLines Format = "jsonl"
+)
+
+// ParseFormat converts a user-supplied format name.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "csv":
+		return CSV, nil
+	case "tsv":
+		return TSV, nil
+	case "jsonl", "json-lines", "ndjson":
+		return JSONLines, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q, expected csv, tsv or jsonl", s)
+	}
+}
+
+// Compression selects how export files are compressed.
+type Compression string
+
+const (
+	// NoCompression writes plain files.
+	NoCompression Compression = ""
+	// Gzip writes .gz files.
+	Gzip Compression = "gzip"
+	// Zstd writes .zst files.
+	Zstd Compression = "zstd"
+)
+
+// ParseCompression converts a user-supplied compression name.
+func ParseCompression(s string) (Compression, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return NoCompression, nil
+	case "gzip", "gz":
+		return Gzip, nil
+	case "zstd", "zst":
+		return Zstd, nil
+	default:
+		return "", fmt.Errorf("unknown compression %q, expected none, gzip or zstd", s)
+	}
+}
+
+// Source is one table or query to export.
+type Source struct {
+	Name  string // Base name of the output files
+	Table string // Table to export, as "schema.table" or "table"
+	Query string // SELECT to export instead of a table
+}
+
+// TableSource exports a whole table into files named after it.
+func TableSource(table string) Source {
+	return Source{Name: table, Table: table}
+}
+
+// sql returns the query that reads the source's rows.
+func (s Source) sql() string {
+	if s.Query != "" {
+		return s.Query
+	}
+	ident := pgx.Identifier{s.Table}
+	if schema, name, ok := strings.Cut(s.Table, "."); ok {
+		ident = pgx.Identifier{schema, name}
+	}
+	return "SELECT * FROM " + ident.Sanitize()
+}
+
+// Options configures an export.
+type Options struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DBName   string
+
+	Sources     []Source
+	Format      Format
+	Compression Compression
+	// SplitSize starts a new file once a file holds this many bytes of
+	// uncompressed rows. Files are then numbered, e.g. orders-00001.csv.
+	// Zero writes one file per source.
+	SplitSize int64
+
+	Dir string // Directory the files are written into
+	// Stdout receives the rows of the only source instead of a file in
+	// Dir. It cannot be split.
+	Stdout io.Writer
+}
+
+// SourceResult reports what was exported from one source.
+type SourceResult struct {
+	Name  string
+	Rows  int64
+	Bytes int64    // Bytes written, after compression
+	Files []string // Files written, empty when writing to Stdout
+}
+
+// Result reports what an export wrote.
+type Result struct {
+	Sources []SourceResult
+}
+
+// Bytes returns the bytes written for all sources.
+func (r *Result) Bytes() int64 {
+	var n int64
+	for _, s := range r.Sources {
+		n += s.Bytes
+	}
+	return n
+}
+
+// Export writes every source of opts in the selected format. The sources
+// are read in one REPEATABLE READ snapshot, so they are consistent with each
+// other like the tables of a backup.
+func Export(ctx context.Context, opts Options) (*Result, error) {
+	if len(opts.Sources) == 0 {
+		return nil, fmt.Errorf("nothing to export: no table or query given")
+	}
+	if opts.Stdout != nil && (len(opts.Sources) > 1 || opts.SplitSize > 0) {
+		return nil, fmt.Errorf("only a single unsplit source can be written to standard output")
+	}
+
+	conn, err := pgx.Connect(ctx, pgbackup.ConnString(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start snapshot: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	// Values are read as text, so fix the settings that change their form.
+	for _, setting := range []string{
+		"SET LOCAL DateStyle = 'ISO, YMD'",
+		"SET LOCAL IntervalStyle = 'postgres'",
+		"SET LOCAL TimeZone = 'UTC'",
+		"SET LOCAL bytea_output = 'hex'",
+		"SET LOCAL extra_float_digits = 3",
+	} {
+		if _, err := tx.Exec(ctx, setting); err != nil {
+			return nil, fmt.Errorf("failed to configure session: %w", err)
+		}
+	}
+
+	result := &Result{}
+	types := &typeResolver{tx: tx, cache: map[uint32]column{}}
+	for _, src := range opts.Sources {
+		r, err := exportSource(ctx, tx, types, opts, src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", src.Name, err)
+		}
+		result.Sources = append(result.Sources, r)
+	}
+	return result, tx.Commit(ctx)
+}
+
+// exportSource streams the rows of one source into its output files.
+func exportSource(ctx context.Context, tx pgx.Tx, types *typeResolver, opts Options, src Source) (SourceResult, error) {
+	sql := src.sql()
+	// Describe the query first: the column types are looked up in the
+	// catalog, which cannot be queried while the rows are streaming.
+	desc, err := tx.Conn().PgConn().Prepare(ctx, "", sql, nil)
+	if err != nil {
+		return SourceResult{}, err
+	}
+	columns := make([]column, len(desc.Fields))
+	for i, f := range desc.Fields {
+		if columns[i], err = types.resolve(ctx, f.DataTypeOID); err != nil {
+			return SourceResult{}, err
+		}
+		columns[i].name = f.Name
+	}
+
+	enc := newEncoder(opts.Format)
+	out := newOutput(opts, src.Name, enc.header(nil, columns))
+	// The simple protocol returns every value in its text form.
+	rows, err := tx.Query(ctx, sql, pgx.QueryExecModeSimpleProtocol)
+	if err != nil {
+		return SourceResult{}, err
+	}
+	defer rows.Close()
+
+	var buf []byte
+	var count int64
+	for rows.Next() {
+		if buf, err = enc.row(buf[:0], columns, rows.RawValues()); err != nil {
+			return SourceResult{}, fmt.Errorf("row %d: %w", count+1, err)
+		}
+		if err := out.write(buf); err != nil {
+			out.close()
+			return SourceResult{}, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		out.close()
+		return SourceResult{}, err
+	}
+	if err := out.close(); err != nil {
+		return SourceResult{}, err
+	}
+	return SourceResult{Name: src.Name, Rows: count, Bytes: out.bytes, Files: out.files}, nil
+}
+
+// typeResolver classifies column types by reading pg_type, unwrapping
+// domains and arrays.
+type typeResolver struct {
+	tx    pgx.Tx
+	cache map[uint32]column
+}
+
+func (r *typeResolver) resolve(ctx context.Context, oid uint32) (column, error) {
+	if c, ok := r.cache[oid]; ok {
+		return c, nil
+	}
+	var typtype, typname, delim string
+	var base, elem uint32
+	var isArray bool
+	err := r.tx.QueryRow(ctx, `
+		SELECT t.typtype::text, t.typname, t.typdelim::text, t.typbasetype, t.typelem,
+		       EXISTS (SELECT 1 FROM pg_catalog.pg_type e WHERE e.oid = t.typelem AND e.typarray = t.oid)
+		FROM pg_catalog.pg_type t
+		WHERE t.oid = $1`, oid).Scan(&typtype, &typname, &delim, &base, &elem, &isArray)
+	if err != nil {
+		return column{}, fmt.Errorf("failed to look up type %d: %w", oid, err)
+	}
+
+	var c column
+	switch {
+	case typtype == "d":
+		c, err = r.resolve(ctx, base)
+	case isArray:
+		var e column
+		e, err = r.resolve(ctx, elem)
+		c = column{kind: kindArray, elem: e.kind, delim: e.delim}
+	default:
+		c = column{kind: kindOf(typname), delim: ','}
+		if len(delim) == 1 {
+			c.delim = delim[0]
+		}
+	}
+	if err != nil {
+		return column{}, err
+	}
+	r.cache[oid] = c
+	return c, nil
+}
+
+// kindOf classifies a base type by name.
+func kindOf(typname string) kind {
+	switch typname {
+	case "bool":
+		return kindBool
+	case "int2", "int4", "int8", "oid", "float4", "float8", "numeric":
+		return kindNumber
+	case "json", "jsonb":
+		return kindJSON
+	case "bytea":
+		return kindBytea
+	case "timestamptz":
+		return kindTimestamp
+	default:
+		return kindText
+	}
+}
+
+// ListTables returns the tables, views and materialized views of the
+// database as "schema.name", for picking what to export. Partitions are
+// left out, exporting their parent includes their rows.
+func ListTables(ctx context.Context, opts Options) ([]string, error) {
+	conn, err := pgx.Connect(ctx, pgbackup.ConnString(opts.Host, opts.Port, opts.User, opts.Password, opts.DBName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	rows, err := conn.Query(ctx, `
+		SELECT n.nspname || '.' || c.relname
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f')
+		  AND NOT c.relispartition
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		  AND n.nspname NOT LIKE 'pg\_toast%'
+		ORDER BY n.nspname, c.relname`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	tables, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	return tables, nil
+}
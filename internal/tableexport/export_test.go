@@ -0,0 +1,184 @@
+package tableexport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testColumns = []column{
+	{name: "id", kind: kindNumber},
+	{name: "note", kind: kindText},
+	{name: "tags", kind: kindArray, elem: kindText, delim: ','},
+	{name: "payload", kind: kindJSON},
+	{name: "blob", kind: kindBytea},
+	{name: "seen_at", kind: kindTimestamp},
+	{name: "scores", kind: kindArray, elem: kindNumber, delim: ','},
+}
+
+var testRow = [][]byte{
+	[]byte("42"),
+	[]byte("line one\nsaid \"hi\", then\ttabbed"),
+	[]byte(`{a,"b c",NULL,"NULL","q\"x"}`),
+	[]byte("{\"k\": [1, 2],\n \"s\": \"v\"}"),
+	[]byte(`\x68656c6c6f`),
+	[]byte("2024-03-01 12:30:00.5+00"),
+	[]byte("{{1,NaN},{NULL,2.50}}"),
+}
+
+func TestEncoders(t *testing.T) {
+	tests := []struct {
+		format Format
+		header string
+		row    string
+		empty  string // id NULL, note empty
+	}{
+		{
+			format: CSV,
+			header: "id,note,tags,payload,blob,seen_at,scores\n",
+			row:    "42,\"line one\nsaid \"\"hi\"\", then\ttabbed\",\"{a,\"\"b c\"\",NULL,\"\"NULL\"\",\"\"q\\\"\"x\"\"}\",\"{\"\"k\"\": [1, 2],\n \"\"s\"\": \"\"v\"\"}\",aGVsbG8=,2024-03-01 12:30:00.5+00,\"{{1,NaN},{NULL,2.50}}\"\n",
+			empty:  ",\"\",,,,,\n",
+		},
+		{
+			format: TSV,
+			header: "id\tnote\ttags\tpayload\tblob\tseen_at\tscores\n",
+			row:    "42\tline one\\nsaid \"hi\", then\\ttabbed\t{a,\"b c\",NULL,\"NULL\",\"q\\\\\"x\"}\t{\"k\": [1, 2],\\n \"s\": \"v\"}\taGVsbG8=\t2024-03-01 12:30:00.5+00\t{{1,NaN},{NULL,2.50}}\n",
+			empty:  "\\N\t\t\\N\t\\N\t\\N\t\\N\t\\N\n",
+		},
+		{
+			format: JSONLines,
+			row:    `{"id":42,"note":"line one\nsaid \"hi\", then\ttabbed","tags":["a","b c",null,"NULL","q\"x"],"payload":{"k":[1,2],"s":"v"},"blob":"aGVsbG8=","seen_at":"2024-03-01T12:30:00.5+00:00","scores":[[1,"NaN"],[null,2.50]]}` + "\n",
+			empty:  `{"id":null,"note":"","tags":null,"payload":null,"blob":null,"seen_at":null,"scores":null}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		enc := newEncoder(tt.format)
+		if got := string(enc.header(nil, testColumns)); got != tt.header {
+			t.Errorf("%s header %q, want %q", tt.format, got, tt.header)
+		}
+		got, err := enc.row(nil, testColumns, testRow)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if string(got) != tt.row {
+			t.Errorf("%s row:\n%s\nwant:\n%s", tt.format, got, tt.row)
+		}
+		got, err = enc.row(nil, testColumns, [][]byte{nil, {}, nil, nil, nil, nil, nil})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if string(got) != tt.empty {
+			t.Errorf("%s NULL and empty row %q, want %q", tt.format, got, tt.empty)
+		}
+	}
+}
+
+func TestParseArray(t *testing.T) {
+	tests := []struct {
+		in    string
+		delim byte
+		want  any
+	}{
+		{"{}", ',', []any{}},
+		{`{1,2,NULL}`, ',', []any{"1", "2", nil}},
+		{`{{"a,b","\\"},{"",null}}`, ',', []any{[]any{"a,b", `\`}, []any{"", nil}}},
+		{"[0:1]={x,y}", ',', []any{"x", "y"}},
+		{"{(1,1),(0,0);(2,2),(1,1)}", ';', []any{"(1,1),(0,0)", "(2,2),(1,1)"}},
+	}
+	for _, tt := range tests {
+		got, err := parseArray(tt.in, tt.delim)
+		if err != nil {
+			t.Errorf("parseArray(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseArray(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "{a", `{"a}`, "{a}b", "{a b"} {
+		if _, err := parseArray(bad, ','); err == nil {
+			t.Errorf("parseArray(%q) did not fail", bad)
+		}
+	}
+}
+
+func TestRFC3339(t *testing.T) {
+	tests := map[string]string{
+		"2024-03-01 12:30:00+00":        "2024-03-01T12:30:00+00:00",
+		"2024-03-01 12:30:00.123456-05": "2024-03-01T12:30:00.123456-05:00",
+		"2024-03-01 12:30:00+05:30":     "2024-03-01T12:30:00+05:30",
+		"infinity":                      "infinity",
+		"0044-03-15 12:00:00+00 BC":     "0044-03-15 12:00:00+00 BC",
+	}
+	for in, want := range tests {
+		if got := rfc3339(in); got != want {
+			t.Errorf("rfc3339(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestOutputSplit(t *testing.T) {
+	dir := t.TempDir()
+	out := newOutput(Options{Dir: dir, Format: CSV, Compression: Gzip, SplitSize: 10}, "public.orders", []byte("id\n"))
+	for _, row := range []string{"1\n", "2\n", "3\n", "4444444444444\n", "5\n"} {
+		if err := out.write([]byte(row)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"id\n1\n2\n3\n", "id\n4444444444444\n", "id\n5\n"}
+	if len(out.files) != len(want) {
+		t.Fatalf("files %q, want %d", out.files, len(want))
+	}
+	for i, path := range out.files {
+		if base := filepath.Base(path); base != []string{"public.orders-00001.csv.gz", "public.orders-00002.csv.gz", "public.orders-00003.csv.gz"}[i] {
+			t.Errorf("file %d named %s", i, base)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(gz)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want[i] {
+			t.Errorf("file %d holds %q, want %q", i+1, data, want[i])
+		}
+	}
+
+	var stdout bytes.Buffer
+	empty := newOutput(Options{Format: TSV, Stdout: &stdout}, "query", []byte("n\n"))
+	if err := empty.close(); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "n\n" || len(empty.files) != 0 {
+		t.Errorf("an empty result wrote %q to files %q", stdout.String(), empty.files)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{"500": 500, "64K": 64 << 10, "100MB": 100 << 20, "1GiB": 1 << 30, "2 mb": 2 << 20}
+	for in, want := range tests {
+		if got, err := ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "MB", "-1K", "1.5G"} {
+		if _, err := ParseSize(bad); err == nil {
+			t.Errorf("ParseSize(%q) did not fail", bad)
+		}
+	}
+}
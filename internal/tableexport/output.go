@@ -0,0 +1,197 @@
+package tableexport
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// output writes the encoded rows of one source to its files, starting a
+// new file whenever the current one reaches the split size.
+type output struct {
+	opts   Options
+	name   string
+	header []byte
+
+	file    *os.File      // Current file, nil when writing to Stdout
+	buf     *bufio.Writer // Buffers writes to file
+	w       io.Writer     // Where rows go, through the compressor
+	closer  io.Closer     // The compressor, if any
+	size    int64         // Uncompressed bytes in the current file
+	rows    int           // Rows in the current file
+	part    int           // Number of the current file, from 1
+	files   []string
+	bytes   int64 // Bytes written to all files, after compression
+	started bool
+}
+
+func newOutput(opts Options, name string, header []byte) *output {
+	return &output{opts: opts, name: name, header: header}
+}
+
+// extension returns the file extension of the format and compression.
+func extension(f Format, c Compression) string {
+	ext := "." + string(f)
+	switch c {
+	case Gzip:
+		ext += ".gz"
+	case Zstd:
+		ext += ".zst"
+	}
+	return ext
+}
+
+// path returns the path of the current file.
+func (o *output) path() string {
+	name := fileName(o.name)
+	if o.opts.SplitSize > 0 {
+		name += fmt.Sprintf("-%05d", o.part)
+	}
+	return filepath.Join(o.opts.Dir, name+extension(o.opts.Format, o.opts.Compression))
+}
+
+// open starts the next file and writes the header into it.
+func (o *output) open() error {
+	o.part++
+	o.size, o.rows = 0, 0
+	var dst io.Writer = o.opts.Stdout
+	if dst == nil {
+		if err := os.MkdirAll(o.opts.Dir, 0755); err != nil {
+			return fmt.Errorf("failed to create export directory: %w", err)
+		}
+		path := o.path()
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		o.file = f
+		o.files = append(o.files, path)
+		dst = f
+	}
+	o.buf = bufio.NewWriterSize(dst, 64<<10)
+	counted := &countingWriter{w: o.buf, n: &o.bytes}
+
+	o.w, o.closer = counted, nil
+	switch o.opts.Compression {
+	case Gzip:
+		gz := gzip.NewWriter(counted)
+		o.w, o.closer = gz, gz
+	case Zstd:
+		zw, err := zstd.NewWriter(counted)
+		if err != nil {
+			return fmt.Errorf("failed to start compression: %w", err)
+		}
+		o.w, o.closer = zw, zw
+	}
+	o.started = true
+	return o.writeRaw(o.header)
+}
+
+// write appends one encoded row, moving to a new file first if the row
+// would take the current one past the split size. Every file holds at
+// least one row, so a row larger than the split size gets a file of its own.
+func (o *output) write(row []byte) error {
+	if !o.started {
+		if err := o.open(); err != nil {
+			return err
+		}
+	} else if o.opts.SplitSize > 0 && o.rows > 0 && o.size+int64(len(row)) > o.opts.SplitSize {
+		if err := o.finish(); err != nil {
+			return err
+		}
+		if err := o.open(); err != nil {
+			return err
+		}
+	}
+	o.rows++
+	return o.writeRaw(row)
+}
+
+func (o *output) writeRaw(b []byte) error {
+	n, err := o.w.Write(b)
+	o.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// finish flushes and closes the current file.
+func (o *output) finish() error {
+	var err error
+	if o.closer != nil {
+		err = o.closer.Close()
+	}
+	if flushErr := o.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if o.file != nil {
+		if closeErr := o.file.Close(); err == nil {
+			err = closeErr
+		}
+		o.file = nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// close finishes the last file. A source without rows still gets a file,
+// holding just the header.
+func (o *output) close() error {
+	if !o.started {
+		if err := o.open(); err != nil {
+			return err
+		}
+	}
+	return o.finish()
+}
+
+// countingWriter counts the bytes written through it into n.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// fileName turns a source name into a portable file name.
+func fileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(` /\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// ParseSize parses a size such as "500000", "64K", "100MB" or "1GiB".
+// Units are binary: K and KB both mean 1024 bytes.
+func ParseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "B"), "I")
+	mult := int64(1)
+	if t != "" {
+		if i := strings.IndexByte("KMGT", t[len(t)-1]); i >= 0 {
+			mult = int64(1) << (10 * (i + 1))
+			t = t[:len(t)-1]
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 500000, 64K, 100MB or 1GiB", s)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,147 @@
+package tui
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+// trustedKeys loads the keys whose signatures the wizard trusts. Problems
+// reading the config or the keys trust no key, so signed backups show as
+// signed by an unknown key rather than failing the wizard.
+func trustedKeys() []ed25519.PublicKey {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil
+	}
+	keys, err := pgbackup.LoadVerifyKeys(append(cfg.TrustedKeys, cfg.SigningKey)...)
+	if err != nil {
+		return nil
+	}
+	return keys
+}
+
+// isDir reports whether path names an existing directory.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// openBrowser lists the backups in the directory entered as the restore
+// form's backup path, so the user can pick one by its trust state. They are
+// verified in the background, as every backup file is hashed.
+func (m Model) openBrowser() (tea.Model, tea.Cmd) {
+	m.browserBackups = nil
+	m.browserError = nil
+	m.browserLoading = true
+	m.browserChoice = 0
+	m.inputs[m.step].Blur()
+	m.currentView = backupBrowser
+	return m, VerifyBackupsCmd(m.inputs[4].Value())
+}
+
+// VerifyBackupsCmd verifies the backups in dir for the browser.
+func VerifyBackupsCmd(dir string) tea.Cmd {
+	return func() tea.Msg {
+		results, err := pgbackup.VerifyDir(dir, trustedKeys())
+		return BackupsVerifiedMsg{Dir: dir, Backups: results, Err: err}
+	}
+}
+
+// backupsVerified shows the verified backups, unless the browser has been
+// left or reopened on another directory since.
+func (m Model) backupsVerified(msg BackupsVerifiedMsg) Model {
+	if !m.browserLoading || msg.Dir != m.inputs[4].Value() {
+		return m
+	}
+	m.browserLoading = false
+	m.browserBackups = msg.Backups
+	m.browserError = msg.Err
+	return m
+}
+
+func (m Model) updateBrowser(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		options := len(m.browserBackups) + 1 // "Back" last
+		switch msg.Type {
+		case tea.KeyUp:
+			m.browserChoice = (m.browserChoice + options - 1) % options
+		case tea.KeyDown:
+			m.browserChoice = (m.browserChoice + 1) % options
+		case tea.KeyEnter:
+			if m.browserChoice < len(m.browserBackups) {
+				m.inputs[4].SetValue(m.browserBackups[m.browserChoice].Path)
+				m.currentView = restoreForm
+				return m.openReview()
+			}
+			m.browserLoading = false
+			m.currentView = restoreForm
+			m.focusOnInput = true
+			m.inputs[m.step].Focus()
+		}
+	}
+	return m, nil
+}
+
+// trustBadge renders a backup's trust state for the browser and review.
+func trustBadge(t pgbackup.Trust) string {
+	switch t {
+	case pgbackup.TrustVerified:
+		return greenTextValue.Render("✔ verified")
+	case pgbackup.TrustUnknownKey:
+		return cancelledStyle.Render("? unknown key")
+	case pgbackup.TrustTampered:
+		return errorStyle.Render("✘ TAMPERED")
+	default:
+		return greyText.Render("- unsigned")
+	}
+}
+
+func (m Model) viewBrowser() string {
+	var b strings.Builder
+	b.WriteString(welcomeStyle.Render("Restore Database"))
+	b.WriteString("\n\n")
+	b.WriteString(fmt.Sprintf("Choose a backup in %s:\n\n", m.inputs[4].Value()))
+
+	var options []string
+	if m.browserLoading {
+		options = append(options, greyText.Render("Verifying the backups..."))
+	} else if m.browserError != nil {
+		options = append(options, errorStyle.Render(m.browserError.Error()))
+	} else if len(m.browserBackups) == 0 {
+		options = append(options, greyText.Render("No backups with a manifest in this directory."))
+	}
+	for i, v := range m.browserBackups {
+		label := fmt.Sprintf("%-48s %s", filepath.Base(v.Path), v.Manifest.CreatedAt.Local().Format("2006-01-02 15:04"))
+		if i == m.browserChoice {
+			label = focusedButton.Render("[x] " + label)
+		} else {
+			label = "[ ] " + label
+		}
+		options = append(options, label+"  "+trustBadge(v.Trust))
+	}
+	if m.browserChoice == len(m.browserBackups) {
+		options = append(options, focusedButton.Render("[x] Back to the form"))
+	} else {
+		options = append(options, "[ ] Back to the form")
+	}
+	b.WriteString(lipgloss.JoinVertical(lipgloss.Left, options...))
+
+	if m.browserChoice < len(m.browserBackups) {
+		if problems := m.browserBackups[m.browserChoice].Problems; len(problems) > 0 {
+			b.WriteString("\n\n")
+			b.WriteString(greyText.Render(strings.Join(problems, "\n")))
+		}
+	}
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("up/down: select • enter: confirm • ctrl+c: quit"))
+	return b.String()
+}
@@ -1,13 +1,19 @@
 package tui
 
 import (
+	"crypto/ed25519"
 	"fmt"
-	"path/filepath"
-	"time"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/curtisbraxdale/go-pg-backup/internal/catalog"
+	"github.com/curtisbraxdale/go-pg-backup/internal/compare"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/hooks"
 	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgclone"
 	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
 )
 
 // RunPgDumpCmd prepares and executes the pg_dump command in a goroutine,
@@ -21,33 +27,77 @@ func RunPgDumpCmd(m Model) tea.Cmd {
 		backupDir := m.inputs[4].Value()
 		port := 5432 // Default PostgreSQL port
 
-		// Construct a unique filename for the backup
-		timestamp := time.Now().Format("20060102-150405")
-		filename := fmt.Sprintf("%s-backup-%s.sql", dbname, timestamp)
-		outputPath := filepath.Join(backupDir, filename)
-
-		// First, create the destination directory if it doesn't exist.
-		if err := pgbackup.CreateDestinationDir(backupDir); err != nil {
-			return PgDumpFinishedMsg{Err: fmt.Errorf("failed to create backup directory: %w", err)}
+		// Use the path shown on the review screen so the file matches what the user confirmed.
+		outputPath := m.pendingOutputPath
+		if outputPath == "" {
+			outputPath = pgbackup.OutputPath(backupDir, dbname)
 		}
 
-		// Prepare the pg_dump command
-		cmd, err := pgbackup.PreparePgDumpCommand(host, port, user, password, dbname, outputPath)
+		cfg, err := config.Load()
 		if err != nil {
 			return PgDumpFinishedMsg{Err: err}
 		}
+		rules, err := m.loadRuleset()
+		if err != nil {
+			return PgDumpFinishedMsg{Err: err}
+		}
+		var signingKey ed25519.PrivateKey
+		if cfg.SigningKey != "" {
+			if signingKey, err = pgbackup.LoadSigningKey(cfg.SigningKey); err != nil {
+				return PgDumpFinishedMsg{Err: err}
+			}
+		}
 
-		// Run the command.
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return PgDumpFinishedMsg{Err: fmt.Errorf("pg_dump failed: %s: %w", string(output), err)}
+		job := hooks.Job{Operation: "backup", Host: host, Port: port, User: user, Password: password, Database: dbname, File: outputPath}
+		if err := m.runHooks(cfg, hooks.Before, job); err != nil {
+			return PgDumpFinishedMsg{Err: err}
+		}
+		var checksums *pgbackup.ChecksumOptions
+		if cfg.Compare.Record {
+			sums := cfg.Compare.Checksums()
+			checksums = &sums
+		}
+		manifest, err := pgbackup.Run(pgbackup.Options{
+			Host:          host,
+			Port:          port,
+			User:          user,
+			Password:      password,
+			DBName:        dbname,
+			OutputPath:    outputPath,
+			DumpBinary:    m.preflightBinary(),
+			ClientBinDirs: cfg.ClientBinDirs,
+			Engine:        m.backupEngine,
+			Masking:       rules,
+			SigningKey:    signingKey,
+			Checksums:     checksums,
+		})
+		job.Finish(err)
+		if hookErr := m.runHooks(cfg, hooks.After, job); err == nil {
+			err = hookErr
+		}
+		if err != nil {
+			return PgDumpFinishedMsg{OutputPath: outputPath, Err: err}
 		}
 
 		// If we reach here, the backup was successful.
-		return PgDumpFinishedMsg{OutputPath: outputPath, Err: nil}
+		binary := "built-in Go engine"
+		if manifest.Engine == pgbackup.EnginePgDump {
+			binary = fmt.Sprintf("%s (%s)", manifest.DumpBinary, manifest.DumpVersion)
+		}
+		msg := PgDumpFinishedMsg{OutputPath: outputPath, Binary: binary, Err: nil}
+		if manifest.Masked {
+			msg.Note = fmt.Sprintf("Masked %d columns with ruleset %s.", len(manifest.MaskedColumns), manifest.MaskingRuleset)
+		}
+		// The backup is sound either way, a search indexes it later.
+		if err := catalog.Add(outputPath, cfg.ClientBinDirs); err != nil {
+			msg.Note = strings.TrimSpace(msg.Note + "\nWarning: failed to index the backup in the catalog: " + err.Error())
+		}
+		return msg
 	}
 }
 
-// RunPgRestoreCmd prepares and executes the psql command for restoring a database.
+// RunPgRestoreCmd restores a database with psql, or with the built-in Go
+// executor when psql is not installed.
 func RunPgRestoreCmd(m Model) tea.Cmd {
 	return func() tea.Msg {
 		host := m.inputs[0].Value()
@@ -57,25 +107,206 @@ func RunPgRestoreCmd(m Model) tea.Cmd {
 		backupPath := m.inputs[4].Value()
 		port := 5432 // Default PostgreSQL port
 
-		// If the user wants to create a new database, do that first.
-		if m.restoreNewDB {
-			err := pgrestore.CreateNewDB(host, port, user, password, dbname)
-			if err != nil {
-				return PgRestoreFinishedMsg{Err: fmt.Errorf("failed to create new database: %w", err)}
+		cfg, err := config.Load()
+		if err != nil {
+			return PgRestoreFinishedMsg{Err: err}
+		}
+
+		job := hooks.Job{Operation: "restore", Host: host, Port: port, User: user, Password: password, Database: dbname, File: backupPath}
+		if err := m.runHooks(cfg, hooks.Before, job); err != nil {
+			return PgRestoreFinishedMsg{Err: err}
+		}
+		result, err := pgrestore.Run(pgrestore.Options{
+			Host:              host,
+			Port:              port,
+			User:              user,
+			Password:          password,
+			DBName:            dbname,
+			BackupPath:        backupPath,
+			Mode:              m.restoreMode,
+			ProtectedTargets:  cfg.ProtectedTargets,
+			SafetyBackupDir:   cfg.SafetyBackupDir,
+			ValidationQueries: cfg.SwapValidationQueries,
+			RestoreBinary:     m.preflightBinary(),
+			ClientBinDirs:     cfg.ClientBinDirs,
+			Maintenance:       cfg.PostRestore,
+			Tables:            m.restoreTables,
+			Progress: func(p pgrestore.Progress) {
+				// Drop updates the UI has not caught up with rather than slow the restore.
+				select {
+				case m.restoreProgress <- PgRestoreProgressMsg("Restoring: " + p.String()):
+				default:
+				}
+			},
+		})
+		var comparison *compare.Report
+		// A partial restore cannot match the backup's manifest.
+		if err == nil && cfg.Compare.AfterRestore && len(m.restoreTables) == 0 {
+			comparison, err = compareRestored(cfg, backupPath, compare.Database{Host: host, Port: port, User: user, Password: password, DBName: dbname})
+		}
+		job.Finish(err)
+		if hookErr := m.runHooks(cfg, hooks.After, job); err == nil {
+			err = hookErr
+		}
+		var steps []string
+		if result != nil {
+			for _, step := range result.Maintenance {
+				steps = append(steps, step.String())
+			}
+		}
+		if err != nil {
+			return PgRestoreFinishedMsg{Err: err, Steps: steps, Comparison: comparison}
+		}
+
+		msg := PgRestoreFinishedMsg{Binary: result.Binary.String(), Steps: steps, Comparison: comparison}
+		if result.Engine == pgrestore.EngineGo {
+			msg.Binary = "built-in Go executor"
+		}
+		if result.PreviousDatabase != "" {
+			msg.Note = fmt.Sprintf("Previous database kept as %s for rollback.", result.PreviousDatabase)
+		}
+		if e := result.Extraction; e != nil {
+			msg.Note = fmt.Sprintf("Restored %d rows of %s.", e.Rows, strings.Join(e.Tables, ", "))
+			if len(e.Skipped) > 0 {
+				msg.Note += fmt.Sprintf("\nLeft out %d statements needing tables that were not restored.", len(e.Skipped))
 			}
 		}
+		return msg
+	}
+}
+
+// waitForRestoreProgress delivers the next progress update of a running restore.
+func waitForRestoreProgress(ch <-chan PgRestoreProgressMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
+// progressLogLines is how much hook output the progress screen shows.
+const progressLogLines = 8
+
+// runHooks runs the configured hooks for phase, streaming their output to
+// the progress screen.
+func (m Model) runHooks(cfg config.Config, phase hooks.Phase, job hooks.Job) error {
+	return hooks.Run(cfg.Hooks, phase, job, func(line string) {
+		m.hookOutput <- HookOutputMsg(line)
+	})
+}
+
+// waitForHookOutput delivers the next line of hook output.
+func waitForHookOutput(ch <-chan HookOutputMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
+// RunPgCloneCmd copies the source database into a new target database,
+// reporting progress on m.cloneProgress.
+func RunPgCloneCmd(m Model) tea.Cmd {
+	return func() tea.Msg {
+		source, target := m.cloneEndpoints()
+		jobs, err := m.cloneJobs()
+		if err != nil {
+			return PgCloneFinishedMsg{Err: err}
+		}
 
-		// Prepare the pg_restore command
-		cmd, err := pgrestore.PreparePgRestoreCommand(host, port, user, password, dbname, backupPath)
+		cfg, err := config.Load()
 		if err != nil {
-			return PgRestoreFinishedMsg{Err: err}
+			return PgCloneFinishedMsg{Err: err}
 		}
 
-		// Run the command
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return PgRestoreFinishedMsg{Err: fmt.Errorf("pg_restore failed: %s: %w", string(output), err)}
+		result, err := pgclone.Run(pgclone.Options{
+			Source:        source,
+			Target:        target,
+			Jobs:          jobs,
+			ClientBinDirs: cfg.ClientBinDirs,
+			Progress: func(p pgclone.Progress) {
+				// Drop updates the UI has not caught up with rather than slow the clone.
+				select {
+				case m.cloneProgress <- PgCloneProgressMsg(p):
+				default:
+				}
+			},
+		})
+		if err != nil {
+			return PgCloneFinishedMsg{Err: err}
 		}
 
-		return PgRestoreFinishedMsg{Err: nil}
+		return PgCloneFinishedMsg{
+			Binary: fmt.Sprintf("%s -> %s", result.DumpBinary, result.RestoreBinary),
+			Note:   fmt.Sprintf("Copied %.1f MiB from %s to %s.", float64(result.Bytes)/(1<<20), source, target),
+		}
+	}
+}
+
+// waitForCloneProgress delivers the next progress update of a running clone.
+func waitForCloneProgress(ch <-chan PgCloneProgressMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
+// RunPreflightCmd checks that the configured backup or restore can run.
+func RunPreflightCmd(m Model) tea.Cmd {
+	return func() tea.Msg {
+		host := m.inputs[0].Value()
+		user := m.inputs[1].Value()
+		password := m.inputs[2].Value()
+		dbname := m.inputs[3].Value()
+		port := 5432 // Default PostgreSQL port
+
+		cfg, err := config.Load()
+		if err != nil {
+			var report preflight.Report
+			report.Checks = append(report.Checks, preflight.Check{Name: "Configuration", Status: preflight.Fail, Detail: err.Error()})
+			return PreflightFinishedMsg{Report: report}
+		}
+
+		if m.formView == cloneForm {
+			source, target := m.cloneEndpoints()
+			return PreflightFinishedMsg{Report: preflight.Clone(preflight.CloneOptions{
+				Source:        source,
+				Target:        target,
+				ClientBinDirs: cfg.ClientBinDirs,
+			})}
+		}
+		if m.formView == backupForm {
+			rules, err := m.loadRuleset()
+			if err != nil {
+				var report preflight.Report
+				report.Checks = append(report.Checks, preflight.Check{Name: "Masking rules", Status: preflight.Fail, Detail: err.Error()})
+				return PreflightFinishedMsg{Report: report}
+			}
+			return PreflightFinishedMsg{Report: preflight.Backup(preflight.BackupOptions{
+				Host:          host,
+				Port:          port,
+				User:          user,
+				Password:      password,
+				DBName:        dbname,
+				OutputPath:    m.pendingOutputPath,
+				ClientBinDirs: cfg.ClientBinDirs,
+				Engine:        m.backupEngine,
+				Masking:       rules,
+			})}
+		}
+		return PreflightFinishedMsg{Report: preflight.Restore(preflight.RestoreOptions{
+			Host:          host,
+			Port:          port,
+			User:          user,
+			Password:      password,
+			DBName:        dbname,
+			BackupPath:    m.inputs[4].Value(),
+			Mode:          m.restoreMode,
+			ClientBinDirs: cfg.ClientBinDirs,
+		})}
+	}
+}
+
+// preflightBinary returns the client binary selected by the pre-flight checks,
+// or an empty string to let the run select one itself.
+func (m Model) preflightBinary() string {
+	if m.preflightReport == nil {
+		return ""
 	}
+	return m.preflightReport.Binary.Path
 }
@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/curtisbraxdale/go-pg-backup/internal/compare"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+)
+
+// comparisonRows is how many tables the summary lists.
+const comparisonRows = 15
+
+// compareRestored compares the restored database with the checksums in the
+// backup's manifest and saves the report if a directory is configured. The
+// error reports a failed comparison or differing data.
+func compareRestored(cfg config.Config, backupPath string, target compare.Database) (*compare.Report, error) {
+	m, err := pgbackup.ReadManifest(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compare the data: %w", err)
+	}
+	report, err := compare.Manifest(m, target)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compare the data: %w", err)
+	}
+	if cfg.Compare.ReportDir != "" {
+		if _, err := report.Save(cfg.Compare.ReportDir); err != nil {
+			return report, err
+		}
+	}
+	if bad := len(report.Mismatches()); bad > 0 {
+		return report, fmt.Errorf("data comparison found %d differing tables", bad)
+	}
+	return report, nil
+}
+
+// renderComparison draws the comparison as a diff table, differing tables
+// first, then those that could not be compared.
+func renderComparison(r *compare.Report) string {
+	var b strings.Builder
+	b.WriteString(whiteText.Render(fmt.Sprintf("Data comparison with %s: %s", r.Source, r.Summary())))
+	b.WriteString("\n")
+	b.WriteString(whiteText.Render(fmt.Sprintf("%-36s %-16s %12s %12s", "TABLE", "STATUS", "BACKUP ROWS", "RESTORED ROWS")))
+	b.WriteString("\n")
+
+	tables := append(append(r.Mismatches(), r.NotComparable()...), matching(r)...)
+	for i, t := range tables {
+		if i == comparisonRows {
+			b.WriteString(greyText.Render(fmt.Sprintf("... %d more tables", len(tables)-comparisonRows)))
+			b.WriteString("\n")
+			break
+		}
+		style := greenTextValue
+		switch t.Status {
+		case compare.Match:
+		case compare.NotComparable:
+			style = greyText
+		default:
+			style = errorStyle
+		}
+		status := string(t.Status)
+		if t.Sample > 0 {
+			status += fmt.Sprintf(" (%g%%)", t.Sample)
+		}
+		b.WriteString(style.Render(fmt.Sprintf("%-36s %-16s %12d %12d", t.Table, status, t.SourceRows, t.TargetRows)))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func matching(r *compare.Report) []compare.TableDiff {
+	var ok []compare.TableDiff
+	for _, t := range r.Tables {
+		if t.Status == compare.Match {
+			ok = append(ok, t)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,88 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+	"github.com/curtisbraxdale/go-pg-backup/internal/repo"
+	"github.com/curtisbraxdale/go-pg-backup/internal/rpo"
+)
+
+// RunFreshnessCheckCmd checks every configured RPO policy against its
+// catalog in the background.
+func RunFreshnessCheckCmd() tea.Cmd {
+	return func() tea.Msg {
+		cfg, err := config.Load()
+		if err != nil {
+			return FreshnessCheckedMsg{Err: err}
+		}
+		return FreshnessCheckedMsg{Results: rpo.Check(cfg.RPO, os.Getenv(repo.PasswordEnv), time.Now())}
+	}
+}
+
+func (m Model) updateDashboard(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case msg.Type == tea.KeyEnter:
+			m.currentView = mainMenu
+		case msg.String() == "r" && !m.dashboardLoading:
+			m.dashboardLoading = true
+			return m, RunFreshnessCheckCmd()
+		}
+	}
+	return m, nil
+}
+
+// statusBadge renders an RPO status for the dashboard.
+func statusBadge(s rpo.Status) string {
+	label := fmt.Sprintf("%-8s", s)
+	switch s {
+	case rpo.OK:
+		return greenTextValue.Render(label)
+	case rpo.Warning:
+		return cancelledStyle.Render(label)
+	default:
+		return errorStyle.Render(label)
+	}
+}
+
+func (m Model) viewDashboard() string {
+	var b strings.Builder
+	b.WriteString(welcomeStyle.Render("Backup Freshness"))
+	b.WriteString("\n\n")
+
+	switch {
+	case m.dashboardLoading:
+		b.WriteString(greyText.Render("Reading the backup catalogs..."))
+	case m.dashboardError != nil:
+		b.WriteString(errorStyle.Render(m.dashboardError.Error()))
+	case len(m.dashboardResults) == 0:
+		b.WriteString(greyText.Render("No RPO policies configured. Add them under \"rpo\" in the config file."))
+	default:
+		b.WriteString(whiteText.Render(fmt.Sprintf("%-8s  %-36s %10s %10s %10s", "STATUS", "DATABASE", "AGE", "MAX AGE", "SIZE")))
+		b.WriteString("\n")
+		for _, r := range m.dashboardResults {
+			age, size, maxAge := "-", "-", "-"
+			if r.Latest != nil {
+				age, size = rpo.FormatAge(r.Age), preflight.FormatBytes(r.Latest.Size)
+			}
+			if r.Policy.MaxAge > 0 {
+				maxAge = rpo.FormatAge(time.Duration(r.Policy.MaxAge))
+			}
+			b.WriteString(fmt.Sprintf("%s  %-36s %10s %10s %10s\n", statusBadge(r.Status), r.Name(), age, maxAge, size))
+			for _, p := range r.Problems {
+				b.WriteString(greyText.Render("          " + p))
+				b.WriteString("\n")
+			}
+		}
+	}
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("r: refresh • enter: back • ctrl+c: quit"))
+	return b.String()
+}
@@ -0,0 +1,256 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/hooks"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+	"github.com/curtisbraxdale/go-pg-backup/internal/tableexport"
+)
+
+// exportPageLines is how many tables the table picker shows at once.
+const exportPageLines = 15
+
+// Export form inputs, in display order.
+const (
+	exportHost = iota
+	exportUser
+	exportPassword
+	exportDB
+	exportDir
+	exportFormat
+	exportCompression
+	exportSplitSize
+)
+
+func setupExportInputs() []textinput.Model {
+	inputs := make([]textinput.Model, 8)
+	prompts := []string{
+		"Database Host",
+		"Database User",
+		"Database Password",
+		"Database Name",
+		"Export Directory",
+		"Format (csv, tsv, jsonl)",
+		"Compression (none, gzip, zstd)",
+		"Split Size (empty for one file per table)",
+	}
+	placeholders := []string{
+		"localhost",
+		"postgres",
+		"password",
+		"mydatabase",
+		"/path/to/export",
+		"csv",
+		"none",
+		"100MB",
+	}
+
+	for i := range inputs {
+		inputs[i] = textinput.New()
+		inputs[i].Prompt = prompts[i] + ": "
+		inputs[i].Placeholder = placeholders[i]
+		inputs[i].CharLimit = 256
+		inputs[i].Width = 50
+		inputs[i].PromptStyle = pinkTextPrompt
+		inputs[i].TextStyle = whiteText
+		if i == exportPassword {
+			inputs[i].EchoMode = textinput.EchoPassword
+			inputs[i].EchoCharacter = '•'
+		}
+	}
+	inputs[0].Focus()
+	return inputs
+}
+
+// exportOptions returns the export configured in the form and picker.
+func (m Model) exportOptions() (tableexport.Options, error) {
+	opts := tableexport.Options{
+		Host:     m.inputs[exportHost].Value(),
+		Port:     5432, // Default PostgreSQL port
+		User:     m.inputs[exportUser].Value(),
+		Password: m.inputs[exportPassword].Value(),
+		DBName:   m.inputs[exportDB].Value(),
+		Dir:      m.inputs[exportDir].Value(),
+	}
+	if opts.Dir == "" {
+		return opts, fmt.Errorf("Export Directory is required")
+	}
+	format := m.inputs[exportFormat].Value()
+	if format == "" {
+		format = string(tableexport.CSV)
+	}
+	var err error
+	if opts.Format, err = tableexport.ParseFormat(format); err != nil {
+		return opts, err
+	}
+	if opts.Compression, err = tableexport.ParseCompression(m.inputs[exportCompression].Value()); err != nil {
+		return opts, err
+	}
+	if size := m.inputs[exportSplitSize].Value(); size != "" {
+		if opts.SplitSize, err = tableexport.ParseSize(size); err != nil {
+			return opts, err
+		}
+	}
+	for i, table := range m.exportTables {
+		if m.exportSelected[i] {
+			opts.Sources = append(opts.Sources, tableexport.TableSource(table))
+		}
+	}
+	return opts, nil
+}
+
+// LoadExportTablesCmd lists the tables of the database entered in the
+// export form in the background.
+func LoadExportTablesCmd(m Model) tea.Cmd {
+	opts, _ := m.exportOptions()
+	return func() tea.Msg {
+		tables, err := tableexport.ListTables(context.Background(), opts)
+		return ExportTablesLoadedMsg{Tables: tables, Err: err}
+	}
+}
+
+// RunExportCmd exports the picked tables, running the export hooks around it.
+func RunExportCmd(m Model) tea.Cmd {
+	return func() tea.Msg {
+		opts, err := m.exportOptions()
+		if err != nil {
+			return ExportFinishedMsg{Err: err}
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return ExportFinishedMsg{Err: err}
+		}
+
+		job := hooks.Job{Operation: "export", Host: opts.Host, Port: opts.Port, User: opts.User, Password: opts.Password, Database: opts.DBName, File: opts.Dir}
+		if err := m.runHooks(cfg, hooks.Before, job); err != nil {
+			return ExportFinishedMsg{Err: err}
+		}
+		result, err := tableexport.Export(context.Background(), opts)
+		job.Finish(err)
+		if hookErr := m.runHooks(cfg, hooks.After, job); err == nil {
+			err = hookErr
+		}
+		if err != nil {
+			return ExportFinishedMsg{Err: err}
+		}
+
+		var lines []string
+		for _, s := range result.Sources {
+			lines = append(lines, fmt.Sprintf("%s: %d rows, %s", s.Name, s.Rows, preflight.FormatBytes(s.Bytes)))
+		}
+		return ExportFinishedMsg{Note: fmt.Sprintf("Exported into %s:\n  %s", opts.Dir, strings.Join(lines, "\n  "))}
+	}
+}
+
+// openExportPicker leaves the export form for the table picker and starts
+// listing the tables.
+func (m Model) openExportPicker() (tea.Model, tea.Cmd) {
+	m.inputs[m.step].Blur()
+	m.currentView = exportPicker
+	m.exportLoading = true
+	m.exportTables = nil
+	m.exportSelected = nil
+	m.exportChoice = 0
+	m.exportOffset = 0
+	m.exportListError = nil
+	return m, LoadExportTablesCmd(m)
+}
+
+func (m Model) updateExportPicker(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case msg.Type == tea.KeyBackspace:
+			m.currentView = exportForm
+			m.focusOnInput = true
+			m.inputs[m.step].Focus()
+			return m, nil
+		case m.exportLoading || len(m.exportTables) == 0:
+			return m, nil
+		case msg.Type == tea.KeyUp:
+			m.exportChoice = (m.exportChoice + len(m.exportTables) - 1) % len(m.exportTables)
+		case msg.Type == tea.KeyDown:
+			m.exportChoice = (m.exportChoice + 1) % len(m.exportTables)
+		case msg.Type == tea.KeySpace:
+			m.exportSelected[m.exportChoice] = !m.exportSelected[m.exportChoice]
+		case msg.String() == "a":
+			all := m.exportPicked() < len(m.exportTables)
+			for i := range m.exportSelected {
+				m.exportSelected[i] = all
+			}
+		case msg.Type == tea.KeyEnter:
+			if _, err := m.exportOptions(); err != nil || m.exportPicked() == 0 {
+				return m, nil
+			}
+			m.submitted = true
+			m.exportInProgress = true
+			m.hookOutput = make(chan HookOutputMsg, 16)
+			return m, tea.Batch(RunExportCmd(m), waitForHookOutput(m.hookOutput))
+		}
+		// Keep the choice on the page shown.
+		if m.exportChoice < m.exportOffset {
+			m.exportOffset = m.exportChoice
+		} else if m.exportChoice >= m.exportOffset+exportPageLines {
+			m.exportOffset = m.exportChoice - exportPageLines + 1
+		}
+	}
+	return m, nil
+}
+
+// exportPicked counts the tables picked for export.
+func (m Model) exportPicked() int {
+	n := 0
+	for _, picked := range m.exportSelected {
+		if picked {
+			n++
+		}
+	}
+	return n
+}
+
+func (m Model) viewExportPicker() string {
+	var b strings.Builder
+	b.WriteString(welcomeStyle.Render("Export Tables"))
+	b.WriteString("\n\n")
+
+	switch {
+	case m.exportLoading:
+		b.WriteString(greyText.Render("Listing the tables..."))
+	case m.exportListError != nil:
+		b.WriteString(errorStyle.Render(m.exportListError.Error()))
+	case len(m.exportTables) == 0:
+		b.WriteString(greyText.Render("The database has no tables."))
+	default:
+		b.WriteString(fmt.Sprintf("Choose the tables of %s to export:\n\n", m.inputs[exportDB].Value()))
+		var lines []string
+		end := min(m.exportOffset+exportPageLines, len(m.exportTables))
+		for i := m.exportOffset; i < end; i++ {
+			box := "[ ] "
+			if m.exportSelected[i] {
+				box = "[x] "
+			}
+			if i == m.exportChoice {
+				lines = append(lines, focusedButton.Render("> "+box+m.exportTables[i]))
+			} else {
+				lines = append(lines, blurredButton.Render("  "+box+m.exportTables[i]))
+			}
+		}
+		b.WriteString(lipgloss.JoinVertical(lipgloss.Left, lines...))
+		b.WriteString("\n\n")
+		b.WriteString(greyText.Render(fmt.Sprintf("%d of %d tables picked", m.exportPicked(), len(m.exportTables))))
+		if _, err := m.exportOptions(); err != nil {
+			b.WriteString("\n")
+			b.WriteString(errorStyle.Render(err.Error()))
+		}
+	}
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("up/down: select • space: pick • a: pick all • enter: export • backspace: back • ctrl+c: quit"))
+	return b.String()
+}
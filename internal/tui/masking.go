@@ -0,0 +1,91 @@
+package tui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/masking"
+)
+
+// availableRulesets lists the masking rulesets in the configured directory.
+// Problems reading the config or the directory simply offer no rulesets.
+func availableRulesets() []string {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil
+	}
+	dir, err := cfg.MaskingRulesDir()
+	if err != nil {
+		return nil
+	}
+	names, err := masking.List(dir)
+	if err != nil {
+		return nil
+	}
+	return names
+}
+
+// loadRuleset loads the masking ruleset picked in the wizard, or returns nil
+// when none was picked.
+func (m Model) loadRuleset() (*masking.Ruleset, error) {
+	if m.maskingRuleset == "" {
+		return nil, nil
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := cfg.MaskingRulesDir()
+	if err != nil {
+		return nil, err
+	}
+	return masking.Find(dir, m.maskingRuleset)
+}
+
+func (m Model) updateMaskingMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
+	options := len(m.maskingRulesets) + 1 // "No masking" first
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyUp:
+			m.maskingMenuChoice = (m.maskingMenuChoice + options - 1) % options
+		case tea.KeyDown:
+			m.maskingMenuChoice = (m.maskingMenuChoice + 1) % options
+		case tea.KeyEnter:
+			m.maskingRuleset = ""
+			if m.maskingMenuChoice > 0 {
+				m.maskingRuleset = m.maskingRulesets[m.maskingMenuChoice-1]
+			}
+			m.currentView = backupForm
+			m.inputs = setupBackupInputs()
+		}
+	}
+	return m, nil
+}
+
+func (m Model) viewMaskingMenu() string {
+	var b strings.Builder
+	b.WriteString(welcomeStyle.Render("Create Backup"))
+	b.WriteString("\n\n")
+	b.WriteString("Mask sensitive data with a ruleset?\n\n")
+
+	labels := append([]string{"No masking"}, m.maskingRulesets...)
+	var options []string
+	for i, label := range labels {
+		if i > 0 {
+			label = "Mask with " + label
+		}
+		if i == m.maskingMenuChoice {
+			options = append(options, focusedButton.Render("[x] "+label))
+		} else {
+			options = append(options, "[ ] "+label)
+		}
+	}
+
+	b.WriteString(lipgloss.JoinVertical(lipgloss.Left, options...))
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("up/down: select • enter: confirm • ctrl+c: quit"))
+	return b.String()
+}
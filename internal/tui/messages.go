@@ -1,5 +1,14 @@
 package tui
 
+import (
+	"github.com/curtisbraxdale/go-pg-backup/internal/compare"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgclone"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+	"github.com/curtisbraxdale/go-pg-backup/internal/rpo"
+	"github.com/curtisbraxdale/go-pg-backup/internal/schemadiff"
+)
+
 // PgDumpStartedMsg indicates that pg_dump has begun.
 type PgDumpStartedMsg struct{}
 
@@ -7,6 +16,8 @@ type PgDumpStartedMsg struct{}
 type PgDumpFinishedMsg struct {
 	Err        error
 	OutputPath string // Path where the backup was saved
+	Binary     string // The pg_dump that ran, with its version
+	Note       string // Extra information for the summary, e.g. what was masked
 }
 
 // PgDumpProgressMsg can be used to stream output from pg_dump (e.g., stderr for warnings).
@@ -17,8 +28,78 @@ type PgRestoreStartedMsg struct{}
 
 // PgRestoreFinishedMsg indicates that pg_restore has completed, with an error if any.
 type PgRestoreFinishedMsg struct {
-	Err error
+	Err    error
+	Note   string   // Extra information for the summary, e.g. where the old database was kept
+	Binary string   // The psql that ran, with its version
+	Steps  []string // Outcome of each post-restore maintenance step
+
+	// Comparison of the restored data with the backup, when enabled.
+	Comparison *compare.Report
 }
 
 // PgRestoreProgressMsg can be used to stream output from pg_restore (e.g., stderr for warnings).
 type PgRestoreProgressMsg string
+
+// HookOutputMsg is a line of output from a hook run around a backup or restore.
+type HookOutputMsg string
+
+// PreflightFinishedMsg carries the results of the pre-flight checks.
+type PreflightFinishedMsg struct {
+	Report preflight.Report
+}
+
+// PgCloneFinishedMsg indicates that a clone has completed, with an error if any.
+type PgCloneFinishedMsg struct {
+	Err    error
+	Note   string // Extra information for the summary, e.g. how much was copied
+	Binary string // The pg_dump and psql that ran, with their versions
+}
+
+// PgCloneProgressMsg reports how far a running clone has got.
+type PgCloneProgressMsg pgclone.Progress
+
+// FreshnessCheckedMsg carries the results of the RPO check for the dashboard.
+type FreshnessCheckedMsg struct {
+	Results []rpo.Result
+	Err     error
+}
+
+// SchemaDiffLoadedMsg carries the schema diff of the backup being restored
+// against the target database.
+type SchemaDiffLoadedMsg struct {
+	Result *schemadiff.Result
+	Err    error
+}
+
+// RestoreTablesLoadedMsg carries the tables of the backup being restored,
+// offered in the restore table picker.
+type RestoreTablesLoadedMsg struct {
+	Tables []string
+	Err    error
+}
+
+// BackupsVerifiedMsg carries the verified backups of the directory shown
+// in the backup browser.
+type BackupsVerifiedMsg struct {
+	Dir     string
+	Backups []pgbackup.Verification
+	Err     error
+}
+
+// SearchFinishedMsg carries the catalog search results, rendered as lines.
+type SearchFinishedMsg struct {
+	Lines []string
+	Err   error
+}
+
+// ExportTablesLoadedMsg carries the tables offered in the export picker.
+type ExportTablesLoadedMsg struct {
+	Tables []string
+	Err    error
+}
+
+// ExportFinishedMsg indicates that an export has completed, with an error if any.
+type ExportFinishedMsg struct {
+	Err  error
+	Note string // What was exported, for the summary
+}
@@ -7,23 +7,50 @@ import (
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/curtisbraxdale/go-pg-backup/internal/compare"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgclone"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+	"github.com/curtisbraxdale/go-pg-backup/internal/rpo"
+	"github.com/curtisbraxdale/go-pg-backup/internal/schemadiff"
 )
 
 type viewState int
 
+// backupEngines lists the options of the backup choice menu, in display order.
+var backupEngines = []pgbackup.Engine{pgbackup.EngineAuto, pgbackup.EngineGo}
+
+// restoreModes lists the options of the restore choice menu, in display order.
+var restoreModes = []pgrestore.Mode{pgrestore.ModeExisting, pgrestore.ModeCreate, pgrestore.ModeRecreate, pgrestore.ModeSwap}
+
 const (
 	mainMenu viewState = iota
+	backupChoiceMenu
 	restoreChoiceMenu
 	backupForm
 	restoreForm
+	reviewScreen
+	preflightScreen
+	cloneForm
+	maskingMenu
+	backupBrowser
+	dashboard
+	schemaDiffView
+	exportForm
+	exportPicker
+	restoreTablePicker
+	searchForm
+	searchResults
 )
 
 // Model defines the application's state.
 type Model struct {
 	// View management
 	currentView       viewState
-	mainMenuChoice    int // 0: backup, 1: restore
-	restoreMenuChoice int // 0: existing db, 1: new db
+	mainMenuChoice    int // 0: backup, 1: restore, 2: clone, 3: freshness dashboard, 4: export, 5: catalog search
+	backupMenuChoice  int // index into backupEngines
+	restoreMenuChoice int // index into restoreModes
 
 	// Form state
 	inputs        []textinput.Model
@@ -33,19 +60,100 @@ type Model struct {
 	submitted     bool
 	quitting      bool
 
+	// Review state
+	formView          viewState // form being reviewed: backupForm or restoreForm
+	reviewChoice      int       // index into the review items (fields, confirmation, run)
+	editingFromReview bool      // return to the review screen after editing a field
+	confirmInput      textinput.Model
+	pendingOutputPath string // backup file path shown in the review and used when running
+
+	// Pre-flight state
+	preflightRunning bool
+	preflightReport  *preflight.Report
+
 	// Backup state
 	backupInProgress bool
 	backupFinished   bool
 	backupError      error
 	outputPath       string
 	backupMessage    string
+	clientBinary     string          // client tool that ran the backup or restore
+	backupEngine     pgbackup.Engine // engine chosen in the backup menu
+	resolvedEngine   pgbackup.Engine // engine the backup will use, shown on the review screen
+
+	// Masking state
+	maskingRulesets   []string // rulesets offered in the masking menu
+	maskingMenuChoice int      // 0: no masking, otherwise index into maskingRulesets + 1
+	maskingRuleset    string   // ruleset picked for the backup, empty for none
 
 	// Restore state
 	restoreInProgress bool
 	restoreFinished   bool
 	restoreError      error
 	restoreMessage    string
-	restoreNewDB      bool
+	restoreMode       pgrestore.Mode
+	restoreEngine     pgrestore.Engine          // engine the restore will use, shown on the review screen
+	restoreProgress   chan PgRestoreProgressMsg // progress reported by the Go executor while restoring
+	restoreTrust      *pgbackup.Verification    // signature check of the backup, shown on the review screen
+	comparison        *compare.Report           // restored data compared with the backup, shown in the summary
+
+	// Restore table picker state
+	restoreTables       []string // tables of a plain backup to restore, empty for all of them
+	restoreTablesFrom   string   // backup path restoreTables were picked from
+	tablePickerLoading  bool
+	tablePickerTables   []string // tables of the backup, as "schema.name"
+	tablePickerSelected []bool   // picked tables, by index into tablePickerTables
+	tablePickerChoice   int      // index into tablePickerTables
+	tablePickerOffset   int      // first table shown
+	tablePickerError    error
+
+	// Schema diff state
+	schemaDiffLoading bool
+	schemaDiff        *schemadiff.Result
+	schemaDiffLines   []string // schemaDiff as a unified diff
+	schemaDiffError   error
+	schemaDiffOffset  int // first diff line shown
+
+	// Hook state
+	hookOutput  chan HookOutputMsg // output of the hooks run around a backup or restore
+	progressLog []string           // latest hook output, shown under the progress message
+
+	// Backup browser state
+	browserBackups []pgbackup.Verification // backups in the directory entered as the backup path
+	browserChoice  int                     // index into browserBackups, or "Back" after them
+	browserError   error
+	browserLoading bool // verifying the backups in the background
+
+	// Dashboard state
+	dashboardLoading bool
+	dashboardResults []rpo.Result
+	dashboardError   error
+
+	// Export state
+	exportLoading    bool     // listing the tables for the picker
+	exportTables     []string // tables offered in the picker, as "schema.name"
+	exportSelected   []bool   // picked tables, by index into exportTables
+	exportChoice     int      // index into exportTables
+	exportOffset     int      // first table shown
+	exportListError  error
+	exportInProgress bool
+	exportFinished   bool
+	exportError      error
+	exportMessage    string
+
+	// Catalog search state
+	searchLoading bool
+	searchLines   []string // rendered matches
+	searchError   error
+	searchOffset  int // first result line shown
+
+	// Clone state
+	cloneInProgress bool
+	cloneFinished   bool
+	cloneError      error
+	cloneMessage    string
+	cloneStatus     pgclone.Progress
+	cloneProgress   chan PgCloneProgressMsg
 }
 
 // NewModel initializes the model with the required text inputs.
@@ -105,7 +213,7 @@ func setupRestoreInputs() []textinput.Model {
 		"postgres",
 		"password",
 		"mydatabase_restored",
-		"/path/to/backup.sql",
+		"/path/to/backup.sql or a directory to browse",
 	}
 
 	for i := range inputs {
@@ -125,6 +233,31 @@ func setupRestoreInputs() []textinput.Model {
 	return inputs
 }
 
+// displayValue returns the value of input i as shown in summaries, with
+// passwords masked.
+func (m Model) displayValue(i int) string {
+	if m.inputs[i].EchoMode == textinput.EchoPassword {
+		return strings.Repeat("•", len(m.inputs[i].Value()))
+	}
+	return m.inputs[i].Value()
+}
+
+// formTitle names the operation a form configures.
+func formTitle(form viewState) string {
+	switch form {
+	case restoreForm:
+		return "Restore"
+	case cloneForm:
+		return "Clone"
+	case exportForm:
+		return "Export"
+	case searchForm:
+		return "Search"
+	default:
+		return "Backup"
+	}
+}
+
 // Init kicks off the event loop.
 func (m Model) Init() tea.Cmd {
 	return textinput.Blink
@@ -171,10 +304,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.backupFinished = true
 		m.backupError = msg.Err
 		m.outputPath = msg.OutputPath
+		m.clientBinary = msg.Binary
 		if msg.Err != nil {
 			m.backupMessage = fmt.Sprintf("Backup failed: %v", msg.Err)
 		} else {
 			m.backupMessage = "Backup completed successfully!"
+			if msg.Note != "" {
+				m.backupMessage += "\n" + msg.Note
+			}
 		}
 		m.quitting = true
 		return m, tea.Quit
@@ -190,29 +327,140 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.restoreInProgress = false
 		m.restoreFinished = true
 		m.restoreError = msg.Err
+		m.clientBinary = msg.Binary
 		if msg.Err != nil {
 			m.restoreMessage = fmt.Sprintf("Restore failed: %v", msg.Err)
 		} else {
 			m.restoreMessage = "Restore completed successfully!"
+			if msg.Note != "" {
+				m.restoreMessage += "\n" + msg.Note
+			}
 		}
+		if len(msg.Steps) > 0 {
+			m.restoreMessage += "\n\nPost-restore maintenance:\n  " + strings.Join(msg.Steps, "\n  ")
+		}
+		m.comparison = msg.Comparison
 		m.quitting = true
 		return m, tea.Quit
 	case PgRestoreProgressMsg:
 		m.restoreMessage = string(msg)
+		return m, waitForRestoreProgress(m.restoreProgress)
+	case HookOutputMsg:
+		m.progressLog = append(m.progressLog, string(msg))
+		if len(m.progressLog) > progressLogLines {
+			m.progressLog = m.progressLog[len(m.progressLog)-progressLogLines:]
+		}
+		return m, waitForHookOutput(m.hookOutput)
+	// Clone messages
+	case PgCloneFinishedMsg:
+		m.cloneInProgress = false
+		m.cloneFinished = true
+		m.cloneError = msg.Err
+		m.clientBinary = msg.Binary
+		if msg.Err != nil {
+			m.cloneMessage = fmt.Sprintf("Clone failed: %v", msg.Err)
+		} else {
+			m.cloneMessage = "Clone completed successfully!"
+			if msg.Note != "" {
+				m.cloneMessage += "\n" + msg.Note
+			}
+		}
+		m.quitting = true
+		return m, tea.Quit
+	case PgCloneProgressMsg:
+		m.cloneStatus = pgclone.Progress(msg)
+		return m, waitForCloneProgress(m.cloneProgress)
+	// Export messages
+	case ExportTablesLoadedMsg:
+		m.exportLoading = false
+		m.exportTables = msg.Tables
+		m.exportSelected = make([]bool, len(msg.Tables))
+		m.exportListError = msg.Err
+		return m, nil
+	case ExportFinishedMsg:
+		m.exportInProgress = false
+		m.exportFinished = true
+		m.exportError = msg.Err
+		if msg.Err != nil {
+			m.exportMessage = fmt.Sprintf("Export failed: %v", msg.Err)
+		} else {
+			m.exportMessage = "Export completed successfully!"
+			if msg.Note != "" {
+				m.exportMessage += "\n" + msg.Note
+			}
+		}
+		m.quitting = true
+		return m, tea.Quit
+	// Backup browser messages
+	case BackupsVerifiedMsg:
+		return m.backupsVerified(msg), nil
+	// Catalog search messages
+	case SearchFinishedMsg:
+		m.searchLoading = false
+		m.searchLines = msg.Lines
+		m.searchError = msg.Err
+		return m, nil
+	// Dashboard messages
+	case FreshnessCheckedMsg:
+		m.dashboardLoading = false
+		m.dashboardResults = msg.Results
+		m.dashboardError = msg.Err
+		return m, nil
+	// Restore table picker messages
+	case RestoreTablesLoadedMsg:
+		return m.tablesLoaded(msg), nil
+	// Schema diff messages
+	case SchemaDiffLoadedMsg:
+		m.schemaDiffLoading = false
+		m.schemaDiff = msg.Result
+		m.schemaDiffError = msg.Err
+		if msg.Result != nil {
+			m.schemaDiffLines = msg.Result.Lines()
+		}
+		return m, nil
+	// Pre-flight messages
+	case PreflightFinishedMsg:
+		m.preflightRunning = false
+		m.preflightReport = &msg.Report
+		m.currentView = preflightScreen
+		m.focusedButton = 0
+		if !msg.Report.Blocking() {
+			m.focusedButton = 1
+		}
 		return m, nil
 	}
 
-	if m.backupInProgress || m.restoreInProgress {
+	if m.backupInProgress || m.restoreInProgress || m.cloneInProgress || m.exportInProgress || m.preflightRunning {
 		return m, nil
 	}
 
 	switch m.currentView {
 	case mainMenu:
 		return m.updateMainMenu(msg)
+	case backupChoiceMenu:
+		return m.updateBackupChoiceMenu(msg)
 	case restoreChoiceMenu:
 		return m.updateRestoreChoiceMenu(msg)
-	case backupForm, restoreForm:
+	case maskingMenu:
+		return m.updateMaskingMenu(msg)
+	case backupBrowser:
+		return m.updateBrowser(msg)
+	case dashboard:
+		return m.updateDashboard(msg)
+	case schemaDiffView:
+		return m.updateSchemaDiff(msg)
+	case exportPicker:
+		return m.updateExportPicker(msg)
+	case restoreTablePicker:
+		return m.updateTablePicker(msg)
+	case searchResults:
+		return m.updateSearchResults(msg)
+	case backupForm, restoreForm, cloneForm, exportForm, searchForm:
 		return m.updateForm(msg)
+	case reviewScreen:
+		return m.updateReview(msg)
+	case preflightScreen:
+		return m.updatePreflight(msg)
 	}
 
 	return m, nil
@@ -222,15 +470,52 @@ func (m Model) updateMainMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.Type {
-		case tea.KeyUp, tea.KeyDown:
-			m.mainMenuChoice = 1 - m.mainMenuChoice // Toggle
+		case tea.KeyUp:
+			m.mainMenuChoice = (m.mainMenuChoice + 5) % 6
+		case tea.KeyDown:
+			m.mainMenuChoice = (m.mainMenuChoice + 1) % 6
 		case tea.KeyEnter:
-			if m.mainMenuChoice == 0 { // Backup
-				m.currentView = backupForm
-				m.inputs = setupBackupInputs()
-			} else { // Restore
+			switch m.mainMenuChoice {
+			case 0: // Backup
+				m.currentView = backupChoiceMenu
+			case 1: // Restore
 				m.currentView = restoreChoiceMenu
+			case 2: // Clone
+				m.currentView = cloneForm
+				m.inputs = setupCloneInputs()
+			case 3: // Freshness dashboard
+				m.currentView = dashboard
+				m.dashboardLoading = true
+				return m, RunFreshnessCheckCmd()
+			case 4: // Export
+				m.currentView = exportForm
+				m.inputs = setupExportInputs()
+			default: // Catalog search
+				m.currentView = searchForm
+				m.inputs = setupSearchInputs()
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m Model) updateBackupChoiceMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyUp:
+			m.backupMenuChoice = (m.backupMenuChoice + len(backupEngines) - 1) % len(backupEngines)
+		case tea.KeyDown:
+			m.backupMenuChoice = (m.backupMenuChoice + 1) % len(backupEngines)
+		case tea.KeyEnter:
+			m.backupEngine = backupEngines[m.backupMenuChoice]
+			m.maskingRulesets = availableRulesets()
+			if len(m.maskingRulesets) > 0 {
+				m.currentView = maskingMenu
+				return m, nil
 			}
+			m.currentView = backupForm
+			m.inputs = setupBackupInputs()
 		}
 	}
 	return m, nil
@@ -240,12 +525,15 @@ func (m Model) updateRestoreChoiceMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.Type {
-		case tea.KeyUp, tea.KeyDown:
-			m.restoreMenuChoice = 1 - m.restoreMenuChoice // Toggle
+		case tea.KeyUp:
+			m.restoreMenuChoice = (m.restoreMenuChoice + len(restoreModes) - 1) % len(restoreModes)
+		case tea.KeyDown:
+			m.restoreMenuChoice = (m.restoreMenuChoice + 1) % len(restoreModes)
 		case tea.KeyEnter:
-			m.restoreNewDB = m.restoreMenuChoice == 1 // 1 is "Create new database"
+			m.restoreMode = restoreModes[m.restoreMenuChoice]
 			m.currentView = restoreForm
 			m.inputs = setupRestoreInputs()
+			m.restoreTables = nil
 		case tea.KeyEsc: // Go back to main menu
 			m.currentView = mainMenu
 		}
@@ -274,16 +562,15 @@ func (m Model) updateForm(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		case tea.KeyEnter:
 			if m.focusOnInput {
-				if m.step == len(m.inputs)-1 {
-					m.submitted = true
-					if m.currentView == backupForm {
-						return m, RunPgDumpCmd(m)
-					}
-					return m, RunPgRestoreCmd(m)
+				if m.step == len(m.inputs)-1 || m.editingFromReview {
+					return m.openReview()
 				}
 				m.nextStep()
 			} else {
 				if m.focusedButton == 0 { // Back
+					if m.editingFromReview {
+						return m.openReview()
+					}
 					if m.step == 0 {
 						m.currentView = mainMenu
 						m.step = 0 // Reset form state
@@ -291,12 +578,8 @@ func (m Model) updateForm(msg tea.Msg) (tea.Model, tea.Cmd) {
 						m.prevStep()
 					}
 				} else { // Next/Submit
-					if m.step == len(m.inputs)-1 {
-						m.submitted = true
-						if m.currentView == backupForm {
-							return m, RunPgDumpCmd(m)
-						}
-						return m, RunPgRestoreCmd(m)
+					if m.step == len(m.inputs)-1 || m.editingFromReview {
+						return m.openReview()
 					}
 					m.nextStep()
 				}
@@ -326,6 +609,15 @@ func (m Model) View() string {
 	if m.restoreInProgress {
 		return m.viewProgress("Restore in progress...", m.restoreMessage)
 	}
+	if m.cloneInProgress {
+		return m.viewCloneProgress()
+	}
+	if m.exportInProgress {
+		return m.viewProgress("Export in progress...", fmt.Sprintf("Exporting %d tables.", m.exportPicked()))
+	}
+	if m.preflightRunning {
+		return m.viewProgress("Running pre-flight checks...", "Checking connectivity, privileges and client tools.")
+	}
 
 	if m.submitted {
 		return m.viewPreSubmit()
@@ -334,10 +626,30 @@ func (m Model) View() string {
 	switch m.currentView {
 	case mainMenu:
 		return m.viewMainMenu()
+	case backupChoiceMenu:
+		return m.viewBackupChoiceMenu()
 	case restoreChoiceMenu:
 		return m.viewRestoreChoiceMenu()
-	case backupForm, restoreForm:
+	case maskingMenu:
+		return m.viewMaskingMenu()
+	case backupBrowser:
+		return m.viewBrowser()
+	case dashboard:
+		return m.viewDashboard()
+	case schemaDiffView:
+		return m.viewSchemaDiff()
+	case exportPicker:
+		return m.viewExportPicker()
+	case restoreTablePicker:
+		return m.viewTablePicker()
+	case searchResults:
+		return m.viewSearchResults()
+	case backupForm, restoreForm, cloneForm, exportForm, searchForm:
 		return m.viewForm()
+	case reviewScreen:
+		return m.viewReview()
+	case preflightScreen:
+		return m.viewPreflight()
 	default:
 		return "Something went wrong."
 	}
@@ -360,6 +672,14 @@ func (m Model) viewSummary() string {
 		err = m.restoreError
 		msg = m.restoreMessage
 		title = "Restore"
+	} else if m.cloneFinished {
+		err = m.cloneError
+		msg = m.cloneMessage
+		title = "Clone"
+	} else if m.exportFinished {
+		err = m.exportError
+		msg = m.exportMessage
+		title = "Export"
 	}
 
 	if err != nil {
@@ -372,6 +692,13 @@ func (m Model) viewSummary() string {
 		if m.outputPath != "" {
 			b.WriteString(fmt.Sprintf("\nBackup file: %s", greenTextValue.Render(m.outputPath)))
 		}
+		if m.clientBinary != "" {
+			b.WriteString(fmt.Sprintf("\nClient: %s", greenTextValue.Render(m.clientBinary)))
+		}
+	}
+	if m.comparison != nil {
+		b.WriteString("\n\n")
+		b.WriteString(renderComparison(m.comparison))
 	}
 	b.WriteString("\n\nPress any key to exit.")
 	return b.String()
@@ -385,6 +712,10 @@ func (m Model) viewProgress(title, message string) string {
 		title,
 		greyText.Render(message),
 	))
+	if len(m.progressLog) > 0 {
+		b.WriteString("\n\n")
+		b.WriteString(whiteText.Render(strings.Join(m.progressLog, "\n")))
+	}
 	b.WriteString("\n\n")
 	b.WriteString(helpStyle.Render("ctrl+c: cancel"))
 	return b.String()
@@ -392,19 +723,11 @@ func (m Model) viewProgress(title, message string) string {
 
 func (m Model) viewPreSubmit() string {
 	var b strings.Builder
-	title := "Backup"
-	if m.currentView == restoreForm {
-		title = "Restore"
-	}
+	title := formTitle(m.formView)
 	b.WriteString(summaryStyle.Render(fmt.Sprintf("%s configuration summary:", title)))
 	b.WriteString("\n\n")
 	for i := range m.inputs {
-		var value string
-		if i == 2 { // Password
-			value = strings.Repeat("•", len(m.inputs[i].Value()))
-		} else {
-			value = m.inputs[i].Value()
-		}
+		value := m.displayValue(i)
 		line := fmt.Sprintf("%s %s", greenTextPrompt.Render(m.inputs[i].Prompt), greenTextValue.Render(value))
 		b.WriteString(line)
 		b.WriteRune('\n')
@@ -422,35 +745,81 @@ func (m Model) viewMainMenu() string {
 
 	backup := "[ ] Create a new backup"
 	restore := "[ ] Restore from a backup file"
+	clone := "[ ] Clone a database to another server"
+	freshness := "[ ] Check backup freshness"
+	export := "[ ] Export tables to CSV, TSV or JSON Lines"
+	search := "[ ] Search the backups for a table, column or function"
 
-	if m.mainMenuChoice == 0 {
+	switch m.mainMenuChoice {
+	case 0:
 		backup = focusedButton.Render("[x] Create a new backup")
-	} else {
+	case 1:
 		restore = focusedButton.Render("[x] Restore from a backup file")
+	case 2:
+		clone = focusedButton.Render("[x] Clone a database to another server")
+	case 3:
+		freshness = focusedButton.Render("[x] Check backup freshness")
+	case 4:
+		export = focusedButton.Render("[x] Export tables to CSV, TSV or JSON Lines")
+	default:
+		search = focusedButton.Render("[x] Search the backups for a table, column or function")
+	}
+
+	b.WriteString(lipgloss.JoinVertical(lipgloss.Left, backup, restore, clone, freshness, export, search))
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("up/down: select • enter: confirm • ctrl+c: quit"))
+	return b.String()
+}
+
+func (m Model) viewBackupChoiceMenu() string {
+	var b strings.Builder
+	b.WriteString(welcomeStyle.Render("Create Backup"))
+	b.WriteString("\n\n")
+	b.WriteString("Choose a dump engine:\n\n")
+
+	var options []string
+	for i, engine := range backupEngines {
+		if i == m.backupMenuChoice {
+			options = append(options, focusedButton.Render("[x] "+engineLabel(engine)))
+		} else {
+			options = append(options, "[ ] "+engineLabel(engine))
+		}
 	}
 
-	b.WriteString(lipgloss.JoinVertical(lipgloss.Left, backup, restore))
+	b.WriteString(lipgloss.JoinVertical(lipgloss.Left, options...))
 	b.WriteString("\n\n")
 	b.WriteString(helpStyle.Render("up/down: select • enter: confirm • ctrl+c: quit"))
 	return b.String()
 }
 
+// engineLabel describes a dump engine in the backup choice menu and review.
+func engineLabel(engine pgbackup.Engine) string {
+	switch engine {
+	case pgbackup.EngineGo:
+		return "Dump with the built-in Go engine (no pg_dump needed)"
+	case pgbackup.EnginePgDump:
+		return "Dump with pg_dump"
+	default:
+		return "Dump with pg_dump (falls back to the Go engine if it is missing)"
+	}
+}
+
 func (m Model) viewRestoreChoiceMenu() string {
 	var b strings.Builder
 	b.WriteString(welcomeStyle.Render("Restore Database"))
 	b.WriteString("\n\n")
 	b.WriteString("Choose a restore option:\n\n")
 
-	existing := "[ ] Restore to an existing database"
-	newDB := "[ ] Create a new database and restore into it"
-
-	if m.restoreMenuChoice == 0 {
-		existing = focusedButton.Render("[x] Restore to an existing database")
-	} else {
-		newDB = focusedButton.Render("[x] Create a new database and restore into it")
+	var options []string
+	for i, mode := range restoreModes {
+		if i == m.restoreMenuChoice {
+			options = append(options, focusedButton.Render("[x] "+mode.String()))
+		} else {
+			options = append(options, "[ ] "+mode.String())
+		}
 	}
 
-	b.WriteString(lipgloss.JoinVertical(lipgloss.Left, existing, newDB))
+	b.WriteString(lipgloss.JoinVertical(lipgloss.Left, options...))
 	b.WriteString("\n\n")
 	b.WriteString(helpStyle.Render("up/down: select • enter: confirm • esc: back • ctrl+c: quit"))
 	return b.String()
@@ -459,10 +828,7 @@ func (m Model) viewRestoreChoiceMenu() string {
 func (m Model) viewForm() string {
 	var b strings.Builder
 
-	title := "Backup"
-	if m.currentView == restoreForm {
-		title = "Restore"
-	}
+	title := formTitle(m.currentView)
 
 	b.WriteString(welcomeStyle.Render(fmt.Sprintf("PostgreSQL %s Wizard", title)))
 	b.WriteString("\n\n")
@@ -482,12 +848,7 @@ func (m Model) viewForm() string {
 
 	// Staged answers
 	for i := 0; i < m.step; i++ {
-		var value string
-		if i == 2 { // Password
-			value = strings.Repeat("•", len(m.inputs[i].Value()))
-		} else {
-			value = m.inputs[i].Value()
-		}
+		value := m.displayValue(i)
 		line := fmt.Sprintf("%s %s", greenTextPrompt.Render(m.inputs[i].Prompt), greenTextValue.Render(value))
 		b.WriteString(line)
 		b.WriteRune('\n')
@@ -514,8 +875,14 @@ func (m Model) viewForm() string {
 
 	backButton = backStyle.Render("[ Back ]")
 
-	if m.step == len(m.inputs)-1 {
-		nextButton = nextStyle.Render("[ Submit ]")
+	if m.editingFromReview {
+		nextButton = nextStyle.Render("[ Done ]")
+	} else if m.step == len(m.inputs)-1 && m.currentView == exportForm {
+		nextButton = nextStyle.Render("[ Choose Tables ]")
+	} else if m.step == len(m.inputs)-1 && m.currentView == searchForm {
+		nextButton = nextStyle.Render("[ Search ]")
+	} else if m.step == len(m.inputs)-1 {
+		nextButton = nextStyle.Render("[ Review ]")
 	} else {
 		nextButton = nextStyle.Render("[ Next ]")
 	}
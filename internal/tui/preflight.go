@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/curtisbraxdale/go-pg-backup/internal/preflight"
+)
+
+func (m Model) updatePreflight(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyLeft, tea.KeyRight, tea.KeyTab, tea.KeyShiftTab:
+			m.focusedButton = 1 - m.focusedButton // Toggle
+		case tea.KeyEnter:
+			if m.focusedButton == 0 { // Back to the review screen
+				m.currentView = reviewScreen
+				return m, nil
+			}
+			if m.preflightReport.Blocking() {
+				return m, nil
+			}
+			m.submitted = true
+			if m.formView == backupForm {
+				m.backupInProgress = true
+				m.backupMessage = "Backup started..."
+				m.hookOutput = make(chan HookOutputMsg, 16)
+				return m, tea.Batch(RunPgDumpCmd(m), waitForHookOutput(m.hookOutput))
+			}
+			if m.formView == cloneForm {
+				m.cloneInProgress = true
+				m.cloneProgress = make(chan PgCloneProgressMsg, 1)
+				return m, tea.Batch(RunPgCloneCmd(m), waitForCloneProgress(m.cloneProgress))
+			}
+			m.restoreInProgress = true
+			m.restoreMessage = "Restore started..."
+			m.restoreProgress = make(chan PgRestoreProgressMsg, 1)
+			m.hookOutput = make(chan HookOutputMsg, 16)
+			return m, tea.Batch(RunPgRestoreCmd(m), waitForRestoreProgress(m.restoreProgress), waitForHookOutput(m.hookOutput))
+		}
+	}
+	return m, nil
+}
+
+func (m Model) viewPreflight() string {
+	var b strings.Builder
+	b.WriteString(welcomeStyle.Render("Pre-flight Checks"))
+	b.WriteString("\n\n")
+	b.WriteString(renderChecklist(*m.preflightReport))
+	b.WriteString("\n")
+
+	if m.preflightReport.Blocking() {
+		b.WriteString(errorStyle.Render("Fix the failed checks before running."))
+	} else {
+		b.WriteString(greenTextPrompt.Render("Ready to run."))
+	}
+	b.WriteString("\n\n")
+
+	backStyle, runStyle := blurredButton, blurredButton
+	if m.focusedButton == 0 {
+		backStyle = focusedButton
+	} else {
+		runStyle = focusedButton
+	}
+	if m.preflightReport.Blocking() {
+		runStyle = greyText.Padding(0, 1)
+	}
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Left, backStyle.Render("[ Back ]"), " ", runStyle.Render("[ Run ]")))
+	b.WriteString("\n")
+	b.WriteString(helpStyle.Render("left/right: switch buttons • enter: select • ctrl+c: quit"))
+	return b.String()
+}
+
+// renderChecklist renders a pre-flight report with one styled line per check.
+func renderChecklist(r preflight.Report) string {
+	var b strings.Builder
+	for _, c := range r.Checks {
+		var mark string
+		switch c.Status {
+		case preflight.Pass:
+			mark = greenTextPrompt.Render("✓")
+		case preflight.Warn:
+			mark = cancelledStyle.Render("!")
+		default:
+			mark = errorStyle.Render("✗")
+		}
+		b.WriteString(fmt.Sprintf("%s %s %s\n", mark, whiteText.Render(c.Name+":"), greyText.Render(c.Detail)))
+	}
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+)
+
+// restoreTablesPageLines is how many tables the restore table picker shows at once.
+const restoreTablesPageLines = 15
+
+// LoadRestoreTablesCmd lists the tables of the backup being restored in the
+// background.
+func LoadRestoreTablesCmd(m Model) tea.Cmd {
+	backupPath := m.inputs[4].Value()
+	return func() tea.Msg {
+		tables, err := pgrestore.ListTables(backupPath)
+		return RestoreTablesLoadedMsg{Tables: tables, Err: err}
+	}
+}
+
+// canPickTables reports whether the review screen offers restoring chosen
+// tables only, which needs a target that is not dropped or swapped.
+func (m Model) canPickTables() bool {
+	return m.formView == restoreForm && (m.restoreMode == pgrestore.ModeExisting || m.restoreMode == pgrestore.ModeCreate)
+}
+
+// openTablePicker leaves the review screen for the restore table picker and
+// starts listing the tables of the backup.
+func (m Model) openTablePicker() (tea.Model, tea.Cmd) {
+	m.currentView = restoreTablePicker
+	m.tablePickerLoading = true
+	m.tablePickerTables = nil
+	m.tablePickerSelected = nil
+	m.tablePickerChoice = 0
+	m.tablePickerOffset = 0
+	m.tablePickerError = nil
+	return m, LoadRestoreTablesCmd(m)
+}
+
+func (m Model) updateTablePicker(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case msg.Type == tea.KeyBackspace:
+			m.currentView = reviewScreen
+			return m, nil
+		case m.tablePickerLoading || len(m.tablePickerTables) == 0:
+			return m, nil
+		case msg.Type == tea.KeyUp:
+			m.tablePickerChoice = (m.tablePickerChoice + len(m.tablePickerTables) - 1) % len(m.tablePickerTables)
+		case msg.Type == tea.KeyDown:
+			m.tablePickerChoice = (m.tablePickerChoice + 1) % len(m.tablePickerTables)
+		case msg.Type == tea.KeySpace:
+			m.tablePickerSelected[m.tablePickerChoice] = !m.tablePickerSelected[m.tablePickerChoice]
+		case msg.String() == "a":
+			all := len(m.pickedTables()) < len(m.tablePickerTables)
+			for i := range m.tablePickerSelected {
+				m.tablePickerSelected[i] = all
+			}
+		case msg.Type == tea.KeyEnter:
+			// Picking none, or all of them, restores the whole backup.
+			m.restoreTables = nil
+			if picked := m.pickedTables(); len(picked) < len(m.tablePickerTables) {
+				m.restoreTables = picked
+			}
+			m.restoreTablesFrom = m.inputs[4].Value()
+			m.currentView = reviewScreen
+			return m, nil
+		}
+		// Keep the choice on the page shown.
+		if m.tablePickerChoice < m.tablePickerOffset {
+			m.tablePickerOffset = m.tablePickerChoice
+		} else if m.tablePickerChoice >= m.tablePickerOffset+restoreTablesPageLines {
+			m.tablePickerOffset = m.tablePickerChoice - restoreTablesPageLines + 1
+		}
+	}
+	return m, nil
+}
+
+// tablesLoaded fills the picker with the tables of the backup, keeping
+// the tables picked before.
+func (m Model) tablesLoaded(msg RestoreTablesLoadedMsg) Model {
+	m.tablePickerLoading = false
+	m.tablePickerTables = msg.Tables
+	m.tablePickerError = msg.Err
+	m.tablePickerSelected = make([]bool, len(msg.Tables))
+	for i, table := range msg.Tables {
+		for _, picked := range m.restoreTables {
+			if table == picked {
+				m.tablePickerSelected[i] = true
+			}
+		}
+	}
+	return m
+}
+
+// pickedTables returns the tables picked in the restore table picker.
+func (m Model) pickedTables() []string {
+	var picked []string
+	for i, table := range m.tablePickerTables {
+		if m.tablePickerSelected[i] {
+			picked = append(picked, table)
+		}
+	}
+	return picked
+}
+
+func (m Model) viewTablePicker() string {
+	var b strings.Builder
+	b.WriteString(welcomeStyle.Render("Restore Tables"))
+	b.WriteString("\n\n")
+
+	switch {
+	case m.tablePickerLoading:
+		b.WriteString(greyText.Render("Reading the tables of the backup..."))
+	case m.tablePickerError != nil:
+		b.WriteString(errorStyle.Render(m.tablePickerError.Error()))
+	case len(m.tablePickerTables) == 0:
+		b.WriteString(greyText.Render("The backup has no tables."))
+	default:
+		b.WriteString(fmt.Sprintf("Choose the tables of %s to restore:\n\n", m.inputs[4].Value()))
+		var lines []string
+		end := min(m.tablePickerOffset+restoreTablesPageLines, len(m.tablePickerTables))
+		for i := m.tablePickerOffset; i < end; i++ {
+			box := "[ ] "
+			if m.tablePickerSelected[i] {
+				box = "[x] "
+			}
+			if i == m.tablePickerChoice {
+				lines = append(lines, focusedButton.Render("> "+box+m.tablePickerTables[i]))
+			} else {
+				lines = append(lines, blurredButton.Render("  "+box+m.tablePickerTables[i]))
+			}
+		}
+		b.WriteString(lipgloss.JoinVertical(lipgloss.Left, lines...))
+		b.WriteString("\n\n")
+		picked := len(m.pickedTables())
+		if picked == 0 {
+			b.WriteString(greyText.Render(fmt.Sprintf("No tables picked, all %d are restored", len(m.tablePickerTables))))
+		} else {
+			b.WriteString(greyText.Render(fmt.Sprintf("%d of %d tables picked", picked, len(m.tablePickerTables))))
+		}
+	}
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("up/down: select • space: pick • a: pick all • enter: done • backspace: back • ctrl+c: quit"))
+	return b.String()
+}
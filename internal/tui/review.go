@@ -0,0 +1,333 @@
+package tui
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgbackup"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+)
+
+// openReview leaves the form and shows the review-and-confirm screen.
+func (m Model) openReview() (tea.Model, tea.Cmd) {
+	if m.currentView == exportForm { // Nothing to confirm, the export only reads
+		return m.openExportPicker()
+	}
+	if m.currentView == searchForm { // Nothing to confirm, the search only reads
+		return m.openSearchResults()
+	}
+	if m.currentView == restoreForm && isDir(m.inputs[4].Value()) {
+		return m.openBrowser()
+	}
+	if m.currentView == backupForm || m.currentView == restoreForm || m.currentView == cloneForm {
+		m.formView = m.currentView
+	}
+	m.inputs[m.step].Blur()
+	m.currentView = reviewScreen
+	m.editingFromReview = false
+	m.focusOnInput = true
+	m.focusedButton = 1
+
+	if m.formView == backupForm {
+		m.pendingOutputPath = pgbackup.OutputPath(m.inputs[4].Value(), m.inputs[3].Value())
+		m.resolvedEngine = pgbackup.SelectEngine(pgbackup.Options{Engine: m.backupEngine})
+	} else if m.formView == restoreForm {
+		m.restoreEngine = pgrestore.SelectEngine(pgrestore.Options{})
+		m.restoreTrust = nil
+		if m.restoreTablesFrom != m.inputs[4].Value() { // Picked from another backup
+			m.restoreTables = nil
+		}
+		if v := pgbackup.VerifyBackup(m.inputs[4].Value(), trustedKeys()); v.Manifest != nil {
+			m.restoreTrust = &v
+		}
+	}
+
+	// A new input each time, so a name typed for an earlier run never
+	// confirms this one.
+	if m.needsTypedConfirmation() {
+		m.confirmInput = textinput.New()
+		m.confirmInput.Prompt = "Type the database name to confirm: "
+		m.confirmInput.CharLimit = 256
+		m.confirmInput.Width = 50
+		m.confirmInput.PromptStyle = pinkTextPrompt
+		m.confirmInput.TextStyle = whiteText
+	}
+	m.reviewChoice = m.runItem()
+	m.syncConfirmFocus()
+	return m, nil
+}
+
+// needsTypedConfirmation reports whether the run must be confirmed by typing
+// the database name, which is the case when restoring over an existing database.
+func (m Model) needsTypedConfirmation() bool {
+	return m.formView == restoreForm && m.restoreMode.Destructive()
+}
+
+// confirmItem returns the review item index of the typed confirmation, or -1.
+func (m Model) confirmItem() int {
+	if m.needsTypedConfirmation() {
+		return len(m.inputs)
+	}
+	return -1
+}
+
+// runItem returns the review item index of the run button.
+func (m Model) runItem() int {
+	if m.needsTypedConfirmation() {
+		return len(m.inputs) + 1
+	}
+	return len(m.inputs)
+}
+
+// confirmed reports whether the run button may be used.
+func (m Model) confirmed() bool {
+	if m.formView == cloneForm {
+		_, err := m.cloneJobs()
+		return err == nil
+	}
+	if !m.needsTypedConfirmation() {
+		return true
+	}
+	return m.confirmInput.Value() == m.inputs[3].Value()
+}
+
+func (m *Model) syncConfirmFocus() {
+	if !m.needsTypedConfirmation() {
+		return
+	}
+	if m.reviewChoice == m.confirmItem() {
+		m.confirmInput.Focus()
+	} else {
+		m.confirmInput.Blur()
+	}
+}
+
+func (m Model) updateReview(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyUp, tea.KeyShiftTab:
+			if m.reviewChoice > 0 {
+				m.reviewChoice--
+			}
+			m.syncConfirmFocus()
+			return m, nil
+		case tea.KeyDown, tea.KeyTab:
+			if m.reviewChoice < m.runItem() {
+				m.reviewChoice++
+			}
+			m.syncConfirmFocus()
+			return m, nil
+		case tea.KeyCtrlD:
+			if m.canDiffSchema() {
+				return m.openSchemaDiff()
+			}
+			return m, nil
+		case tea.KeyCtrlT:
+			if m.canPickTables() {
+				return m.openTablePicker()
+			}
+			return m, nil
+		case tea.KeyEnter:
+			switch {
+			case m.reviewChoice < len(m.inputs): // Jump back to the field
+				m.currentView = m.formView
+				m.step = m.reviewChoice
+				m.editingFromReview = true
+				m.focusOnInput = true
+				m.inputs[m.step].Focus()
+				return m, nil
+			case m.reviewChoice == m.confirmItem():
+				m.reviewChoice = m.runItem()
+				m.syncConfirmFocus()
+				return m, nil
+			case m.reviewChoice == m.runItem():
+				if !m.confirmed() {
+					return m, nil
+				}
+				m.preflightRunning = true
+				return m, RunPreflightCmd(m)
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	if m.reviewChoice == m.confirmItem() {
+		m.confirmInput, cmd = m.confirmInput.Update(msg)
+	}
+	return m, cmd
+}
+
+func (m Model) viewReview() string {
+	var b strings.Builder
+
+	title := formTitle(m.formView)
+
+	b.WriteString(welcomeStyle.Render(fmt.Sprintf("Review %s", title)))
+	b.WriteString("\n\n")
+
+	for i := range m.inputs {
+		value := m.displayValue(i)
+		line := fmt.Sprintf("%s %s", greenTextPrompt.Render(m.inputs[i].Prompt), greenTextValue.Render(value))
+		if i == m.reviewChoice {
+			line = focusedButton.Render(">") + line
+		} else {
+			line = blurredButton.Render(" ") + line
+		}
+		b.WriteString(line)
+		b.WriteRune('\n')
+	}
+	if m.formView == restoreForm {
+		b.WriteString(blurredButton.Render(" "))
+		b.WriteString(fmt.Sprintf("%s %s\n", greenTextPrompt.Render("Mode:"), greenTextValue.Render(m.restoreMode.String())))
+		if len(m.restoreTables) > 0 {
+			b.WriteString(blurredButton.Render(" "))
+			b.WriteString(fmt.Sprintf("%s %s\n", greenTextPrompt.Render("Tables:"), greenTextValue.Render(strings.Join(m.restoreTables, ", "))))
+		}
+		if m.restoreTrust != nil {
+			b.WriteString(blurredButton.Render(" "))
+			b.WriteString(fmt.Sprintf("%s %s\n", greenTextPrompt.Render("Signature:"), trustBadge(m.restoreTrust.Trust)))
+		}
+	}
+	if m.formView == backupForm {
+		b.WriteString(blurredButton.Render(" "))
+		b.WriteString(fmt.Sprintf("%s %s\n", greenTextPrompt.Render("Engine:"), greenTextValue.Render(engineLabel(m.backupEngine))))
+		if m.maskingRuleset != "" {
+			b.WriteString(blurredButton.Render(" "))
+			b.WriteString(fmt.Sprintf("%s %s\n", greenTextPrompt.Render("Masking:"), greenTextValue.Render(m.maskingRuleset)))
+		}
+	}
+	if m.formView == cloneForm {
+		if _, err := m.cloneJobs(); err != nil {
+			b.WriteString(blurredButton.Render(" "))
+			b.WriteString(errorStyle.Render(err.Error()))
+			b.WriteString("\n")
+		}
+	}
+	if m.pendingOutputPath != "" && m.formView == backupForm {
+		b.WriteString(blurredButton.Render(" "))
+		b.WriteString(fmt.Sprintf("%s %s\n", greenTextPrompt.Render("Backup File:"), greenTextValue.Render(m.pendingOutputPath)))
+	}
+
+	b.WriteString("\n")
+	b.WriteString(greyText.Render("Command:"))
+	b.WriteString("\n")
+	b.WriteString(whiteText.Render(m.previewCommand()))
+	b.WriteString("\n\n")
+
+	if m.needsTypedConfirmation() {
+		warning := fmt.Sprintf("Restoring into the existing database %q will overwrite its contents.", m.inputs[3].Value())
+		switch m.restoreMode {
+		case pgrestore.ModeRecreate:
+			warning = fmt.Sprintf("The database %q will be dropped and recreated. A safety backup is taken first.", m.inputs[3].Value())
+		case pgrestore.ModeSwap:
+			warning = fmt.Sprintf("The database %q will be replaced once the staging copy is restored. The old one is kept for rollback.", m.inputs[3].Value())
+		}
+		b.WriteString(errorStyle.Render(warning))
+		b.WriteString("\n")
+		if m.reviewChoice == m.confirmItem() {
+			b.WriteString(focusedButton.Render(">"))
+		} else {
+			b.WriteString(blurredButton.Render(" "))
+		}
+		b.WriteString(m.confirmInput.View())
+		b.WriteString("\n\n")
+	}
+
+	runLabel := fmt.Sprintf("[ Run %s ]", strings.ToLower(title))
+	var runButton string
+	switch {
+	case !m.confirmed():
+		runButton = greyText.Padding(0, 1).Render(runLabel)
+	case m.reviewChoice == m.runItem():
+		runButton = focusedButton.Render(runLabel)
+	default:
+		runButton = blurredButton.Render(runLabel)
+	}
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Left, runButton))
+	b.WriteString("\n")
+	help := "up/down: select • enter: edit field / run"
+	if m.canDiffSchema() {
+		help += " • ctrl+d: schema diff"
+	}
+	if m.canPickTables() {
+		help += " • ctrl+t: pick tables"
+	}
+	help += " • ctrl+c: quit"
+	b.WriteString(helpStyle.Render(help))
+
+	return b.String()
+}
+
+// previewCommand returns the command line that will be run, with the password
+// redacted. The client binary is only known once the pre-flight checks have
+// selected one for the server, until then its bare name is shown.
+func (m Model) previewCommand() string {
+	host := m.inputs[0].Value()
+	user := m.inputs[1].Value()
+	password := m.inputs[2].Value()
+	dbname := m.inputs[3].Value()
+	port := 5432 // Default PostgreSQL port
+
+	if m.formView == cloneForm {
+		return m.previewClone()
+	}
+	if m.formView == backupForm {
+		if m.dumpsWithGo() {
+			return fmt.Sprintf("built-in Go engine: %s@%s:%d/%s -> %s", user, host, port, dbname, m.pendingOutputPath)
+		}
+		return formatCommandLine(pgbackup.PrepareDumpCommand(m.binaryOrName("pg_dump"), host, port, user, password, dbname, m.pendingOutputPath))
+	}
+	if len(m.restoreTables) > 0 {
+		return fmt.Sprintf("extract %s from %s, then restore into %s@%s:%d/%s", strings.Join(m.restoreTables, ", "), m.inputs[4].Value(), user, host, port, dbname)
+	}
+	if m.restoreEngine == pgrestore.EngineGo {
+		return fmt.Sprintf("built-in Go executor: %s -> %s@%s:%d/%s", m.inputs[4].Value(), user, host, port, dbname)
+	}
+	return formatCommandLine(pgrestore.PrepareRestoreCommand(m.binaryOrName("psql"), host, port, user, password, dbname, m.inputs[4].Value()))
+}
+
+// dumpsWithGo reports whether the backup will use the built-in Go engine.
+func (m Model) dumpsWithGo() bool {
+	return m.resolvedEngine == pgbackup.EngineGo
+}
+
+// binaryOrName returns the binary chosen by the pre-flight checks, or name.
+func (m Model) binaryOrName(name string) string {
+	if binary := m.preflightBinary(); binary != "" {
+		return binary
+	}
+	return name
+}
+
+// formatCommandLine renders cmd as a shell command line. The password is only
+// ever passed through PGPASSWORD, so it is shown redacted.
+func formatCommandLine(cmd *exec.Cmd) string {
+	var parts []string
+	for _, env := range cmd.Env {
+		if strings.HasPrefix(env, "PGPASSWORD=") {
+			parts = append(parts, "PGPASSWORD=********")
+		}
+	}
+	for _, arg := range cmd.Args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellQuote quotes s for display in a POSIX shell command line.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:@,+", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,131 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+	"github.com/curtisbraxdale/go-pg-backup/internal/pgrestore"
+	"github.com/curtisbraxdale/go-pg-backup/internal/schemadiff"
+)
+
+// schemaDiffPageLines is how many diff lines the schema diff view shows.
+const schemaDiffPageLines = 20
+
+// RunSchemaDiffCmd compares the schema of the backup being restored with
+// the target database in the background.
+func RunSchemaDiffCmd(m Model) tea.Cmd {
+	backupPath := m.inputs[4].Value()
+	target := schemadiff.Database{
+		Host:     m.inputs[0].Value(),
+		Port:     5432, // Default PostgreSQL port
+		User:     m.inputs[1].Value(),
+		Password: m.inputs[2].Value(),
+		DBName:   m.inputs[3].Value(),
+	}
+	return func() tea.Msg {
+		if cfg, err := config.Load(); err == nil {
+			target.ClientBinDirs = cfg.ClientBinDirs
+		}
+		result, err := schemadiff.Backup(backupPath, target)
+		return SchemaDiffLoadedMsg{Result: result, Err: err}
+	}
+}
+
+// canDiffSchema reports whether the review screen offers the schema diff,
+// which needs a target database that already exists.
+func (m Model) canDiffSchema() bool {
+	return m.formView == restoreForm && m.restoreMode != pgrestore.ModeCreate
+}
+
+// openSchemaDiff leaves the review screen for the schema diff view.
+func (m Model) openSchemaDiff() (tea.Model, tea.Cmd) {
+	m.currentView = schemaDiffView
+	m.schemaDiffLoading = true
+	m.schemaDiff = nil
+	m.schemaDiffLines = nil
+	m.schemaDiffError = nil
+	m.schemaDiffOffset = 0
+	return m, RunSchemaDiffCmd(m)
+}
+
+func (m Model) updateSchemaDiff(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		last := max(len(m.schemaDiffLines)-schemaDiffPageLines, 0)
+		switch msg.Type {
+		case tea.KeyUp:
+			m.schemaDiffOffset--
+		case tea.KeyDown:
+			m.schemaDiffOffset++
+		case tea.KeyPgUp:
+			m.schemaDiffOffset -= schemaDiffPageLines
+		case tea.KeyPgDown, tea.KeySpace:
+			m.schemaDiffOffset += schemaDiffPageLines
+		case tea.KeyHome:
+			m.schemaDiffOffset = 0
+		case tea.KeyEnd:
+			m.schemaDiffOffset = last
+		case tea.KeyEnter, tea.KeyBackspace:
+			m.currentView = reviewScreen
+			return m, nil
+		}
+		m.schemaDiffOffset = min(max(m.schemaDiffOffset, 0), last)
+	}
+	return m, nil
+}
+
+// diffLineStyle colours a unified diff line by its prefix.
+func diffLineStyle(line string) string {
+	switch {
+	case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+		return greyText.Render(line)
+	case strings.HasPrefix(line, "@@"):
+		return pinkTextPrompt.Render(line)
+	case strings.HasPrefix(line, "+"):
+		return greenTextValue.Render(line)
+	case strings.HasPrefix(line, "-"):
+		return errorStyle.Render(line)
+	default:
+		return whiteText.Render(line)
+	}
+}
+
+func (m Model) viewSchemaDiff() string {
+	var b strings.Builder
+	b.WriteString(welcomeStyle.Render("Schema Diff"))
+	b.WriteString("\n\n")
+	b.WriteString(greyText.Render(fmt.Sprintf("%s compared with the database %s", m.inputs[4].Value(), m.inputs[3].Value())))
+	b.WriteString("\n\n")
+
+	switch {
+	case m.schemaDiffLoading:
+		b.WriteString(greyText.Render("Reading both schemas..."))
+		b.WriteString("\n")
+	case m.schemaDiffError != nil:
+		b.WriteString(errorStyle.Render(m.schemaDiffError.Error()))
+		b.WriteString("\n")
+	default:
+		lines := m.schemaDiffLines
+		end := min(m.schemaDiffOffset+schemaDiffPageLines, len(lines))
+		for _, line := range lines[m.schemaDiffOffset:end] {
+			b.WriteString(diffLineStyle(line))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+		if len(lines) > schemaDiffPageLines {
+			b.WriteString(greyText.Render(fmt.Sprintf("Lines %d-%d of %d. ", m.schemaDiffOffset+1, end, len(lines))))
+		}
+		style := greenTextValue
+		if len(m.schemaDiff.Changes) > 0 {
+			style = cancelledStyle
+		}
+		b.WriteString(style.Render(m.schemaDiff.Summary()))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(helpStyle.Render("up/down, pgup/pgdown: scroll • enter: back to the review • ctrl+c: quit"))
+	return b.String()
+}
@@ -0,0 +1,182 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/curtisbraxdale/go-pg-backup/internal/catalog"
+	"github.com/curtisbraxdale/go-pg-backup/internal/config"
+)
+
+// searchPageLines is how many result lines the search screen shows at once.
+const searchPageLines = 20
+
+// Search form inputs, in display order.
+const (
+	searchDir = iota
+	searchName
+	searchKind
+)
+
+func setupSearchInputs() []textinput.Model {
+	inputs := make([]textinput.Model, 3)
+	prompts := []string{
+		"Backup Directory",
+		"Table, Column or Function",
+		"Kind (table, column, function, empty for any)",
+	}
+	placeholders := []string{
+		"/path/to/backups",
+		"orders.discount",
+		"",
+	}
+
+	for i := range inputs {
+		inputs[i] = textinput.New()
+		inputs[i].Prompt = prompts[i] + ": "
+		inputs[i].Placeholder = placeholders[i]
+		inputs[i].CharLimit = 256
+		inputs[i].Width = 50
+		inputs[i].PromptStyle = pinkTextPrompt
+		inputs[i].TextStyle = whiteText
+	}
+	inputs[0].Focus()
+	return inputs
+}
+
+// RunSearchCmd brings the catalog of the directory entered in the search
+// form up to date and searches it in the background.
+func RunSearchCmd(m Model) tea.Cmd {
+	dir := m.inputs[searchDir].Value()
+	name := m.inputs[searchName].Value()
+	kindName := m.inputs[searchKind].Value()
+	return func() tea.Msg {
+		kind, ok := catalog.ParseKind(kindName)
+		if !ok {
+			return SearchFinishedMsg{Err: fmt.Errorf("unknown kind %q, want table, column or function", kindName)}
+		}
+		if name == "" {
+			return SearchFinishedMsg{Err: fmt.Errorf("an object name is required")}
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return SearchFinishedMsg{Err: err}
+		}
+		idx, err := catalog.Update(catalog.Source{Dir: dir, ClientBinDirs: cfg.ClientBinDirs})
+		if err != nil {
+			return SearchFinishedMsg{Err: err}
+		}
+		return SearchFinishedMsg{Lines: searchResultLines(idx, idx.Search(catalog.Query{Name: name, Kind: kind}))}
+	}
+}
+
+// searchResultLines renders the matches, one block of lines per object,
+// followed by the backups that could not be read.
+func searchResultLines(idx *catalog.Index, matches []catalog.Match) []string {
+	const layout = "2006-01-02 15:04"
+	var lines []string
+	for i, m := range matches {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		summary := fmt.Sprintf("in %d of %d backups", len(m.Backups), m.Total)
+		if m.InLatest(idx) {
+			summary += ", including the newest"
+		}
+		lines = append(lines,
+			pinkTextPrompt.Render(fmt.Sprintf("%s %s", m.Kind, m.Name))+greyText.Render(fmt.Sprintf(" (%s/%s)", m.Host, m.Database)),
+			fmt.Sprintf("  %s %s  %s", greenTextPrompt.Render("First:"), m.First().CreatedAt.Local().Format(layout), m.First().Location),
+			fmt.Sprintf("  %s  %s  %s", greenTextPrompt.Render("Last:"), m.Last().CreatedAt.Local().Format(layout), m.Last().Location),
+			greyText.Render("  "+summary),
+		)
+		for _, b := range m.Backups {
+			lines = append(lines, whiteText.Render(fmt.Sprintf("    %s  %s", b.CreatedAt.Local().Format(layout), b.Location)))
+		}
+	}
+	if failed := idx.Failed(); len(failed) > 0 {
+		if len(matches) == 0 {
+			lines = append(lines, cancelledStyle.Render("No readable backup holds a matching object."))
+		}
+		lines = append(lines, "", errorStyle.Render(fmt.Sprintf("%d backups could not be read and were skipped:", len(failed))))
+		for _, b := range failed {
+			lines = append(lines, greyText.Render(fmt.Sprintf("    %s: %s", b.Location, b.Error)))
+		}
+	}
+	return lines
+}
+
+// openSearchResults leaves the search form for the results and starts the search.
+func (m Model) openSearchResults() (tea.Model, tea.Cmd) {
+	m.inputs[m.step].Blur()
+	m.currentView = searchResults
+	m.searchLoading = true
+	m.searchLines = nil
+	m.searchError = nil
+	m.searchOffset = 0
+	return m, RunSearchCmd(m)
+}
+
+func (m Model) updateSearchResults(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		last := max(len(m.searchLines)-searchPageLines, 0)
+		switch msg.Type {
+		case tea.KeyUp:
+			m.searchOffset--
+		case tea.KeyDown:
+			m.searchOffset++
+		case tea.KeyPgUp:
+			m.searchOffset -= searchPageLines
+		case tea.KeyPgDown, tea.KeySpace:
+			m.searchOffset += searchPageLines
+		case tea.KeyBackspace: // Refine the search
+			m.currentView = searchForm
+			m.step = searchName
+			m.focusOnInput = true
+			m.inputs[m.step].Focus()
+			return m, nil
+		case tea.KeyEnter:
+			m.currentView = mainMenu
+			return m, nil
+		}
+		m.searchOffset = min(max(m.searchOffset, 0), last)
+	}
+	return m, nil
+}
+
+func (m Model) viewSearchResults() string {
+	var b strings.Builder
+	b.WriteString(welcomeStyle.Render("Backup Catalog Search"))
+	b.WriteString("\n\n")
+	b.WriteString(greyText.Render(fmt.Sprintf("%q in the backups of %s", m.inputs[searchName].Value(), m.inputs[searchDir].Value())))
+	b.WriteString("\n\n")
+
+	switch {
+	case m.searchLoading:
+		b.WriteString(greyText.Render("Indexing the backups and searching..."))
+		b.WriteString("\n")
+	case m.searchError != nil:
+		b.WriteString(errorStyle.Render(m.searchError.Error()))
+		b.WriteString("\n")
+	case len(m.searchLines) == 0:
+		b.WriteString(cancelledStyle.Render("No backup holds a matching object."))
+		b.WriteString("\n")
+	default:
+		end := min(m.searchOffset+searchPageLines, len(m.searchLines))
+		for _, line := range m.searchLines[m.searchOffset:end] {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		if len(m.searchLines) > searchPageLines {
+			b.WriteString("\n")
+			b.WriteString(greyText.Render(fmt.Sprintf("Lines %d-%d of %d", m.searchOffset+1, end, len(m.searchLines))))
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("\n")
+	b.WriteString(helpStyle.Render("up/down, pgup/pgdown: scroll • backspace: new search • enter: main menu • ctrl+c: quit"))
+	return b.String()
+}
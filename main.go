@@ -4,12 +4,18 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/curtisbraxdale/go-pg-backup/internal/cli"
 	"github.com/curtisbraxdale/go-pg-backup/internal/tui"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func main() {
+	// Any arguments select the non-interactive command-line interface.
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	m := tui.NewModel()
 	p := tea.NewProgram(m) // Initialize your Bubble Tea model
 